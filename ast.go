@@ -0,0 +1,74 @@
+package subprocess
+
+import (
+	"fmt"
+
+	"github.com/cuongtranba/subprocess/ast"
+)
+
+// AST returns the syntax tree of exec, for tools that inspect pipeline
+// definitions without running them. The tree is a copy, changing it has no
+// effect on exec. Unknown Executable implementations are returned as a Process
+// named after their String
+func AST(exec Executable) ast.Node {
+	switch x := exec.(type) {
+	case *ExecutableProcess:
+		ops := x.process.ops
+		return &ast.Process{Position: x.pos, Command: ops.Command, Args: append([]string(nil), ops.Args...), Dir: ops.Dir}
+
+	case *Builtin:
+		return &ast.Builtin{Name: x.name, Args: append([]string(nil), x.args...)}
+
+	case *Pipeline:
+		switch x.operation {
+		case OpPipe:
+			return &ast.Pipe{Position: x.pos, Left: AST(x.left), Right: AST(x.right)}
+		case OpAnd:
+			return &ast.And{Position: x.pos, Left: AST(x.left), Right: AST(x.right)}
+		case OpOr:
+			return &ast.Or{Position: x.pos, Left: AST(x.left), Right: AST(x.right)}
+		case OpSeq:
+			return &ast.Seq{Position: x.pos, Left: AST(x.left), Right: AST(x.right)}
+		case OpRedirect:
+			return &ast.Redirect{Position: x.pos, Op: x.redirect.String(), Path: x.path, Exec: AST(x.left)}
+		default:
+			return &ast.Background{Position: x.pos, Exec: AST(x.left)}
+		}
+
+	case *Router:
+		node := &ast.Router{Source: AST(x.source)}
+		for _, rt := range x.routes {
+			node.Cases = append(node.Cases, &ast.Case{Pattern: rt.pattern.String(), Dest: AST(rt.dest)})
+		}
+		if x.fallback != nil {
+			node.Fallback = AST(x.fallback)
+		}
+		return node
+
+	case *Merger:
+		node := &ast.FanIn{Mode: x.mode.String()}
+		for _, p := range x.producers {
+			node.Producers = append(node.Producers, AST(p))
+		}
+		return node
+
+	case *Batch:
+		node := &ast.Parallel{Policy: x.policy.String(), Limit: x.limit}
+		for _, exec := range x.execs {
+			node.Execs = append(node.Execs, AST(exec))
+		}
+		return node
+
+	case *Branch:
+		return &ast.Branch{Exec: AST(x.exec)}
+
+	case *Conditional:
+		return &ast.Conditional{Negate: x.negate, Exec: AST(x.exec)}
+
+	case *LazyStage:
+		return &ast.Lazy{}
+
+	default:
+		return &ast.Process{Command: fmt.Sprint(exec)}
+	}
+}
@@ -0,0 +1,130 @@
+// Package ast describes the structure of pipelines built with the subprocess
+// package, for tools such as linters, formatters and translators that inspect
+// definitions without running them. subprocess.AST returns the tree of an
+// Executable, Walk traverses it and BaseVisitor gives the default traversal
+package ast
+
+//go:generate go run ./internal/astgen
+
+// Pos is a position in the source a node was parsed from
+// Nodes built in Go have the zero Pos
+type Pos struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in bytes, starting at 1
+}
+
+// IsValid reports whether the position is known
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Node is a node of a pipeline tree
+type Node interface {
+	Pos() Pos
+}
+
+// Process runs a program
+type Process struct {
+	Position Pos
+	Command  string
+	Args     []string
+	Dir      string // empty for the working directory of the program
+}
+
+// Builtin runs a command implemented in Go, such as test or true
+type Builtin struct {
+	Position Pos
+	Name     string
+	Args     []string
+}
+
+// Pipe connects the stdout of Left to the stdin of Right
+type Pipe struct {
+	Position Pos
+	Left     Node
+	Right    Node
+}
+
+// And runs Right only if Left succeeds
+type And struct {
+	Position Pos
+	Left     Node
+	Right    Node
+}
+
+// Or runs Right only if Left fails
+type Or struct {
+	Position Pos
+	Left     Node
+	Right    Node
+}
+
+// Seq runs Right after Left, whether Left succeeds or not
+type Seq struct {
+	Position Pos
+	Left     Node
+	Right    Node
+}
+
+// Background runs Exec without waiting for it
+type Background struct {
+	Position Pos
+	Exec     Node
+}
+
+// Redirect sends an output stream of Exec to a file, or its stderr to its stdout
+type Redirect struct {
+	Position Pos
+	Op       string // >, >>, 2> or 2>&1
+	Path     string // empty for 2>&1
+	Exec     Node
+}
+
+// Router sends each line of the output of Source to the first matching case
+type Router struct {
+	Position Pos
+	Source   Node
+	Cases    []*Case
+	Fallback Node // nil without a default route
+}
+
+// Case is a route of a Router
+type Case struct {
+	Position Pos
+	Pattern  string // regular expression matched against each line
+	Dest     Node
+}
+
+// FanIn runs Producers concurrently and merges their output
+type FanIn struct {
+	Position  Pos
+	Mode      string // interleaved, ordered or by-key
+	Producers []Node
+}
+
+// Parallel runs Execs concurrently, at most Limit at a time
+type Parallel struct {
+	Position Pos
+	Policy   string // collect-errors or fail-fast
+	Limit    int    // 0 runs every executable at once
+	Execs    []Node
+}
+
+// Branch runs Exec and can be cancelled on its own
+type Branch struct {
+	Position Pos
+	Exec     Node
+}
+
+// Conditional runs Exec only if a condition evaluated at run time holds
+type Conditional struct {
+	Position Pos
+	Negate   bool // runs when the condition is false, for Unless
+	Exec     Node
+}
+
+// Lazy is a stage built at run time, its tree is unknown until then
+type Lazy struct {
+	Position Pos
+}
@@ -0,0 +1,159 @@
+// Command astgen generates the Visitor interface, BaseVisitor, Walk and the
+// Pos methods of the nodes declared in ast.go, run through go generate
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"strings"
+)
+
+// node is a node type and its child fields
+type node struct {
+	name     string
+	children []child
+}
+
+// child is a field of a node holding other nodes
+type child struct {
+	field string
+	slice bool
+}
+
+func main() {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "ast.go", nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Node types are the structs with a Position field
+	structs := make(map[string]*ast.StructType)
+	var names []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if ok && hasField(st, "Position") {
+				structs[ts.Name.Name] = st
+				names = append(names, ts.Name.Name)
+			}
+		}
+	}
+
+	nodes := make([]node, 0, len(names))
+	for _, name := range names {
+		n := node{name: name}
+		for _, f := range structs[name].Fields.List {
+			slice, ok := nodeType(f.Type, structs)
+			if !ok {
+				continue
+			}
+			for _, ident := range f.Names {
+				n.children = append(n.children, child{field: ident.Name, slice: slice})
+			}
+		}
+		nodes = append(nodes, n)
+	}
+
+	src, err := format.Source(generate(nodes))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("walk_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hasField reports whether st has a field called name
+func hasField(st *ast.StructType, name string) bool {
+	for _, f := range st.Fields.List {
+		for _, ident := range f.Names {
+			if ident.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodeType reports whether expr holds nodes: Node, a pointer to a node type,
+// or a slice of either, and whether it is a slice
+func nodeType(expr ast.Expr, structs map[string]*ast.StructType) (slice bool, ok bool) {
+	if arr, isSlice := expr.(*ast.ArrayType); isSlice {
+		_, ok := nodeType(arr.Elt, structs)
+		return true, ok
+	}
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return false, x.Name == "Node"
+	case *ast.StarExpr:
+		ident, isIdent := x.X.(*ast.Ident)
+		return false, isIdent && structs[ident.Name] != nil
+	}
+	return false, false
+}
+
+func generate(nodes []node) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by astgen; DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "package ast")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "// Visitor is called by Walk for every node of a tree")
+	fmt.Fprintln(&b, "// Returning false skips the children of the node")
+	fmt.Fprintln(&b, "type Visitor interface {")
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "Visit%s(n *%s) bool\n", n.name, n.name)
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintln(&b, "// BaseVisitor visits every node of a tree. Embed it in a Visitor and")
+	fmt.Fprintln(&b, "// override the methods of the nodes of interest")
+	fmt.Fprintln(&b, "type BaseVisitor struct{}")
+	fmt.Fprintln(&b)
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "func (BaseVisitor) Visit%s(n *%s) bool { return true }\n\n", n.name, n.name)
+	}
+
+	fmt.Fprintln(&b, "// Walk traverses the tree of n depth-first, calling v for each node")
+	fmt.Fprintln(&b, "// before its children")
+	fmt.Fprintln(&b, "func Walk(v Visitor, n Node) {")
+	fmt.Fprintln(&b, "switch n := n.(type) {")
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "case *%s:\n", n.name)
+		if len(n.children) == 0 {
+			fmt.Fprintf(&b, "v.Visit%s(n)\n", n.name)
+			continue
+		}
+		fmt.Fprintf(&b, "if !v.Visit%s(n) {\nreturn\n}\n", n.name)
+		for _, c := range n.children {
+			if c.slice {
+				fmt.Fprintf(&b, "for _, child := range n.%s {\nif child != nil {\nWalk(v, child)\n}\n}\n", c.field)
+			} else {
+				fmt.Fprintf(&b, "if n.%s != nil {\nWalk(v, n.%s)\n}\n", c.field, c.field)
+			}
+		}
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b, "}")
+
+	for _, n := range nodes {
+		fmt.Fprintln(&b)
+		receiver := strings.ToLower(n.name[:1])
+		fmt.Fprintf(&b, "func (%s *%s) Pos() Pos { return %s.Position }\n", receiver, n.name, receiver)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,208 @@
+// Code generated by astgen; DO NOT EDIT.
+
+package ast
+
+// Visitor is called by Walk for every node of a tree
+// Returning false skips the children of the node
+type Visitor interface {
+	VisitProcess(n *Process) bool
+	VisitBuiltin(n *Builtin) bool
+	VisitPipe(n *Pipe) bool
+	VisitAnd(n *And) bool
+	VisitOr(n *Or) bool
+	VisitSeq(n *Seq) bool
+	VisitBackground(n *Background) bool
+	VisitRedirect(n *Redirect) bool
+	VisitRouter(n *Router) bool
+	VisitCase(n *Case) bool
+	VisitFanIn(n *FanIn) bool
+	VisitParallel(n *Parallel) bool
+	VisitBranch(n *Branch) bool
+	VisitConditional(n *Conditional) bool
+	VisitLazy(n *Lazy) bool
+}
+
+// BaseVisitor visits every node of a tree. Embed it in a Visitor and
+// override the methods of the nodes of interest
+type BaseVisitor struct{}
+
+func (BaseVisitor) VisitProcess(n *Process) bool { return true }
+
+func (BaseVisitor) VisitBuiltin(n *Builtin) bool { return true }
+
+func (BaseVisitor) VisitPipe(n *Pipe) bool { return true }
+
+func (BaseVisitor) VisitAnd(n *And) bool { return true }
+
+func (BaseVisitor) VisitOr(n *Or) bool { return true }
+
+func (BaseVisitor) VisitSeq(n *Seq) bool { return true }
+
+func (BaseVisitor) VisitBackground(n *Background) bool { return true }
+
+func (BaseVisitor) VisitRedirect(n *Redirect) bool { return true }
+
+func (BaseVisitor) VisitRouter(n *Router) bool { return true }
+
+func (BaseVisitor) VisitCase(n *Case) bool { return true }
+
+func (BaseVisitor) VisitFanIn(n *FanIn) bool { return true }
+
+func (BaseVisitor) VisitParallel(n *Parallel) bool { return true }
+
+func (BaseVisitor) VisitBranch(n *Branch) bool { return true }
+
+func (BaseVisitor) VisitConditional(n *Conditional) bool { return true }
+
+func (BaseVisitor) VisitLazy(n *Lazy) bool { return true }
+
+// Walk traverses the tree of n depth-first, calling v for each node
+// before its children
+func Walk(v Visitor, n Node) {
+	switch n := n.(type) {
+	case *Process:
+		v.VisitProcess(n)
+	case *Builtin:
+		v.VisitBuiltin(n)
+	case *Pipe:
+		if !v.VisitPipe(n) {
+			return
+		}
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *And:
+		if !v.VisitAnd(n) {
+			return
+		}
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *Or:
+		if !v.VisitOr(n) {
+			return
+		}
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *Seq:
+		if !v.VisitSeq(n) {
+			return
+		}
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *Background:
+		if !v.VisitBackground(n) {
+			return
+		}
+		if n.Exec != nil {
+			Walk(v, n.Exec)
+		}
+	case *Redirect:
+		if !v.VisitRedirect(n) {
+			return
+		}
+		if n.Exec != nil {
+			Walk(v, n.Exec)
+		}
+	case *Router:
+		if !v.VisitRouter(n) {
+			return
+		}
+		if n.Source != nil {
+			Walk(v, n.Source)
+		}
+		for _, child := range n.Cases {
+			if child != nil {
+				Walk(v, child)
+			}
+		}
+		if n.Fallback != nil {
+			Walk(v, n.Fallback)
+		}
+	case *Case:
+		if !v.VisitCase(n) {
+			return
+		}
+		if n.Dest != nil {
+			Walk(v, n.Dest)
+		}
+	case *FanIn:
+		if !v.VisitFanIn(n) {
+			return
+		}
+		for _, child := range n.Producers {
+			if child != nil {
+				Walk(v, child)
+			}
+		}
+	case *Parallel:
+		if !v.VisitParallel(n) {
+			return
+		}
+		for _, child := range n.Execs {
+			if child != nil {
+				Walk(v, child)
+			}
+		}
+	case *Branch:
+		if !v.VisitBranch(n) {
+			return
+		}
+		if n.Exec != nil {
+			Walk(v, n.Exec)
+		}
+	case *Conditional:
+		if !v.VisitConditional(n) {
+			return
+		}
+		if n.Exec != nil {
+			Walk(v, n.Exec)
+		}
+	case *Lazy:
+		v.VisitLazy(n)
+	}
+}
+
+func (p *Process) Pos() Pos { return p.Position }
+
+func (b *Builtin) Pos() Pos { return b.Position }
+
+func (p *Pipe) Pos() Pos { return p.Position }
+
+func (a *And) Pos() Pos { return a.Position }
+
+func (o *Or) Pos() Pos { return o.Position }
+
+func (s *Seq) Pos() Pos { return s.Position }
+
+func (b *Background) Pos() Pos { return b.Position }
+
+func (r *Redirect) Pos() Pos { return r.Position }
+
+func (r *Router) Pos() Pos { return r.Position }
+
+func (c *Case) Pos() Pos { return c.Position }
+
+func (f *FanIn) Pos() Pos { return f.Position }
+
+func (p *Parallel) Pos() Pos { return p.Position }
+
+func (b *Branch) Pos() Pos { return b.Position }
+
+func (c *Conditional) Pos() Pos { return c.Position }
+
+func (l *Lazy) Pos() Pos { return l.Position }
@@ -0,0 +1,59 @@
+package subprocess
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/cuongtranba/subprocess/ast"
+)
+
+// commandCollector records the commands of a tree, skipping routers
+type commandCollector struct {
+	ast.BaseVisitor
+	commands []string
+}
+
+func (c *commandCollector) VisitProcess(n *ast.Process) bool {
+	c.commands = append(c.commands, n.Command)
+	return true
+}
+
+func (c *commandCollector) VisitBuiltin(n *ast.Builtin) bool {
+	c.commands = append(c.commands, n.Name)
+	return true
+}
+
+func (c *commandCollector) VisitRouter(n *ast.Router) bool {
+	return false
+}
+
+func TestAST(t *testing.T) {
+	// Test: the tree mirrors the operators and Walk visits it in order
+	cat, _ := NewExecutable("cat", "log")
+	grep, _ := NewExecutable("grep", "err")
+	echo, _ := NewExecutable("echo", "ok")
+	wc, _ := NewExecutable("wc", "-l")
+	lazy := Lazy(func(ctx context.Context, prior *Result) (Executable, error) { return echo, nil })
+	tree := cat.Pipe(grep).And(When(func(context.Context) bool { return true }, echo)).
+		Or(FanIn(True(), Route(cat).When("x", wc))).And(lazy.Background())
+
+	node := AST(tree)
+	and, ok := node.(*ast.And)
+	if !ok {
+		t.Fatalf("expected an And at the root, got %T", node)
+	}
+	if bg, ok := and.Right.(*ast.Background); !ok || bg.Exec == nil {
+		t.Errorf("expected a background lazy stage, got %#v", and.Right)
+	}
+	if node.Pos().IsValid() {
+		t.Errorf("expected no position for a tree built in Go, got %v", node.Pos())
+	}
+
+	collector := &commandCollector{}
+	ast.Walk(collector, node)
+	expected := []string{"cat", "grep", "echo", "true"}
+	if !slices.Equal(collector.commands, expected) {
+		t.Errorf("expected %q, got %q", expected, collector.commands)
+	}
+}
@@ -0,0 +1,77 @@
+package subprocess
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Attach connects the local terminal to the pseudo-terminal of a process
+// started WithPTY, like docker exec -it. in is switched to raw mode, so every
+// key reaches the process as typed: Ctrl-C is delivered by the terminal of
+// the process as SIGINT to it, not to the program. The output of the process
+// is written to out, and the window size of in is applied to the process when
+// attaching and on every SIGWINCH. When in is not a terminal, its content is
+// typed as it is and its end closes the input of the process
+// Attach returns once the process exited and its output was written, with the
+// exit error of the process and the terminal restored. When in cannot be
+// interrupted, like a blocking os.Stdin, the next key pressed after the exit
+// is read and dropped
+// Only supported on Linux
+func Attach(runner *ProcessRunner, in *os.File, out io.Writer) error {
+	pty := runner.PTY()
+	if pty == nil {
+		return errors.New("subprocess: process has no PTY, start it WithPTY")
+	}
+
+	if isTerminal(in) {
+		restore, err := RawMode(in)
+		if err != nil {
+			return err
+		}
+		defer restore()
+
+		resize := func() {
+			if rows, cols, err := windowSize(in); err == nil && rows > 0 {
+				runner.Resize(rows, cols)
+			}
+		}
+		resize()
+		winch := make(chan os.Signal, 1)
+		notifyResize(winch)
+		done := make(chan struct{})
+		defer func() {
+			signal.Stop(winch)
+			close(done)
+		}()
+		go func() {
+			for {
+				select {
+				case <-winch:
+					resize()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	typed := make(chan struct{})
+	go func() {
+		defer close(typed)
+		if _, err := io.Copy(pty, in); err == nil {
+			runner.ReaderWriter().CloseWrite()
+		}
+	}()
+
+	io.Copy(out, pty)
+	err := runner.Wait()
+	// Stop reading in where reads can be interrupted
+	if in.SetReadDeadline(time.Now()) == nil {
+		<-typed
+		in.SetReadDeadline(time.Time{})
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitFor waits until the output written to w contains s
+func waitFor(t *testing.T, w *lockedBuffer, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(w.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected output containing %q, got %q", s, w.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	// Test: keys typed on the local terminal reach the process, Ctrl-C
+	// interrupts it through its own terminal, the window size follows the
+	// local terminal and raw mode is undone once the process exits
+	keyboard, local := testPTY(t)
+	if err := setWindowSize(keyboard, 40, 120); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	script := `trap 'echo interrupted; exit 3' INT; read name; echo "hi $name"; stty size; while :; do sleep 0.05; done`
+	p, _ := NewProcess("sh", []string{"-c", script}, WithPTY())
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	defer runner.Stop()
+
+	var out lockedBuffer
+	attached := make(chan error, 1)
+	go func() { attached <- Attach(runner, local, &out) }()
+
+	io.WriteString(keyboard, "pty\r")
+	waitFor(t, &out, "hi pty")
+	waitFor(t, &out, "40 120")
+	io.WriteString(keyboard, "\x03")
+
+	select {
+	case err := <-attached:
+		if err == nil || runner.Cmd().ProcessState.ExitCode() != 3 {
+			t.Errorf("expected exit code 3, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Attach did not return after Ctrl-C")
+	}
+	if !strings.Contains(out.String(), "interrupted") {
+		t.Errorf("expected the process to handle SIGINT, got %q", out.String())
+	}
+
+	var state syscall.Termios
+	if err := termiosIoctl(local, syscall.TCGETS, &state); err != nil || state.Lflag&syscall.ICANON == 0 {
+		t.Errorf("expected the terminal to be restored, got lflag %#x, %v", state.Lflag, err)
+	}
+
+	plain, _ := NewProcess("true", nil)
+	runner, _ = plain.Exec(ctx)
+	if err := Attach(runner, local, io.Discard); err == nil {
+		t.Error("expected an error without WithPTY")
+	}
+	runner.Wait()
+}
@@ -0,0 +1,136 @@
+// Package backoff computes delays between attempts of an operation, for
+// retries, supervisor restarts and circuit breakers
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by Backoff.Wait once the budget allows no more attempts
+var ErrBudgetExhausted = errors.New("backoff: budget exhausted")
+
+// Strategy computes the delay before an attempt
+// Implementations must be safe for concurrent use, state is kept by Backoff
+type Strategy interface {
+	// Delay returns the wait before attempt (1 for the first retry),
+	// prev is the delay returned for the previous attempt, 0 for the first
+	Delay(attempt int, prev time.Duration) time.Duration
+}
+
+// StrategyFunc adapts a function to the Strategy interface
+type StrategyFunc func(attempt int, prev time.Duration) time.Duration
+
+func (f StrategyFunc) Delay(attempt int, prev time.Duration) time.Duration {
+	return f(attempt, prev)
+}
+
+// Constant waits d before every attempt
+func Constant(d time.Duration) Strategy {
+	return StrategyFunc(func(int, time.Duration) time.Duration {
+		return d
+	})
+}
+
+// Exponential waits base before the first attempt and doubles the delay
+// for every following one, up to limit
+func Exponential(base, limit time.Duration) Strategy {
+	return StrategyFunc(func(attempt int, _ time.Duration) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < limit; i++ {
+			d *= 2
+		}
+		return min(d, limit)
+	})
+}
+
+// FullJitter waits a random duration between 0 and the delay of s, spreading
+// out clients that would otherwise retry in lockstep
+func FullJitter(s Strategy) Strategy {
+	return StrategyFunc(func(attempt int, prev time.Duration) time.Duration {
+		d := s.Delay(attempt, prev)
+		if d <= 0 {
+			return 0
+		}
+		return rand.N(d + 1)
+	})
+}
+
+// DecorrelatedJitter waits a random duration between base and three times
+// the previous delay, up to limit, as described in the AWS architecture blog
+func DecorrelatedJitter(base, limit time.Duration) Strategy {
+	return StrategyFunc(func(_ int, prev time.Duration) time.Duration {
+		upper := max(prev*3, base)
+		if upper <= base {
+			return min(base, limit)
+		}
+		return min(base+rand.N(upper-base+1), limit)
+	})
+}
+
+// Budget bounds how long a Backoff keeps allowing attempts
+// Zero fields are unlimited
+type Budget struct {
+	MaxAttempts int           // number of attempts after the first one
+	MaxElapsed  time.Duration // total time since the Backoff was created or reset
+}
+
+// Backoff tracks the attempts of one operation against a Strategy and a Budget
+// It is not safe for concurrent use, create one per operation
+type Backoff struct {
+	strategy Strategy
+	budget   Budget
+	attempt  int
+	prev     time.Duration
+	start    time.Time
+}
+
+// New creates a Backoff using strategy within budget
+func New(strategy Strategy, budget Budget) *Backoff {
+	return &Backoff{strategy: strategy, budget: budget, start: time.Now()}
+}
+
+// Next returns the delay before the next attempt, and false once the budget is exhausted
+func (b *Backoff) Next() (time.Duration, bool) {
+	if b.budget.MaxAttempts > 0 && b.attempt >= b.budget.MaxAttempts {
+		return 0, false
+	}
+	d := max(b.strategy.Delay(b.attempt+1, b.prev), 0)
+	if b.budget.MaxElapsed > 0 && time.Since(b.start)+d > b.budget.MaxElapsed {
+		return 0, false
+	}
+	b.attempt++
+	b.prev = d
+	return d, true
+}
+
+// Wait sleeps for the next delay, returning ErrBudgetExhausted once the
+// budget is exhausted or the context error if ctx is done first
+func (b *Backoff) Wait(ctx context.Context) error {
+	d, ok := b.Next()
+	if !ok {
+		return ErrBudgetExhausted
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Attempt returns the number of delays handed out since the last reset
+func (b *Backoff) Attempt() int {
+	return b.attempt
+}
+
+// Reset starts over, e.g. after a success or once a restarted process stayed up
+func (b *Backoff) Reset() {
+	b.attempt = 0
+	b.prev = 0
+	b.start = time.Now()
+}
@@ -0,0 +1,79 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStrategies(t *testing.T) {
+	// Test: delays of the deterministic strategies
+	tests := []struct {
+		name     string
+		strategy Strategy
+		expected []time.Duration
+	}{
+		{"constant", Constant(time.Second), []time.Duration{time.Second, time.Second, time.Second}},
+		{"exponential", Exponential(100*time.Millisecond, time.Second),
+			[]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.strategy, Budget{})
+			for i, expected := range tt.expected {
+				if d, _ := b.Next(); d != expected {
+					t.Errorf("attempt %d: expected %v, got %v", i+1, expected, d)
+				}
+			}
+		})
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	// Test: jittered delays stay within their bounds
+	base, limit := 10*time.Millisecond, time.Second
+	full := New(FullJitter(Exponential(base, limit)), Budget{})
+	decorrelated := New(DecorrelatedJitter(base, limit), Budget{})
+
+	for i := 0; i < 100; i++ {
+		if d, _ := full.Next(); d < 0 || d > limit {
+			t.Fatalf("full jitter delay out of bounds: %v", d)
+		}
+		prev := decorrelated.prev
+		d, _ := decorrelated.Next()
+		if d < base || d > limit || d > max(prev*3, base) {
+			t.Fatalf("decorrelated jitter delay out of bounds: %v after %v", d, prev)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	// Test: attempts and elapsed time are bounded, Reset starts over
+	b := New(Constant(time.Millisecond), Budget{MaxAttempts: 2})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := b.Wait(ctx); err != nil {
+			t.Fatalf("attempt %d: unexpected error %v", i+1, err)
+		}
+	}
+	if err := b.Wait(ctx); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+	b.Reset()
+	if _, ok := b.Next(); !ok {
+		t.Error("expected attempts after Reset")
+	}
+
+	elapsed := New(Constant(time.Hour), Budget{MaxElapsed: time.Minute})
+	if _, ok := elapsed.Next(); ok {
+		t.Error("expected delay beyond the elapsed budget to be refused")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := New(Constant(time.Hour), Budget{}).Wait(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBranchCancelled is the error of a branch stopped with Branch.Cancel
+var ErrBranchCancelled = errors.New("branch cancelled")
+
+// Branch wraps an Executable so it can be cancelled on its own while the rest
+// of the tree keeps running, e.g. one job of a Background set or a Group
+type Branch struct {
+	node
+	exec   Executable
+	signal *branchSignal // shared by the copies returned by With* methods
+}
+
+// branchSignal is closed once the branch is cancelled
+type branchSignal struct {
+	once sync.Once
+	done chan struct{}
+}
+
+// Cancellable wraps exec in a Branch that can be cancelled with Cancel
+func Cancellable(exec Executable) *Branch {
+	b := &Branch{
+		exec:   exec,
+		signal: &branchSignal{done: make(chan struct{})},
+	}
+	b.node = newNode(b)
+	return b
+}
+
+// Cancel stops the running branch and skips every later run of it
+// The result of the branch is marked Cancelled with ErrBranchCancelled
+func (b *Branch) Cancel() {
+	b.signal.once.Do(func() {
+		close(b.signal.done)
+	})
+}
+
+// Cancelled reports whether Cancel was called
+func (b *Branch) Cancelled() bool {
+	select {
+	case <-b.signal.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// String returns the wrapped executable
+func (b *Branch) String() string {
+	return fmt.Sprint(b.exec)
+}
+
+// Run executes the branch using the visitor pattern
+func (b *Branch) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, b.settings)
+	return visitor.run(b, func() (*Result, error) {
+		return visitor.VisitBranch(b)
+	})
+}
+
+// clone returns a copy of b sharing its cancel signal
+func (b *Branch) clone() *Branch {
+	clone := *b
+	clone.self = &clone
+	return &clone
+}
+
+func (b *Branch) configure(edit func(*settings)) Executable {
+	clone := b.clone()
+	clone.exec = configureExec(b.exec, edit)
+	edit(&clone.settings)
+	return clone
+}
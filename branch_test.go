@@ -0,0 +1,62 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBranchCancelInGroup(t *testing.T) {
+	// Test: cancelling one branch stops it without failing the rest of the group
+	slow, _ := NewExecutable("sleep", "10")
+	branch := Cancellable(slow)
+	fast, _ := NewExecutable("sh", "-c", "sleep 0.2; echo done")
+
+	g, _ := NewGroup(context.Background())
+	g.Go(branch)
+	g.Go(fast)
+	time.AfterFunc(50*time.Millisecond, branch.Cancel)
+
+	start := time.Now()
+	if err := g.Wait(); err != nil {
+		t.Fatalf("expected the group to succeed, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("cancelled branch kept running")
+	}
+
+	results := g.Results()
+	if !results[0].Cancelled || !errors.Is(results[0].Error, ErrBranchCancelled) {
+		t.Errorf("expected cancelled branch result, got %+v", results[0])
+	}
+	if string(results[1].Stdout) != "done\n" {
+		t.Errorf("expected other branch to finish, got %q", results[1].Stdout)
+	}
+}
+
+func TestBranchCancelInBackground(t *testing.T) {
+	// Test: a cancelled background job is recorded without failing the pipeline
+	slow, _ := NewExecutable("sleep", "10")
+	branch := Cancellable(slow)
+	echo, _ := NewExecutable("echo", "foreground")
+
+	time.AfterFunc(100*time.Millisecond, branch.Cancel)
+	result, err := branch.Background().And(echo).Run(context.Background())
+	if err != nil {
+		t.Fatalf("expected pipeline to succeed, got %v", err)
+	}
+	if string(result.Stdout) != "foreground\n" {
+		t.Errorf("unexpected output %q", result.Stdout)
+	}
+	bgErrs := result.Children[0].BackgroundErrors
+	if len(bgErrs) != 1 || !errors.Is(bgErrs[0], ErrBranchCancelled) {
+		t.Errorf("expected cancelled background job, got %v", bgErrs)
+	}
+
+	// A cancelled branch is skipped by later runs
+	result, err = branch.Run(context.Background())
+	if !errors.Is(err, ErrBranchCancelled) || !result.Cancelled {
+		t.Errorf("expected cancelled result, got %+v", result)
+	}
+}
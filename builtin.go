@@ -0,0 +1,83 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Builtin is an Executable implemented in Go instead of spawning a process,
+// so common shell conditions behave the same on every platform
+type Builtin struct {
+	node
+	name string
+	args []string
+	run  func() int // returns the exit code
+	err  error      // usage error found when the builtin was created
+}
+
+// BuiltinError reports a builtin that exited with a non-zero status
+type BuiltinError struct {
+	Name string
+	Code int
+}
+
+func (e *BuiltinError) Error() string {
+	return fmt.Sprintf("%s: exit status %d", e.Name, e.Code)
+}
+
+// ExitCode returns the exit code of the builtin
+func (e *BuiltinError) ExitCode() int {
+	return e.Code
+}
+
+// newBuiltin creates a Builtin from its name, arguments and implementation
+func newBuiltin(name string, args []string, run func() int) *Builtin {
+	b := &Builtin{
+		name: name,
+		args: args,
+		run:  run,
+	}
+	b.node = newNode(b)
+	return b
+}
+
+// True returns a builtin that always succeeds, like true(1)
+func True() Executable {
+	return newBuiltin("true", nil, func() int { return 0 })
+}
+
+// False returns a builtin that always fails with exit code 1, like false(1)
+func False() Executable {
+	return newBuiltin("false", nil, func() int { return 1 })
+}
+
+// String returns the command line of the builtin
+func (b *Builtin) String() string {
+	parts := []string{b.name}
+	for _, arg := range b.args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// clone returns a copy of b, so With* methods never modify a shared definition
+func (b *Builtin) clone() *Builtin {
+	clone := *b
+	clone.self = &clone
+	return &clone
+}
+
+func (b *Builtin) configure(edit func(*settings)) Executable {
+	clone := b.clone()
+	edit(&clone.settings)
+	return clone
+}
+
+// Run executes the builtin using the visitor pattern
+func (b *Builtin) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, b.settings)
+	return visitor.run(b, func() (*Result, error) {
+		return visitor.VisitBuiltin(b)
+	})
+}
@@ -0,0 +1,94 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCondition(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, []byte("data"), 0644)
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, nil, 0755)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"empty expression", nil, 1},
+		{"non-empty string", []string{"x"}, 0},
+		{"empty string", []string{""}, 1},
+		{"-n", []string{"-n", "x"}, 0},
+		{"-z", []string{"-z", "x"}, 1},
+		{"string equal", []string{"a", "=", "a"}, 0},
+		{"string not equal", []string{"a", "!=", "a"}, 1},
+		{"numeric less", []string{"2", "-lt", "10"}, 0},
+		{"numeric greater equal", []string{"2", "-ge", "10"}, 1},
+		{"file exists", []string{"-e", file}, 0},
+		{"missing file", []string{"-e", filepath.Join(dir, "missing")}, 1},
+		{"regular file", []string{"-f", file}, 0},
+		{"directory", []string{"-d", dir}, 0},
+		{"file is not a directory", []string{"-d", file}, 1},
+		{"non-empty file", []string{"-s", file}, 0},
+		{"empty file", []string{"-s", empty}, 1},
+		{"executable", []string{"-x", empty}, 0},
+		{"not executable", []string{"-x", file}, 1},
+		{"negation", []string{"!", "-d", file}, 0},
+		{"and", []string{"-f", file, "-a", "-d", dir}, 0},
+		{"or", []string{"-d", file, "-o", "-d", dir}, 0},
+		{"parentheses", []string{"!", "(", "a", "=", "a", "-o", "", ")"}, 1},
+		{"invalid integer", []string{"a", "-eq", "1"}, 2},
+		{"missing paren", []string{"(", "a"}, 2},
+		{"extra argument", []string{"a", "b"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := Test(tt.args...).Run(context.Background())
+			if result.ExitCode != tt.code {
+				t.Errorf("exit code = %d, want %d (error: %v)", result.ExitCode, tt.code, result.Error)
+			}
+		})
+	}
+}
+
+func TestBuiltinsInPipelines(t *testing.T) {
+	// Test: builtins compose with processes like shell commands
+	ctx := context.Background()
+	yes, _ := NewExecutable("echo", "yes")
+	no, _ := NewExecutable("echo", "no")
+
+	result, err := Test("-d", "/").And(yes).Or(no).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if string(result.Stdout) != "yes\n" {
+		t.Errorf("expected yes, got %q", result.Stdout)
+	}
+
+	result, _ = False().Or(True()).And(no).Run(ctx)
+	if string(result.Stdout) != "no\n" {
+		t.Errorf("expected no, got %q", result.Stdout)
+	}
+
+	_, err = False().Run(ctx)
+	var builtinErr *BuiltinError
+	if !errors.As(err, &builtinErr) || builtinErr.ExitCode() != 1 {
+		t.Errorf("expected BuiltinError with exit code 1, got %v", err)
+	}
+}
+
+func TestBuiltinValidate(t *testing.T) {
+	// Test: malformed expressions are reported by Validate
+	if err := Test("1", "-gt", "x").Validate(); err == nil {
+		t.Error("expected validation error")
+	}
+	if err := Test("-f", "/etc/passwd").Validate(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
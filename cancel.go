@@ -0,0 +1,52 @@
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// WithCancelSignal sends sig instead of SIGKILL when the context is done, so
+// the process can clean up. The process is killed if it is still running
+// after killDelay, or after Defaults.ShutdownTimeout as set when the process
+// starts if killDelay is zero. Output written while it shuts down is still read
+func WithCancelSignal(sig os.Signal, killDelay time.Duration) Option {
+	return func(o *Options) {
+		o.CancelSignal = sig
+		o.KillDelay = killDelay
+	}
+}
+
+// setCancel makes the cancellation of the context signal the process, or its
+// process group with WithProcessGroup. With a CancelSignal, cmd.WaitDelay
+// kills the process once the kill delay expired
+func setCancel(cmd *exec.Cmd, ops *Options) {
+	sig := ops.CancelSignal
+	if sig == nil {
+		sig = os.Kill
+	} else {
+		cmd.WaitDelay = ops.KillDelay
+		if cmd.WaitDelay <= 0 {
+			cmd.WaitDelay = Defaults.ShutdownTimeout
+		}
+	}
+	group := ops.ProcessGroup
+	cmd.Cancel = func() error {
+		return signalProcess(cmd.Process, group, sig)
+	}
+}
+
+// awaitShutdown waits for the process sent the cancel signal to exit and
+// reports whether cmd.WaitDelay had to kill it. That only kills the process
+// itself, so the rest of its process group is killed here
+func (p *ProcessRunner) awaitShutdown() bool {
+	cancelled := time.Now()
+	<-p.done
+	if p.exitedAt.Sub(cancelled) < p.cmd.WaitDelay {
+		return false
+	}
+	if p.group {
+		p.signal(os.Kill)
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithCancelSignal(t *testing.T) {
+	// Test: cancelling the context sends the signal, then kills after the delay
+	tests := []struct {
+		name       string
+		script     string
+		output     string
+		minElapsed time.Duration
+	}{
+		{"cleans up", "trap 'echo cleaned; exit 0' TERM; echo ready; while :; do sleep 0.01; done", "ready\ncleaned\n", 0},
+		{"killed after delay", "trap '' TERM; echo ready; while :; do sleep 0.01; done", "ready\n", 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			p, _ := NewProcess("sh", []string{"-c", tt.script}, WithCancelSignal(syscall.SIGTERM, 300*time.Millisecond))
+			runner, err := p.Exec(ctx)
+			if err != nil {
+				t.Fatalf("exec failed: %v", err)
+			}
+			output := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(runner.Stdout())
+				output <- data
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			start := time.Now()
+			cancel()
+			runner.Wait()
+			elapsed := time.Since(start)
+
+			if elapsed < tt.minElapsed || elapsed > 3*time.Second {
+				t.Errorf("unexpected shutdown time %v", elapsed)
+			}
+			if got := string(<-output); got != tt.output {
+				t.Errorf("expected output %q, got %q", tt.output, got)
+			}
+		})
+	}
+}
+
+func TestWithCancelSignalKillDelay(t *testing.T) {
+	saved := Defaults
+	defer func() { Defaults = saved }()
+	stubborn := "trap '' TERM; echo ready; while :; do sleep 0.01; done"
+
+	// Test: a zero kill delay is Defaults.ShutdownTimeout as set when the
+	// process starts, and becomes the WaitDelay of the exec.Cmd
+	option := WithCancelSignal(syscall.SIGTERM, 0)
+	Defaults.ShutdownTimeout = 200 * time.Millisecond
+	p, _ := NewProcess("sh", []string{"-c", stubborn}, option)
+	ctx, cancel := context.WithCancel(context.Background())
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if delay := runner.Cmd().WaitDelay; delay != 200*time.Millisecond {
+		t.Errorf("expected WaitDelay 200ms, got %v", delay)
+	}
+	io.ReadAll(io.LimitReader(runner.Stdout(), 6))
+	start := time.Now()
+	cancel()
+	runner.Wait()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("unexpected shutdown time %v", elapsed)
+	}
+
+	// Test: WithTimeout shuts the process down the same way
+	p, _ = NewProcess("sh", []string{"-c", stubborn}, WithCancelSignal(syscall.SIGTERM, 200*time.Millisecond), WithTimeout(100*time.Millisecond))
+	start = time.Now()
+	runner, err = p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	var timeout *TimeoutError
+	if err := runner.Wait(); !errors.As(err, &timeout) {
+		t.Errorf("expected a *TimeoutError, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("unexpected shutdown time %v", elapsed)
+	}
+
+	// Test: with WithProcessGroup the descendants still holding the output
+	// are killed with the process
+	script := "trap '' TERM; (trap '' TERM; sleep 10) & echo ready; wait"
+	p, _ = NewProcess("sh", []string{"-c", script}, WithCancelSignal(syscall.SIGTERM, 200*time.Millisecond), WithProcessGroup())
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	runner, err = p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	output := make(chan []byte, 1)
+	go func() {
+		data, _ := io.ReadAll(runner.Stdout())
+		output <- data
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case data := <-output:
+		if string(data) != "ready\n" {
+			t.Errorf("expected output %q, got %q", "ready\n", data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the output of the process group was not closed")
+	}
+	runner.Wait()
+}
@@ -0,0 +1,183 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WithRecording records the terminal session of a process started WithPTY to
+// w as an asciinema v2 cast, for auditing interactive operations. The cast
+// holds the terminal output as "o" events, typed input as "i" events and
+// window size changes as "r" events, each with the seconds since the start.
+// Play it with asciinema play, or with ReadCast and Cast.Replay
+// Output is recorded when it is read, like WithTranscript
+func WithRecording(w io.Writer) Option {
+	return func(o *Options) {
+		o.Recording = w
+	}
+}
+
+// castRecorder writes the events of one terminal session to a cast
+type castRecorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	cut   map[string][]byte // start of a character cut off at the end of the last chunk
+}
+
+// newCastRecorder writes the header of a cast for a terminal of rows and cols
+func newCastRecorder(w io.Writer, rows, cols uint16, title string) *castRecorder {
+	c := &castRecorder{w: w, start: time.Now(), cut: map[string][]byte{}}
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     int(cols),
+		Height:    int(rows),
+		Timestamp: c.start.Unix(),
+		Title:     title,
+	})
+	fmt.Fprintf(w, "%s\n", header)
+	return c
+}
+
+// record adds a chunk of data of kind "o" or "i". Cast events hold text, so
+// a character split between two chunks is written with the second one
+func (c *castRecorder) record(kind string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data = append(c.cut[kind], data...)
+	c.cut[kind] = nil
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data, c.cut[kind] = data[:i], append([]byte(nil), data[i:]...)
+			}
+			break
+		}
+	}
+	c.write(kind, string(data))
+}
+
+// resize adds a window size change
+func (c *castRecorder) resize(rows, cols uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.write("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// flush writes the rest of a character cut off at the end of the session
+func (c *castRecorder) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, kind := range []string{"i", "o"} {
+		c.write(kind, string(c.cut[kind]))
+		c.cut[kind] = nil
+	}
+}
+
+func (c *castRecorder) write(kind, data string) {
+	if data == "" {
+		return
+	}
+	quoted, _ := json.Marshal(data)
+	fmt.Fprintf(c.w, "[%.6f, %q, %s]\n", time.Since(c.start).Seconds(), kind, quoted)
+}
+
+// castHeader is the first line of an asciinema v2 cast
+type castHeader struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Cast is a terminal session in the asciinema v2 format, as read by ReadCast
+type Cast struct {
+	Width     int       // columns of the terminal at the start
+	Height    int       // rows of the terminal at the start
+	Timestamp time.Time // when the recording started, zero if unknown
+	Title     string
+	Events    []CastEvent
+}
+
+// CastEvent is one event of a Cast
+type CastEvent struct {
+	Time time.Duration // since the start of the recording
+	Kind string        // "o" output, "i" input, "r" resize to "COLSxROWS" or "m" marker
+	Data string
+}
+
+// ReadCast parses an asciinema v2 cast, such as one written WithRecording
+func ReadCast(r io.Reader) (*Cast, error) {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, 16<<20)
+	if !lines.Scan() {
+		if err := lines.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("cast: missing header")
+	}
+	var header castHeader
+	if err := json.Unmarshal(lines.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("cast: header: %w", err)
+	}
+	if header.Version != 2 {
+		return nil, fmt.Errorf("cast: unsupported version %d", header.Version)
+	}
+	cast := &Cast{Width: header.Width, Height: header.Height, Title: header.Title}
+	if header.Timestamp != 0 {
+		cast.Timestamp = time.Unix(header.Timestamp, 0)
+	}
+
+	for line := 2; lines.Scan(); line++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		var event struct {
+			Time float64
+			Kind string
+			Data string
+		}
+		fields := []any{&event.Time, &event.Kind, &event.Data}
+		if err := json.Unmarshal(lines.Bytes(), &fields); err != nil || len(fields) != 3 {
+			return nil, fmt.Errorf("cast: line %d: invalid event %s", line, lines.Bytes())
+		}
+		cast.Events = append(cast.Events, CastEvent{
+			Time: time.Duration(event.Time * float64(time.Second)),
+			Kind: event.Kind,
+			Data: event.Data,
+		})
+	}
+	return cast, lines.Err()
+}
+
+// Replay writes the output events of the cast to w with their original
+// timing divided by speed: 2 plays twice as fast, 0 writes everything at
+// once. It stops early with the error of ctx when ctx is done
+func (c *Cast) Replay(ctx context.Context, w io.Writer, speed float64) error {
+	start := time.Now()
+	for _, event := range c.Events {
+		if event.Kind != "o" {
+			continue
+		}
+		if speed > 0 {
+			at := time.Duration(float64(event.Time) / speed)
+			if err := sleepContext(ctx, at-time.Since(start)); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, event.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
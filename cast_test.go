@@ -0,0 +1,121 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCastRecorder(t *testing.T) {
+	// Test: events are written after the header and a character split
+	// between two chunks is written whole with the second one
+	var out bytes.Buffer
+	c := newCastRecorder(&out, 24, 80, "sh")
+	c.record("o", []byte("caf\xc3"))
+	c.record("o", []byte("\xa9\r\n"))
+	c.record("i", []byte("q"))
+	c.resize(30, 100)
+	c.record("o", []byte("\xe2\x82"))
+	c.flush()
+
+	cast, err := ReadCast(&out)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if cast.Width != 80 || cast.Height != 24 || cast.Title != "sh" || cast.Timestamp.IsZero() {
+		t.Errorf("unexpected header %+v", cast)
+	}
+	var got []string
+	for _, event := range cast.Events {
+		got = append(got, event.Kind+" "+event.Data)
+	}
+	want := []string{"o caf", "o é\r\n", "i q", "r 100x30", "o \ufffd\ufffd"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected events %q, got %q", want, got)
+	}
+}
+
+func TestReadCast(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		events int
+		err    string
+	}{
+		{
+			// Test: a cast written by asciinema is read
+			name:   "asciinema",
+			input:  "{\"version\": 2, \"width\": 120, \"height\": 40, \"env\": {\"TERM\": \"xterm\"}}\n[0.5, \"o\", \"$ \"]\n\n[1.25, \"m\", \"\"]\n",
+			events: 2,
+		},
+		{
+			// Test: an empty input has no header
+			name: "empty",
+			err:  "missing header",
+		},
+		{
+			// Test: version 1 casts are rejected
+			name:  "version 1",
+			input: `{"version": 1, "width": 80, "height": 24, "stdout": []}`,
+			err:   "unsupported version 1",
+		},
+		{
+			// Test: a malformed event names its line
+			name:  "bad event",
+			input: "{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.1, \"o\"]\n",
+			err:   "line 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cast, err := ReadCast(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if len(cast.Events) != tt.events {
+				t.Errorf("expected %d events, got %+v", tt.events, cast.Events)
+			}
+		})
+	}
+}
+
+func TestCastReplay(t *testing.T) {
+	cast := &Cast{Events: []CastEvent{
+		{Time: 0, Kind: "o", Data: "a"},
+		{Time: 50 * time.Millisecond, Kind: "i", Data: "typed"},
+		{Time: 100 * time.Millisecond, Kind: "o", Data: "b"},
+	}}
+
+	// Test: only output is replayed, with the timing divided by speed
+	var out bytes.Buffer
+	start := time.Now()
+	if err := cast.Replay(context.Background(), &out, 2); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if elapsed := time.Since(start); out.String() != "ab" || elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected replay %q in %v", out.String(), elapsed)
+	}
+
+	// Test: speed 0 writes everything at once
+	out.Reset()
+	start = time.Now()
+	cast.Replay(context.Background(), &out, 0)
+	if elapsed := time.Since(start); out.String() != "ab" || elapsed > 50*time.Millisecond {
+		t.Errorf("unexpected instant replay %q in %v", out.String(), elapsed)
+	}
+
+	// Test: a done context stops the replay
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cast.Replay(ctx, &out, 1); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package subprocess
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos describes the faults InjectChaos adds to processes, to test how
+// orchestration code copes with misbehaving processes
+// Each rate is the probability, between 0 and 1, that a run gets the fault
+type Chaos struct {
+	Seed int64 // runs with the same seed get the same faults
+
+	ExitRate float64 // kill the process on start, failing with ExitCode
+	ExitCode int     // exit code of injected failures, 1 if zero
+
+	DelayRate float64       // delay the start of the process
+	MaxDelay  time.Duration // longest injected delay, 1s if zero
+
+	KillRate     float64       // send SIGKILL while the process runs
+	MaxKillAfter time.Duration // latest injected SIGKILL after the start, 1s if zero
+
+	TruncateRate float64 // cut the stdout of the process short
+	MaxTruncate  int     // most stdout bytes kept when truncating, 1024 if zero
+
+	OnFault func(Fault) // called for every injected fault, may be called concurrently
+}
+
+// FaultKind is the kind of an injected fault
+type FaultKind int
+
+const (
+	FaultExit     FaultKind = iota // process failed with a non-zero exit code
+	FaultDelay                     // process started late
+	FaultKill                      // process killed with SIGKILL
+	FaultTruncate                  // stdout cut short
+)
+
+// String returns a string representation of the fault kind
+func (k FaultKind) String() string {
+	switch k {
+	case FaultExit:
+		return "exit"
+	case FaultDelay:
+		return "delay"
+	case FaultKill:
+		return "kill"
+	case FaultTruncate:
+		return "truncate"
+	default:
+		return "unknown"
+	}
+}
+
+// Fault is a fault injected into a run
+type Fault struct {
+	Kind     FaultKind
+	Command  string
+	ExitCode int           // exit code with FaultExit
+	Delay    time.Duration // start delay with FaultDelay, time until SIGKILL with FaultKill
+	Bytes    int           // stdout bytes kept with FaultTruncate
+}
+
+// String describes the fault
+func (f Fault) String() string {
+	switch f.Kind {
+	case FaultExit:
+		return fmt.Sprintf("%s: injected exit code %d", f.Command, f.ExitCode)
+	case FaultDelay:
+		return fmt.Sprintf("%s: injected start delay of %v", f.Command, f.Delay)
+	case FaultKill:
+		return fmt.Sprintf("%s: injected SIGKILL after %v", f.Command, f.Delay)
+	case FaultTruncate:
+		return fmt.Sprintf("%s: stdout truncated to %d bytes", f.Command, f.Bytes)
+	default:
+		return fmt.Sprintf("%s: %s fault", f.Command, f.Kind)
+	}
+}
+
+// FaultError is the error of a process failed by an injected FaultExit
+type FaultError struct {
+	Fault Fault
+}
+
+func (e *FaultError) Error() string {
+	return "chaos: " + e.Fault.String()
+}
+
+// ExitCode returns the injected exit code
+func (e *FaultError) ExitCode() int {
+	return e.Fault.ExitCode
+}
+
+// InjectChaos returns a copy of exec whose processes randomly misbehave as
+// described by c. Every process draws from its own generator seeded from
+// c.Seed and its position in the tree, so a seed reproduces the same faults
+// exec itself is not modified
+func InjectChaos(exec Executable, c Chaos) Executable {
+	var index atomic.Int64
+	return mapProcesses(exec, func(ops *Options) {
+		ops.chaos = &chaosSource{
+			config: c,
+			rand:   rand.New(rand.NewSource(c.Seed + index.Add(1))),
+		}
+	})
+}
+
+// chaosSource draws the faults of the runs of one process
+type chaosSource struct {
+	config Chaos
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// draw returns the faults of the next run of ops
+func (s *chaosSource) draw(ops *Options) []Fault {
+	c := s.config
+	var faults []Fault
+	add := func(rate float64, f Fault) {
+		// Always draw, so one fault does not shift the draws of the others
+		if s.rand.Float64() < rate {
+			f.Command = ops.Command
+			faults = append(faults, f)
+		}
+	}
+
+	s.mu.Lock()
+	add(c.DelayRate, Fault{Kind: FaultDelay, Delay: s.duration(c.MaxDelay)})
+	add(c.ExitRate, Fault{Kind: FaultExit, ExitCode: orDefault(c.ExitCode, 1)})
+	add(c.KillRate, Fault{Kind: FaultKill, Delay: s.duration(c.MaxKillAfter)})
+	add(c.TruncateRate, Fault{Kind: FaultTruncate, Bytes: s.rand.Intn(orDefault(c.MaxTruncate, 1024) + 1)})
+	s.mu.Unlock()
+
+	if c.OnFault != nil {
+		for _, f := range faults {
+			c.OnFault(f)
+		}
+	}
+	return faults
+}
+
+// duration returns a random duration up to limit, 1s if limit is zero
+func (s *chaosSource) duration(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		limit = time.Second
+	}
+	return time.Duration(s.rand.Int63n(int64(limit) + 1))
+}
+
+// orDefault returns v, or def if v is zero
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// startDelay returns the delay injected before the start, if any
+func startDelay(faults []Fault) time.Duration {
+	for _, f := range faults {
+		if f.Kind == FaultDelay {
+			return f.Delay
+		}
+	}
+	return 0
+}
+
+// injectFaults applies the faults that act on the started process
+func (p *ProcessRunner) injectFaults(faults []Fault) {
+	for _, f := range faults {
+		switch f.Kind {
+		case FaultExit:
+			p.kill(&FaultError{Fault: f})
+		case FaultKill:
+			go func(after time.Duration) {
+				timer := time.NewTimer(after)
+				defer timer.Stop()
+				select {
+				case <-p.done:
+				case <-timer.C:
+					p.Stop()
+				}
+			}(f.Delay)
+		case FaultTruncate:
+			p.stdoutStream = &truncatedReader{r: p.stdoutStream, n: f.Bytes, close: p.stdout.Close}
+			p.readerWriter.Reader = io.MultiReader(p.stdoutStream, p.stderrStream)
+		}
+	}
+}
+
+// truncatedReader returns EOF after n bytes and closes the pipe, so the
+// process gets SIGPIPE if it writes more, like a reader that went away
+type truncatedReader struct {
+	r     io.Reader
+	n     int
+	close func() error
+}
+
+func (t *truncatedReader) Read(p []byte) (int, error) {
+	if t.n <= 0 {
+		t.close()
+		return 0, io.EOF
+	}
+	if len(p) > t.n {
+		p = p[:t.n]
+	}
+	n, err := t.r.Read(p)
+	t.n -= n
+	return n, err
+}
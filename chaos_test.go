@@ -0,0 +1,128 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInjectChaos(t *testing.T) {
+	// Test: every kind of fault changes the run as described
+	tests := []struct {
+		name  string
+		args  []string
+		chaos Chaos
+		check func(t *testing.T, result *Result, err error, elapsed time.Duration)
+	}{
+		{
+			name:  "exit",
+			args:  []string{"sh", "-c", "echo ok"},
+			chaos: Chaos{ExitRate: 1, ExitCode: 3},
+			check: func(t *testing.T, result *Result, err error, elapsed time.Duration) {
+				var faultErr *FaultError
+				if !errors.As(err, &faultErr) {
+					t.Fatalf("expected a FaultError, got %v", err)
+				}
+				if result.ExitCode != 3 {
+					t.Errorf("expected exit code 3, got %d", result.ExitCode)
+				}
+			},
+		},
+		{
+			name:  "delay",
+			args:  []string{"true"},
+			chaos: Chaos{DelayRate: 1, MaxDelay: 300 * time.Millisecond, Seed: 1},
+			check: func(t *testing.T, result *Result, err error, elapsed time.Duration) {
+				if err != nil {
+					t.Fatalf("run failed: %v", err)
+				}
+			},
+		},
+		{
+			name:  "kill",
+			args:  []string{"sleep", "10"},
+			chaos: Chaos{KillRate: 1, MaxKillAfter: 50 * time.Millisecond},
+			check: func(t *testing.T, result *Result, err error, elapsed time.Duration) {
+				if err == nil || !strings.Contains(err.Error(), "killed") {
+					t.Errorf("expected the process to be killed, got %v", err)
+				}
+				if elapsed > 5*time.Second {
+					t.Errorf("expected an early kill, took %v", elapsed)
+				}
+			},
+		},
+		{
+			name:  "truncate",
+			args:  []string{"seq", "100000"},
+			chaos: Chaos{TruncateRate: 1, MaxTruncate: 10},
+			check: func(t *testing.T, result *Result, err error, elapsed time.Duration) {
+				if len(result.Stdout) > 10 {
+					t.Errorf("expected at most 10 bytes, got %d", len(result.Stdout))
+				}
+				if !strings.HasPrefix("1\n2\n3\n4\n5\n", string(result.Stdout)) {
+					t.Errorf("expected a prefix of the output, got %q", result.Stdout)
+				}
+			},
+		},
+		{
+			name:  "no faults",
+			args:  []string{"echo", "ok"},
+			chaos: Chaos{},
+			check: func(t *testing.T, result *Result, err error, elapsed time.Duration) {
+				if err != nil || string(result.Stdout) != "ok\n" {
+					t.Errorf("expected a normal run, got %q, %v", result.Stdout, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := NewExecutable(tt.args[0], tt.args[1:]...)
+			var faults []Fault
+			tt.chaos.OnFault = func(f Fault) { faults = append(faults, f) }
+
+			start := time.Now()
+			result, err := InjectChaos(exec, tt.chaos).Run(context.Background())
+			tt.check(t, result, err, time.Since(start))
+
+			if tt.name != "no faults" && (len(faults) != 1 || faults[0].Kind.String() != tt.name) {
+				t.Errorf("expected one %s fault, got %v", tt.name, faults)
+			}
+		})
+	}
+}
+
+func TestInjectChaosSeed(t *testing.T) {
+	// Test: the same seed injects the same faults into the same stages
+	a, _ := NewExecutable("echo", "a")
+	b, _ := NewExecutable("echo", "b")
+	tree := a.And(b).Or(a)
+
+	faults := func(seed int64) []string {
+		var got []string
+		chaos := Chaos{
+			Seed:      seed,
+			ExitRate:  0.5,
+			DelayRate: 0.5,
+			MaxDelay:  time.Millisecond,
+			OnFault:   func(f Fault) { got = append(got, f.String()) },
+		}
+		exec := InjectChaos(tree, chaos)
+		for range 5 {
+			exec.Run(context.Background())
+		}
+		return got
+	}
+
+	first := faults(42)
+	if len(first) == 0 {
+		t.Fatal("expected some faults")
+	}
+	if second := faults(42); !slices.Equal(first, second) {
+		t.Errorf("expected the same faults, got %q and %q", first, second)
+	}
+}
@@ -0,0 +1,176 @@
+package subprocess
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CIStyle selects the log commands understood by a CI system
+type CIStyle int
+
+const (
+	CINone          CIStyle = iota // Plain output without annotations
+	CIGitHubActions                // ::group:: and ::error:: workflow commands
+	CITeamCity                     // ##teamcity service messages
+)
+
+// String returns a string representation of the CI style
+func (s CIStyle) String() string {
+	switch s {
+	case CINone:
+		return "none"
+	case CIGitHubActions:
+		return "github-actions"
+	case CITeamCity:
+		return "teamcity"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectCI returns the style of the CI system the program runs in, from the
+// environment variables those systems set, or CINone
+func DetectCI() CIStyle {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return CIGitHubActions
+	case os.Getenv("TEAMCITY_VERSION") != "":
+		return CITeamCity
+	default:
+		return CINone
+	}
+}
+
+// WithCIAnnotations streams the output of the process to w in a collapsible
+// group named after its command, in the log syntax of style, followed by an
+// error annotation if the process fails, so CI logs show where a pipeline
+// failed while it runs. Lines of stdout and stderr are written as they are
+// read, in the order they arrive
+// CI systems do not nest groups, so groups of stages running at the same time,
+// like the stages of a pipe, interleave
+func WithCIAnnotations(w io.Writer, style CIStyle) Option {
+	return func(o *Options) {
+		o.CILog, o.CIStyle = w, style
+	}
+}
+
+// ciLog writes the output of one process run as a CI log group
+type ciLog struct {
+	mu      sync.Mutex
+	w       io.Writer
+	style   CIStyle
+	command string
+	partial [2][]byte // unterminated last line of stdout and stderr
+	pending int       // streams not at EOF, plus the process until it exits
+	err     error     // error of the process, annotated once the group is closed
+}
+
+// newCILog opens the group of command on w
+func newCILog(w io.Writer, style CIStyle, command string) *ciLog {
+	l := &ciLog{w: w, style: style, command: command, pending: 3}
+	switch style {
+	case CIGitHubActions:
+		fmt.Fprintf(w, "::group::%s\n", githubEscape(command, false))
+	case CITeamCity:
+		fmt.Fprintf(w, "##teamcity[blockOpened name='%s']\n", teamcityEscape(command))
+	}
+	return l
+}
+
+// write writes the complete lines of data read from stream, 0 for stdout and
+// 1 for stderr, keeping the unterminated rest for the next read
+func (l *ciLog) write(stream int, data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buf := append(l.partial[stream], data...)
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		l.w.Write(buf[:i+1])
+		buf = buf[i+1:]
+	}
+	l.partial[stream] = append([]byte(nil), buf...)
+}
+
+// eof writes the unterminated last line of stream
+func (l *ciLog) eof(stream int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rest := l.partial[stream]; len(rest) > 0 {
+		l.w.Write(append(rest, '\n'))
+		l.partial[stream] = nil
+	}
+	l.finish()
+}
+
+// exited records the error of the process
+func (l *ciLog) exited(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.err = err
+	l.finish()
+}
+
+// finish closes the group once both streams reached EOF and the process exited
+func (l *ciLog) finish() {
+	if l.pending--; l.pending > 0 {
+		return
+	}
+
+	switch l.style {
+	case CIGitHubActions:
+		fmt.Fprintf(l.w, "::endgroup::\n")
+		if l.err != nil {
+			fmt.Fprintf(l.w, "::error title=%s::%s\n", githubEscape(l.command, true), githubEscape(l.err.Error(), false))
+		}
+	case CITeamCity:
+		name := teamcityEscape(l.command)
+		fmt.Fprintf(l.w, "##teamcity[blockClosed name='%s']\n", name)
+		if l.err != nil {
+			fmt.Fprintf(l.w, "##teamcity[message text='%s' status='ERROR']\n", teamcityEscape(l.command+": "+l.err.Error()))
+		}
+	default:
+		if l.err != nil {
+			fmt.Fprintf(l.w, "%s: %v\n", l.command, l.err)
+		}
+	}
+}
+
+// ciReader writes what is read from r on stream to a ciLog
+type ciReader struct {
+	r      io.Reader
+	stream int
+	log    *ciLog
+	done   bool
+}
+
+func (c *ciReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.log.write(c.stream, p[:n])
+	}
+	if err != nil && !c.done {
+		c.done = true
+		c.log.eof(c.stream)
+	}
+	return n, err
+}
+
+// githubEscape escapes s for a workflow command message or property
+func githubEscape(s string, property bool) string {
+	s = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+	if property {
+		s = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(s)
+	}
+	return s
+}
+
+// teamcityEscape escapes s for a service message attribute
+func teamcityEscape(s string) string {
+	return strings.NewReplacer("|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]").Replace(s)
+}
@@ -0,0 +1,84 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCIAnnotations(t *testing.T) {
+	// Test: the output is grouped as it is read and a failure is annotated in the CI syntax
+	script := "echo out; sleep 0.1; echo 'bad [input]' >&2; sleep 0.1; printf end; exit 2"
+	name := "sh -c 'echo out; sleep 0.1; echo '\\''bad [input]'\\'' >&2; sleep 0.1; printf end; exit 2'"
+
+	tests := []struct {
+		style    CIStyle
+		expected string
+	}{
+		{CIGitHubActions, "::group::" + name + "\nout\nbad [input]\nend\n::endgroup::\n" +
+			"::error title=" + name + "::exit status 2\n"},
+		{CITeamCity, "##teamcity[blockOpened name='" + teamcityEscape(name) + "']\nout\nbad [input]\nend\n" +
+			"##teamcity[blockClosed name='" + teamcityEscape(name) + "']\n" +
+			"##teamcity[message text='" + teamcityEscape(name+": exit status 2") + "' status='ERROR']\n"},
+		{CINone, "out\nbad [input]\nend\n" + name + ": exit status 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style.String(), func(t *testing.T) {
+			var out lockedBuffer
+			failing, _ := Command("sh", []string{"-c", script}, WithCIAnnotations(&out, tt.style))
+			result, _ := failing.Run(context.Background())
+			if out.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+			if string(result.Stdout) != "out\nend" {
+				t.Errorf("expected the output to be captured too, got %q", result.Stdout)
+			}
+		})
+	}
+}
+
+func TestCIAnnotationsStreaming(t *testing.T) {
+	// Test: output is written while the process still runs
+	var out lockedBuffer
+	slow, _ := Command("sh", []string{"-c", "echo ready; sleep 1"}, WithCIAnnotations(&out, CIGitHubActions))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		slow.Run(context.Background())
+	}()
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for !strings.Contains(out.String(), "ready\n") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), "ready\n") {
+		t.Errorf("expected streamed output, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "::endgroup::") {
+		t.Error("expected the group to stay open while the process runs")
+	}
+	<-done
+	if !strings.HasSuffix(out.String(), "::endgroup::\n") {
+		t.Errorf("expected the group to be closed, got %q", out.String())
+	}
+}
+
+func TestDetectCI(t *testing.T) {
+	// Test: the CI system is detected from its environment variables
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("TEAMCITY_VERSION", "")
+	if style := DetectCI(); style != CINone {
+		t.Errorf("expected no CI, got %v", style)
+	}
+	t.Setenv("TEAMCITY_VERSION", "2024.1")
+	if style := DetectCI(); style != CITeamCity {
+		t.Errorf("expected TeamCity, got %v", style)
+	}
+	t.Setenv("GITHUB_ACTIONS", "true")
+	if style := DetectCI(); style != CIGitHubActions {
+		t.Errorf("expected GitHub Actions, got %v", style)
+	}
+}
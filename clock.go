@@ -0,0 +1,114 @@
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// FakeTime sets the clock a process sees through libfaketime, for
+// deterministic tests of time-dependent tools
+type FakeTime struct {
+	Start   time.Time // time the process sees when it starts
+	Frozen  bool      // the clock stands still at Start instead of advancing from it
+	Library string    // path of libfaketime, common install locations are searched when empty
+}
+
+// fakeTimeLibraries are the usual install locations of libfaketime
+var fakeTimeLibraries = []string{
+	"/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1",
+	"/usr/lib/aarch64-linux-gnu/faketime/libfaketime.so.1",
+	"/usr/lib/faketime/libfaketime.so.1",
+	"/usr/lib64/faketime/libfaketime.so.1",
+	"/usr/local/lib/faketime/libfaketime.so.1",
+	"/opt/homebrew/lib/faketime/libfaketime.1.dylib",
+	"/usr/local/lib/faketime/libfaketime.1.dylib",
+}
+
+// WithTimezone sets the TZ of the process, e.g. "UTC" or "Asia/Tokyo"
+func WithTimezone(tz string) Option {
+	return func(o *Options) {
+		o.Timezone = tz
+	}
+}
+
+// WithFakeTime makes the process see the clock described by ft, by preloading
+// libfaketime. Tools that are statically linked or read the time through
+// syscalls directly, like Go programs, are not affected
+func WithFakeTime(ft FakeTime) Option {
+	return func(o *Options) {
+		o.FakeTime = &ft
+	}
+}
+
+// library returns the path of libfaketime
+func (ft *FakeTime) library() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", errors.New("WithFakeTime is not supported on Windows")
+	}
+	candidates := fakeTimeLibraries
+	if ft.Library != "" {
+		candidates = []string{ft.Library}
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("WithFakeTime: libfaketime not found, install it or set FakeTime.Library")
+}
+
+// clockEnv returns the environment overrides for the timezone and fake time
+// of ops on top of base
+func clockEnv(ops *Options, base []string) []string {
+	var env []string
+	if ops.Timezone != "" {
+		env = append(env, "TZ="+ops.Timezone)
+	}
+	ft := ops.FakeTime
+	if ft == nil {
+		return env
+	}
+	library, err := ft.library()
+	if err != nil {
+		// Reported when the process starts
+		return env
+	}
+
+	// libfaketime reads the time in the timezone of the process
+	start := ft.Start.In(time.Local)
+	if ops.Timezone != "" {
+		if loc, err := time.LoadLocation(ops.Timezone); err == nil {
+			start = ft.Start.In(loc)
+		}
+	}
+	stamp := start.Format("2006-01-02 15:04:05")
+	if !ft.Frozen {
+		stamp = "@" + stamp
+	}
+	env = append(env, "FAKETIME="+stamp, "FAKETIME_DONT_FAKE_MONOTONIC=1")
+
+	preload := "LD_PRELOAD"
+	if runtime.GOOS == "darwin" {
+		preload = "DYLD_INSERT_LIBRARIES"
+		env = append(env, "DYLD_FORCE_FLAT_NAMESPACE=1")
+	}
+	libraries := library
+	for _, kv := range base {
+		if value, ok := strings.CutPrefix(kv, preload+"="); ok && value != "" {
+			libraries += ":" + value
+		}
+	}
+	return append(env, preload+"="+libraries)
+}
+
+// checkClock reports a fake time that cannot be set up
+func checkClock(ops *Options) error {
+	if ops.FakeTime == nil {
+		return nil
+	}
+	_, err := ops.FakeTime.library()
+	return err
+}
@@ -0,0 +1,76 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimezone(t *testing.T) {
+	// Test: the process sees the pinned timezone
+	exec, _ := Command("date", []string{"+%Z"}, WithTimezone("Asia/Tokyo"))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "JST\n" {
+		t.Errorf("expected JST, got %q", result.Stdout)
+	}
+}
+
+func TestFakeTimeEnv(t *testing.T) {
+	// Test: libfaketime is preloaded with the start time in the process timezone
+	library := filepath.Join(t.TempDir(), "libfaketime.so.1")
+	if err := os.WriteFile(library, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		ft       FakeTime
+		expected string
+	}{
+		{"advancing", FakeTime{Start: start, Library: library}, "FAKETIME=@2024-02-29 21:00:00"},
+		{"frozen", FakeTime{Start: start, Frozen: true, Library: library}, "FAKETIME=2024-02-29 21:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := NewProcess("date", nil, WithTimezone("Asia/Tokyo"), WithFakeTime(tt.ft))
+			env := clockEnv(p.ops, []string{"LD_PRELOAD=/other.so"})
+			for _, want := range []string{"TZ=Asia/Tokyo", tt.expected, "LD_PRELOAD=" + library + ":/other.so"} {
+				if !slices.Contains(env, want) {
+					t.Errorf("expected %q in %q", want, env)
+				}
+			}
+		})
+	}
+
+	missing, _ := Command("date", nil, WithFakeTime(FakeTime{Library: "/no/such/libfaketime.so"}))
+	if err := missing.Validate(); err == nil {
+		t.Error("expected validation error for a missing library")
+	}
+	if _, err := missing.Run(context.Background()); err == nil {
+		t.Error("expected run error for a missing library")
+	}
+}
+
+func TestFakeTime(t *testing.T) {
+	// Test: the process sees the fake clock
+	ft := FakeTime{Start: time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC), Frozen: true}
+	if _, err := ft.library(); err != nil {
+		t.Skip(err)
+	}
+	exec, _ := Command("date", []string{"+%Y-%m-%d %H:%M:%S"}, WithTimezone("UTC"), WithFakeTime(ft))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "2001-02-03 04:05:06\n" {
+		t.Errorf("unexpected time %q", result.Stdout)
+	}
+}
@@ -3,30 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"embed"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 
 	"github.com/cuongtranba/subprocess"
 )
 
-func main() {
-	// Get the path to prints.sh (same directory as this main.go)
-	execDir, err := os.Executable()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting executable path: %v\n", err)
-		os.Exit(1)
-	}
-	scriptPath := filepath.Join(filepath.Dir(execDir), "prints.sh")
-
-	// For development, use relative path if executable path doesn't work
-	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-		scriptPath = "./cmd/echo/prints.sh"
-	}
+// The script is built into the binary, so it runs from any directory
+//
+//go:embed prints.sh
+var scripts embed.FS
 
+func main() {
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -41,7 +33,7 @@ func main() {
 	}()
 
 	// Create and start the process
-	process, err := subprocess.NewProcess("/bin/bash", []string{scriptPath})
+	process, err := subprocess.NewProcess("/bin/bash", nil, subprocess.WithEmbeddedScript(scripts, "prints.sh"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating process: %v\n", err)
 		os.Exit(1)
@@ -66,7 +58,7 @@ func main() {
 
 	// Goroutine to copy from our stdin to process stdin
 	go func() {
-		defer rw.Close()
+		defer rw.CloseWrite()
 		defer close(done)
 
 		scanner := bufio.NewScanner(os.Stdin)
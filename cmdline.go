@@ -0,0 +1,107 @@
+package subprocess
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WithRawCmdLine passes line to the process verbatim as its Windows command
+// line, program name included, for tools that parse it in their own way
+// Args are ignored. On other platforms the process fails to start
+func WithRawCmdLine(line string) Option {
+	return func(o *Options) {
+		o.RawCmdLine = line
+	}
+}
+
+// windowsCmdLine returns the command line for name and args when it needs
+// more than the MSVC quoting done by os/exec, and whether it does
+// cmd.exe and batch files parse the line themselves, so metacharacters are
+// escaped with carets. msiexec expects properties as KEY="value"
+func windowsCmdLine(name string, args []string) (string, bool) {
+	base := strings.ToLower(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	ext := filepath.Ext(base)
+	parts := []string{quoteWindowsArg(name)}
+
+	switch {
+	case base == "cmd" || base == "cmd.exe":
+		// Arguments after /c or /k form the command cmd.exe runs
+		command := false
+		for _, arg := range args {
+			if command {
+				parts = append(parts, escapeCmdMeta(quoteWindowsArg(arg)))
+				continue
+			}
+			parts = append(parts, quoteWindowsArg(arg))
+			if lower := strings.ToLower(arg); lower == "/c" || lower == "/k" {
+				command = true
+			}
+		}
+	case ext == ".bat" || ext == ".cmd":
+		for _, arg := range args {
+			parts = append(parts, escapeCmdMeta(quoteWindowsArg(arg)))
+		}
+	case base == "msiexec" || base == "msiexec.exe":
+		for _, arg := range args {
+			parts = append(parts, quoteMsiArg(arg))
+		}
+	default:
+		return "", false
+	}
+	return strings.Join(parts, " "), true
+}
+
+// quoteWindowsArg quotes arg so CommandLineToArgvW and the MSVC runtime parse
+// it back unchanged: backslashes are only special before a double quote
+func quoteWindowsArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// Escape the backslashes and the quote itself
+			b.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		b.WriteByte(arg[i])
+	}
+	// Backslashes before the closing quote must not escape it
+	b.WriteString(strings.Repeat(`\`, 2*backslashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// escapeCmdMeta escapes the characters cmd.exe interprets, quotes included,
+// so they reach the program cmd.exe starts literally
+func escapeCmdMeta(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`()%!^"<>&|`, c) {
+			b.WriteByte('^')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// quoteMsiArg quotes the value of a KEY=value property like msiexec expects,
+// with quotes in the value doubled. Other arguments are quoted as usual
+func quoteMsiArg(arg string) string {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok || key == "" || strings.ContainsAny(key, " \t\"/") {
+		return quoteWindowsArg(arg)
+	}
+	if value != "" && !strings.ContainsAny(value, " \t\"") {
+		return arg
+	}
+	return key + `="` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package subprocess
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// applyCmdLine sets the command line of cmd when os/exec would quote it wrong
+// Only Windows passes a command line, elsewhere args are passed as they are
+func applyCmdLine(cmd *exec.Cmd, ops *Options) error {
+	if ops.RawCmdLine != "" {
+		return errors.New("WithRawCmdLine is only supported on Windows")
+	}
+	return nil
+}
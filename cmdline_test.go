@@ -0,0 +1,69 @@
+package subprocess
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestQuoteWindowsArg(t *testing.T) {
+	// Test: arguments survive CommandLineToArgvW parsing
+	tests := []struct {
+		arg      string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"with space", `"with space"`},
+		{`C:\dir\`, `C:\dir\`},
+		{`C:\my dir\`, `"C:\my dir\\"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`a\"b`, `"a\\\"b"`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteWindowsArg(tt.arg); got != tt.expected {
+			t.Errorf("quoteWindowsArg(%q) = %s, want %s", tt.arg, got, tt.expected)
+		}
+	}
+}
+
+func TestWindowsCmdLine(t *testing.T) {
+	// Test: cmd.exe, batch files and msiexec get their own quoting
+	tests := []struct {
+		name     string
+		cmd      string
+		args     []string
+		expected string
+		custom   bool
+	}{
+		{"regular program", "git.exe", []string{"log"}, "", false},
+		{"cmd.exe", `C:\Windows\System32\cmd.exe`, []string{"/c", "echo", "a&b", "100%"},
+			`C:\Windows\System32\cmd.exe /c echo a^&b 100^%`, true},
+		{"cmd.exe quoted", "cmd", []string{"/C", "echo", "x | y"}, `cmd /C echo ^"x ^| y^"`, true},
+		{"batch file", "build.bat", []string{"a>b"}, `build.bat a^>b`, true},
+		{"msiexec", "msiexec.exe", []string{"/i", `C:\pkg setup.msi`, `INSTALLDIR=C:\Program Files\App`, "/qn"},
+			`msiexec.exe /i "C:\pkg setup.msi" INSTALLDIR="C:\Program Files\App" /qn`, true},
+		{"msiexec quotes", "msiexec", []string{`NAME=say "hi"`}, `msiexec NAME="say ""hi"""`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, custom := windowsCmdLine(tt.cmd, tt.args)
+			if custom != tt.custom || got != tt.expected {
+				t.Errorf("got %s (custom %v), want %s (custom %v)", got, custom, tt.expected, tt.custom)
+			}
+		})
+	}
+}
+
+func TestRawCmdLineOtherPlatforms(t *testing.T) {
+	// Test: a raw command line cannot be honored outside Windows
+	if runtime.GOOS == "windows" {
+		t.Skip("raw command lines are supported on Windows")
+	}
+	exec, _ := Command("echo", nil, WithRawCmdLine("echo hi"))
+	if _, err := exec.Run(context.Background()); err == nil {
+		t.Error("expected error for a raw command line")
+	}
+}
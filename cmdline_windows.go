@@ -0,0 +1,22 @@
+package subprocess
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// applyCmdLine sets the command line of cmd when os/exec would quote it wrong
+func applyCmdLine(cmd *exec.Cmd, ops *Options) error {
+	line := ops.RawCmdLine
+	if line == "" {
+		var ok bool
+		if line, ok = windowsCmdLine(cmd.Args[0], cmd.Args[1:]); !ok {
+			return nil
+		}
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = line
+	return nil
+}
@@ -0,0 +1,76 @@
+package subprocess
+
+import (
+	"os"
+	"regexp"
+)
+
+// ColorPolicy controls whether processes print colored output
+type ColorPolicy int
+
+const (
+	ColorDefault ColorPolicy = iota // Leave the environment and output unchanged
+	ColorAuto                       // ColorAlways when os.Stdout is a terminal, ColorNever otherwise
+	ColorAlways                     // Ask tools to color output even though it goes to a pipe
+	ColorNever                      // Ask tools not to color output and strip escape sequences from captured output
+)
+
+// String returns a string representation of the color policy
+func (c ColorPolicy) String() string {
+	switch c {
+	case ColorDefault:
+		return "default"
+	case ColorAuto:
+		return "auto"
+	case ColorAlways:
+		return "always"
+	case ColorNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// WithColor sets the color policy of the process. Tools only see pipes, so
+// they usually disable colors on their own: ColorAlways sets FORCE_COLOR and
+// CLICOLOR_FORCE so output shown on a terminal keeps its colors, ColorNever
+// sets NO_COLOR and strips the escape sequences left from captured output
+func WithColor(policy ColorPolicy) Option {
+	return func(o *Options) {
+		o.Color = policy
+	}
+}
+
+// resolve returns the policy applied for c, deciding ColorAuto
+func (c ColorPolicy) resolve() ColorPolicy {
+	if c != ColorAuto {
+		return c
+	}
+	if isTerminal(os.Stdout) {
+		return ColorAlways
+	}
+	return ColorNever
+}
+
+// colorEnv returns the environment variables that apply the policy
+func colorEnv(policy ColorPolicy) []string {
+	switch policy.resolve() {
+	case ColorAlways:
+		return []string{"FORCE_COLOR=1", "CLICOLOR_FORCE=1", "CLICOLOR=1", "NO_COLOR="}
+	case ColorNever:
+		return []string{"NO_COLOR=1", "FORCE_COLOR=0", "CLICOLOR_FORCE=0", "CLICOLOR=0"}
+	default:
+		return nil
+	}
+}
+
+// ansiEscape matches CSI sequences, such as colors and cursor moves, and OSC sequences
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// captureOutput returns the captured output of a process using policy
+func captureOutput(policy ColorPolicy, output []byte) []byte {
+	if policy.resolve() != ColorNever || output == nil {
+		return output
+	}
+	return ansiEscape.ReplaceAll(output, nil)
+}
@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestColorPolicy(t *testing.T) {
+	// Test: the policy sets the color variables and strips captured escape sequences
+	colored := `printf '\033[1;31mred\033[0m \033]8;;http://x\033\\link\033]8;;\033\\\n'; echo "$FORCE_COLOR/$NO_COLOR"`
+	tests := []struct {
+		name     string
+		policy   ColorPolicy
+		expected string
+	}{
+		{"default", ColorDefault, "\x1b[1;31mred\x1b[0m \x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\\n" + os.Getenv("FORCE_COLOR") + "/" + os.Getenv("NO_COLOR") + "\n"},
+		{"always", ColorAlways, "\x1b[1;31mred\x1b[0m \x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\\n1/\n"},
+		{"never", ColorNever, "red link\n0/1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := Command("sh", []string{"-c", colored}, WithColor(tt.policy))
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Stdout)
+			}
+		})
+	}
+
+	// The last stage of a pipe decides for the captured output
+	source, _ := NewExecutable("printf", `\033[32mok\033[0m\n`)
+	sink, _ := Command("cat", nil, WithColor(ColorNever))
+	result, _ := source.Pipe(sink).Run(context.Background())
+	if string(result.Stdout) != "ok\n" {
+		t.Errorf("expected stripped pipe output, got %q", result.Stdout)
+	}
+
+	if expected := map[bool]ColorPolicy{true: ColorAlways, false: ColorNever}[isTerminal(os.Stdout)]; ColorAuto.resolve() != expected {
+		t.Errorf("expected auto to resolve to %v", expected)
+	}
+}
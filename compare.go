@@ -0,0 +1,161 @@
+package subprocess
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Difference is one difference between two runs of a pipeline
+type Difference struct {
+	Stage string // command of the stage, prefixed by the commands of its parents
+	Field string // what differs: structure, exit code, skipped, duration, stdout or stderr
+	A, B  string // the values in the first and second run
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s: %s -> %s", d.Stage, d.Field, d.A, d.B)
+}
+
+// Comparison lists the differences between two runs, in tree order
+type Comparison struct {
+	Differences []Difference
+}
+
+// Equal reports whether the runs showed no differences
+func (c *Comparison) Equal() bool {
+	return len(c.Differences) == 0
+}
+
+// String returns one line per difference
+func (c *Comparison) String() string {
+	if c.Equal() {
+		return "no differences"
+	}
+	lines := make([]string, len(c.Differences))
+	for i, d := range c.Differences {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CompareOption configures Compare
+type CompareOption func(*compareConfig)
+
+type compareConfig struct {
+	relative  float64       // reported relative change in duration, 0 ignores durations
+	absolute  time.Duration // smaller changes in duration are never reported
+	normalize func([]byte) []byte
+}
+
+// DurationThreshold reports stages whose duration changed by more than
+// relative (0.2 is 20%) and by more than absolute, which filters out the noise
+// of very short stages. Durations are ignored without it
+func DurationThreshold(relative float64, absolute time.Duration) CompareOption {
+	return func(c *compareConfig) {
+		c.relative = relative
+		c.absolute = absolute
+	}
+}
+
+// NormalizeOutput applies normalize to stdout and stderr before they are
+// compared, e.g. to mask timestamps or temporary paths
+func NormalizeOutput(normalize func([]byte) []byte) CompareOption {
+	return func(c *compareConfig) {
+		c.normalize = normalize
+	}
+}
+
+// Compare reports the differences between two results of the same pipeline
+// per stage: exit codes, skipped stages, output and, with DurationThreshold,
+// durations. Trees of different shape are compared as far as they match
+func Compare(a, b *Result, opts ...CompareOption) *Comparison {
+	var config compareConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	c := &Comparison{}
+	c.compare(a, b, "", &config)
+	return c
+}
+
+func (c *Comparison) add(stage, field string, a, b any) {
+	c.Differences = append(c.Differences, Difference{Stage: stage, Field: field, A: fmt.Sprint(a), B: fmt.Sprint(b)})
+}
+
+func (c *Comparison) compare(a, b *Result, path string, config *compareConfig) {
+	if a == nil || b == nil {
+		if a != b {
+			c.add(path, "structure", a != nil, b != nil)
+		}
+		return
+	}
+	stage := a.Command
+	if stage == "" {
+		stage = a.Type.String()
+	}
+	path = treePath(path, stage)
+
+	if a.Type != b.Type || a.Command != b.Command {
+		c.add(path, "structure", stageName(a), stageName(b))
+		return
+	}
+	if a.ExitCode != b.ExitCode {
+		c.add(path, "exit code", a.ExitCode, b.ExitCode)
+	}
+	if a.Skipped != b.Skipped {
+		c.add(path, "skipped", a.Skipped, b.Skipped)
+	}
+	if config.relative > 0 && a.Duration > 0 {
+		change := b.Duration - a.Duration
+		if change.Abs() > config.absolute && float64(change.Abs())/float64(a.Duration) > config.relative {
+			c.add(path, "duration", a.Duration, fmt.Sprintf("%v (%+.0f%%)", b.Duration, 100*float64(change)/float64(a.Duration)))
+		}
+	}
+
+	// Only leaves are compared by output, parents repeat the output of a child
+	if len(a.Children) == 0 && len(b.Children) == 0 {
+		c.compareOutput(path, "stdout", a.Stdout, b.Stdout, config)
+		c.compareOutput(path, "stderr", a.Stderr, b.Stderr, config)
+	}
+
+	if len(a.Children) != len(b.Children) {
+		c.add(path, "structure", fmt.Sprintf("%d children", len(a.Children)), fmt.Sprintf("%d children", len(b.Children)))
+	}
+	for i := range min(len(a.Children), len(b.Children)) {
+		c.compare(a.Children[i], b.Children[i], path, config)
+	}
+}
+
+// compareOutput reports the first line that differs between a and b
+func (c *Comparison) compareOutput(path, field string, a, b []byte, config *compareConfig) {
+	if config.normalize != nil {
+		a, b = config.normalize(a), config.normalize(b)
+	}
+	if bytes.Equal(a, b) {
+		return
+	}
+	linesA, linesB := strings.SplitAfter(string(a), "\n"), strings.SplitAfter(string(b), "\n")
+	for i := 0; ; i++ {
+		var lineA, lineB string
+		if i < len(linesA) {
+			lineA = linesA[i]
+		}
+		if i < len(linesB) {
+			lineB = linesB[i]
+		}
+		if lineA != lineB {
+			c.add(path, fmt.Sprintf("%s line %d", field, i+1), fmt.Sprintf("%q", lineA), fmt.Sprintf("%q", lineB))
+			return
+		}
+	}
+}
+
+// stageName describes a result for structure differences
+func stageName(r *Result) string {
+	if r.Command == "" {
+		return r.Type.String()
+	}
+	return fmt.Sprintf("%s %q", r.Type, r.Command)
+}
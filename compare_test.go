@@ -0,0 +1,58 @@
+package subprocess
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	// Test: differences per stage are reported, normalized output is equal
+	stage := func(cmd, out string, code int, d time.Duration) *Result {
+		return &Result{Type: OpSingle, Command: cmd, Stdout: []byte(out), ExitCode: code, Duration: d}
+	}
+	pipe := func(left, right *Result) *Result {
+		return &Result{Type: OpPipe, Command: left.Command + " | " + right.Command, Children: []*Result{left, right}}
+	}
+
+	a := pipe(stage("gen", "a\nb\nbuilt at 10:00\n", 0, time.Second), stage("sort", "x\n", 0, 10*time.Millisecond))
+	b := pipe(stage("gen", "a\nc\nbuilt at 11:00\n", 0, 2*time.Second), stage("sort", "x\n", 1, 20*time.Millisecond))
+
+	diff := Compare(a, b, DurationThreshold(0.2, 100*time.Millisecond))
+	expected := []string{
+		`gen | sort > gen: duration: 1s -> 2s (+100%)`,
+		`gen | sort > gen: stdout line 2: "b\n" -> "c\n"`,
+		`gen | sort > sort: exit code: 0 -> 1`,
+	}
+	if diff.String() != strings.Join(expected, "\n") {
+		t.Errorf("unexpected differences:\n%s", diff)
+	}
+
+	// Durations are ignored by default, normalization hides volatile output
+	times := regexp.MustCompile(`\d\d:\d\d`)
+	a.Children[0].Stdout, b.Children[1].ExitCode = []byte("built at 10:00\n"), 0
+	b.Children[0].Stdout = []byte("built at 11:00\n")
+	diff = Compare(a, b, NormalizeOutput(func(out []byte) []byte { return times.ReplaceAll(out, []byte("TIME")) }))
+	if !diff.Equal() {
+		t.Errorf("expected no differences, got:\n%s", diff)
+	}
+
+	if diff := Compare(a, stage("gen", "", 0, 0)); diff.Equal() {
+		t.Error("expected a structure difference")
+	}
+}
+
+func TestCompareRuns(t *testing.T) {
+	// Test: two runs of the same pipeline differ only where the output does
+	ctx := context.Background()
+	echo, _ := NewExecutable("sh", "-c", "echo same; date +%N")
+	first, _ := echo.Run(ctx)
+	second, _ := echo.Run(ctx)
+
+	diff := Compare(first, second)
+	if len(diff.Differences) != 1 || diff.Differences[0].Field != "stdout line 2" {
+		t.Errorf("expected the second line to differ, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,257 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// FromCmd creates an Executable from the Path, Args, Dir, Env, Stdin, Stdout
+// and Stderr of an exec.Cmd. Stdout and Stderr receive the output as it is
+// read, like WithStdout and WithStderr, so it is also captured in the Result
+// The Cmd itself is never started, every Run starts a new process
+// It returns cmd.Err, such as the lookup error of exec.Command, and rejects a
+// Cmd already started or setting SysProcAttr, ExtraFiles, Cancel or
+// WaitDelay, which the Executable could not honour
+func FromCmd(cmd *exec.Cmd) (Executable, error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	if cmd.Process != nil {
+		return nil, errors.New("subprocess: FromCmd: Cmd already started")
+	}
+	var unsupported []string
+	if cmd.SysProcAttr != nil {
+		unsupported = append(unsupported, "SysProcAttr")
+	}
+	if len(cmd.ExtraFiles) > 0 {
+		unsupported = append(unsupported, "ExtraFiles")
+	}
+	if cmd.Cancel != nil {
+		unsupported = append(unsupported, "Cancel")
+	}
+	if cmd.WaitDelay != 0 {
+		unsupported = append(unsupported, "WaitDelay")
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("subprocess: FromCmd: %s not supported", strings.Join(unsupported, ", "))
+	}
+
+	var args []string
+	if len(cmd.Args) > 1 {
+		args = cmd.Args[1:]
+	}
+	opts := []Option{WithDir(cmd.Dir), WithEnv(cmd.Env...), WithStdin(cmd.Stdin)}
+	if cmd.Stdout != nil {
+		opts = append(opts, WithStdout(cmd.Stdout))
+	}
+	if cmd.Stderr != nil {
+		opts = append(opts, WithStderr(cmd.Stderr))
+	}
+	process, err := NewProcess(cmd.Path, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return FromProcess(process), nil
+}
+
+// Cmd mirrors the methods of exec.Cmd on top of an Executable, so code written
+// against os/exec can migrate to pipelines one call site at a time
+// Like with exec.Cmd, Stdout and Stderr receive the output streams of the
+// last stage apart
+type Cmd struct {
+	Stdout io.Writer // receives the stdout when set, like exec.Cmd.Stdout
+	Stderr io.Writer // receives the stderr when set, like exec.Cmd.Stderr
+
+	exec    Executable
+	ctx     context.Context
+	started bool
+
+	pipeReader *io.PipeReader // read end of StdoutPipe
+	pipeWriter *io.PipeWriter
+	done       chan struct{} // closed once the run finished
+	err        error
+}
+
+// NewCmd returns a Cmd that runs exec with ctx
+func NewCmd(ctx context.Context, exec Executable) *Cmd {
+	return &Cmd{exec: exec, ctx: ctx}
+}
+
+// Run starts the executable and waits for it to complete
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the executable and returns its stdout
+// Unless Stderr is set, the stderr of a failed run is in the Stderr of the
+// *exec.ExitError, like with exec.Cmd
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("subprocess: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	var stderr *bytes.Buffer
+	if c.Stderr == nil {
+		stderr = new(bytes.Buffer)
+		c.Stderr = stderr
+	}
+
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if stderr != nil && errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the executable and returns its stdout and stderr
+// in the order they were read
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("subprocess: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("subprocess: Stderr already set")
+	}
+	var out lockedBuffer
+	c.Stdout, c.Stderr = &out, &out
+	err := c.Run()
+	return out.buf.Bytes(), err
+}
+
+// StdoutPipe returns a pipe connected to the stdout once the executable starts
+// Like with exec.Cmd, all reads must complete before calling Wait
+// Only processes and pipes of processes can be streamed
+func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("subprocess: Stdout already set")
+	}
+	if c.started {
+		return nil, errors.New("subprocess: StdoutPipe after process started")
+	}
+	if !isStreamable(c.exec) {
+		return nil, errors.New("subprocess: StdoutPipe needs a process or a pipe")
+	}
+	c.pipeReader, c.pipeWriter = io.Pipe()
+	c.Stdout = c.pipeWriter
+	return c.pipeReader, nil
+}
+
+// Start starts the executable without waiting for it to complete
+// It runs with the settings of the executable, and a panic during the run is
+// returned by Wait as a *PanicError
+func (c *Cmd) Start() error {
+	if c.started {
+		return errors.New("subprocess: already started")
+	}
+	c.started = true
+	c.done = make(chan struct{})
+
+	started := make(chan error, 1)
+	visitor := newExecutionVisitor(c.ctx, settingsOf(c.exec))
+	go func() {
+		defer close(c.done)
+		_, c.err = visitor.run(c.exec, func() (*Result, error) {
+			return c.visit(visitor, started)
+		})
+		if c.pipeWriter != nil {
+			c.pipeWriter.Close()
+		}
+		// Reports a panic before the stages were started
+		select {
+		case started <- c.err:
+		default:
+		}
+	}()
+	return <-started
+}
+
+// visit runs the executable, writing its output to Stdout and Stderr, and
+// sends the error of starting it to started
+func (c *Cmd) visit(v *ExecutionVisitor, started chan<- error) (*Result, error) {
+	stdoutW, stderrW := c.Stdout, c.Stderr
+	if stdoutW == nil {
+		stdoutW = io.Discard
+	}
+	if stderrW == nil {
+		stderrW = io.Discard
+	}
+
+	if !isStreamable(c.exec) {
+		// Operators like And and Or only produce output once they complete
+		started <- nil
+		result, err := c.exec.Run(v.ctx)
+		if result != nil {
+			stdoutW.Write(result.Stdout)
+			stderrW.Write(result.Stderr)
+		}
+		return result, err
+	}
+
+	chain, failed, err := v.startChain(flattenPipe(c.exec))
+	started <- err
+	if err != nil {
+		return failed, err
+	}
+	chain.closeInput()
+	stopWatchdog := v.watchProgress(chain)
+
+	stdout, stderr := chain.streams()
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		io.Copy(stderrW, stderr)
+	}()
+	if _, err := io.Copy(stdoutW, stdout); err != nil {
+		// The reader of StdoutPipe was closed, the last stage gets SIGPIPE
+		chain.closeOutput()
+	}
+	<-stderrDone
+	result := v.finishChain(c.exec, chain, nil)
+	if err := stopWatchdog(); err != nil {
+		result.Error = err
+		result.ExitCode = -1
+	}
+	return result, result.Error
+}
+
+// Wait waits for the executable to complete and returns its error
+func (c *Cmd) Wait() error {
+	if !c.started {
+		return errors.New("subprocess: not started")
+	}
+	if c.pipeReader != nil {
+		// Drain what the caller did not read so no stage blocks on a full pipe
+		io.Copy(io.Discard, c.pipeReader)
+	}
+	<-c.done
+	return c.err
+}
+
+// lockedBuffer is a bytes.Buffer written by the stdout and stderr copies at once
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
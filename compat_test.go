@@ -0,0 +1,188 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFromCmd(t *testing.T) {
+	// Test: Args, Dir, Env, Stdout and Stderr of the exec.Cmd are used
+	cmd := exec.Command("sh", "-c", "pwd; echo $GREETING; echo oops >&2")
+	cmd.Dir = "/"
+	cmd.Env = []string{"GREETING=hello"}
+	var stdout, stderr strings.Builder
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	fromCmd, err := FromCmd(cmd)
+	if err != nil {
+		t.Fatalf("FromCmd failed: %v", err)
+	}
+	result, err := fromCmd.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "/\nhello\n" {
+		t.Errorf("unexpected output: %q", result.Stdout)
+	}
+	if stdout.String() != "/\nhello\n" || stderr.String() != "oops\n" {
+		t.Errorf("unexpected Stdout %q and Stderr %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestFromCmdErrors(t *testing.T) {
+	// Test: the error of the Cmd and fields the Executable cannot honour are
+	// returned instead of being dropped
+	started := exec.Command("true")
+	if err := started.Run(); err != nil {
+		t.Fatal(err)
+	}
+	withFiles := exec.Command("true")
+	withFiles.ExtraFiles = []*os.File{os.Stdin}
+	withAttr := exec.Command("true")
+	withAttr.SysProcAttr = &syscall.SysProcAttr{}
+	withAttr.WaitDelay = time.Second
+
+	tests := []struct {
+		cmd *exec.Cmd
+		err string
+	}{
+		{exec.Command("no-such-binary-xyz"), `exec: "no-such-binary-xyz": executable file not found in $PATH`},
+		{started, "subprocess: FromCmd: Cmd already started"},
+		{withFiles, "subprocess: FromCmd: ExtraFiles not supported"},
+		{withAttr, "subprocess: FromCmd: SysProcAttr, WaitDelay not supported"},
+	}
+	for _, tt := range tests {
+		if _, err := FromCmd(tt.cmd); err == nil || err.Error() != tt.err {
+			t.Errorf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestCmdOutput(t *testing.T) {
+	// Test: Output works on a pipe like on exec.Cmd
+	ctx := context.Background()
+	echo, _ := NewExecutable("echo", "hello")
+	tr, _ := NewExecutable("tr", "a-z", "A-Z")
+
+	out, err := NewCmd(ctx, echo.Pipe(tr)).Output()
+	if err != nil {
+		t.Fatalf("Output failed: %v", err)
+	}
+	if string(out) != "HELLO\n" {
+		t.Errorf("expected %q, got %q", "HELLO\n", out)
+	}
+
+	// Operators that are not streamed also work
+	ok, _ := NewExecutable("true")
+	done, _ := NewExecutable("echo", "done")
+	out, err = NewCmd(ctx, ok.And(done)).Output()
+	if err != nil || string(out) != "done\n" {
+		t.Errorf("unexpected And output: %q, %v", out, err)
+	}
+}
+
+func TestCmdOutputStreams(t *testing.T) {
+	// Test: Output returns stdout alone and the stderr of a failure in the *exec.ExitError
+	ctx := context.Background()
+	script := "echo out; echo err >&2; exit 2"
+	failing, _ := NewExecutable("sh", "-c", script)
+	echo, _ := NewExecutable("echo", "in")
+	cat, _ := NewExecutable("sh", "-c", "cat; "+script)
+
+	for executable, expected := range map[Executable]string{failing: "out\n", echo.Pipe(cat): "in\nout\n"} {
+		out, err := NewCmd(ctx, executable).Output()
+		if string(out) != expected {
+			t.Errorf("expected stdout %q, got %q", expected, out)
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("expected *exec.ExitError, got %v", err)
+		}
+		if string(exitErr.Stderr) != "err\n" {
+			t.Errorf("expected stderr in the exit error, got %q", exitErr.Stderr)
+		}
+	}
+
+	// CombinedOutput returns both streams
+	out, _ := NewCmd(ctx, failing).CombinedOutput()
+	if !strings.Contains(string(out), "out\n") || !strings.Contains(string(out), "err\n") {
+		t.Errorf("expected both streams, got %q", out)
+	}
+}
+
+func TestCmdPanic(t *testing.T) {
+	// Test: a panic while starting a pipe is recovered and returned as a PanicError
+	echo, _ := NewExecutable("echo", "hi")
+	cat, _ := NewExecutable("cat")
+	bad := When(func(context.Context) bool { panic("bad condition") }, echo)
+
+	err := NewCmd(context.Background(), bad.Pipe(cat)).Run()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "bad condition" {
+		t.Errorf("expected PanicError, got %v", err)
+	}
+}
+
+func TestCmdRunExitError(t *testing.T) {
+	// Test: failures surface as *exec.ExitError
+	failing, _ := NewExecutable("sh", "-c", "exit 4")
+
+	err := NewCmd(context.Background(), failing).Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected *exec.ExitError, got %v", err)
+	}
+	if exitErr.ExitCode() != 4 {
+		t.Errorf("expected exit code 4, got %d", exitErr.ExitCode())
+	}
+}
+
+func TestCmdStdoutPipe(t *testing.T) {
+	// Test: output is streamed while the pipeline runs
+	ctx := context.Background()
+	seq, _ := NewExecutable("seq", "1", "5")
+	grep, _ := NewExecutable("grep", "-v", "3")
+
+	cmd := NewCmd(ctx, seq.Pipe(grep))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	out, _ := io.ReadAll(stdout)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if string(out) != "1\n2\n4\n5\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestProcessRunnerCmd(t *testing.T) {
+	// Test: the underlying exec.Cmd is available from the runner
+	p, _ := NewProcess("echo", []string{"hi"})
+	runner, err := p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	io.ReadAll(runner.ReaderWriter())
+	runner.Wait()
+
+	cmd := runner.Cmd()
+	if cmd.ProcessState == nil || !cmd.ProcessState.Success() {
+		t.Error("expected a successful ProcessState")
+	}
+	if !strings.HasSuffix(cmd.Path, "echo") {
+		t.Errorf("unexpected path: %s", cmd.Path)
+	}
+}
@@ -0,0 +1,250 @@
+package subprocess
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compile translates exec into an equivalent standalone bash script, for
+// environments where the Go program cannot run. The script runs with
+// set -euo pipefail and kills the background jobs still running when it exits
+// Stages decided at run time (When, Unless, Lazy), routers, fan-ins,
+// processes reading Go values (WithStdin, embedded scripts) and options the
+// engine enforces while the process runs, such as limits, locks or stdin
+// policies, cannot be compiled and return an error. Options that only change
+// what the engine captures or reports, such as sinks, encodings or metadata,
+// are left out
+func Compile(exec Executable) (string, error) {
+	c := &compiler{}
+	body, err := c.compile(exec, "root")
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# Generated by subprocess.Compile\n")
+	b.WriteString("set -euo pipefail\n")
+	if c.background {
+		b.WriteString("trap 'jobs -p | xargs -r kill 2>/dev/null' EXIT\n")
+	}
+	b.WriteString(body + "\n")
+	if c.background {
+		// Like the engine, wait for background jobs without failing on them
+		b.WriteString("wait\n")
+	}
+	return b.String(), nil
+}
+
+// compiler translates a tree into shell syntax
+type compiler struct {
+	background bool // the script starts background jobs
+}
+
+// compile returns the shell syntax of exec, found at path in the tree
+func (c *compiler) compile(exec Executable, path string) (string, error) {
+	switch x := exec.(type) {
+	case *ExecutableProcess:
+		return compileProcess(x, path)
+
+	case *Builtin:
+		parts := []string{x.name}
+		for _, arg := range x.args {
+			parts = append(parts, shellQuote(arg))
+		}
+		return strings.Join(parts, " "), nil
+
+	case *Branch:
+		return c.compile(x.exec, path)
+
+	case *Pipeline:
+		if x.operation == OpPipe {
+			// a | b & runs as (a | b) &, which is also how the shell parses it
+			if stripped, ok := stripBackground(x); ok {
+				pipe, err := c.compile(stripped, path)
+				if err != nil {
+					return "", err
+				}
+				c.background = true
+				return "{ " + pipe + " & }", nil
+			}
+			var stages []string
+			for i, stage := range flattenPipe(x) {
+				s, err := c.group(stage, treePath(path, fmt.Sprintf("pipe stage %d", i+1)))
+				if err != nil {
+					return "", err
+				}
+				stages = append(stages, s)
+			}
+			return strings.Join(stages, " | "), nil
+		}
+
+		name := x.operation.String()
+		left, err := c.group(x.left, treePath(path, name+" left"))
+		if err != nil {
+			return "", err
+		}
+		switch x.operation {
+		case OpBackground:
+			c.background = true
+			return "{ " + left + " & }", nil
+		case OpRedirect:
+			if x.redirect == RedirectErrOut {
+				return left + " 2>&1", nil
+			}
+			return left + " " + x.redirect.String() + " " + shellQuote(x.path), nil
+		case OpAnd, OpOr, OpSeq:
+			right, err := c.group(x.right, treePath(path, name+" right"))
+			if err != nil {
+				return "", err
+			}
+			switch x.operation {
+			case OpAnd:
+				return left + " && " + right, nil
+			case OpOr:
+				return left + " || " + right, nil
+			}
+			// set -e would stop the script when left fails
+			return left + " || true; " + right, nil
+		}
+		return "", fmt.Errorf("%s: unknown operation %s", path, name)
+
+	case nil:
+		return "", fmt.Errorf("%s: nil executable", path)
+
+	default:
+		return "", fmt.Errorf("%s: %T cannot be compiled to a script", path, exec)
+	}
+}
+
+// group returns the shell syntax of exec, in braces if it is made of several
+// commands so the operators around it apply to it as a whole
+func (c *compiler) group(exec Executable, path string) (string, error) {
+	s, err := c.compile(exec, path)
+	if err != nil {
+		return "", err
+	}
+	if p, ok := exec.(*Pipeline); ok && p.operation != OpBackground {
+		return "{ " + s + "; }", nil
+	}
+	return s, nil
+}
+
+// compileProcess returns the command line of a process with its directory,
+// environment, umask, delay and timeout
+func compileProcess(ep *ExecutableProcess, path string) (string, error) {
+	ops := ep.process.ops
+	if option := uncompilableOption(ops); option != "" {
+		return "", fmt.Errorf("%s: %s cannot be compiled to a script", path, option)
+	}
+
+	var parts []string
+	if ops.Env != nil {
+		parts = append(parts, "env", "-i")
+		for _, kv := range processEnv(ops) {
+			parts = append(parts, shellQuote(kv))
+		}
+	} else if overrides := envOverrides(ops, []string{"PATH=" + inheritedPath}); len(overrides) > 0 {
+		parts = append(parts, "env")
+		for _, kv := range overrides {
+			// Directories added to PATH go in front of the PATH of the script
+			if prefix, ok := strings.CutSuffix(kv, inheritedPath); ok {
+				parts = append(parts, shellQuote(prefix)+`"$PATH"`)
+				continue
+			}
+			parts = append(parts, shellQuote(kv))
+		}
+	}
+	if ops.Timeout > 0 {
+		parts = append(parts, "timeout", shellSeconds(ops.Timeout))
+	}
+	parts = append(parts, shellQuote(resolveCommand(ops)))
+	for _, arg := range ops.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	switch {
+	case ops.StdinData != nil:
+		parts = append(parts, "< <(printf %s "+shellQuote(string(ops.StdinData))+")")
+	case ops.StdinFile != "":
+		parts = append(parts, "<", shellQuote(ops.StdinFile))
+	}
+	line := strings.Join(parts, " ")
+
+	if ops.Dir == "" && ops.Delay <= 0 && ops.Umask == nil {
+		return line, nil
+	}
+	if ops.Dir != "" || ops.Umask != nil {
+		line = "exec " + line
+	}
+	if ops.Umask != nil {
+		line = fmt.Sprintf("umask %04o && %s", *ops.Umask, line)
+	}
+	if ops.Dir != "" {
+		line = "cd " + shellQuote(ops.Dir) + " && " + line
+	}
+	if ops.Delay > 0 {
+		line = "sleep " + strings.TrimSuffix(shellSeconds(ops.Delay), "s") + " && " + line
+	}
+	return "(" + line + ")", nil
+}
+
+// inheritedPath stands for the PATH of the script when computing the
+// environment of a process that inherits it
+const inheritedPath = "\x00PATH"
+
+// uncompilableOption names an option of ops that the engine enforces while
+// the process runs and a script cannot reproduce, or returns ""
+func uncompilableOption(ops *Options) string {
+	switch {
+	case ops.Stdin != nil:
+		return "WithStdin"
+	case ops.Script != nil:
+		return "an embedded script"
+	case ops.RawCmdLine != "":
+		return "WithRawCmdLine"
+	case ops.PTY:
+		return "WithPTY"
+	case len(ops.Ports) > 0:
+		return "WithPorts"
+	case ops.StdinPolicy != StdinCloseOnEOF:
+		return "WithStdinPolicy"
+	case ops.NoNetwork:
+		return "WithNoNetwork"
+	case ops.CPULimit > 0:
+		return "WithCPULimit"
+	case ops.MemoryLimit > 0:
+		return "WithMemoryLimit"
+	case ops.DiskLimit != nil:
+		return "WithDiskLimit"
+	case ops.OutputLimit == OutputFail:
+		return "WithOutputLimitPolicy(OutputFail)"
+	case ops.DeadlineNotice != nil:
+		return "WithDeadlineNotice"
+	case ops.Heartbeat != nil:
+		return "WithHeartbeat"
+	case ops.MutexKey != "":
+		return "WithMutexKey"
+	case ops.LockFile != "":
+		return "WithLockFile"
+	case ops.LoadThrottle != nil:
+		return "WithLoadThrottle"
+	case ops.FakeTime != nil:
+		return "WithFakeTime"
+	case ops.ProcessGroup:
+		return "WithProcessGroup"
+	case ops.CancelSignal != nil || ops.KillDelay > 0:
+		return "WithCancelSignal"
+	case len(ops.Diagnostics) > 0:
+		return "WithDiagnostics"
+	case ops.chaos != nil:
+		return "InjectChaos"
+	}
+	return ""
+}
+
+// shellSeconds formats d as seconds for timeout and sleep
+func shellSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
@@ -0,0 +1,101 @@
+package subprocess
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	// Test: the script prints the same output and exits like the run
+	echo := func(s string) Executable {
+		e, _ := NewExecutable("echo", s)
+		return e
+	}
+	fail, _ := NewExecutable("sh", "-c", "echo failing; exit 3")
+	tr, _ := NewExecutable("tr", "a-z", "A-Z")
+	pwd, _ := Command("pwd", nil, WithDir("/"))
+	stdin, _ := Command("cat", nil, WithStdinString("it's\nhere"))
+	env, _ := Command("sh", []string{"-c", "echo $GREETING"}, WithEnvOverrides(map[string]string{"GREETING": "hello world"}))
+	tools := NewToolchain().Tool("greet", "/bin/echo").Prepend("/opt/tools")
+	tool, _ := Command("greet", []string{"hi"}, WithToolchain(tools))
+	path, _ := Command("sh", []string{"-c", "echo $PATH"}, WithToolchain(tools))
+	umask, _ := Command("sh", []string{"-c", "umask"}, WithUmask(0o027), WithDir("/"))
+	color, _ := Command("sh", []string{"-c", "echo $NO_COLOR"}, WithColor(ColorNever))
+
+	tests := []struct {
+		name string
+		exec Executable
+	}{
+		{"and", echo("a").And(echo("b"))},
+		{"or recovers", fail.Or(echo("recovered"))},
+		{"and stops", fail.And(echo("skipped"))},
+		{"pipe", echo("shout").Pipe(tr)},
+		{"grouping", fail.Or(echo("x")).Pipe(tr).And(echo("y"))},
+		{"builtins", Test("-d", "/").And(True()).And(echo("dir"))},
+		{"dir", pwd},
+		{"env", env},
+		{"toolchain", tool},
+		{"toolchain path", path},
+		{"umask", umask},
+		{"color", color},
+		{"background", echo("bg").Background().And(echo("fg"))},
+		{"stdin", stdin.Pipe(tr)},
+		{"redirect", fail.RedirectStderrToStdout().Or(echo("x").RedirectStderr("/dev/null"))},
+		{"then", fail.Then(echo("after"))},
+		{"then fails", echo("a").And(echo("b")).Then(fail)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Compile(tt.exec)
+			if err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			result, _ := tt.exec.Run(context.Background())
+
+			out, err := exec.Command("bash", "-c", script).Output()
+			code := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			}
+			if code != result.ExitCode {
+				t.Errorf("expected exit code %d, got %d\n%s", result.ExitCode, code, script)
+			}
+			// The run reports the output of the last stage, the script prints everything
+			if !strings.Contains(string(out), string(result.Stdout)) {
+				t.Errorf("expected output containing %q, got %q\n%s", result.Stdout, out, script)
+			}
+		})
+	}
+}
+
+func TestCompileUnsupported(t *testing.T) {
+	// Test: stages decided at run time are reported with their path
+	echo, _ := NewExecutable("echo", "hi")
+	timed, _ := Command("sleep", []string{"1"}, WithTimeout(1500*time.Millisecond))
+
+	if _, err := Compile(echo.And(When(func(context.Context) bool { return true }, echo))); err == nil || !strings.Contains(err.Error(), "and right") {
+		t.Errorf("expected an error for When, got %v", err)
+	}
+
+	for name, opt := range map[string]Option{
+		"WithNoNetwork":   WithNoNetwork(),
+		"WithCPULimit":    WithCPULimit(time.Second),
+		"WithMemoryLimit": WithMemoryLimit(1 << 30),
+		"WithStdinPolicy": WithStdinPolicy(StdinKeepOpen),
+		"WithLockFile":    WithLockFile("/tmp/lock"),
+	} {
+		limited, _ := Command("echo", []string{"hi"}, opt)
+		if _, err := Compile(echo.And(limited)); err == nil || !strings.Contains(err.Error(), "and right: "+name+" cannot be compiled") {
+			t.Errorf("expected an error for %s, got %v", name, err)
+		}
+	}
+
+	script, err := Compile(timed)
+	if err != nil || !strings.Contains(script, "timeout 1.5s sleep 1") {
+		t.Errorf("expected a timeout command, got %q, %v", script, err)
+	}
+}
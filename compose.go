@@ -0,0 +1,165 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Runnable is the part of Executable a stage implemented outside the package
+// has to provide, Compose adds the rest
+type Runnable interface {
+	Run(ctx context.Context) (*Result, error)
+}
+
+// Compose turns r into an Executable, for stages implemented in Go outside
+// the package. The stage composes like the executables of the package and
+// gets the settings of its Executable methods, such as WithShutdownTimeout,
+// which apply to what it runs through the package
+// String describes the stage with the String method of r, if it has one
+func Compose(r Runnable) Executable {
+	c := &composed{r: r}
+	c.node = newNode(c)
+	return c
+}
+
+// composed is a Runnable made an Executable by Compose
+type composed struct {
+	node
+	r Runnable
+}
+
+// Run runs the stage with the settings of the node, recovering its panics
+func (c *composed) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, c.settings)
+	return visitor.run(c, func() (*Result, error) {
+		return c.r.Run(ctx)
+	})
+}
+
+// String describes the wrapped stage
+func (c *composed) String() string {
+	if s, ok := c.r.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", c.r)
+}
+
+func (c *composed) configure(edit func(*settings)) Executable {
+	clone := *c
+	clone.self = &clone
+	edit(&clone.settings)
+	return &clone
+}
+
+// node holds the settings every executable of the package carries and
+// implements the composition methods of Executable once, on top of the
+// executable it is embedded in
+type node struct {
+	self     Executable // the executable the node is embedded in
+	settings settings
+}
+
+// newNode returns the node of self, with the settings taken from Defaults
+func newNode(self Executable) node {
+	return node{self: self, settings: defaultSettings()}
+}
+
+// configurable is implemented by the executables embedding a node
+type configurable interface {
+	// configure returns a copy of the executable with edit applied to its
+	// settings, and to the ones of the executables it wraps if any
+	configure(edit func(*settings)) Executable
+	nodeSettings() settings
+}
+
+func (n *node) nodeSettings() settings {
+	return n.settings
+}
+
+// configureExec applies edit to the settings of a copy of exec. Executables
+// implemented outside the package without Compose are returned as they are
+func configureExec(exec Executable, edit func(*settings)) Executable {
+	if c, ok := exec.(configurable); ok {
+		return c.configure(edit)
+	}
+	return exec
+}
+
+// Pipe creates a pipeline that pipes output to the next executable
+func (n *node) Pipe(next Executable) Executable {
+	return newPipeline(OpPipe, n.self, next, n.settings)
+}
+
+// And creates a pipeline that runs next only if this succeeds
+func (n *node) And(next Executable) Executable {
+	return newPipeline(OpAnd, n.self, next, n.settings)
+}
+
+// Or creates a pipeline that runs next only if this fails
+func (n *node) Or(next Executable) Executable {
+	return newPipeline(OpOr, n.self, next, n.settings)
+}
+
+// Then creates a pipeline that runs next after this, whether this succeeds or not
+func (n *node) Then(next Executable) Executable {
+	return newPipeline(OpSeq, n.self, next, n.settings)
+}
+
+// Background creates a pipeline that runs this in the background
+func (n *node) Background() Executable {
+	return newPipeline(OpBackground, n.self, nil, n.settings)
+}
+
+// RedirectStdout creates a pipeline that writes the stdout of this to path
+func (n *node) RedirectStdout(path string) Executable {
+	return newRedirect(n.self, n.settings, RedirectOut, path)
+}
+
+// AppendStdout creates a pipeline that appends the stdout of this to path
+func (n *node) AppendStdout(path string) Executable {
+	return newRedirect(n.self, n.settings, RedirectAppend, path)
+}
+
+// RedirectStderr creates a pipeline that writes the stderr of this to path
+func (n *node) RedirectStderr(path string) Executable {
+	return newRedirect(n.self, n.settings, RedirectErr, path)
+}
+
+// RedirectStderrToStdout creates a pipeline that captures the stderr of this after its stdout
+func (n *node) RedirectStderrToStdout() Executable {
+	return newRedirect(n.self, n.settings, RedirectErrOut, "")
+}
+
+// WithShutdownTimeout sets the graceful shutdown timeout
+func (n *node) WithShutdownTimeout(timeout time.Duration) Executable {
+	return configureExec(n.self, func(s *settings) {
+		s.shutdownTimeout = timeout
+	})
+}
+
+// WithProgressTimeout sets how long pipes may go without progress before failing
+func (n *node) WithProgressTimeout(timeout time.Duration) Executable {
+	return configureExec(n.self, func(s *settings) {
+		s.progressTimeout = timeout
+	})
+}
+
+// Reader returns the output of this as an io.Reader, starting it on the first Read
+// A failed run is reported by the final Read, Close stops a run still in progress
+func (n *node) Reader(ctx context.Context) io.ReadCloser {
+	return newExecReader(ctx, n.self)
+}
+
+// Writer returns an io.Writer that feeds the stdin of this, starting it on the first Write
+// Close signals EOF and returns the error of the run
+func (n *node) Writer(ctx context.Context) io.WriteCloser {
+	return newExecWriter(ctx, n.self)
+}
+
+// Validate checks the tree without running it and returns a *ValidationError
+// listing every problem found, such as missing binaries or invalid timeouts
+func (n *node) Validate() error {
+	return validate(n.self)
+}
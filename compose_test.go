@@ -0,0 +1,66 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// upper is a stage implemented outside the package, it only provides Run
+type upper struct{}
+
+func (upper) Run(ctx context.Context) (*Result, error) {
+	return &Result{Type: OpSingle, Stdout: []byte("UP\n")}, nil
+}
+
+func TestCompose(t *testing.T) {
+	ctx := context.Background()
+	cat, _ := NewExecutable("cat")
+	stage := Compose(upper{})
+
+	// Test: a composed stage runs in a pipe like the executables of the package
+	result, err := stage.Pipe(cat).Run(ctx)
+	if err != nil || string(result.Stdout) != "UP\n" {
+		t.Errorf("expected UP from the pipe, got %q, %v", result.Stdout, err)
+	}
+	if got := stage.And(cat).(*Pipeline).String(); got != "subprocess.upper && cat" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	// Test: its settings are read like the ones of the package executables
+	configured := stage.WithShutdownTimeout(3 * time.Second)
+	if settingsOf(configured).shutdownTimeout != 3*time.Second || settingsOf(stage).shutdownTimeout != Defaults.ShutdownTimeout {
+		t.Error("expected WithShutdownTimeout to configure a copy")
+	}
+
+	// Test: a panicking stage fails like the package executables do
+	boom := Compose(panicking{})
+	if _, err := boom.Run(ctx); !errors.As(err, new(*PanicError)) {
+		t.Errorf("expected a PanicError, got %v", err)
+	}
+}
+
+type panicking struct{}
+
+func (panicking) Run(ctx context.Context) (*Result, error) {
+	panic("boom")
+}
+
+func TestNodeSelf(t *testing.T) {
+	// Test: composing a configured copy uses the copy, not the original
+	echo, _ := NewExecutable("echo", "a")
+	for _, exec := range []Executable{
+		echo, True(), echo.Pipe(echo), Cancellable(echo), FanIn(echo), Lazy(nil),
+		Parallel(echo), Route(echo), When(nil, echo), Compose(upper{}),
+	} {
+		configured := exec.WithProgressTimeout(time.Minute)
+		pipe := configured.Then(echo).(*Pipeline)
+		if pipe.left != configured || pipe.settings.progressTimeout != time.Minute {
+			t.Errorf("%T: expected the pipe to start with the configured copy", exec)
+		}
+		if settingsOf(exec).progressTimeout == time.Minute {
+			t.Errorf("%T: expected the original to keep its settings", exec)
+		}
+	}
+}
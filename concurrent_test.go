@@ -0,0 +1,82 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// runConcurrently runs exec from n goroutines and checks every output
+func runConcurrently(t *testing.T, exec Executable, n int, want string) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(result.Stdout) != want {
+				errs <- fmt.Errorf("output = %q, want %q", result.Stdout, want)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConcurrentReuse(t *testing.T) {
+	echo, _ := NewExecutable("echo", "hello")
+	upper, _ := NewExecutable("tr", "a-z", "A-Z")
+	fail, _ := NewExecutable("false")
+	cat, _ := NewExecutable("cat")
+	lines, _ := NewExecutable("printf", "a\\nb\\n")
+	sleep, _ := NewExecutable("sleep", "0.01")
+
+	tests := []struct {
+		name string
+		exec Executable
+		want string
+	}{
+		{"process", echo, "hello\n"},
+		{"pipe", echo.Pipe(upper).Pipe(cat), "HELLO\n"},
+		{"and", fail.Or(echo).And(echo), "hello\n"},
+		{"or", fail.Or(echo), "hello\n"},
+		{"background", sleep.Background().And(echo), "hello\n"},
+		{"route", Route(lines).When("^a", upper).Pipe(cat), "A\n"},
+		{"fan-in", FanIn(echo, echo).Mode(MergeOrdered), "hello\nhello\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runConcurrently(t, tt.exec, 8, tt.want)
+		})
+	}
+}
+
+func TestNewProcessCopiesSlices(t *testing.T) {
+	// Test: changing the caller's slices after construction has no effect
+	args := []string{"-c", "echo $VALUE $0", "original"}
+	env := []string{"VALUE=original"}
+	echo, _ := Command("sh", args, WithEnv(env...))
+
+	env[0] = "VALUE=changed"
+	args[2] = "changed"
+
+	result, err := echo.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "original original\n" {
+		t.Errorf("unexpected output: %q", result.Stdout)
+	}
+}
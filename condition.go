@@ -0,0 +1,226 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Test returns a builtin that evaluates a condition like test(1) and [ ]
+// It succeeds when the expression is true, fails with exit code 1 when it is
+// false and with exit code 2 when the expression is malformed
+//
+// Supported: ! expr, expr -a expr, expr -o expr, ( expr ), string tests
+// (-n, -z, =, !=, <, >), integer comparisons (-eq, -ne, -lt, -le, -gt, -ge)
+// and file tests (-e, -f, -d, -s, -L, -h, -r, -w, -x). Permission tests only
+// look at the mode bits, so they behave the same on every platform
+func Test(args ...string) Executable {
+	args = slices.Clone(args)
+	cond, err := parseCondition(args)
+	b := newBuiltin("test", args, func() int {
+		if cond() {
+			return 0
+		}
+		return 1
+	})
+	b.err = err
+	return b
+}
+
+// condParser parses test(1) arguments into a condition
+type condParser struct {
+	args []string
+	pos  int
+}
+
+// parseCondition parses args, an empty expression is false
+func parseCondition(args []string) (func() bool, error) {
+	if len(args) == 0 {
+		return func() bool { return false }, nil
+	}
+	p := &condParser{args: args}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(args) {
+		return nil, fmt.Errorf("test: unexpected argument %q", args[p.pos])
+	}
+	return cond, nil
+}
+
+// peek returns the next argument without consuming it
+func (p *condParser) peek() string {
+	if p.pos < len(p.args) {
+		return p.args[p.pos]
+	}
+	return ""
+}
+
+func (p *condParser) or() (func() bool, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.args) && p.peek() == "-o" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func() bool { return l() || right() }
+	}
+	return left, nil
+}
+
+func (p *condParser) and() (func() bool, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.args) && p.peek() == "-a" {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func() bool { return l() && right() }
+	}
+	return left, nil
+}
+
+func (p *condParser) not() (func() bool, error) {
+	if p.pos < len(p.args)-1 && p.peek() == "!" {
+		p.pos++
+		cond, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func() bool { return !cond() }, nil
+	}
+	return p.primary()
+}
+
+func (p *condParser) primary() (func() bool, error) {
+	if p.pos >= len(p.args) {
+		return nil, fmt.Errorf("test: missing argument")
+	}
+
+	if p.peek() == "(" && p.pos < len(p.args)-1 {
+		p.pos++
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" || p.pos >= len(p.args) {
+			return nil, fmt.Errorf("test: missing )")
+		}
+		p.pos++
+		return cond, nil
+	}
+
+	arg := p.args[p.pos]
+	p.pos++
+
+	// arg op operand
+	if p.pos < len(p.args)-1 {
+		if cond, ok, err := binaryCondition(arg, p.args[p.pos], p.args[p.pos+1]); ok {
+			p.pos += 2
+			return cond, err
+		}
+	}
+
+	// op operand
+	if p.pos < len(p.args) {
+		if cond, ok := unaryCondition(arg, p.args[p.pos]); ok {
+			p.pos++
+			return cond, nil
+		}
+	}
+
+	// A lone string is true when it is not empty
+	return func() bool { return arg != "" }, nil
+}
+
+// unaryCondition returns the condition for a unary operator, if op is one
+func unaryCondition(op, operand string) (func() bool, bool) {
+	stat := func(check func(os.FileInfo) bool) func() bool {
+		return func() bool {
+			info, err := os.Stat(operand)
+			return err == nil && check(info)
+		}
+	}
+
+	switch op {
+	case "-n":
+		return func() bool { return operand != "" }, true
+	case "-z":
+		return func() bool { return operand == "" }, true
+	case "-e":
+		return stat(func(os.FileInfo) bool { return true }), true
+	case "-f":
+		return stat(func(info os.FileInfo) bool { return info.Mode().IsRegular() }), true
+	case "-d":
+		return stat(func(info os.FileInfo) bool { return info.IsDir() }), true
+	case "-s":
+		return stat(func(info os.FileInfo) bool { return info.Size() > 0 }), true
+	case "-r":
+		return stat(func(info os.FileInfo) bool { return info.Mode().Perm()&0444 != 0 }), true
+	case "-w":
+		return stat(func(info os.FileInfo) bool { return info.Mode().Perm()&0222 != 0 }), true
+	case "-x":
+		return stat(func(info os.FileInfo) bool { return info.Mode().Perm()&0111 != 0 }), true
+	case "-L", "-h":
+		return func() bool {
+			info, err := os.Lstat(operand)
+			return err == nil && info.Mode()&os.ModeSymlink != 0
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+// binaryCondition returns the condition for a binary operator, if op is one
+func binaryCondition(left, op, right string) (func() bool, bool, error) {
+	switch op {
+	case "=", "==":
+		return func() bool { return left == right }, true, nil
+	case "!=":
+		return func() bool { return left != right }, true, nil
+	case "<":
+		return func() bool { return left < right }, true, nil
+	case ">":
+		return func() bool { return left > right }, true, nil
+	}
+
+	var compare func(a, b int64) bool
+	switch op {
+	case "-eq":
+		compare = func(a, b int64) bool { return a == b }
+	case "-ne":
+		compare = func(a, b int64) bool { return a != b }
+	case "-lt":
+		compare = func(a, b int64) bool { return a < b }
+	case "-le":
+		compare = func(a, b int64) bool { return a <= b }
+	case "-gt":
+		compare = func(a, b int64) bool { return a > b }
+	case "-ge":
+		compare = func(a, b int64) bool { return a >= b }
+	default:
+		return nil, false, nil
+	}
+
+	a, err := strconv.ParseInt(left, 10, 64)
+	if err != nil {
+		return nil, true, fmt.Errorf("test: integer expression expected: %q", left)
+	}
+	b, err := strconv.ParseInt(right, 10, 64)
+	if err != nil {
+		return nil, true, fmt.Errorf("test: integer expression expected: %q", right)
+	}
+	return func() bool { return compare(a, b) }, true, nil
+}
@@ -0,0 +1,120 @@
+package subprocess
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const (
+	crashTailSize       = 4096                  // bytes of output kept for crash reports
+	crashSampleInterval = 50 * time.Millisecond // how often /proc status is sampled
+)
+
+// CrashReport is the postmortem bundle of a process killed by a crash signal
+type CrashReport struct {
+	Signal      syscall.Signal // signal that killed the process, like SIGSEGV or SIGABRT
+	CorePattern string         // kernel core pattern, where the core dump went
+	CoreFile    string         // core file found in the working directory, if any
+	OutputTail  []byte         // last bytes of output read from the process
+	Status      string         // last /proc/<pid>/status sampled before the crash
+}
+
+// crashSignals are the signals reported in a CrashReport
+var crashSignals = []syscall.Signal{
+	syscall.SIGSEGV, syscall.SIGABRT, syscall.SIGBUS, syscall.SIGILL, syscall.SIGFPE,
+}
+
+// WithCrashReport attaches a CrashReport to Result.Crash when the process dies
+// from a crash signal like SIGSEGV or SIGABRT, for postmortem analysis of native
+// tools. The /proc status is sampled while the process runs, so it may be a few
+// milliseconds old. The status and core pattern are only collected on Linux
+func WithCrashReport() Option {
+	return func(o *Options) {
+		o.CrashReport = true
+	}
+}
+
+// sampleStatus keeps the latest /proc status of the process until it exits
+func (p *ProcessRunner) sampleStatus() {
+	pid := p.cmd.Process.Pid
+	ticker := time.NewTicker(crashSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		if status := procStatus(pid); status != "" {
+			p.mu.Lock()
+			p.lastStatus = status
+			p.mu.Unlock()
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CrashReport returns the crash bundle of a process started with WithCrashReport
+// that was killed by a crash signal, or nil. It is only valid after Wait returns
+func (p *ProcessRunner) CrashReport() *CrashReport {
+	if p.tail == nil || !p.exited() {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(p.err, &exitErr) {
+		return nil
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || !isCrashSignal(status.Signal()) {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &CrashReport{
+		Signal:      status.Signal(),
+		CorePattern: corePattern(),
+		CoreFile:    findCoreFile(p.cmd.Dir, p.cmd.Process.Pid),
+		OutputTail:  append([]byte(nil), p.tail.data...),
+		Status:      p.lastStatus,
+	}
+}
+
+// isCrashSignal reports whether sig is one of crashSignals
+func isCrashSignal(sig syscall.Signal) bool {
+	for _, s := range crashSignals {
+		if sig == s {
+			return true
+		}
+	}
+	return false
+}
+
+// outputTail keeps the last crashTailSize bytes read from the process
+type outputTail struct {
+	data []byte
+}
+
+// tailReader records what is read from r in the tail of runner
+type tailReader struct {
+	r      io.Reader
+	runner *ProcessRunner
+}
+
+func (t *tailReader) Read(b []byte) (int, error) {
+	n, err := t.r.Read(b)
+	if n > 0 {
+		t.runner.mu.Lock()
+		tail := append(t.runner.tail.data, b[:n]...)
+		if len(tail) > crashTailSize {
+			tail = append([]byte(nil), tail[len(tail)-crashTailSize:]...)
+		}
+		t.runner.tail.data = tail
+		t.runner.mu.Unlock()
+	}
+	return n, err
+}
@@ -0,0 +1,45 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// procStatus returns the content of /proc/<pid>/status, or "" once it is gone
+func procStatus(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// corePattern returns the kernel core pattern, like "core" or "|/usr/lib/systemd/systemd-coredump ..."
+func corePattern() string {
+	data, err := os.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// findCoreFile returns the core file left by pid in dir, if the core pattern
+// writes core files to the working directory
+func findCoreFile(dir string, pid int) string {
+	pattern := corePattern()
+	if pattern == "" || strings.HasPrefix(pattern, "|") || strings.Contains(pattern, "/") {
+		return ""
+	}
+	for _, name := range []string{fmt.Sprintf("core.%d", pid), "core"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			if abs, err := filepath.Abs(path); err == nil {
+				return abs
+			}
+			return path
+		}
+	}
+	return ""
+}
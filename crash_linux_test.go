@@ -0,0 +1,38 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCrashReport(t *testing.T) {
+	// Test: a process killed by SIGSEGV gets a crash bundle, a plain failure does not
+	ctx := context.Background()
+	crashing, _ := Command("sh", []string{"-c", "ulimit -c 0; echo before crash; sleep 0.2; kill -SEGV $$"},
+		WithCrashReport())
+
+	result, err := crashing.Run(ctx)
+	if err == nil {
+		t.Fatal("expected crashing process to fail")
+	}
+	crash := result.Crash
+	if crash == nil {
+		t.Fatal("expected a crash report")
+	}
+	if crash.Signal != syscall.SIGSEGV {
+		t.Errorf("expected SIGSEGV, got %v", crash.Signal)
+	}
+	if !strings.Contains(string(crash.OutputTail), "before crash") {
+		t.Errorf("expected output tail, got %q", crash.OutputTail)
+	}
+	if !strings.Contains(crash.Status, "Pid:") {
+		t.Errorf("expected /proc status, got %q", crash.Status)
+	}
+
+	failing, _ := Command("sh", []string{"-c", "exit 3"}, WithCrashReport())
+	if result, _ := failing.Run(ctx); result.Crash != nil {
+		t.Errorf("expected no crash report for a plain failure, got %+v", result.Crash)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package subprocess
+
+func procStatus(pid int) string {
+	return ""
+}
+
+func corePattern() string {
+	return ""
+}
+
+func findCoreFile(dir string, pid int) string {
+	return ""
+}
@@ -0,0 +1,54 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// fGetPipeSize is F_GETPIPE_SZ, the capacity of a pipe in bytes
+const fGetPipeSize = 1032
+
+// pipeFull reports whether the pipe f holds as many bytes as it can, so its
+// writers block. It reports false when f is not a pipe
+func pipeFull(f *os.File) bool {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	full := false
+	conn.Control(func(fd uintptr) {
+		size, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fGetPipeSize, 0)
+		if errno != 0 {
+			return
+		}
+		var pending int32
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCINQ, uintptr(unsafe.Pointer(&pending))); errno != 0 {
+			return
+		}
+		full = int(pending) >= int(size)
+	})
+	return full
+}
+
+// writingPipe reports whether a thread of pid or of its descendants is
+// blocked writing to a pipe, according to /proc/<pid>/task/<tid>/wchan
+func writingPipe(pid int) bool {
+	tasks, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", pid))
+	for _, task := range tasks {
+		if wchan, err := os.ReadFile(filepath.Join(task, "wchan")); err == nil && strings.Contains(string(wchan), "pipe_write") {
+			return true
+		}
+		children, _ := os.ReadFile(filepath.Join(task, "children"))
+		for _, child := range strings.Fields(string(children)) {
+			if child, err := strconv.Atoi(child); err == nil && writingPipe(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
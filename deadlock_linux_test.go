@@ -0,0 +1,38 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlock(t *testing.T) {
+	// Test: a stage filling its stderr while the engine waits for its stdout
+	// is reported as deadlocked long before the progress timeout
+	ctx := context.Background()
+	noisy, _ := NewExecutable("sh", "-c", "head -c 200000 /dev/zero >&2; echo done")
+	cat, _ := NewExecutable("cat")
+
+	start := time.Now()
+	_, err := noisy.Pipe(cat).WithProgressTimeout(10 * time.Second).Run(ctx)
+	var deadlock *DeadlockError
+	if !errors.As(err, &deadlock) {
+		t.Fatalf("expected DeadlockError, got: %v", err)
+	}
+	if duration := time.Since(start); duration > 2*time.Second {
+		t.Errorf("deadlock detection took too long: %v", duration)
+	}
+	if len(deadlock.Stages) != 1 || !strings.HasPrefix(deadlock.Stages[0], "sh -c") || !strings.Contains(deadlock.Stages[0], "stderr") {
+		t.Errorf("unexpected stuck stages: %v", deadlock.Stages)
+	}
+
+	// Test: a slow consumer with full pipes is backpressure, not a deadlock
+	producer, _ := NewExecutable("sh", "-c", "head -c 200000 /dev/zero")
+	slow, _ := NewExecutable("sh", "-c", "sleep 0.5; wc -c")
+	result, err := producer.Pipe(slow).WithProgressTimeout(10 * time.Second).Run(ctx)
+	if err != nil || strings.TrimSpace(string(result.Stdout)) != "200000" {
+		t.Errorf("expected the slow pipe to finish, got %q, %v", result.Stdout, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package subprocess
+
+import "os"
+
+// pipeFull reports false, the fill level of pipes is only read on Linux
+func pipeFull(f *os.File) bool {
+	return false
+}
+
+// writingPipe reports false, blocked writers are only found on Linux
+func writingPipe(pid int) bool {
+	return false
+}
@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Config holds the package level defaults picked up by new Executables
+type Config struct {
+	ShutdownTimeout time.Duration // graceful shutdown timeout
+	ProgressTimeout time.Duration // fail pipes that make no progress for this long, 0 disables
+	MaxOutput       int64         // captured output of a result is truncated to this many bytes, 0 is unlimited
+	Logger          *slog.Logger  // receives process start and exit events at debug level, nil disables logging
+	Env             []string      // environment of new processes in "key=value" form, nil inherits it
+	Repanic         bool          // raise panics again after stopping stages instead of returning a PanicError
+	Proxy           *Proxy        // proxy settings added to the environment of new processes, nil adds none
+	Toolchain       *Toolchain    // resolves the commands of new processes, nil uses PATH
+}
+
+// Defaults are picked up by every Process and Executable created afterwards
+// Set them once at program start, before creating executables; they are not
+// safe to change while other goroutines create executables
+var Defaults = Config{
+	ShutdownTimeout: 5 * time.Second,
+}
+
+// readOutput reads r to EOF, keeping at most max bytes when max is positive,
+// and reports whether output was dropped. exceeded, if set, is called as soon
+// as r has more than max bytes. The rest is drained so the producer never
+// blocks on a full pipe
+func readOutput(r io.Reader, max int64, exceeded func()) ([]byte, bool) {
+	if max <= 0 {
+		output, _ := io.ReadAll(r)
+		return output, false
+	}
+	output, _ := io.ReadAll(io.LimitReader(r, max+1))
+	if int64(len(output)) <= max {
+		return output, false
+	}
+	if exceeded != nil {
+		exceeded()
+	}
+	io.Copy(io.Discard, r)
+	return output[:max], true
+}
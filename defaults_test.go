@@ -0,0 +1,62 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaults(t *testing.T) {
+	// Test: executables created after setting Defaults pick them up
+	saved := Defaults
+	defer func() { Defaults = saved }()
+
+	var logs bytes.Buffer
+	Defaults = Config{
+		ShutdownTimeout: time.Second,
+		MaxOutput:       5,
+		Logger:          slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Env:             []string{"GREETING=hello world"},
+	}
+
+	echo, _ := NewExecutable("sh", "-c", "echo $GREETING")
+	result, err := echo.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "hello" {
+		t.Errorf("expected output truncated to %q, got %q", "hello", result.Stdout)
+	}
+
+	for _, event := range []string{"process started", "process exited"} {
+		if !strings.Contains(logs.String(), event) {
+			t.Errorf("expected log to contain %q, got: %s", event, logs.String())
+		}
+	}
+
+	ep := echo.(*ExecutableProcess)
+	if ep.settings.shutdownTimeout != time.Second {
+		t.Errorf("expected shutdown timeout 1s, got %v", ep.settings.shutdownTimeout)
+	}
+}
+
+func TestDefaultsMaxOutputPipe(t *testing.T) {
+	// Test: the limit applies to pipes without blocking the producer
+	saved := Defaults
+	defer func() { Defaults = saved }()
+	Defaults.MaxOutput = 3
+
+	seq, _ := NewExecutable("seq", "1", "100000")
+	cat, _ := NewExecutable("cat")
+
+	result, err := seq.Pipe(cat).Run(context.Background())
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	if string(result.Stdout) != "1\n2" {
+		t.Errorf("expected truncated output, got %q", result.Stdout)
+	}
+}
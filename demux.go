@@ -0,0 +1,93 @@
+package subprocess
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// StreamDemux tells the stderr lines apart in output that carries both
+// streams, like the terminal of WithPTY or WithCombinedOutput
+type StreamDemux struct {
+	Markers  []string         // prefixes the program writes before its stderr lines, removed from the output
+	Patterns []*regexp.Regexp // lines that look like stderr, such as ^(error|warning):
+}
+
+// DemuxConfidence tells how reliable the split of WithStreamDemux is
+type DemuxConfidence int
+
+const (
+	DemuxProtocol  DemuxConfidence = iota // Every stderr line was tagged with a marker by the program
+	DemuxHeuristic                        // Some lines were classified by a pattern and may be wrong
+)
+
+// String returns a string representation of the demux confidence
+func (c DemuxConfidence) String() string {
+	switch c {
+	case DemuxProtocol:
+		return "protocol"
+	case DemuxHeuristic:
+		return "heuristic"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText writes the confidence by name in reports
+func (c DemuxConfidence) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// WithStreamDemux moves the lines of the captured stdout that d recognizes as
+// stderr to Result.Stderr, after the output of the stderr pipe, for processes
+// whose output streams are merged. Lines starting with a marker are moved
+// without it; lines matching a pattern are moved as they are. The confidence
+// of the split is recorded under the "demux" key of Result.Metadata
+func WithStreamDemux(d StreamDemux) Option {
+	return func(o *Options) {
+		o.Demux = &d
+	}
+}
+
+// split moves the lines of stdout recognized as stderr after stderr
+func (d *StreamDemux) split(stdout, stderr []byte) ([]byte, []byte, DemuxConfidence) {
+	var out []byte
+	errOut := append([]byte(nil), stderr...)
+	confidence := DemuxProtocol
+	for len(stdout) > 0 {
+		line := stdout
+		if i := bytes.IndexByte(stdout, '\n'); i >= 0 {
+			line = stdout[:i+1]
+		}
+		stdout = stdout[len(line):]
+
+		if marker, ok := d.marker(line); ok {
+			errOut = append(errOut, line[len(marker):]...)
+		} else if d.matches(bytes.TrimRight(line, "\r\n")) {
+			errOut = append(errOut, line...)
+			confidence = DemuxHeuristic
+		} else {
+			out = append(out, line...)
+		}
+	}
+	return out, errOut, confidence
+}
+
+// marker returns the marker line starts with
+func (d *StreamDemux) marker(line []byte) (string, bool) {
+	for _, marker := range d.Markers {
+		if marker != "" && bytes.HasPrefix(line, []byte(marker)) {
+			return marker, true
+		}
+	}
+	return "", false
+}
+
+// matches reports whether a pattern matches line
+func (d *StreamDemux) matches(line []byte) bool {
+	for _, re := range d.Patterns {
+		if re.Match(line) {
+			return true
+		}
+	}
+	return false
+}
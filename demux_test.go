@@ -0,0 +1,88 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStreamDemux(t *testing.T) {
+	script := `echo out; echo "[stderr] marked" >&2; echo "error: failed" >&2; echo last`
+
+	tests := []struct {
+		name           string
+		demux          StreamDemux
+		wantStdout     string
+		wantStderr     string
+		wantConfidence DemuxConfidence
+	}{
+		{
+			// Test: markers move stderr lines and are removed
+			name:           "markers",
+			demux:          StreamDemux{Markers: []string{"[stderr] "}},
+			wantStdout:     "out\nlast\nerror: failed\n",
+			wantStderr:     "marked\n",
+			wantConfidence: DemuxProtocol,
+		},
+		{
+			// Test: lines matching a pattern are moved as they are
+			name:           "patterns",
+			demux:          StreamDemux{Patterns: []*regexp.Regexp{regexp.MustCompile(`^error:`)}},
+			wantStdout:     "out\nlast\n[stderr] marked\n",
+			wantStderr:     "error: failed\n",
+			wantConfidence: DemuxHeuristic,
+		},
+		{
+			// Test: markers are checked before patterns
+			name: "both",
+			demux: StreamDemux{
+				Markers:  []string{"[stderr] "},
+				Patterns: []*regexp.Regexp{regexp.MustCompile(`^(error|\[stderr\])`)},
+			},
+			wantStdout:     "out\nlast\n",
+			wantStderr:     "marked\nerror: failed\n",
+			wantConfidence: DemuxHeuristic,
+		},
+		{
+			// Test: without a match the output stays in stdout
+			name:           "no match",
+			demux:          StreamDemux{Markers: []string{"E> "}},
+			wantStdout:     "out\nlast\n[stderr] marked\nerror: failed\n",
+			wantConfidence: DemuxProtocol,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := Command("sh", []string{"-c", script}, WithCombinedOutput(), WithStreamDemux(tt.demux))
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("expected stdout %q, got %q", tt.wantStdout, result.Stdout)
+			}
+			if string(result.Stderr) != tt.wantStderr {
+				t.Errorf("expected stderr %q, got %q", tt.wantStderr, result.Stderr)
+			}
+			if result.Metadata["demux"] != tt.wantConfidence {
+				t.Errorf("expected confidence %v, got %v", tt.wantConfidence, result.Metadata["demux"])
+			}
+		})
+	}
+}
+
+func TestStreamDemuxReport(t *testing.T) {
+	// Test: the confidence is written by name in reports
+	exec, _ := Command("sh", []string{"-c", "echo 'E> err'"}, WithStreamDemux(StreamDemux{Markers: []string{"E> "}}))
+	result, _ := exec.Run(context.Background())
+	data, err := json.Marshal(result.Report())
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"demux":"protocol"`) {
+		t.Errorf("expected the confidence in %s", data)
+	}
+}
@@ -0,0 +1,92 @@
+package subprocess
+
+import (
+	"context"
+	"path/filepath"
+)
+
+// InDir returns a copy of exec whose processes run in dir, like (cd dir && exec)
+// in a shell, without wrapping them in sh -c. Processes with a relative
+// directory of their own resolve it inside dir, absolute ones are kept
+// exec itself is not modified, so the same definition can run in several places
+func InDir(dir string, exec Executable) Executable {
+	return mapProcesses(exec, func(ops *Options) {
+		if ops.Dir == "" {
+			ops.Dir = dir
+		} else if !filepath.IsAbs(ops.Dir) {
+			ops.Dir = filepath.Join(dir, ops.Dir)
+		}
+	})
+}
+
+// mapProcesses returns a deep copy of exec where edit has changed the options
+// of every process, including the ones built later by lazy stages
+func mapProcesses(exec Executable, edit func(ops *Options)) Executable {
+	switch x := exec.(type) {
+	case *ExecutableProcess:
+		ops := *x.process.ops
+		edit(&ops)
+		clone := x.clone()
+		clone.process = &Process{ops: &ops}
+		return clone
+
+	case *Pipeline:
+		clone := x.clone()
+		clone.left = mapProcesses(x.left, edit)
+		if x.right != nil {
+			clone.right = mapProcesses(x.right, edit)
+		}
+		return clone
+
+	case *Router:
+		clone := x.clone()
+		clone.source = mapProcesses(x.source, edit)
+		for i, rt := range clone.routes {
+			clone.routes[i].dest = mapProcesses(rt.dest, edit)
+		}
+		if x.fallback != nil {
+			clone.fallback = mapProcesses(x.fallback, edit)
+		}
+		return clone
+
+	case *Merger:
+		clone := x.clone()
+		for i, p := range clone.producers {
+			clone.producers[i] = mapProcesses(p, edit)
+		}
+		return clone
+
+	case *Batch:
+		clone := x.clone()
+		for i, exec := range clone.execs {
+			clone.execs[i] = mapProcesses(exec, edit)
+		}
+		return clone
+
+	case *Branch:
+		clone := x.clone()
+		clone.exec = mapProcesses(x.exec, edit)
+		return clone
+
+	case *Conditional:
+		clone := x.clone()
+		clone.exec = mapProcesses(x.exec, edit)
+		return clone
+
+	case *LazyStage:
+		clone := x.clone()
+		build := x.build
+		clone.build = func(ctx context.Context, prior *Result) (Executable, error) {
+			exec, err := build(ctx, prior)
+			if err != nil || exec == nil {
+				return exec, err
+			}
+			return mapProcesses(exec, edit), nil
+		}
+		return clone
+
+	default:
+		// Builtins run in the program and unknown executables are left alone
+		return exec
+	}
+}
@@ -0,0 +1,65 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInDir(t *testing.T) {
+	// Test: every process of a composed tree runs in the directory
+	ctx := context.Background()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	pwd, _ := NewExecutable("pwd")
+	cat, _ := NewExecutable("cat")
+	subPwd, _ := Command("pwd", nil, WithDir("sub"))
+	rootPwd, _ := Command("pwd", nil, WithDir("/"))
+	lazyPwd := Lazy(func(ctx context.Context, prior *Result) (Executable, error) {
+		return NewExecutable("pwd")
+	})
+	tree := pwd.Pipe(cat).And(FanIn(subPwd).Mode(MergeOrdered)).And(rootPwd).And(lazyPwd)
+
+	result, err := InDir(dir, tree).Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	expected := []string{dir, filepath.Join(dir, "sub"), "/", dir}
+	var outputs []string
+	collectOutputs(result, &outputs)
+	if len(outputs) != len(expected) {
+		t.Fatalf("expected %d outputs, got %q", len(expected), outputs)
+	}
+	for i, want := range expected {
+		if outputs[i] != want+"\n" {
+			t.Errorf("output %d: expected %q, got %q", i, want+"\n", outputs[i])
+		}
+	}
+
+	// The original tree is unchanged
+	if d := subPwd.(*ExecutableProcess).process.ops.Dir; d != "sub" {
+		t.Errorf("expected the original process to keep its directory, got %q", d)
+	}
+}
+
+// collectOutputs appends the output of the leaves of result, left to right,
+// skipping the producers that were piped into another stage
+func collectOutputs(result *Result, outputs *[]string) {
+	switch {
+	case result.Type == OpPipe || result.Type == OpFanIn:
+		*outputs = append(*outputs, string(result.Stdout))
+	case len(result.Children) == 0:
+		*outputs = append(*outputs, string(result.Stdout))
+	default:
+		for _, child := range result.Children {
+			collectOutputs(child, outputs)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+)
+
+// ScriptDelivery controls how an embedded script reaches its interpreter
+type ScriptDelivery int
+
+const (
+	ScriptTempFile ScriptDelivery = iota // Extract to a temporary file (default)
+	ScriptFD                             // Pass /dev/fd/3, a pipe the script is written to
+	ScriptStdin                          // Write the script to stdin, e.g. for bash -s
+)
+
+// String returns a string representation of the script delivery
+func (d ScriptDelivery) String() string {
+	switch d {
+	case ScriptTempFile:
+		return "temp-file"
+	case ScriptFD:
+		return "fd"
+	case ScriptStdin:
+		return "stdin"
+	default:
+		return "unknown"
+	}
+}
+
+// EmbeddedScript is a script read from a file system, usually an embed.FS,
+// and extracted to a temporary file for every run
+type EmbeddedScript struct {
+	FS       fs.FS
+	Path     string
+	Delivery ScriptDelivery
+}
+
+// WithEmbeddedScript runs the script at name in fsys, so programs need no
+// script files next to their binary. Without a command the script is run
+// directly and needs a shebang line, otherwise it is passed as the first
+// argument to the command, e.g. /bin/bash
+// The script is extracted to a temporary file only its owner can access,
+// which is removed once the process exited
+func WithEmbeddedScript(fsys fs.FS, name string) Option {
+	return func(o *Options) {
+		o.Script = &EmbeddedScript{FS: fsys, Path: name}
+	}
+}
+
+// WithInMemoryScript runs the script at name in fsys without writing it to
+// disk, for hardened systems with noexec or read-only temp directories
+// The command must be an interpreter. ScriptFD passes the script as the path
+// /dev/fd/3 before args and is not supported on Windows. ScriptStdin feeds it
+// on stdin, so args must make the interpreter read it from there (bash -s,
+// python -) and the process gets no other input
+func WithInMemoryScript(fsys fs.FS, name string, delivery ScriptDelivery) Option {
+	return func(o *Options) {
+		o.Script = &EmbeddedScript{FS: fsys, Path: name, Delivery: delivery}
+	}
+}
+
+// RunEmbedded runs the script at name in fsys with args and returns its result
+// Use WithEmbeddedScript to run it with an interpreter or to compose it
+func RunEmbedded(ctx context.Context, fsys fs.FS, name string, args ...string) (*Result, error) {
+	exec, err := Command("", args, WithEmbeddedScript(fsys, name))
+	if err != nil {
+		return nil, err
+	}
+	return exec.Run(ctx)
+}
+
+// extract writes the script to a new temporary file and returns its path
+func (s *EmbeddedScript) extract() (string, error) {
+	content, err := fs.ReadFile(s.FS, s.Path)
+	if err != nil {
+		return "", fmt.Errorf("embedded script: %w", err)
+	}
+	f, err := os.CreateTemp("", "subprocess-*-"+path.Base(s.Path))
+	if err != nil {
+		return "", fmt.Errorf("embedded script: %w", err)
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o700)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("embedded script: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// launch is the command line a process is started with
+type launch struct {
+	name       string
+	args       []string
+	stdin      io.Reader  // read by the process instead of Options.Stdin
+	extraFiles []*os.File // passed to the process from fd 3 on
+	cleanup    func()     // called once the process exited
+}
+
+// commandLine returns how to start the process described by ops, delivering
+// its embedded script if there is one
+func commandLine(ops *Options) (*launch, error) {
+	stdin, closeStdin, err := openStdin(ops)
+	if err != nil {
+		return nil, err
+	}
+	l := &launch{name: resolveCommand(ops), args: ops.Args, stdin: stdin, cleanup: closeStdin}
+	if ops.Script == nil {
+		return l, nil
+	}
+	if ops.Script.Delivery != ScriptTempFile {
+		if err := l.deliverInMemory(ops); err != nil {
+			closeStdin()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	script, err := ops.Script.extract()
+	if err != nil {
+		closeStdin()
+		return nil, err
+	}
+	l.cleanup = func() {
+		closeStdin()
+		os.Remove(script)
+	}
+	if l.name == "" {
+		l.name = script
+	} else {
+		l.args = append([]string{script}, l.args...)
+	}
+	return l, nil
+}
+
+// deliverInMemory passes the script of ops to the interpreter through a pipe
+func (l *launch) deliverInMemory(ops *Options) error {
+	if l.name == "" {
+		return errors.New("embedded script: in-memory delivery needs an interpreter command")
+	}
+	content, err := fs.ReadFile(ops.Script.FS, ops.Script.Path)
+	if err != nil {
+		return fmt.Errorf("embedded script: %w", err)
+	}
+
+	switch ops.Script.Delivery {
+	case ScriptStdin:
+		if ops.hasStdin() {
+			return errors.New("embedded script: stdin delivery cannot be combined with WithStdin")
+		}
+		l.stdin = bytes.NewReader(content)
+	case ScriptFD:
+		if runtime.GOOS == "windows" {
+			return errors.New("embedded script: fd delivery is not supported on windows")
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("embedded script: %w", err)
+		}
+		// Closing both ends on exit also ends a write the interpreter never read
+		go func() {
+			w.Write(content)
+			w.Close()
+		}()
+		l.extraFiles = []*os.File{r}
+		l.args = append([]string{"/dev/fd/3"}, l.args...)
+		closeStdin := l.cleanup
+		l.cleanup = func() {
+			closeStdin()
+			r.Close()
+			w.Close()
+		}
+	default:
+		return fmt.Errorf("embedded script: unknown delivery %v", ops.Script.Delivery)
+	}
+	return nil
+}
+
+// redirectsStdin reports whether the process reads its stdin from a reader
+// instead of the runner
+func (o *Options) redirectsStdin() bool {
+	return o.hasStdin() || o.Script != nil && o.Script.Delivery == ScriptStdin
+}
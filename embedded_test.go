@@ -0,0 +1,84 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedScript(t *testing.T) {
+	// Test: embedded scripts are extracted, run and removed afterwards
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"scripts/hello.sh": {Data: []byte("#!/bin/sh\necho \"$0\"\necho hello \"$1\"\n")},
+	}
+
+	direct, err := RunEmbedded(ctx, fsys, "scripts/hello.sh", "world")
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	interpreted, _ := Command("sh", []string{"there"}, WithEmbeddedScript(fsys, "scripts/hello.sh"))
+	if s := fmt.Sprint(interpreted); s != "sh scripts/hello.sh there" {
+		t.Errorf("unexpected command line %q", s)
+	}
+	indirect, err := interpreted.Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	for _, result := range []*Result{direct, indirect} {
+		script, output, _ := strings.Cut(string(result.Stdout), "\n")
+		if !strings.HasPrefix(output, "hello ") {
+			t.Errorf("unexpected output %q", result.Stdout)
+		}
+		if _, err := os.Stat(script); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", script, err)
+		}
+	}
+
+	missing, _ := Command("", nil, WithEmbeddedScript(fsys, "scripts/missing.sh"))
+	if err := missing.Validate(); err == nil {
+		t.Error("expected validation error for a missing script")
+	}
+	if _, err := missing.Run(ctx); err == nil {
+		t.Error("expected run error for a missing script")
+	}
+}
+
+func TestInMemoryScript(t *testing.T) {
+	// Test: scripts reach the interpreter without a temporary file
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"hello.sh": {Data: []byte("echo \"$0\" hello \"$1\"\n")},
+	}
+
+	tests := []struct {
+		delivery ScriptDelivery
+		args     []string
+		expected string
+	}{
+		{ScriptFD, []string{"fd"}, "/dev/fd/3 hello fd\n"},
+		{ScriptStdin, []string{"-s", "stdin"}, "sh hello stdin\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.delivery.String(), func(t *testing.T) {
+			exec, _ := Command("sh", tt.args, WithInMemoryScript(fsys, "hello.sh", tt.delivery))
+			result, err := exec.Run(ctx)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Stdout)
+			}
+		})
+	}
+
+	noInterpreter, _ := Command("", nil, WithInMemoryScript(fsys, "hello.sh", ScriptStdin))
+	if err := noInterpreter.Validate(); err == nil {
+		t.Error("expected validation error without an interpreter")
+	}
+}
@@ -0,0 +1,288 @@
+package subprocess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// encodings maps normalized names to functions wrapping output in a reader
+// that decodes it to UTF-8
+var encodings = struct {
+	sync.RWMutex
+	decoders map[string]func(io.Reader) io.Reader
+}{decoders: map[string]func(io.Reader) io.Reader{
+	"utf8":        func(r io.Reader) io.Reader { return r },
+	"latin1":      singleByteDecoder(&latin1),
+	"iso88591":    singleByteDecoder(&latin1),
+	"cp1252":      singleByteDecoder(&windows1252),
+	"windows1252": singleByteDecoder(&windows1252),
+	"utf16":       utf16Decoder(binary.LittleEndian),
+	"utf16le":     utf16Decoder(binary.LittleEndian),
+	"utf16be":     utf16Decoder(binary.BigEndian),
+	"auto":        autoDecoder,
+}}
+
+// WithEncoding transcodes the stdout and stderr of the process from the named
+// encoding to UTF-8 before they are captured or streamed
+// Built in are utf-8, latin1 (iso-8859-1), cp1252 (windows-1252), utf-16le,
+// utf-16be and auto, which detects UTF-16 and UTF-8 and falls back to cp1252
+// Others such as shift-jis can be added with RegisterEncoding
+func WithEncoding(name string) Option {
+	return func(o *Options) {
+		o.Encoding = name
+	}
+}
+
+// RegisterEncoding makes name usable with WithEncoding, decode wraps output in
+// a reader producing UTF-8, e.g. japanese.ShiftJIS.NewDecoder().Reader from
+// golang.org/x/text. decode is called before the process starts, so the reader
+// must only read on demand. Names are matched ignoring case, dashes and underscores
+func RegisterEncoding(name string, decode func(io.Reader) io.Reader) {
+	encodings.Lock()
+	encodings.decoders[normalizeEncoding(name)] = decode
+	encodings.Unlock()
+}
+
+// lookupEncoding returns the decoder of the named encoding, nil for none
+func lookupEncoding(name string) (func(io.Reader) io.Reader, error) {
+	if name == "" {
+		return nil, nil
+	}
+	encodings.RLock()
+	decode, ok := encodings.decoders[normalizeEncoding(name)]
+	encodings.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return decode, nil
+}
+
+func normalizeEncoding(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// decodeFunc appends the UTF-8 form of src to dst and returns how many bytes
+// of src it consumed. An incomplete character at the end is left for the next
+// call unless atEOF
+type decodeFunc func(dst, src []byte, atEOF bool) ([]byte, int)
+
+// decodeReader decodes the output of r with decode
+type decodeReader struct {
+	r      io.Reader
+	decode decodeFunc
+	src    []byte // read but not decoded yet
+	out    []byte // decoded but not returned yet
+	err    error
+	buf    [4096]byte
+}
+
+func (d *decodeReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf[:])
+		d.src = append(d.src, d.buf[:n]...)
+		d.err = err
+		var used int
+		d.out, used = d.decode(nil, d.src, err != nil)
+		d.src = append(d.src[:0], d.src[used:]...)
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// latin1 maps the bytes 0x80-0xff of ISO-8859-1 to runes
+var latin1 = func() (table [128]rune) {
+	for i := range table {
+		table[i] = rune(0x80 + i)
+	}
+	return table
+}()
+
+// windows1252 differs from latin1 in 0x80-0x9f, unassigned bytes decode to U+FFFD
+var windows1252 = func() [128]rune {
+	table := latin1
+	copy(table[:32], []rune{
+		'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+		'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+	})
+	return table
+}()
+
+// singleByteDecoder decodes an encoding that is ASCII below 0x80
+func singleByteDecoder(table *[128]rune) func(io.Reader) io.Reader {
+	decode := func(dst, src []byte, atEOF bool) ([]byte, int) {
+		for _, b := range src {
+			if b < 0x80 {
+				dst = append(dst, b)
+			} else {
+				dst = utf8.AppendRune(dst, table[b-0x80])
+			}
+		}
+		return dst, len(src)
+	}
+	return func(r io.Reader) io.Reader {
+		return &decodeReader{r: r, decode: decode}
+	}
+}
+
+// utf16Decoder decodes UTF-16 in the given byte order, skipping a leading BOM
+func utf16Decoder(order binary.ByteOrder) func(io.Reader) io.Reader {
+	return func(r io.Reader) io.Reader {
+		start := true
+		decode := func(dst, src []byte, atEOF bool) ([]byte, int) {
+			used := 0
+			for len(src)-used >= 2 {
+				unit := rune(order.Uint16(src[used:]))
+				size := 2
+				switch {
+				case start && unit == 0xfeff:
+					used += size
+					start = false
+					continue
+				case unit >= 0xd800 && unit < 0xdc00:
+					// A high surrogate needs the low one that follows
+					if len(src)-used < 4 {
+						if !atEOF {
+							return dst, used
+						}
+						unit = utf8.RuneError
+						break
+					}
+					if low := rune(order.Uint16(src[used+2:])); utf16.IsSurrogate(low) {
+						unit = utf16.DecodeRune(unit, low)
+						size = 4
+					} else {
+						unit = utf8.RuneError
+					}
+				case utf16.IsSurrogate(unit):
+					unit = utf8.RuneError
+				}
+				start = false
+				dst = utf8.AppendRune(dst, unit)
+				used += size
+			}
+			if atEOF && used < len(src) {
+				dst = utf8.AppendRune(dst, utf8.RuneError)
+				used = len(src)
+			}
+			return dst, used
+		}
+		return &decodeReader{r: r, decode: decode}
+	}
+}
+
+// autoDecoder detects the encoding from the start of the output
+func autoDecoder(r io.Reader) io.Reader {
+	return &autoReader{r: r}
+}
+
+// autoReader picks a decoder from the first chunk of output, so it does not
+// wait for more output than the process wrote before passing it through
+type autoReader struct {
+	r       io.Reader
+	decoded io.Reader
+}
+
+func (a *autoReader) Read(p []byte) (int, error) {
+	if a.decoded == nil {
+		var head []byte
+		var err error
+		buf := make([]byte, 1024)
+		// Only read again for output that is empty so far or ends with a
+		// byte order mark or UTF-8 character cut short, which the next chunk
+		// completes
+		for err == nil && (len(head) == 0 || partialBOM(head) || cutRune(head)) {
+			var n int
+			n, err = a.r.Read(buf)
+			head = append(head, buf[:n]...)
+		}
+		rest := a.r
+		if err != nil {
+			rest = &errReader{err}
+		}
+		a.decoded = detectEncoding(head, err != nil)(io.MultiReader(bytes.NewReader(head), rest))
+	}
+	return a.decoded.Read(p)
+}
+
+// partialBOM reports whether head is the start of a byte order mark but not a
+// complete one
+func partialBOM(head []byte) bool {
+	for _, bom := range [][]byte{{0xef, 0xbb, 0xbf}, {0xff, 0xfe}, {0xfe, 0xff}} {
+		if len(head) < len(bom) && bytes.HasPrefix(bom, head) {
+			return true
+		}
+	}
+	return false
+}
+
+// errReader returns err from every Read
+type errReader struct{ err error }
+
+func (e *errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// detectEncoding guesses the encoding of output starting with head
+func detectEncoding(head []byte, atEOF bool) func(io.Reader) io.Reader {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xef, 0xbb, 0xbf}):
+		return func(r io.Reader) io.Reader {
+			io.CopyN(io.Discard, r, 3)
+			return r
+		}
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		return utf16Decoder(binary.LittleEndian)
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}):
+		return utf16Decoder(binary.BigEndian)
+	}
+
+	// ASCII text in UTF-16 has a zero byte in every unit
+	var evenZeros, oddZeros int
+	for i, b := range head {
+		if b == 0 {
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+	}
+	switch units := len(head) / 2; {
+	case units > 0 && oddZeros >= units/2 && evenZeros == 0:
+		return utf16Decoder(binary.LittleEndian)
+	case units > 0 && evenZeros >= units/2 && oddZeros == 0:
+		return utf16Decoder(binary.BigEndian)
+	}
+
+	if validUTF8Prefix(head, atEOF) {
+		return func(r io.Reader) io.Reader { return r }
+	}
+	return singleByteDecoder(&windows1252)
+}
+
+// cutRune reports whether head is valid UTF-8 up to a character cut off at
+// the end
+func cutRune(head []byte) bool {
+	return validUTF8Prefix(head, false) && !validUTF8Prefix(head, true)
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, allowing a character cut
+// off at the end unless atEOF
+func validUTF8Prefix(b []byte, atEOF bool) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			return !atEOF && !utf8.FullRune(b)
+		}
+		b = b[size:]
+	}
+	return true
+}
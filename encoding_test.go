@@ -0,0 +1,111 @@
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestDecodeEncodings(t *testing.T) {
+	// Test: output in legacy encodings is decoded to UTF-8, also one byte at a time
+	tests := []struct {
+		encoding string
+		input    []byte
+		expected string
+		whole    bool // read in one chunk, auto detects from the first one
+	}{
+		{"cp1252", []byte("caf\xe9 \x80 \x93ok\x94"), "café € “ok”", false},
+		{"ISO-8859-1", []byte("na\xefve"), "naïve", false},
+		{"utf-16le", []byte("\xff\xfeh\x00i\x00=\xd8\x00\xde"), "hi😀", false},
+		{"utf-16be", []byte("\x00h\x00i"), "hi", false},
+		{"auto", []byte("\xff\xfeh\x00i\x00"), "hi", false},
+		{"auto", []byte("\xef\xbb\xbfcafé"), "café", false},
+		{"auto", []byte("h\x00i\x00\n\x00"), "hi\n", true},
+		{"auto", []byte("café"), "café", true},
+		{"auto", []byte("caf\xe9"), "café", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			decode, err := lookupEncoding(tt.encoding)
+			if err != nil {
+				t.Fatalf("lookup failed: %v", err)
+			}
+			input := io.Reader(bytes.NewReader(tt.input))
+			if !tt.whole {
+				input = iotest.OneByteReader(input)
+			}
+			output, err := io.ReadAll(decode(input))
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+
+	if _, err := lookupEncoding("klingon"); err == nil {
+		t.Error("expected error for unknown encoding")
+	}
+}
+
+func TestAutoEncodingStreams(t *testing.T) {
+	// Test: auto passes the first chunk through without waiting for more output
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte("ready\n"))
+
+	decode, _ := lookupEncoding("auto")
+	buf := make([]byte, 64)
+	done := make(chan string)
+	go func() {
+		n, _ := decode(r).Read(buf)
+		done <- string(buf[:n])
+	}()
+	select {
+	case got := <-done:
+		if got != "ready\n" {
+			t.Errorf("expected %q, got %q", "ready\n", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read blocked waiting for more output")
+	}
+}
+
+func TestProcessEncoding(t *testing.T) {
+	// Test: process output is transcoded, registered encodings are used
+	ctx := context.Background()
+	exec, _ := Command("printf", []string{`caf\351`}, WithEncoding("cp1252"))
+	result, err := exec.Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "café" {
+		t.Errorf("expected %q, got %q", "café", result.Stdout)
+	}
+
+	RegisterEncoding("Upper_Test", func(r io.Reader) io.Reader { return upperReader{r} })
+	exec, _ = Command("echo", []string{"hi"}, WithEncoding("upper-test"))
+	result, _ = exec.Run(ctx)
+	if string(result.Stdout) != "HI\n" {
+		t.Errorf("expected registered encoding to be used, got %q", result.Stdout)
+	}
+
+	unknown, _ := Command("echo", nil, WithEncoding("klingon"))
+	if err := unknown.Validate(); err == nil {
+		t.Error("expected validation error for unknown encoding")
+	}
+}
+
+// upperReader is a stand-in decoder that upper-cases ASCII
+type upperReader struct{ r io.Reader }
+
+func (u upperReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return n, err
+}
@@ -0,0 +1,53 @@
+package subprocess
+
+import (
+	"os"
+	"strings"
+)
+
+// processEnv returns the environment of the process described by ops
+// nil means the environment of the program is inherited unchanged
+func processEnv(ops *Options) []string {
+	base := ops.Env
+	if base == nil {
+		base = os.Environ()
+	}
+	overrides := envOverrides(ops, base)
+	if len(overrides) == 0 {
+		return ops.Env
+	}
+	return mergeEnv(base, overrides)
+}
+
+// envOverrides returns the variables ops sets on top of the environment base
+func envOverrides(ops *Options, base []string) []string {
+	var overrides []string
+	if ops.Proxy != nil {
+		overrides = append(overrides, ops.Proxy.env()...)
+	}
+	overrides = append(overrides, colorEnv(ops.Color)...)
+	if ops.Toolchain != nil {
+		overrides = append(overrides, ops.Toolchain.env(base)...)
+	}
+	overrides = append(overrides, clockEnv(ops, base)...)
+	return append(overrides, ops.EnvOverrides...)
+}
+
+// mergeEnv returns base with the "key=value" entries of overrides replacing
+// or extending the entries with the same key
+func mergeEnv(base, overrides []string) []string {
+	keys := make(map[string]bool, len(overrides))
+	for _, kv := range overrides {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if !keys[key] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, overrides...)
+}
@@ -0,0 +1,103 @@
+package subprocess
+
+import (
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// secretEnvKeys are the parts of variable names whose values are redacted in
+// an EnvSnapshot, compared without case
+var secretEnvKeys = []string{
+	"TOKEN", "SECRET", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH", "PRIVATE", "SESSION", "COOKIE",
+}
+
+// redacted replaces secret values in an EnvSnapshot
+const redacted = "xxxxx"
+
+// EnvSnapshot is the environment a process was started with, compared with
+// the environment of the program. Secret values are redacted
+type EnvSnapshot struct {
+	Env     []string `json:"env"`               // "key=value" entries passed to the process
+	Added   []string `json:"added,omitempty"`   // keys the program does not have
+	Removed []string `json:"removed,omitempty"` // keys of the program left out
+	Changed []string `json:"changed,omitempty"` // keys with a value different from the program
+}
+
+// WithEnvSnapshot records the exact environment of the process in Result.Env
+// with its difference to the environment of the program, so environment
+// problems of a pipeline can be diagnosed from its report. The values of
+// variables named like secrets, such as GITHUB_TOKEN or AWS_SECRET_ACCESS_KEY,
+// or containing one of secrets, are redacted, as are the passwords of URLs
+func WithEnvSnapshot(secrets ...string) Option {
+	return func(o *Options) {
+		o.SnapshotEnv = true
+		o.SecretEnv = append(o.SecretEnv, secrets...)
+	}
+}
+
+// EnvSnapshot returns the environment of a process started with
+// WithEnvSnapshot, or nil
+func (p *ProcessRunner) EnvSnapshot() *EnvSnapshot {
+	return p.env
+}
+
+// snapshotEnv describes env, nil for the inherited environment, against the
+// environment of the program
+func snapshotEnv(env []string, secrets []string) *EnvSnapshot {
+	parent := envMap(os.Environ())
+	if env == nil {
+		env = os.Environ()
+	}
+	child := envMap(env)
+
+	s := &EnvSnapshot{Env: make([]string, 0, len(env))}
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		s.Env = append(s.Env, key+"="+redactEnv(key, value, secrets))
+	}
+	for key, value := range child {
+		if old, ok := parent[key]; !ok {
+			s.Added = append(s.Added, key)
+		} else if old != value {
+			s.Changed = append(s.Changed, key)
+		}
+	}
+	for key := range parent {
+		if _, ok := child[key]; !ok {
+			s.Removed = append(s.Removed, key)
+		}
+	}
+	slices.Sort(s.Added)
+	slices.Sort(s.Removed)
+	slices.Sort(s.Changed)
+	return s
+}
+
+// envMap returns the values of env by key, later entries win like in exec
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// redactEnv returns value, redacted if key looks secret or value is a URL
+// with a password
+func redactEnv(key, value string, secrets []string) string {
+	upper := strings.ToUpper(key)
+	for _, secret := range slices.Concat(secrets, secretEnvKeys) {
+		if secret != "" && strings.Contains(upper, strings.ToUpper(secret)) {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvSnapshot(t *testing.T) {
+	t.Setenv("SNAPSHOT_KEPT", "same")
+	t.Setenv("SNAPSHOT_CHANGED", "parent")
+	t.Setenv("SNAPSHOT_REMOVED", "gone")
+
+	env := []string{
+		"PATH=/usr/bin:/bin",
+		"SNAPSHOT_KEPT=same",
+		"SNAPSHOT_CHANGED=child",
+		"SNAPSHOT_ADDED=new",
+		"GITHUB_TOKEN=ghp_secret",
+		"DATABASE_URL=postgres://app:hunter2@db/app",
+		"INTERNAL_CONFIG=hidden",
+	}
+	exec, _ := Command("true", nil, WithEnv(env...), WithEnvSnapshot("internal"))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	snapshot := result.Env
+	if snapshot == nil {
+		t.Fatal("expected an environment snapshot")
+	}
+
+	tests := []struct {
+		name string
+		got  bool
+	}{
+		// Test: plain values are recorded as they are
+		{"kept", slices.Contains(snapshot.Env, "SNAPSHOT_KEPT=same")},
+		// Test: variables named like secrets are redacted
+		{"token", slices.Contains(snapshot.Env, "GITHUB_TOKEN=xxxxx")},
+		// Test: passwords of URLs are redacted
+		{"url", slices.Contains(snapshot.Env, "DATABASE_URL=postgres://app:xxxxx@db/app")},
+		// Test: extra secrets are redacted without case
+		{"extra secret", slices.Contains(snapshot.Env, "INTERNAL_CONFIG=xxxxx")},
+		// Test: new keys are added
+		{"added", slices.Contains(snapshot.Added, "SNAPSHOT_ADDED")},
+		// Test: different values are changed
+		{"changed", slices.Contains(snapshot.Changed, "SNAPSHOT_CHANGED") && !slices.Contains(snapshot.Changed, "SNAPSHOT_KEPT")},
+		// Test: keys of the program left out are removed
+		{"removed", slices.Contains(snapshot.Removed, "SNAPSHOT_REMOVED")},
+	}
+	for _, tt := range tests {
+		if !tt.got {
+			t.Errorf("%s: unexpected snapshot %+v", tt.name, snapshot)
+		}
+	}
+
+	data, _ := json.Marshal(result.Report())
+	if strings.Contains(string(data), "ghp_secret") || strings.Contains(string(data), "hunter2") {
+		t.Errorf("expected secrets to be redacted in the report: %s", data)
+	}
+}
+
+func TestEnvSnapshotInherited(t *testing.T) {
+	// Test: an inherited environment has no difference, stages of a pipe are recorded
+	echo, _ := Command("echo", []string{"a"}, WithEnvSnapshot())
+	cat, _ := Command("cat", nil)
+	result, err := echo.Pipe(cat).Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	snapshot := result.Children[0].Env
+	if snapshot == nil || len(snapshot.Env) == 0 {
+		t.Fatalf("expected an environment snapshot, got %+v", snapshot)
+	}
+	if len(snapshot.Added)+len(snapshot.Removed)+len(snapshot.Changed) != 0 {
+		t.Errorf("expected no difference, got %+v", snapshot)
+	}
+	if result.Children[1].Env != nil {
+		t.Error("expected no snapshot without WithEnvSnapshot")
+	}
+}
@@ -12,7 +12,7 @@ import (
 func main() {
 	ctx := context.Background()
 
-	fmt.Println("=== Pipeline Examples ===\n")
+	fmt.Print("=== Pipeline Examples ===\n\n")
 
 	// Example 1: Simple Pipe
 	fmt.Println("1. Simple Pipe: echo 'hello world' | grep 'world'")
@@ -2,81 +2,95 @@ package subprocess
 
 import (
 	"context"
-	"time"
+	"strings"
+
+	"github.com/cuongtranba/subprocess/ast"
 )
 
 // ExecutableProcess wraps a Process to implement the Executable interface
 // This adapter pattern keeps the Process type simple while enabling composition
 type ExecutableProcess struct {
-	process         *Process
-	shutdownTimeout time.Duration
+	node
+	process *Process
+	pos     ast.Pos // position in the command line of Parse
 }
 
 // NewExecutable creates an Executable from a Process
+// Use Command to configure the process with options
 func NewExecutable(cmd string, args ...string) (Executable, error) {
-	process, err := NewProcess(cmd, args)
+	return Command(cmd, args)
+}
+
+// Command creates an Executable from a command, its arguments and options
+// such as WithDir, WithEnv and WithStdin
+func Command(cmd string, args []string, opts ...Option) (Executable, error) {
+	process, err := NewProcess(cmd, args, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &ExecutableProcess{
-		process:         process,
-		shutdownTimeout: 5 * time.Second, // default timeout
-	}, nil
+	return FromProcess(process), nil
 }
 
-// Run executes the single process
-func (e *ExecutableProcess) Run(ctx context.Context) (*Result, error) {
-	// Create a visitor to execute this process
-	visitor := &ExecutionVisitor{
-		ctx:             ctx,
-		shutdownTimeout: e.shutdownTimeout,
-		backgroundJobs:  make([]*BackgroundJob, 0),
+// FromProcess creates an Executable from a configured Process
+func FromProcess(process *Process) Executable {
+	e := &ExecutableProcess{
+		process: process,
 	}
-	return visitor.VisitProcess(e)
+	e.node = newNode(e)
+	return e
 }
 
-// Pipe creates a pipeline that pipes output to the next executable
-func (e *ExecutableProcess) Pipe(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpPipe,
-		left:            e,
-		right:           next,
-		shutdownTimeout: e.shutdownTimeout,
+// String returns the command line of the process, quoted like a shell would need it
+func (e *ExecutableProcess) String() string {
+	parts := make([]string, 0, len(e.process.ops.Args)+2)
+	if ops := e.process.ops; ops.Command != "" || ops.Script == nil {
+		parts = append(parts, shellQuote(ops.Command))
+	}
+	if script := e.process.ops.Script; script != nil {
+		parts = append(parts, shellQuote(script.Path))
+	}
+	for _, arg := range e.process.ops.Args {
+		parts = append(parts, shellQuote(arg))
 	}
+	return strings.Join(parts, " ")
 }
 
-// And creates a pipeline that runs next only if this succeeds
-func (e *ExecutableProcess) And(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpAnd,
-		left:            e,
-		right:           next,
-		shutdownTimeout: e.shutdownTimeout,
+// shellQuote quotes s with single quotes unless it only contains safe characters
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
 	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./=:,+@%", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
-// Or creates a pipeline that runs next only if this fails
-func (e *ExecutableProcess) Or(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpOr,
-		left:            e,
-		right:           next,
-		shutdownTimeout: e.shutdownTimeout,
-	}
+// clone returns a copy of e, so With* methods never modify a shared definition
+func (e *ExecutableProcess) clone() *ExecutableProcess {
+	clone := *e
+	clone.self = &clone
+	return &clone
 }
 
-// Background creates a pipeline that runs this in the background
-func (e *ExecutableProcess) Background() Executable {
-	return &Pipeline{
-		operation:       OpBackground,
-		left:            e,
-		right:           nil, // background has no right side
-		shutdownTimeout: e.shutdownTimeout,
-	}
+func (e *ExecutableProcess) configure(edit func(*settings)) Executable {
+	clone := e.clone()
+	edit(&clone.settings)
+	return clone
 }
 
-// WithShutdownTimeout sets the graceful shutdown timeout
-func (e *ExecutableProcess) WithShutdownTimeout(timeout time.Duration) Executable {
-	e.shutdownTimeout = timeout
-	return e
+// Run executes the single process
+func (e *ExecutableProcess) Run(ctx context.Context) (*Result, error) {
+	// Create a visitor to execute this process
+	visitor := newExecutionVisitor(ctx, e.settings)
+	return visitor.run(e, func() (*Result, error) {
+		return visitor.VisitProcess(e)
+	})
 }
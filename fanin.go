@@ -0,0 +1,190 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MergeMode controls how the output of several producers is combined
+type MergeMode int
+
+const (
+	MergeInterleaved MergeMode = iota // Lines in the order they arrive
+	MergeOrdered                      // All lines of each producer, in producer order
+	MergeByKey                        // Merge pre-sorted outputs by key (like sort -m)
+)
+
+// String returns a string representation of the merge mode
+func (m MergeMode) String() string {
+	switch m {
+	case MergeInterleaved:
+		return "interleaved"
+	case MergeOrdered:
+		return "ordered"
+	case MergeByKey:
+		return "by-key"
+	default:
+		return "unknown"
+	}
+}
+
+// Merger runs several producers concurrently and merges their output
+// line by line into a single stream
+type Merger struct {
+	node
+	producers []Executable
+	mode      MergeMode
+	key       func(line []byte) string
+	buffer    lineBuffer
+}
+
+// FanIn creates a Merger that combines the output of producers
+// Lines are interleaved in arrival order unless another mode is set
+func FanIn(producers ...Executable) *Merger {
+	m := &Merger{
+		producers: producers,
+		mode:      MergeInterleaved,
+		buffer:    defaultLineBuffer(),
+	}
+	m.node = newNode(m)
+	return m
+}
+
+// Mode sets how producer output is merged
+func (m *Merger) Mode(mode MergeMode) *Merger {
+	clone := m.clone()
+	clone.mode = mode
+	return clone
+}
+
+// Key sets the merge key used by MergeByKey and switches to that mode
+// Each producer's output must already be sorted by this key
+// Without a key function, whole lines are compared
+func (m *Merger) Key(key func(line []byte) string) *Merger {
+	clone := m.clone()
+	clone.mode = MergeByKey
+	clone.key = key
+	return clone
+}
+
+// Buffer sets the initial buffer size and the maximum line length used when
+// scanning producers output, like bufio.Scanner.Buffer
+// Lines longer than max fail the run instead of being split. Sizes that are
+// not positive, or an initial size above max, are reported by Run and Validate
+func (m *Merger) Buffer(initial, max int) *Merger {
+	clone := m.clone()
+	clone.buffer = lineBuffer{initial: initial, max: max}
+	return clone
+}
+
+// clone returns a copy of m, so builder methods never modify a shared definition
+func (m *Merger) clone() *Merger {
+	clone := *m
+	clone.producers = append([]Executable(nil), m.producers...)
+	clone.self = &clone
+	return &clone
+}
+
+func (m *Merger) configure(edit func(*settings)) Executable {
+	clone := m.clone()
+	edit(&clone.settings)
+	return clone
+}
+
+// String describes the merger and its producers
+func (m *Merger) String() string {
+	parts := make([]string, 0, len(m.producers))
+	for _, p := range m.producers {
+		parts = append(parts, fmt.Sprint(p))
+	}
+	return fmt.Sprintf("fan-in[%s](%s)", m.mode, strings.Join(parts, "; "))
+}
+
+// Run executes all producers and merges their output using the visitor pattern
+func (m *Merger) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, m.settings)
+	return visitor.run(m, func() (*Result, error) {
+		return visitor.VisitFanIn(m)
+	})
+}
+
+// merge drains the line channels of all producers according to the merge mode
+// The lines of each producer are also collected into outputs for its child result
+func (m *Merger) merge(lines []chan []byte, outputs [][]byte) []byte {
+	var merged []byte
+
+	switch m.mode {
+	case MergeOrdered:
+		// Drain every producer concurrently so none blocks on a full pipe
+		var wg sync.WaitGroup
+		for i := range lines {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for line := range lines[i] {
+					outputs[i] = append(append(outputs[i], line...), '\n')
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, out := range outputs {
+			merged = append(merged, out...)
+		}
+
+	case MergeByKey:
+		key := m.key
+		if key == nil {
+			key = func(line []byte) string { return string(line) }
+		}
+
+		// k-way merge: repeatedly emit the smallest head, ties go to the earlier producer
+		heads := make([][]byte, len(lines))
+		open := make([]bool, len(lines))
+		for i := range lines {
+			heads[i], open[i] = <-lines[i]
+		}
+		for {
+			next := -1
+			for i := range lines {
+				if open[i] && (next < 0 || key(heads[i]) < key(heads[next])) {
+					next = i
+				}
+			}
+			if next < 0 {
+				break
+			}
+			outputs[next] = append(append(outputs[next], heads[next]...), '\n')
+			merged = append(append(merged, heads[next]...), '\n')
+			heads[next], open[next] = <-lines[next]
+		}
+
+	default:
+		type taggedLine struct {
+			producer int
+			line     []byte
+		}
+		all := make(chan taggedLine)
+		var wg sync.WaitGroup
+		for i := range lines {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for line := range lines[i] {
+					all <- taggedLine{producer: i, line: line}
+				}
+			}(i)
+		}
+		go func() {
+			wg.Wait()
+			close(all)
+		}()
+		for tl := range all {
+			outputs[tl.producer] = append(append(outputs[tl.producer], tl.line...), '\n')
+			merged = append(append(merged, tl.line...), '\n')
+		}
+	}
+
+	return merged
+}
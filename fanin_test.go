@@ -0,0 +1,141 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFanInInterleaved(t *testing.T) {
+	// Test: all lines from every producer are present
+	ctx := context.Background()
+
+	a, _ := NewExecutable("printf", "a1\\na2\\n")
+	b, _ := NewExecutable("printf", "b1\\nb2\\n")
+
+	result, err := FanIn(a, b).Run(ctx)
+	if err != nil {
+		t.Fatalf("fan-in failed: %v", err)
+	}
+
+	if result.Type != OpFanIn {
+		t.Errorf("expected OpFanIn, got %v", result.Type)
+	}
+	if len(result.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(result.Children))
+	}
+
+	for _, line := range []string{"a1", "a2", "b1", "b2"} {
+		if !strings.Contains(string(result.Stdout), line) {
+			t.Errorf("expected output to contain %q, got: %s", line, result.Stdout)
+		}
+	}
+
+	if string(result.Children[1].Stdout) != "b1\nb2\n" {
+		t.Errorf("unexpected second producer output: %q", result.Children[1].Stdout)
+	}
+}
+
+func TestFanInOrdered(t *testing.T) {
+	// Test: output is grouped by producer, in producer order
+	ctx := context.Background()
+
+	// The first producer finishes last
+	slow, _ := NewExecutable("sh", "-c", "sleep 0.1; echo slow1; echo slow2")
+	fast, _ := NewExecutable("printf", "fast1\\nfast2\\n")
+
+	result, err := FanIn(slow, fast).Mode(MergeOrdered).Run(ctx)
+	if err != nil {
+		t.Fatalf("fan-in failed: %v", err)
+	}
+
+	expected := "slow1\nslow2\nfast1\nfast2\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("expected %q, got %q", expected, result.Stdout)
+	}
+}
+
+func TestFanInMergeByKey(t *testing.T) {
+	// Test: sorted shards are merged like sort -m
+	ctx := context.Background()
+
+	shard1, _ := NewExecutable("printf", "apple\\ncherry\\nmango\\n")
+	shard2, _ := NewExecutable("printf", "banana\\ndate\\n")
+	shard3, _ := NewExecutable("printf", "fig\\n")
+
+	result, err := FanIn(shard1, shard2, shard3).Mode(MergeByKey).Run(ctx)
+	if err != nil {
+		t.Fatalf("fan-in failed: %v", err)
+	}
+
+	expected := "apple\nbanana\ncherry\ndate\nfig\nmango\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("expected %q, got %q", expected, result.Stdout)
+	}
+}
+
+func TestFanInCustomKey(t *testing.T) {
+	// Test: merge on the second field of each line
+	ctx := context.Background()
+
+	shard1, _ := NewExecutable("printf", "x 1\\ny 3\\n")
+	shard2, _ := NewExecutable("printf", "z 2\\nw 4\\n")
+
+	second := func(line []byte) string {
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			return ""
+		}
+		return fields[1]
+	}
+
+	result, err := FanIn(shard1, shard2).Key(second).Run(ctx)
+	if err != nil {
+		t.Fatalf("fan-in failed: %v", err)
+	}
+
+	expected := "x 1\nz 2\ny 3\nw 4\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("expected %q, got %q", expected, result.Stdout)
+	}
+}
+
+func TestFanInProducerFailure(t *testing.T) {
+	// Test: a failing producer fails the merge but keeps other output
+	ctx := context.Background()
+
+	ok, _ := NewExecutable("echo", "fine")
+	failing, _ := NewExecutable("sh", "-c", "exit 2")
+
+	result, err := FanIn(ok, failing).Run(ctx)
+	if err == nil {
+		t.Fatal("expected error from failing producer")
+	}
+	if result.ExitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", result.ExitCode)
+	}
+	if !strings.Contains(string(result.Stdout), "fine") {
+		t.Errorf("expected output from successful producer, got: %s", result.Stdout)
+	}
+}
+
+func TestFanInLongLines(t *testing.T) {
+	// Test: a larger buffer allows merging very long lines
+	ctx := context.Background()
+
+	long, _ := NewExecutable("sh", "-c", "head -c 100000 /dev/zero | tr '\\0' a; echo")
+	short, _ := NewExecutable("echo", "b")
+
+	if _, err := FanIn(long, short).Run(ctx); err == nil {
+		t.Error("expected line length error with default buffer")
+	}
+
+	long, _ = NewExecutable("sh", "-c", "head -c 100000 /dev/zero | tr '\\0' a; echo")
+	result, err := FanIn(long, short).Mode(MergeOrdered).Buffer(4096, 1<<20).Run(ctx)
+	if err != nil {
+		t.Fatalf("fan-in failed: %v", err)
+	}
+	if len(result.Stdout) != 100003 {
+		t.Errorf("expected 100003 bytes, got %d", len(result.Stdout))
+	}
+}
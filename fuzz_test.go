@@ -0,0 +1,256 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// FuzzOperatorTree builds operator trees of builtins from the fuzzer input,
+// runs them without spawning processes and compares the exit code with a
+// model of the shell semantics. Crashes, hangs and wrong codes fail the run
+//
+//	go test -run '^$' -fuzz FuzzOperatorTree
+func FuzzOperatorTree(f *testing.F) {
+	f.Add([]byte{0})
+	f.Add([]byte{3, 0, 1})          // true && false
+	f.Add([]byte{4, 1, 0})          // false || true
+	f.Add([]byte{2, 1, 0})          // false | true
+	f.Add([]byte{2, 5, 1, 1})       // (false &) | false
+	f.Add([]byte{7, 3, 1, 2, 0, 1}) // fan-in
+	f.Add([]byte{6, 1, 1})          // when[false](false)
+	f.Add([]byte{3, 8, 1, 2, 8, 0, 1})
+	f.Add([]byte{9, 1, 0}) // false; true
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d := &treeDecoder{data: data}
+		tree := d.decode(0)
+		exec := tree.build()
+
+		done := make(chan *Result, 1)
+		go func() {
+			result, _ := exec.Run(context.Background())
+			done <- result
+		}()
+		select {
+		case result := <-done:
+			if want := tree.eval(); result.ExitCode != want {
+				t.Errorf("%s: expected exit code %d, got %d", tree, want, result.ExitCode)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: did not finish", tree)
+		}
+	})
+}
+
+// FuzzParse parses fuzzed command lines without running them. Parse must not
+// panic, and the String of a parsed line must parse back to the same String
+//
+//	go test -run '^$' -fuzz FuzzParse
+func FuzzParse(f *testing.F) {
+	f.Add("cat log | grep err && echo ok || echo fail &")
+	f.Add(`echo 'a b' "c \"d\"" e\ f # comment`)
+	f.Add("(make 2>&1 > build.log) 2> err.log | sort < input &")
+	f.Add("a > f 2>&1 & b >> g")
+
+	f.Fuzz(func(t *testing.T, cmdline string) {
+		exec, err := Parse(cmdline)
+		if err != nil {
+			return
+		}
+		s := fmt.Sprint(exec)
+		again, err := Parse(s)
+		if err != nil {
+			t.Fatalf("%q: String %q does not parse: %v", cmdline, s, err)
+		}
+		if got := fmt.Sprint(again); got != s {
+			t.Errorf("%q: String %q parses to %q", cmdline, s, got)
+		}
+	})
+}
+
+// fuzzOp is an operator of a fuzzed tree
+type fuzzOp int
+
+const (
+	fuzzTrue fuzzOp = iota
+	fuzzFalse
+	fuzzPipe
+	fuzzAnd
+	fuzzOr
+	fuzzBackground
+	fuzzWhen
+	fuzzFanIn
+	fuzzLazy
+	fuzzSeq
+)
+
+// fuzzNode is a tree decoded from fuzzer input, built into an Executable and
+// evaluated by the model
+type fuzzNode struct {
+	op   fuzzOp
+	kids []*fuzzNode
+	cond bool // with fuzzWhen
+}
+
+// treeDecoder turns arbitrary bytes into a tree of bounded depth
+type treeDecoder struct {
+	data []byte
+}
+
+func (d *treeDecoder) next() byte {
+	if len(d.data) == 0 {
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *treeDecoder) decode(depth int) *fuzzNode {
+	op := fuzzOp(d.next() % 10)
+	if depth >= 6 {
+		op %= 2
+	}
+	n := &fuzzNode{op: op}
+	switch op {
+	case fuzzPipe, fuzzAnd, fuzzOr, fuzzSeq:
+		n.kids = []*fuzzNode{d.decode(depth + 1), d.decode(depth + 1)}
+	case fuzzBackground, fuzzLazy:
+		n.kids = []*fuzzNode{d.decode(depth + 1)}
+	case fuzzWhen:
+		n.cond = d.next()%2 == 0
+		n.kids = []*fuzzNode{d.decode(depth + 1)}
+	case fuzzFanIn:
+		for range 1 + int(d.next()%3) {
+			n.kids = append(n.kids, d.decode(depth+1))
+		}
+	}
+	return n
+}
+
+func (n *fuzzNode) build() Executable {
+	switch n.op {
+	case fuzzTrue:
+		return True()
+	case fuzzFalse:
+		return False()
+	case fuzzPipe:
+		return n.kids[0].build().Pipe(n.kids[1].build())
+	case fuzzAnd:
+		return n.kids[0].build().And(n.kids[1].build())
+	case fuzzOr:
+		return n.kids[0].build().Or(n.kids[1].build())
+	case fuzzSeq:
+		return n.kids[0].build().Then(n.kids[1].build())
+	case fuzzBackground:
+		return n.kids[0].build().Background()
+	case fuzzWhen:
+		return When(func(context.Context) bool { return n.cond }, n.kids[0].build())
+	case fuzzFanIn:
+		producers := make([]Executable, len(n.kids))
+		for i, kid := range n.kids {
+			producers[i] = kid.build()
+		}
+		return FanIn(producers...)
+	default:
+		return Lazy(func(context.Context, *Result) (Executable, error) {
+			return n.kids[0].build(), nil
+		})
+	}
+}
+
+// eval returns the exit code the shell semantics give n
+func (n *fuzzNode) eval() int {
+	switch n.op {
+	case fuzzTrue:
+		return 0
+	case fuzzFalse:
+		return 1
+	case fuzzPipe:
+		// a | b & runs as (a | b) &
+		if n.background() {
+			return 0
+		}
+		return n.evalStage()
+	case fuzzAnd:
+		if code := n.kids[0].eval(); code != 0 {
+			return code
+		}
+		return n.kids[1].eval()
+	case fuzzOr:
+		if n.kids[0].eval() == 0 {
+			return 0
+		}
+		return n.kids[1].eval()
+	case fuzzSeq:
+		n.kids[0].eval()
+		return n.kids[1].eval()
+	case fuzzBackground:
+		return 0
+	case fuzzWhen:
+		if !n.cond {
+			return 0
+		}
+		return n.kids[0].eval()
+	case fuzzFanIn:
+		for _, kid := range n.kids {
+			if code := kid.evalStage(); code != 0 {
+				return code
+			}
+		}
+		return 0
+	default:
+		return n.kids[0].eval()
+	}
+}
+
+// evalStage returns the exit code of n run as the stages of a pipe chain,
+// where the first failing stage fails the pipe
+func (n *fuzzNode) evalStage() int {
+	if n.op != fuzzPipe {
+		return n.eval()
+	}
+	if code := n.kids[0].evalStage(); code != 0 {
+		return code
+	}
+	return n.kids[1].evalStage()
+}
+
+// background reports whether a stage of the pipe n runs in the background
+func (n *fuzzNode) background() bool {
+	switch n.op {
+	case fuzzBackground:
+		return true
+	case fuzzPipe:
+		return n.kids[0].background() || n.kids[1].background()
+	default:
+		return false
+	}
+}
+
+func (n *fuzzNode) String() string {
+	switch n.op {
+	case fuzzTrue:
+		return "true"
+	case fuzzFalse:
+		return "false"
+	case fuzzPipe:
+		return fmt.Sprintf("(%s | %s)", n.kids[0], n.kids[1])
+	case fuzzAnd:
+		return fmt.Sprintf("(%s && %s)", n.kids[0], n.kids[1])
+	case fuzzOr:
+		return fmt.Sprintf("(%s || %s)", n.kids[0], n.kids[1])
+	case fuzzSeq:
+		return fmt.Sprintf("(%s; %s)", n.kids[0], n.kids[1])
+	case fuzzBackground:
+		return fmt.Sprintf("(%s &)", n.kids[0])
+	case fuzzWhen:
+		return fmt.Sprintf("when[%v](%s)", n.cond, n.kids[0])
+	case fuzzFanIn:
+		return fmt.Sprintf("fan-in%v", n.kids)
+	default:
+		return fmt.Sprintf("lazy(%s)", n.kids[0])
+	}
+}
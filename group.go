@@ -0,0 +1,121 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Group runs executables and Go functions concurrently with shared cancellation,
+// like errgroup: the first error cancels the context of every other member
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+
+	mu      sync.Mutex
+	results []*Result
+	stagger time.Duration // delay between the starts of members
+	members int           // number of members started with Go or GoFunc
+}
+
+// NewGroup creates a Group and the context shared by its members
+// The context is cancelled when a member fails or when Wait returns
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel}, ctx
+}
+
+// Stagger starts the members added afterwards interval apart, avoiding a
+// thundering herd when many identical commands hit a shared resource
+func (g *Group) Stagger(interval time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stagger = interval
+	g.members = 0
+}
+
+// startDelay returns how long the next member waits before it starts
+func (g *Group) startDelay() time.Duration {
+	delay := staggerDelay(g.stagger, g.members)
+	g.members++
+	return delay
+}
+
+// staggerDelay returns how long the nth start waits when starts are interval apart
+func staggerDelay(interval time.Duration, n int) time.Duration {
+	return interval * time.Duration(n)
+}
+
+// Go runs exec in a new goroutine with the group context
+func (g *Group) Go(exec Executable) {
+	g.mu.Lock()
+	idx := len(g.results)
+	g.results = append(g.results, nil)
+	delay := g.startDelay()
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+
+		if err := sleepContext(g.ctx, delay); err != nil {
+			g.mu.Lock()
+			g.results[idx] = &Result{Type: OpSingle, Skipped: true, Error: err, ExitCode: -1}
+			g.mu.Unlock()
+			return
+		}
+		result, err := exec.Run(g.ctx)
+		g.mu.Lock()
+		g.results[idx] = result
+		g.mu.Unlock()
+		g.fail(err)
+	}()
+}
+
+// GoFunc runs fn in a new goroutine with the group context
+func (g *Group) GoFunc(fn func(ctx context.Context) error) {
+	g.mu.Lock()
+	delay := g.startDelay()
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if sleepContext(g.ctx, delay) != nil {
+			return
+		}
+		g.fail(fn(g.ctx))
+	}()
+}
+
+// Wait blocks until every member returns and returns the first error, if any
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+// Results returns the results of the executables started with Go, in call order
+// It must be called after Wait
+func (g *Group) Results() []*Result {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Result(nil), g.results...)
+}
+
+// fail records the first error and cancels the group
+func (g *Group) fail(err error) {
+	// A cancelled branch was stopped on purpose, the rest of the group keeps running
+	if err == nil || errors.Is(err, ErrBranchCancelled) {
+		return
+	}
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
@@ -0,0 +1,104 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroupSuccess(t *testing.T) {
+	// Test: executables and functions all run, results keep call order
+	g, _ := NewGroup(context.Background())
+
+	first, _ := NewExecutable("echo", "one")
+	second, _ := NewExecutable("echo", "two")
+	g.Go(first)
+	g.Go(second)
+
+	called := false
+	g.GoFunc(func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		t.Fatalf("group failed: %v", err)
+	}
+	if !called {
+		t.Error("expected function to run")
+	}
+
+	results := g.Results()
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if string(results[0].Stdout) != "one\n" || string(results[1].Stdout) != "two\n" {
+		t.Errorf("unexpected outputs: %q, %q", results[0].Stdout, results[1].Stdout)
+	}
+}
+
+func TestGroupFuncErrorCancelsProcess(t *testing.T) {
+	// Test: a failing function stops a long running process
+	g, _ := NewGroup(context.Background())
+
+	sleep, _ := NewExecutable("sleep", "10")
+	g.Go(sleep)
+
+	boom := errors.New("boom")
+	g.GoFunc(func(ctx context.Context) error {
+		return boom
+	})
+
+	start := time.Now()
+	if err := g.Wait(); !errors.Is(err, boom) {
+		t.Errorf("expected function error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("process was not cancelled")
+	}
+}
+
+func TestGroupProcessErrorCancelsFunc(t *testing.T) {
+	// Test: a failing process cancels the context seen by functions
+	g, ctx := NewGroup(context.Background())
+
+	failing, _ := NewExecutable("sh", "-c", "exit 3")
+	g.Go(failing)
+
+	g.GoFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := g.Wait()
+	if err == nil {
+		t.Fatal("expected error from failing process")
+	}
+	if ctx.Err() == nil {
+		t.Error("expected group context to be cancelled")
+	}
+	if code := g.Results()[0].ExitCode; code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+}
+
+func TestGroupStagger(t *testing.T) {
+	// Test: members start interval apart
+	g, _ := NewGroup(context.Background())
+	g.Stagger(100 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		noop, _ := NewExecutable("true")
+		g.Go(noop)
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := g.Results()
+	for i := 1; i < len(results); i++ {
+		if gap := results[i].Start.Sub(results[i-1].Start); gap < 90*time.Millisecond {
+			t.Errorf("member %d started %v after the previous one", i, gap)
+		}
+	}
+}
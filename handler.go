@@ -0,0 +1,98 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"runtime/debug"
+)
+
+// WithStdoutHandler passes each line of stdout to handler as it is read,
+// without the newline, instead of capturing it in Result.Stdout
+// The line is only valid during the call. Memory use is bounded by the
+// longest line, so high-volume commands can run for as long as needed
+// WithMaxOutputSize and WithOutputLimitPolicy apply to the handled bytes,
+// while the default limit of captured output does not
+func WithStdoutHandler(handler func(line []byte)) Option {
+	return func(o *Options) {
+		o.StdoutHandler = handler
+	}
+}
+
+// WithStderrHandler passes each line of stderr to handler as it is read,
+// instead of capturing it in Result.Stderr, like WithStdoutHandler
+func WithStderrHandler(handler func(line []byte)) Option {
+	return func(o *Options) {
+		o.StderrHandler = handler
+	}
+}
+
+// readHandled reads r to the end, passing each line to handler, and reports
+// whether output was dropped. With a positive max only the first max bytes
+// are passed on like in readOutput: exceeded, if set, is called as soon as r
+// has more and the rest is drained. A panic of handler stops reading and is
+// returned with its stack
+func readHandled(r io.Reader, color ColorPolicy, max int64, exceeded func(), handler func(line []byte)) (truncated bool, panicErr *PanicError) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicErr = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+	src := r
+	if max > 0 {
+		src = io.LimitReader(r, max)
+	}
+	br := bufio.NewReader(src)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// Gather a line longer than the buffer
+			long := append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull {
+				line, err = br.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if len(line) > 0 {
+			handler(captureOutput(color, bytes.TrimSuffix(line, []byte("\n"))))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if max <= 0 {
+		return false, nil
+	}
+	var next [1]byte
+	if n, _ := io.ReadFull(r, next[:]); n == 0 {
+		return false, nil
+	}
+	if exceeded != nil {
+		exceeded()
+	}
+	io.Copy(io.Discard, r)
+	return true, nil
+}
+
+// stopForPanic records the panic of an output handler, which runs on a reader
+// goroutine, and stops the process so the visitor can raise it again
+func (p *ProcessRunner) stopForPanic(err *PanicError) {
+	p.mu.Lock()
+	p.panicked = err
+	p.mu.Unlock()
+	p.kill(err)
+	p.closeOutput()
+}
+
+// raisePanic panics on the visitor goroutine with the panic of an output
+// handler of the exited process, so ExecutionVisitor.run recovers it
+func (p *ProcessRunner) raisePanic() {
+	p.mu.Lock()
+	err := p.panicked
+	p.mu.Unlock()
+	if err != nil {
+		panic(err)
+	}
+}
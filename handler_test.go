@@ -0,0 +1,80 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOutputHandlers(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	script := "echo one; echo two >&2; echo three; printf " + long + "; printf 'last'"
+
+	tests := []struct {
+		name       string
+		opts       func(stdout, stderr *[]string) []Option
+		pipe       bool
+		wantStdout []string
+		wantStderr []string
+		wantResult string
+	}{
+		{
+			// Test: both streams are passed line by line and not captured
+			name: "stdout and stderr",
+			opts: func(stdout, stderr *[]string) []Option {
+				return []Option{
+					WithStdoutHandler(func(line []byte) { *stdout = append(*stdout, string(line)) }),
+					WithStderrHandler(func(line []byte) { *stderr = append(*stderr, string(line)) }),
+				}
+			},
+			wantStdout: []string{"one", "three", long + "last"},
+			wantStderr: []string{"two"},
+		},
+		{
+			// Test: a stream without handler is still captured
+			name: "stderr only",
+			opts: func(stdout, stderr *[]string) []Option {
+				return []Option{WithStderrHandler(func(line []byte) { *stderr = append(*stderr, string(line)) })}
+			},
+			wantStderr: []string{"two"},
+			wantResult: "one\nthree\n" + long + "last",
+		},
+		{
+			// Test: the handler of the last stage of a pipe receives the pipe output
+			name: "pipe",
+			opts: func(stdout, stderr *[]string) []Option {
+				return []Option{WithStdoutHandler(func(line []byte) { *stdout = append(*stdout, string(line)) })}
+			},
+			pipe:       true,
+			wantStdout: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr []string
+			var exec Executable
+			if tt.pipe {
+				source, _ := NewExecutable("printf", `a\nb`)
+				cat, _ := Command("cat", nil, tt.opts(&stdout, &stderr)...)
+				exec = source.Pipe(cat)
+			} else {
+				exec, _ = Command("sh", []string{"-c", script}, tt.opts(&stdout, &stderr)...)
+			}
+
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if strings.Join(stdout, "|") != strings.Join(tt.wantStdout, "|") {
+				t.Errorf("expected stdout lines %q, got %q", tt.wantStdout, stdout)
+			}
+			if strings.Join(stderr, "|") != strings.Join(tt.wantStderr, "|") {
+				t.Errorf("expected stderr lines %q, got %q", tt.wantStderr, stderr)
+			}
+			if string(result.Stdout) != tt.wantResult {
+				t.Errorf("expected captured stdout %q, got %q", tt.wantResult, result.Stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+)
+
+// LazyFunc builds an Executable at run time
+// prior is the result of the executable run before it with And or Or, or nil
+type LazyFunc func(ctx context.Context, prior *Result) (Executable, error)
+
+// LazyStage is an Executable whose definition is built when it runs, so its command
+// and arguments can depend on earlier results
+type LazyStage struct {
+	node
+	build LazyFunc
+}
+
+// Lazy creates a stage built by build when it runs
+// When it is the right side of And or Or, build gets the result of the left side
+// In a pipe it is built when the pipe starts, and only a built process reads
+// the output of the previous stage
+func Lazy(build LazyFunc) *LazyStage {
+	l := &LazyStage{
+		build: build,
+	}
+	l.node = newNode(l)
+	return l
+}
+
+// String describes the stage, whose command is only known at run time
+func (l *LazyStage) String() string {
+	return "<lazy>"
+}
+
+// resolve builds the executable, applying the settings of l
+func (l *LazyStage) resolve(ctx context.Context, prior *Result) (Executable, error) {
+	exec, err := l.build(ctx, prior)
+	if err != nil {
+		return nil, fmt.Errorf("lazy stage: %w", err)
+	}
+	if exec == nil {
+		return nil, fmt.Errorf("lazy stage: built a nil executable")
+	}
+	return exec.WithShutdownTimeout(l.settings.shutdownTimeout).WithProgressTimeout(l.settings.progressTimeout), nil
+}
+
+// Run builds the executable without a prior result and runs it using the visitor pattern
+func (l *LazyStage) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, l.settings)
+	return visitor.run(l, func() (*Result, error) {
+		return visitor.VisitLazy(l, nil)
+	})
+}
+
+// clone returns a copy of l, so With* methods never modify a shared definition
+func (l *LazyStage) clone() *LazyStage {
+	clone := *l
+	clone.self = &clone
+	return &clone
+}
+
+func (l *LazyStage) configure(edit func(*settings)) Executable {
+	clone := l.clone()
+	edit(&clone.settings)
+	return clone
+}
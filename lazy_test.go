@@ -0,0 +1,55 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	// Test: the stage is built from the prior result at run time
+	ctx := context.Background()
+	version, _ := NewExecutable("echo", "v1.2.3")
+	tag := Lazy(func(ctx context.Context, prior *Result) (Executable, error) {
+		return NewExecutable("echo", "release-"+strings.TrimSpace(string(prior.Stdout)))
+	})
+
+	result, err := version.And(tag).Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Stdout) != "release-v1.2.3\n" {
+		t.Errorf("unexpected output %q", result.Stdout)
+	}
+}
+
+func TestLazyInPipe(t *testing.T) {
+	// Test: a lazy process stage reads the output of the previous stage
+	ctx := context.Background()
+	source, _ := NewExecutable("printf", "a\\nb\\na\\n")
+	count := Lazy(func(ctx context.Context, prior *Result) (Executable, error) {
+		return NewExecutable("grep", "-c", "a")
+	})
+
+	result, err := source.Pipe(count).Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result.Stdout) != "2\n" {
+		t.Errorf("unexpected output %q", result.Stdout)
+	}
+}
+
+func TestLazyBuildError(t *testing.T) {
+	// Test: a failing factory fails the stage
+	errBuild := errors.New("no target")
+	failing := Lazy(func(ctx context.Context, prior *Result) (Executable, error) {
+		return nil, errBuild
+	})
+
+	result, err := failing.Run(context.Background())
+	if !errors.Is(err, errBuild) || result.ExitCode != -1 {
+		t.Errorf("expected build error, got %v (exit %d)", err, result.ExitCode)
+	}
+}
@@ -0,0 +1,186 @@
+package subprocess
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+const (
+	limitPollInterval = 50 * time.Millisecond  // how often resource limits are checked
+	diskPollInterval  = 500 * time.Millisecond // how often directory sizes are computed
+)
+
+// CPULimitError reports a process that was killed for using too much CPU time
+type CPULimitError struct {
+	Limit time.Duration // configured CPU time limit
+	Used  time.Duration // CPU time used when the process was killed
+}
+
+func (e *CPULimitError) Error() string {
+	return fmt.Sprintf("cpu limit exceeded: used %v of %v", e.Used, e.Limit)
+}
+
+// MemoryLimitError reports a process that was killed for using too much memory
+type MemoryLimitError struct {
+	Limit int64 // configured limit in bytes
+	Peak  int64 // peak resident set size in bytes
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("memory limit exceeded: peak %d bytes of %d", e.Peak, e.Limit)
+}
+
+// DiskLimitError reports a process that was killed for filling a directory
+type DiskLimitError struct {
+	Dir   string // monitored directory
+	Limit int64  // configured limit in bytes
+	Used  int64  // size of the directory when the process was killed
+}
+
+func (e *DiskLimitError) Error() string {
+	return fmt.Sprintf("disk limit exceeded: %s uses %d bytes of %d", e.Dir, e.Used, e.Limit)
+}
+
+// WithCPULimit kills the process once it has used more than limit CPU time
+// (user and system time, including waited-for children), unlike a context
+// timeout which counts wall time. Usage is polled, so the process may run
+// slightly over the limit. Only supported on Linux
+func WithCPULimit(limit time.Duration) Option {
+	return func(o *Options) {
+		o.CPULimit = limit
+	}
+}
+
+// WithMemoryLimit kills the process once its resident set size exceeds limit
+// bytes. The peak usage is recorded in Result.PeakMemory. Only the process
+// itself is measured, not its descendants. Only supported on Linux
+func WithMemoryLimit(limit int64) Option {
+	return func(o *Options) {
+		o.MemoryLimit = limit
+	}
+}
+
+// WithDiskLimit kills the process once the total size of the files in dir
+// exceeds limit bytes, protecting hosts from tools that fill disks. An empty
+// dir monitors the working directory of the process. The size is computed
+// periodically, so the directory may grow slightly over the limit
+func WithDiskLimit(dir string, limit int64) Option {
+	return func(o *Options) {
+		o.DiskLimit = &DiskLimit{Dir: dir, Limit: limit}
+	}
+}
+
+// DiskLimit is a size limit on a directory written by a process
+type DiskLimit struct {
+	Dir   string // monitored directory, empty for the working directory
+	Limit int64  // maximum total size of its files in bytes
+}
+
+// hasLimits reports whether ops sets any resource limit
+func (o *Options) hasLimits() bool {
+	return o.CPULimit > 0 || o.MemoryLimit > 0 || o.DiskLimit != nil
+}
+
+// needsProcStats reports whether the limits of ops need per-process statistics
+func (o *Options) needsProcStats() bool {
+	return o.CPULimit > 0 || o.MemoryLimit > 0
+}
+
+// monitorLimits polls the resource usage of the process until it exits and
+// kills it when a limit is exceeded
+func (p *ProcessRunner) monitorLimits(ops *Options) {
+	pid := p.cmd.Process.Pid
+	ticker := time.NewTicker(limitPollInterval)
+	defer ticker.Stop()
+
+	var diskDir string
+	var lastDiskCheck time.Time
+	if ops.DiskLimit != nil {
+		diskDir = ops.DiskLimit.Dir
+		if diskDir == "" {
+			diskDir = ops.Dir
+		}
+		if diskDir == "" {
+			diskDir = "."
+		}
+	}
+
+	for {
+		var now time.Time
+		select {
+		case <-p.done:
+			return
+		case now = <-ticker.C:
+		}
+
+		if ops.DiskLimit != nil && now.Sub(lastDiskCheck) >= diskPollInterval {
+			lastDiskCheck = now
+			if used := dirSize(diskDir); used > ops.DiskLimit.Limit {
+				p.kill(&DiskLimitError{Dir: diskDir, Limit: ops.DiskLimit.Limit, Used: used})
+				return
+			}
+		}
+
+		if ops.CPULimit > 0 {
+			if used, err := cpuTime(pid); err == nil && used > ops.CPULimit {
+				p.kill(&CPULimitError{Limit: ops.CPULimit, Used: used})
+				return
+			}
+		}
+
+		if ops.MemoryLimit > 0 {
+			current, peak, err := memoryUsage(pid)
+			if err != nil {
+				continue
+			}
+			p.recordPeakMemory(peak)
+			if current > ops.MemoryLimit {
+				p.kill(&MemoryLimitError{Limit: ops.MemoryLimit, Peak: p.PeakMemory()})
+				return
+			}
+		}
+	}
+}
+
+// dirSize returns the total size of the regular files in dir
+// Files that disappear while walking are ignored
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// recordPeakMemory raises the recorded peak memory to peak
+func (p *ProcessRunner) recordPeakMemory(peak int64) {
+	p.mu.Lock()
+	p.peakMemory = max(p.peakMemory, peak)
+	p.mu.Unlock()
+}
+
+// PeakMemory returns the highest resident set size seen in bytes, only
+// measured when a memory limit is set
+func (p *ProcessRunner) PeakMemory() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peakMemory
+}
+
+// kill stops the process, Wait returns reason instead of the exit status
+func (p *ProcessRunner) kill(reason error) {
+	p.mu.Lock()
+	p.killedBy = reason
+	p.mu.Unlock()
+	p.Stop()
+}
@@ -0,0 +1,81 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTick is the unit of the times in /proc/<pid>/stat (USER_HZ)
+const clockTick = time.Second / 100
+
+// checkLimitsSupported reports whether CPU and memory limits can be enforced
+func checkLimitsSupported() error {
+	return nil
+}
+
+// cpuTime returns the user and system time used by pid and its waited-for children
+func cpuTime(pid int) (time.Duration, error) {
+	fields, err := procStat(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	// utime, stime, cutime and cstime are fields 14 to 17
+	var ticks int64
+	for _, field := range fields[11:15] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse /proc/%d/stat: %w", pid, err)
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * clockTick, nil
+}
+
+// memoryUsage returns the current and peak resident set size of pid in bytes
+func memoryUsage(pid int) (current, peak int64, err error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || (name != "VmRSS" && name != "VmHWM") {
+			continue
+		}
+		// Values are reported like "  1234 kB"
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse /proc/%d/status: %w", pid, err)
+		}
+		if name == "VmRSS" {
+			current = kb * 1024
+		} else {
+			peak = kb * 1024
+		}
+	}
+	return current, max(current, peak), nil
+}
+
+// procStat returns the fields of /proc/<pid>/stat after the command name
+// The first returned field is the state (field 3)
+func procStat(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The command name is in parentheses and may contain spaces
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("parse /proc/%d/stat: malformed", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 15 {
+		return nil, fmt.Errorf("parse /proc/%d/stat: too few fields", pid)
+	}
+	return fields, nil
+}
@@ -0,0 +1,72 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCPULimit(t *testing.T) {
+	// Test: a busy loop is killed once it used its CPU time
+	ctx := context.Background()
+	busy, _ := Command("sh", []string{"-c", "while :; do :; done"}, WithCPULimit(200*time.Millisecond))
+
+	start := time.Now()
+	result, err := busy.Run(ctx)
+
+	var cpuErr *CPULimitError
+	if !errors.As(err, &cpuErr) {
+		t.Fatalf("expected CPULimitError, got %v", err)
+	}
+	if cpuErr.Used < 200*time.Millisecond {
+		t.Errorf("expected usage above the limit, got %v", cpuErr.Used)
+	}
+	if result.ExitCode != -1 {
+		t.Errorf("expected exit code -1, got %d", result.ExitCode)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("process was not killed in time")
+	}
+}
+
+func TestCPULimitIgnoresWallTime(t *testing.T) {
+	// Test: a mostly idle process is not killed by its CPU limit
+	idle, _ := Command("sleep", []string{"0.3"}, WithCPULimit(100*time.Millisecond))
+	if _, err := idle.Run(context.Background()); err != nil {
+		t.Errorf("expected idle process to finish, got %v", err)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	// Test: tail buffering one endless line is killed above its memory limit
+	ctx := context.Background()
+	zeros, _ := NewExecutable("head", "-c", "1000000000", "/dev/zero")
+	tail, _ := Command("tail", []string{"-n", "1"}, WithMemoryLimit(50<<20))
+
+	result, _ := zeros.Pipe(tail).Run(ctx)
+
+	// head fails with a broken pipe once tail is killed
+	var memErr *MemoryLimitError
+	if err := result.Children[1].Error; !errors.As(err, &memErr) {
+		t.Fatalf("expected MemoryLimitError, got %v", err)
+	}
+	if memErr.Peak <= 50<<20 {
+		t.Errorf("expected peak above the limit, got %d", memErr.Peak)
+	}
+	if peak := result.Children[1].PeakMemory; peak != memErr.Peak {
+		t.Errorf("expected PeakMemory %d in the stage result, got %d", memErr.Peak, peak)
+	}
+}
+
+func TestMemoryLimitRecordsPeak(t *testing.T) {
+	// Test: the peak usage is recorded for processes within their limit
+	sleep, _ := Command("sleep", []string{"0.2"}, WithMemoryLimit(1<<30))
+	result, err := sleep.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if result.PeakMemory <= 0 {
+		t.Errorf("expected peak memory to be recorded, got %d", result.PeakMemory)
+	}
+}
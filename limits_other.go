@@ -0,0 +1,21 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"errors"
+	"time"
+)
+
+// checkLimitsSupported reports whether CPU and memory limits can be enforced
+func checkLimitsSupported() error {
+	return errors.New("CPU and memory limits are only supported on Linux")
+}
+
+func cpuTime(pid int) (time.Duration, error) {
+	return 0, checkLimitsSupported()
+}
+
+func memoryUsage(pid int) (current, peak int64, err error) {
+	return 0, 0, checkLimitsSupported()
+}
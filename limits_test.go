@@ -0,0 +1,38 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiskLimit(t *testing.T) {
+	// Test: a process filling its working directory is killed
+	dir := t.TempDir()
+	writer, _ := Command("sh", []string{"-c", "while :; do head -c 100000 /dev/zero >> log; sleep 0.01; done"},
+		WithDir(dir), WithDiskLimit("", 1<<20))
+
+	start := time.Now()
+	_, err := writer.Run(context.Background())
+
+	var diskErr *DiskLimitError
+	if !errors.As(err, &diskErr) {
+		t.Fatalf("expected DiskLimitError, got %v", err)
+	}
+	if diskErr.Dir != dir || diskErr.Used <= 1<<20 {
+		t.Errorf("unexpected error details: %v", diskErr)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("process was not killed in time")
+	}
+}
+
+func TestDiskLimitWithinLimit(t *testing.T) {
+	// Test: processes below the limit are not affected
+	dir := t.TempDir()
+	writer, _ := Command("sh", []string{"-c", "echo small > out; sleep 0.6"}, WithDiskLimit(dir, 1<<20), WithDir(dir))
+	if _, err := writer.Run(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package subprocess
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// lockPollInterval is how often a busy lock file is tried again
+const lockPollInterval = 20 * time.Millisecond
+
+// WithMutexKey serializes the runs of every process sharing key within this
+// program, for non-reentrant tools like database migrations. The process waits
+// for the key before it starts and holds it until it exits. Waiting ends with
+// an error when the context is done. Never use the same key twice in a pipe:
+// the second stage would wait for the first one forever
+func WithMutexKey(key string) Option {
+	return func(o *Options) {
+		o.MutexKey = key
+	}
+}
+
+// WithLockFile serializes the runs of every process sharing the lock file
+// path, also across programs, like WithMutexKey. The file is created if needed
+// and locked with flock, so it must be on a local file system
+// Only supported on Unix
+func WithLockFile(path string) Option {
+	return func(o *Options) {
+		o.LockFile = path
+	}
+}
+
+// keyLocks holds one single slot semaphore per mutex key
+var keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// lockKey waits until key is free or ctx is done, and returns the unlock function
+func lockKey(ctx context.Context, key string) (func(), error) {
+	keyLocks.mu.Lock()
+	if keyLocks.locks == nil {
+		keyLocks.locks = make(map[string]chan struct{})
+	}
+	lock, ok := keyLocks.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		keyLocks.locks[key] = lock
+	}
+	keyLocks.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireLocks takes the mutex key and lock file of ops, in that order, and
+// returns the function releasing them
+func acquireLocks(ctx context.Context, ops *Options) (func(), error) {
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+
+	if ops.MutexKey != "" {
+		unlock, err := lockKey(ctx, ops.MutexKey)
+		if err != nil {
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	if ops.LockFile != "" {
+		unlock, err := lockFile(ctx, ops.LockFile)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
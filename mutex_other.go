@@ -0,0 +1,13 @@
+//go:build !unix
+
+package subprocess
+
+import (
+	"context"
+	"errors"
+)
+
+// lockFile locks path across programs
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return nil, errors.New("WithLockFile is only supported on Unix")
+}
@@ -0,0 +1,52 @@
+package subprocess
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMutexKey(t *testing.T) {
+	// Test: runs sharing a key or lock file never overlap
+	lockPath := filepath.Join(t.TempDir(), "lock")
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"key", WithMutexKey("test-mutex")},
+		{"lock file", WithLockFile(lockPath)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sleep, _ := Command("sleep", []string{"0.2"}, tt.opt)
+
+			g, _ := NewGroup(context.Background())
+			start := time.Now()
+			g.Go(sleep)
+			g.Go(sleep)
+			if err := g.Wait(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+				t.Errorf("expected runs to be serialized, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestMutexKeyContext(t *testing.T) {
+	// Test: waiting for a busy key ends with the context
+	holder, _ := Command("sleep", []string{"1"}, WithMutexKey("test-busy"))
+	waiter, _ := Command("true", nil, WithMutexKey("test-busy"))
+
+	go holder.Run(context.Background())
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := waiter.Run(ctx); err == nil {
+		t.Error("expected error while the key is held")
+	}
+}
@@ -0,0 +1,25 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNoNetwork(t *testing.T) {
+	// Test: only the loopback interface exists in the stage
+	ctx := context.Background()
+	netdev, _ := Command("tail", []string{"-n", "+3", "/proc/net/dev"}, WithNoNetwork())
+
+	result, err := netdev.Run(ctx)
+	if err != nil {
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Stdout)), "\n")
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "lo:") {
+			t.Errorf("unexpected interface: %q", line)
+		}
+	}
+}
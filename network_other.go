@@ -0,0 +1,13 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// isolateNetwork runs cmd without network access
+func isolateNetwork(cmd *exec.Cmd) error {
+	return errors.New("WithNoNetwork is only supported on Linux")
+}
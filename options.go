@@ -0,0 +1,212 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// Option configures a Process
+type Option func(*Options)
+
+// StdinPolicy controls when the engine closes the stdin of a stage
+type StdinPolicy int
+
+const (
+	StdinCloseOnEOF       StdinPolicy = iota // Close once upstream output reaches EOF (default)
+	StdinCloseImmediately                    // Close as soon as the stage starts, upstream output is discarded
+	StdinKeepOpen                            // Never close, stdin stays open until the stage exits
+)
+
+// String returns a string representation of the stdin policy
+func (s StdinPolicy) String() string {
+	switch s {
+	case StdinCloseOnEOF:
+		return "close-on-eof"
+	case StdinCloseImmediately:
+		return "close-immediately"
+	case StdinKeepOpen:
+		return "keep-open"
+	default:
+		return "unknown"
+	}
+}
+
+// WithStdinPolicy sets when the engine closes the stdin of the process
+// Some tools (ffmpeg, interactive database clients) need stdin kept open
+// or closed at a specific point instead of after upstream EOF
+func WithStdinPolicy(policy StdinPolicy) Option {
+	return func(o *Options) {
+		o.StdinPolicy = policy
+	}
+}
+
+// WithDir sets the working directory of the process
+func WithDir(dir string) Option {
+	return func(o *Options) {
+		o.Dir = dir
+	}
+}
+
+// WithEnv sets the environment of the process in "key=value" form,
+// replacing the inherited environment
+func WithEnv(env ...string) Option {
+	return func(o *Options) {
+		o.Env = slices.Clone(env)
+	}
+}
+
+// WithEnvMap sets the environment of the process from a map,
+// replacing the inherited environment
+func WithEnvMap(env map[string]string) Option {
+	return func(o *Options) {
+		o.Env = envList(env)
+	}
+}
+
+// WithEnvOverrides keeps the inherited environment, or the one set by WithEnv,
+// and sets the given variables on top of it. Later calls add to earlier ones
+func WithEnvOverrides(env map[string]string) Option {
+	return func(o *Options) {
+		o.EnvOverrides = mergeEnv(o.EnvOverrides, envList(env))
+	}
+}
+
+// envList returns env in "key=value" form, sorted by key
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		list = append(list, key+"="+env[key])
+	}
+	return list
+}
+
+// WithCombinedOutput captures stderr after stdout in Result.Stdout, leaving
+// Result.Stderr empty, like reading ReaderWriter
+func WithCombinedOutput() Option {
+	return func(o *Options) {
+		o.CombinedOutput = true
+	}
+}
+
+// WithStdout copies the stdout of the process to w as it is read, e.g. to
+// show progress on os.Stdout while the output is still captured
+// w must not block, as it slows down the process, and its errors are ignored
+func WithStdout(w io.Writer) Option {
+	return func(o *Options) {
+		o.StdoutSink = w
+	}
+}
+
+// WithStderr copies the stderr of the process to w as it is read, like WithStdout
+func WithStderr(w io.Writer) Option {
+	return func(o *Options) {
+		o.StderrSink = w
+	}
+}
+
+// WithStdin makes the process read r as its stdin, like "cmd < file"
+// In a pipe the stage reads r and the output of the previous stage is discarded
+// r is consumed by the first run, so it should not be shared by concurrent runs
+func WithStdin(r io.Reader) Option {
+	return func(o *Options) {
+		o.Stdin, o.StdinData, o.StdinFile = r, nil, ""
+	}
+}
+
+// DeadlineNotice tells a process that the deadline of its context is close,
+// so cooperative tools can checkpoint before they are killed
+type DeadlineNotice struct {
+	Before time.Duration // how long before the deadline to notify
+	Signal os.Signal     // sent to the process when set, e.g. syscall.SIGUSR1
+	Line   string        // written to stdin followed by a newline when set, stdin must still be open
+}
+
+// WithDeadlineNotice notifies the process notice.Before its context deadline
+// Nothing is sent when the context has no deadline
+func WithDeadlineNotice(notice DeadlineNotice) Option {
+	return func(o *Options) {
+		o.DeadlineNotice = &notice
+	}
+}
+
+// Heartbeat periodically writes to the stdin of a process, for tools that
+// exit or time out when their input stays silent
+type Heartbeat struct {
+	Interval time.Duration // how often Data is written
+	Data     []byte        // written on every beat, a newline when empty
+}
+
+// WithHeartbeat writes data to the stdin of the process every interval until
+// it exits or its stdin is closed. Heartbeats are written between other writes,
+// so use it with StdinKeepOpen or a stdin that carries no other data
+// Heartbeats do not count as pipe progress: a stage that stops producing output
+// is still caught by the progress timeout, while output the child prints in
+// reply (its own heartbeats) keeps the pipe alive
+func WithHeartbeat(interval time.Duration, data []byte) Option {
+	return func(o *Options) {
+		o.Heartbeat = &Heartbeat{Interval: interval, Data: slices.Clone(data)}
+	}
+}
+
+// WithNoNetwork runs the process in a new network namespace without any
+// interface but a down loopback, so it is guaranteed to be offline. This makes
+// build steps hermetic and surfaces hidden network dependencies as failures
+// Only supported on Linux; without root it needs unprivileged user namespaces
+func WithNoNetwork() Option {
+	return func(o *Options) {
+		o.NoNetwork = true
+	}
+}
+
+// WithDelay waits d before starting the process, e.g. to give a server
+// started in the background time to listen. The wait ends early with an
+// error when the context is done
+func WithDelay(d time.Duration) Option {
+	return func(o *Options) {
+		o.Delay = d
+	}
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithMetadata annotates the process with key and value, copied to
+// Result.Metadata of every run, e.g. the artifact path a build step produces
+func WithMetadata(key string, value any) Option {
+	return func(o *Options) {
+		o.Metadata = maps.Clone(o.Metadata)
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]any)
+		}
+		o.Metadata[key] = value
+	}
+}
+
+// diagnosticsTimeout bounds the diagnostics run after a failure
+const diagnosticsTimeout = 30 * time.Second
+
+// WithDiagnostics runs cmds when the process fails and attaches their results
+// to Result.Diagnostics, e.g. a dmesg tail or df -h, turning cryptic failures
+// into actionable reports. Diagnostics run one after another, even when the
+// context of the failed run is done, and get 30 seconds in total
+func WithDiagnostics(cmds ...Executable) Option {
+	return func(o *Options) {
+		o.Diagnostics = append(o.Diagnostics, cmds...)
+	}
+}
@@ -0,0 +1,92 @@
+package subprocess
+
+import (
+	"fmt"
+	"io"
+)
+
+// OutputLimitPolicy controls what happens to a process printing more than
+// its WithMaxOutputSize limit
+type OutputLimitPolicy int
+
+const (
+	OutputTruncate OutputLimitPolicy = iota // Keep the first bytes and set Result.Truncated
+	OutputFail                              // Kill the process with an *OutputLimitError
+)
+
+// String returns a string representation of the output limit policy
+func (p OutputLimitPolicy) String() string {
+	switch p {
+	case OutputTruncate:
+		return "truncate"
+	case OutputFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// OutputLimitError reports a process that was killed for printing more than
+// its output limit with the OutputFail policy
+type OutputLimitError struct {
+	Command string
+	Stream  string // stdout or stderr
+	Limit   int64  // configured limit in bytes
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("%s: %s exceeded the output limit of %d bytes", e.Command, e.Stream, e.Limit)
+}
+
+// WithMaxOutputSize caps the stdout and stderr captured in the Result of the
+// process at bytes each, overriding Defaults.MaxOutput. What happens past the
+// limit is set with WithOutputLimitPolicy, by default the output is truncated
+func WithMaxOutputSize(bytes int64) Option {
+	return func(o *Options) {
+		o.MaxOutputSize = bytes
+	}
+}
+
+// WithOutputLimitPolicy sets what happens when the process prints more than
+// its output limit: OutputTruncate drains the rest and sets Result.Truncated,
+// OutputFail kills the process right away with an *OutputLimitError
+func WithOutputLimitPolicy(policy OutputLimitPolicy) Option {
+	return func(o *Options) {
+		o.OutputLimit = policy
+	}
+}
+
+// outputReader reads the streams of a started process within its output limit
+type outputReader struct {
+	ops    *Options
+	runner *ProcessRunner
+	max    int64 // limit of the executable settings, overridden by ops.MaxOutputSize
+}
+
+// read reads stream to EOF and reports whether output was dropped at the limit
+// Lines go to handler instead if one is set, within the limit of the process
+// only since handled output is not kept in memory
+func (o outputReader) read(r io.Reader, stream string, handler func(line []byte)) ([]byte, bool) {
+	max := o.max
+	if o.ops.MaxOutputSize > 0 || handler != nil {
+		max = o.ops.MaxOutputSize
+	}
+	var exceeded func()
+	if o.ops.OutputLimit == OutputFail {
+		exceeded = func() {
+			o.runner.kill(&OutputLimitError{Command: o.ops.Command, Stream: stream, Limit: max})
+			// Descendants still holding the pipes get SIGPIPE instead of
+			// being drained forever
+			o.runner.closeOutput()
+		}
+	}
+	if handler != nil {
+		truncated, err := readHandled(r, o.ops.Color, max, exceeded, handler)
+		if err != nil {
+			o.runner.stopForPanic(err)
+		}
+		return nil, truncated
+	}
+	output, truncated := readOutput(r, max, exceeded)
+	return captureOutput(o.ops.Color, output), truncated
+}
@@ -0,0 +1,139 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMaxOutputSize(t *testing.T) {
+	yes := func(opts ...Option) Executable {
+		e, _ := Command("sh", []string{"-c", "echo err >&2; yes"}, opts...)
+		return e
+	}
+	must := func(e Executable, _ error) Executable { return e }
+	cat, _ := NewExecutable("cat")
+
+	tests := []struct {
+		name          string
+		exec          Executable
+		wantStdout    string
+		wantTruncated bool
+		wantLimitErr  bool
+	}{
+		{
+			// Test: output within the limit is kept whole
+			name:       "within limit",
+			exec:       must(Command("echo", []string{"hi"}, WithMaxOutputSize(10))),
+			wantStdout: "hi\n",
+		},
+		{
+			// Test: truncate keeps the first bytes and flags the result
+			name:          "truncate",
+			exec:          must(Command("seq", []string{"1", "100000"}, WithMaxOutputSize(4))),
+			wantStdout:    "1\n2\n",
+			wantTruncated: true,
+		},
+		{
+			// Test: fail kills a runaway process with an OutputLimitError
+			name:          "fail",
+			exec:          yes(WithMaxOutputSize(6), WithOutputLimitPolicy(OutputFail)),
+			wantStdout:    "y\ny\ny\n",
+			wantTruncated: true,
+			wantLimitErr:  true,
+		},
+		{
+			// Test: the limit of the last stage applies to the pipe output, the
+			// stage that exceeded it fails while the producer gets SIGPIPE
+			name:          "pipe",
+			exec:          yes().Pipe(must(Command("cat", nil, WithMaxOutputSize(2), WithOutputLimitPolicy(OutputFail)))),
+			wantStdout:    "y\n",
+			wantTruncated: true,
+			wantLimitErr:  true,
+		},
+		{
+			// Test: a stage without its own limit is not truncated
+			name:       "unlimited",
+			exec:       must(Command("echo", []string{"hi"})).Pipe(cat),
+			wantStdout: "hi\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, _ := tt.exec.Run(ctx)
+			err := result.Error
+			if result.Type == OpPipe {
+				err = result.Children[1].Error
+			}
+
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("expected stdout %q, got %q", tt.wantStdout, result.Stdout)
+			}
+			if result.Truncated != tt.wantTruncated {
+				t.Errorf("expected truncated %v, got %v", tt.wantTruncated, result.Truncated)
+			}
+			var limitErr *OutputLimitError
+			if errors.As(err, &limitErr) != tt.wantLimitErr {
+				t.Errorf("expected output limit error %v, got %v", tt.wantLimitErr, err)
+			}
+			if !tt.wantLimitErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxOutputSizeHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        OutputLimitPolicy
+		wantLines     []string
+		wantTruncated bool
+		wantLimitErr  bool
+	}{
+		{
+			// Test: a handler only receives the bytes within the limit
+			name:          "truncate",
+			policy:        OutputTruncate,
+			wantLines:     []string{"y", "y", "y"},
+			wantTruncated: true,
+		},
+		{
+			// Test: fail kills a runaway process feeding a handler
+			name:          "fail",
+			policy:        OutputFail,
+			wantLines:     []string{"y", "y", "y"},
+			wantTruncated: true,
+			wantLimitErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var lines []string
+			exec, _ := Command("sh", []string{"-c", "yes | head -c 100000"},
+				WithMaxOutputSize(6),
+				WithOutputLimitPolicy(tt.policy),
+				WithStdoutHandler(func(line []byte) { lines = append(lines, string(line)) }))
+			result, err := exec.Run(ctx)
+
+			if !slices.Equal(lines, tt.wantLines) {
+				t.Errorf("expected lines %q, got %q", tt.wantLines, lines)
+			}
+			if result.Truncated != tt.wantTruncated {
+				t.Errorf("expected truncated %v, got %v", tt.wantTruncated, result.Truncated)
+			}
+			var limitErr *OutputLimitError
+			if errors.As(err, &limitErr) != tt.wantLimitErr {
+				t.Errorf("expected output limit error %v, got %v", tt.wantLimitErr, err)
+			}
+		})
+	}
+}
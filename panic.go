@@ -0,0 +1,73 @@
+package subprocess
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError reports a panic during execution, such as in a user supplied
+// merge key function or output handler. Stages that were still running have
+// been stopped
+type PanicError struct {
+	Value any    // value passed to panic
+	Stack []byte // stack of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic during execution: %v", e.Value)
+}
+
+// run calls visit to execute exec, turning a panic into a *PanicError result
+// after stopping every process and background job started by the visitor
+// With Defaults.Repanic set, the panic is raised again after the cleanup
+// The command line and timing of exec are recorded unless visit set them
+func (v *ExecutionVisitor) run(exec Executable, visit func() (*Result, error)) (result *Result, err error) {
+	start := time.Now()
+	defer func() {
+		if result != nil {
+			if result.Command == "" {
+				result.Command = fmt.Sprint(exec)
+			}
+			if result.Start.IsZero() {
+				result.Start, result.Duration = start, time.Since(start)
+			}
+		}
+	}()
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		// Panics of output handlers are raised again with their own stack
+		panicErr, ok := value.(*PanicError)
+		if !ok {
+			panicErr = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+		v.stopAll()
+		if v.settings.repanic {
+			panic(panicErr.Value)
+		}
+		err = panicErr
+		result = &Result{Type: OpSingle, Error: err, ExitCode: -1}
+	}()
+	return visit()
+}
+
+// stopAll kills every process and cancels every background job started by the visitor
+func (v *ExecutionVisitor) stopAll() {
+	v.mu.Lock()
+	runners := v.runners
+	v.mu.Unlock()
+
+	for _, job := range v.backgroundJobs {
+		job.cancel()
+	}
+	for _, runner := range runners {
+		if !runner.exited() {
+			runner.Stop()
+		}
+		runner.ReaderWriter().Close()
+		runner.Wait()
+	}
+}
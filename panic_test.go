@@ -0,0 +1,100 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	// Test: a panicking merge key stops the producers and returns a PanicError
+	a, _ := NewExecutable("sh", "-c", "echo a; exec sleep 10")
+	b, _ := NewExecutable("sh", "-c", "echo b; exec sleep 10")
+	bad := func(line []byte) string { panic("bad key") }
+
+	start := time.Now()
+	result, err := FanIn(a, b).Key(bad).Run(context.Background())
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected PanicError, got %v", err)
+	}
+	if panicErr.Value != "bad key" || len(panicErr.Stack) == 0 {
+		t.Errorf("unexpected panic details: %v", panicErr.Value)
+	}
+	if result.ExitCode != -1 {
+		t.Errorf("expected exit code -1, got %d", result.ExitCode)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("producers were not stopped")
+	}
+}
+
+func TestPanicRepanic(t *testing.T) {
+	// Test: with Repanic the panic is raised again after cleanup
+	saved := Defaults
+	defer func() { Defaults = saved }()
+	Defaults.Repanic = true
+
+	a, _ := NewExecutable("sh", "-c", "echo a; exec sleep 10")
+	merger := FanIn(a, a).Key(func([]byte) string { panic("bad key") })
+
+	defer func() {
+		if recover() != "bad key" {
+			t.Error("expected the panic to be raised again")
+		}
+	}()
+	merger.Run(context.Background())
+}
+
+func TestPanicInOutputHandler(t *testing.T) {
+	bad := func(line []byte) { panic("bad handler") }
+	script := "echo out; echo err >&2; exec sleep 10"
+	stdout, _ := Command("sh", []string{"-c", script}, WithStdoutHandler(bad))
+	stderr, _ := Command("sh", []string{"-c", script}, WithStderrHandler(bad))
+	source, _ := NewExecutable("echo", "a")
+	last, _ := Command("sh", []string{"-c", "cat; " + script}, WithStdoutHandler(bad))
+
+	tests := []struct {
+		name string
+		exec Executable
+	}{
+		{
+			// Test: a panicking stdout handler stops the process and returns a PanicError
+			name: "stdout",
+			exec: stdout,
+		},
+		{
+			// Test: a panicking stderr handler, run on its own goroutine, does not crash the program
+			name: "stderr",
+			exec: stderr,
+		},
+		{
+			// Test: a panicking handler of the last stage of a pipe is recovered too
+			name: "pipe",
+			exec: source.Pipe(last),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := tt.exec.Run(context.Background())
+
+			var panicErr *PanicError
+			if !errors.As(err, &panicErr) {
+				t.Fatalf("expected PanicError, got %v", err)
+			}
+			if panicErr.Value != "bad handler" || len(panicErr.Stack) == 0 {
+				t.Errorf("unexpected panic details: %v", panicErr.Value)
+			}
+			if result.ExitCode != -1 {
+				t.Errorf("expected exit code -1, got %d", result.ExitCode)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Error("process was not stopped")
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParallelPolicy controls how a Batch reacts to a failing executable
+type ParallelPolicy int
+
+const (
+	ParallelCollectErrors ParallelPolicy = iota // Run every executable and join their errors
+	ParallelFailFast                            // Cancel the other executables at the first failure
+)
+
+// String returns a string representation of the parallel policy
+func (p ParallelPolicy) String() string {
+	switch p {
+	case ParallelCollectErrors:
+		return "collect-errors"
+	case ParallelFailFast:
+		return "fail-fast"
+	default:
+		return "unknown"
+	}
+}
+
+// Batch runs several executables concurrently, each with its own stdin and
+// output, at most limit at a time
+type Batch struct {
+	node
+	execs   []Executable
+	limit   int           // 0 runs every executable at once
+	stagger time.Duration // delay between the starts of executables
+	policy  ParallelPolicy
+	deps    []batchDependency // timers started by other executables
+}
+
+// batchDependency delays an executable of a Batch until another one started
+// or succeeded, plus a delay
+type batchDependency struct {
+	stage, on int
+	delay     time.Duration
+	done      bool // wait for on to succeed instead of to start
+}
+
+// Parallel creates a Batch running execs concurrently, for fan-out work such
+// as building several modules at once. Every executable runs, without a
+// concurrency limit, unless Limit and Policy say otherwise
+func Parallel(execs ...Executable) *Batch {
+	b := &Batch{
+		execs: execs,
+	}
+	b.node = newNode(b)
+	return b
+}
+
+// Limit runs at most n executables at a time, 0 runs all of them at once
+// The others start in order as running ones finish
+func (b *Batch) Limit(n int) *Batch {
+	clone := b.clone()
+	clone.limit = n
+	return clone
+}
+
+// Stagger starts the executables interval apart, like Group.Stagger, avoiding
+// a thundering herd when many identical commands hit a shared resource
+// With a limit, an executable waits for both its turn and a free slot
+func (b *Batch) Stagger(interval time.Duration) *Batch {
+	clone := b.clone()
+	clone.stagger = interval
+	return clone
+}
+
+// After starts the executable at index stage delay after the one at index on
+// started, e.g. giving a server time to listen before its clients run. It is
+// skipped when on is skipped. While waiting it does not take a slot of Limit
+func (b *Batch) After(stage, on int, delay time.Duration) *Batch {
+	clone := b.clone()
+	clone.deps = append(clone.deps, batchDependency{stage: stage, on: on, delay: delay})
+	return clone
+}
+
+// AfterDone starts the executable at index stage delay after the one at index
+// on succeeded, like a migration that must finish before its consumers start
+// It is skipped when on fails or is skipped
+func (b *Batch) AfterDone(stage, on int, delay time.Duration) *Batch {
+	clone := b.clone()
+	clone.deps = append(clone.deps, batchDependency{stage: stage, on: on, delay: delay, done: true})
+	return clone
+}
+
+// checkDependencies reports dependencies on missing executables, negative
+// delays and cycles
+func (b *Batch) checkDependencies() error {
+	waits := make(map[int][]int)
+	for _, d := range b.deps {
+		if d.stage < 0 || d.stage >= len(b.execs) || d.on < 0 || d.on >= len(b.execs) {
+			return fmt.Errorf("parallel dependency of %d on %d: no such executable", d.stage, d.on)
+		}
+		if d.delay < 0 {
+			return fmt.Errorf("parallel dependency of %d on %d: negative delay %v", d.stage, d.on, d.delay)
+		}
+		waits[d.stage] = append(waits[d.stage], d.on)
+	}
+
+	visited := make(map[int]bool)
+	var visit func(i int, path []int) error
+	visit = func(i int, path []int) error {
+		for j, stage := range path {
+			if stage == i {
+				cycle := make([]string, 0, len(path)-j+1)
+				for _, stage := range append(path[j:], i) {
+					cycle = append(cycle, fmt.Sprint(stage))
+				}
+				return fmt.Errorf("parallel dependency cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		if visited[i] {
+			return nil
+		}
+		for _, on := range waits[i] {
+			if err := visit(on, append(path, i)); err != nil {
+				return err
+			}
+		}
+		visited[i] = true
+		return nil
+	}
+	for i := range b.execs {
+		if err := visit(i, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Policy sets how the batch reacts to a failing executable
+func (b *Batch) Policy(policy ParallelPolicy) *Batch {
+	clone := b.clone()
+	clone.policy = policy
+	return clone
+}
+
+// clone returns a copy of b, so builder methods never modify a shared definition
+func (b *Batch) clone() *Batch {
+	clone := *b
+	clone.execs = append([]Executable(nil), b.execs...)
+	clone.deps = append([]batchDependency(nil), b.deps...)
+	clone.self = &clone
+	return &clone
+}
+
+func (b *Batch) configure(edit func(*settings)) Executable {
+	clone := b.clone()
+	edit(&clone.settings)
+	return clone
+}
+
+// String describes the batch and its executables
+func (b *Batch) String() string {
+	parts := make([]string, 0, len(b.execs))
+	for _, exec := range b.execs {
+		parts = append(parts, fmt.Sprint(exec))
+	}
+	mode := b.policy.String()
+	if b.limit > 0 {
+		mode += fmt.Sprintf(", limit %d", b.limit)
+	}
+	if b.stagger > 0 {
+		mode += fmt.Sprintf(", stagger %v", b.stagger)
+	}
+	for _, d := range b.deps {
+		event := "starts"
+		if d.done {
+			event = "succeeds"
+		}
+		mode += fmt.Sprintf(", %d %v after %d %s", d.stage, d.delay, d.on, event)
+	}
+	return fmt.Sprintf("parallel[%s](%s)", mode, strings.Join(parts, "; "))
+}
+
+// Run executes the executables concurrently using the visitor pattern
+func (b *Batch) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, b.settings)
+	return visitor.run(b, func() (*Result, error) {
+		return visitor.VisitParallel(b)
+	})
+}
+
+// ExitStatusError reports a child of a Batch that exited with a non-zero
+// status but returned no error, like an Executable implemented outside the
+// package may do
+type ExitStatusError struct {
+	Command string
+	Code    int
+}
+
+func (e *ExitStatusError) Error() string {
+	return fmt.Sprintf("%s: exit status %d", e.Command, e.Code)
+}
+
+// ExitCode returns the exit code of the child
+func (e *ExitStatusError) ExitCode() int {
+	return e.Code
+}
+
+// stageEvents tells the executables of a Batch waiting for another one when it
+// started and ended
+type stageEvents struct {
+	started, done     chan struct{}
+	startedAt, doneAt time.Time
+	skipped           bool // it never ran, valid once started is closed
+	ok                bool // it succeeded, valid once done is closed
+}
+
+// awaitDependencies waits until the timers of deps expired and returns why
+// the executable waiting for them is skipped instead, or ""
+func awaitDependencies(ctx context.Context, deps []batchDependency, events []*stageEvents) string {
+	for _, d := range deps {
+		on := events[d.on]
+		event := on.started
+		if d.done {
+			event = on.done
+		}
+		select {
+		case <-event:
+		case <-ctx.Done():
+			return "parallel run cancelled"
+		}
+
+		at := on.startedAt
+		switch {
+		case on.skipped:
+			return fmt.Sprintf("dependency %d was skipped", d.on)
+		case d.done && !on.ok:
+			return fmt.Sprintf("dependency %d failed", d.on)
+		case d.done:
+			at = on.doneAt
+		}
+		if sleepContext(ctx, time.Until(at.Add(d.delay))) != nil {
+			return "parallel run cancelled"
+		}
+	}
+	return ""
+}
+
+// runParallelChild runs one child of a batch and returns its result, which
+// holds an error whenever the child failed, also when exec is nil or returns
+// no result or a non-zero exit code without an error
+func runParallelChild(ctx context.Context, exec Executable) *Result {
+	if exec == nil {
+		err := errors.New("parallel: nil executable")
+		return &Result{Type: OpSingle, Error: err, ExitCode: -1}
+	}
+	result, err := exec.Run(ctx)
+	if result == nil {
+		if err == nil {
+			err = fmt.Errorf("parallel: %v returned no result", exec)
+		}
+		return &Result{Type: OpSingle, Error: err, ExitCode: -1, Command: fmt.Sprint(exec)}
+	}
+	switch {
+	case result.Error == nil && err != nil:
+		result.Error = err
+	case result.Error == nil && result.ExitCode != 0:
+		result.Error = &ExitStatusError{Command: fmt.Sprint(exec), Code: result.ExitCode}
+	}
+	if result.Error != nil && result.ExitCode == 0 {
+		result.ExitCode = -1
+	}
+	return result
+}
+
+// VisitParallel runs the executables of b concurrently within its limit
+// The output of the children is concatenated in argument order. With
+// ParallelCollectErrors the error joins the errors of every failed child and
+// the exit code is the one of the first failed child in argument order. With
+// ParallelFailFast the first failure cancels the children still running and
+// skips the ones not started yet, and gives its error and exit code
+// A child failing with a non-zero exit code but no error gets an
+// *ExitStatusError, a nil child fails without stopping the others
+// A child with dependencies waits for their timers in its own goroutine,
+// after its stagger turn, and only then takes a slot
+func (v *ExecutionVisitor) VisitParallel(b *Batch) (*Result, error) {
+	if err := v.ctx.Err(); err != nil {
+		return &Result{Type: OpParallel, Error: err, ExitCode: -1}, err
+	}
+	if err := b.checkDependencies(); err != nil {
+		return &Result{Type: OpParallel, Error: err, ExitCode: -1}, err
+	}
+
+	ctx, cancel := context.WithCancel(v.ctx)
+	defer cancel()
+
+	limit := b.limit
+	if limit <= 0 || limit > len(b.execs) {
+		limit = len(b.execs)
+	}
+	slots := make(chan struct{}, limit)
+	children := make([]*Result, len(b.execs))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = -1 // index of the child that failed first with ParallelFailFast
+	)
+	events := make([]*stageEvents, len(b.execs))
+	waits := make([][]batchDependency, len(b.execs))
+	for i := range b.execs {
+		events[i] = &stageEvents{started: make(chan struct{}), done: make(chan struct{})}
+	}
+	for _, d := range b.deps {
+		waits[d.stage] = append(waits[d.stage], d)
+	}
+
+	skip := func(i int, reason string) {
+		children[i] = &Result{Type: OpSingle, Skipped: true, SkipReason: reason, Command: fmt.Sprint(b.execs[i])}
+		events[i].skipped = true
+		close(events[i].started)
+		close(events[i].done)
+	}
+	// acquire takes a slot, or skips the executable i once the run is cancelled
+	acquire := func(i int) bool {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			skip(i, "parallel run cancelled")
+			return false
+		}
+		return true
+	}
+	run := func(i int, exec Executable) {
+		defer func() { <-slots }()
+		events[i].startedAt = time.Now()
+		close(events[i].started)
+		result := runParallelChild(ctx, exec)
+		children[i] = result
+		events[i].ok, events[i].doneAt = result.Error == nil, time.Now()
+		close(events[i].done)
+		if result.Error != nil && b.policy == ParallelFailFast {
+			mu.Lock()
+			if failed < 0 {
+				failed = i
+			}
+			mu.Unlock()
+			cancel()
+		}
+	}
+
+	start := time.Now()
+	for i, exec := range b.execs {
+		// Turns count from the start of the batch, a slow slot does not delay them further
+		sleepContext(ctx, time.Until(start.Add(staggerDelay(b.stagger, i))))
+		if len(waits[i]) > 0 {
+			wg.Add(1)
+			go func(i int, exec Executable) {
+				defer wg.Done()
+				if reason := awaitDependencies(ctx, waits[i], events); reason != "" {
+					skip(i, reason)
+				} else if acquire(i) {
+					run(i, exec)
+				}
+			}(i, exec)
+			continue
+		}
+		if !acquire(i) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, exec Executable) {
+			defer wg.Done()
+			run(i, exec)
+		}(i, exec)
+	}
+	wg.Wait()
+
+	result := &Result{Type: OpParallel, Children: children}
+	for _, child := range children {
+		result.Stdout = append(result.Stdout, child.Stdout...)
+		result.Stderr = append(result.Stderr, child.Stderr...)
+	}
+	if failed >= 0 {
+		result.Error = children[failed].Error
+		result.ExitCode = children[failed].ExitCode
+		return result, result.Error
+	}
+
+	var errs []error
+	for _, child := range children {
+		if child.Error == nil {
+			continue
+		}
+		if len(errs) == 0 {
+			result.ExitCode = child.ExitCode
+		}
+		errs = append(errs, child.Error)
+	}
+	if result.ExitCode == 0 && v.ctx.Err() != nil {
+		// Children were skipped because the run was cancelled
+		errs = append(errs, v.ctx.Err())
+		result.ExitCode = -1
+	}
+	result.Error = errors.Join(errs...)
+	return result, result.Error
+}
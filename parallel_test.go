@@ -0,0 +1,257 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	ctx := context.Background()
+	echo := func(s string) Executable {
+		e, _ := NewExecutable("echo", s)
+		return e
+	}
+	fail := func(code string) Executable {
+		e, _ := NewExecutable("sh", "-c", "sleep 0.05; exit "+code)
+		return e
+	}
+
+	tests := []struct {
+		name       string
+		batch      *Batch
+		wantCode   int
+		wantErrors int
+		wantStdout string
+	}{
+		{
+			// Test: the output is concatenated in argument order
+			name:       "success",
+			batch:      Parallel(echo("a"), echo("b"), echo("c")),
+			wantStdout: "a\nb\nc\n",
+		},
+		{
+			// Test: every executable runs and the errors are joined
+			name:       "collect errors",
+			batch:      Parallel(echo("a"), fail("3"), fail("4"), echo("b")),
+			wantCode:   3,
+			wantErrors: 2,
+			wantStdout: "a\nb\n",
+		},
+		{
+			// Test: a limit of one runs the executables one at a time
+			name:       "limit",
+			batch:      Parallel(echo("a"), fail("2"), echo("b")).Limit(1),
+			wantCode:   2,
+			wantErrors: 1,
+			wantStdout: "a\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.batch.Run(ctx)
+			if result.Type != OpParallel {
+				t.Errorf("expected OpParallel, got %v", result.Type)
+			}
+			if result.ExitCode != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, result.ExitCode)
+			}
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("expected stdout %q, got %q", tt.wantStdout, result.Stdout)
+			}
+			var joined interface{ Unwrap() []error }
+			switch {
+			case tt.wantErrors == 0 && err != nil:
+				t.Errorf("expected no error, got %v", err)
+			case tt.wantErrors > 0 && (!errors.As(err, &joined) || len(joined.Unwrap()) != tt.wantErrors):
+				t.Errorf("expected %d errors, got %v", tt.wantErrors, err)
+			}
+			if len(result.Children) != len(tt.batch.execs) {
+				t.Errorf("expected %d children, got %d", len(tt.batch.execs), len(result.Children))
+			}
+		})
+	}
+}
+
+func TestParallelLimit(t *testing.T) {
+	// Test: no more than the limit run at the same time
+	dir := t.TempDir()
+	script := `mkdir "$0/running.$$"; n=$(ls "$0" | wc -l); echo $n; sleep 0.1; rmdir "$0/running.$$"`
+	var execs []Executable
+	for range 6 {
+		e, _ := NewExecutable("sh", "-c", script, dir)
+		execs = append(execs, e)
+	}
+
+	result, err := Parallel(execs...).Limit(2).Run(context.Background())
+	if err != nil {
+		t.Fatalf("parallel failed: %v", err)
+	}
+	for _, line := range strings.Fields(string(result.Stdout)) {
+		if line != "1" && line != "2" {
+			t.Errorf("expected at most 2 concurrent executables, got %s", line)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected every executable to finish, found %d", len(entries))
+	}
+}
+
+func TestParallelFailFast(t *testing.T) {
+	// Test: the first failure cancels the running executables and skips the others
+	marker := filepath.Join(t.TempDir(), "started")
+	fail, _ := NewExecutable("sh", "-c", "sleep 0.05; exit 5")
+	slow, _ := NewExecutable("sleep", "5")
+	late, _ := NewExecutable("touch", marker)
+
+	start := time.Now()
+	result, err := Parallel(fail, slow, late).Limit(2).Policy(ParallelFailFast).Run(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected the slow executable to be cancelled, took %v", elapsed)
+	}
+	if result.ExitCode != 5 {
+		t.Errorf("expected exit code 5, got %d", result.ExitCode)
+	}
+	if result.Children[1].Error == nil {
+		t.Error("expected the slow executable to be cancelled")
+	}
+	if !result.Children[2].Skipped {
+		t.Error("expected the last executable to be skipped")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected the last executable not to start")
+	}
+}
+
+func TestParallelStagger(t *testing.T) {
+	// Test: executables start interval apart, also when a slot frees up earlier
+	var execs []Executable
+	for i := 0; i < 3; i++ {
+		noop, _ := NewExecutable("true")
+		execs = append(execs, noop)
+	}
+
+	for _, limit := range []int{0, 1} {
+		result, err := Parallel(execs...).Limit(limit).Stagger(100 * time.Millisecond).Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 1; i < len(result.Children); i++ {
+			if gap := result.Children[i].Start.Sub(result.Children[i-1].Start); gap < 90*time.Millisecond {
+				t.Errorf("limit %d: executable %d started %v after the previous one", limit, i, gap)
+			}
+		}
+	}
+
+	// A negative interval is invalid
+	if err := Parallel(execs...).Stagger(-time.Second).Validate(); err == nil {
+		t.Error("expected a validation error")
+	}
+}
+
+// exitOnly is an Executable that reports a non-zero exit code without an
+// error, like one implemented outside the package may do
+type exitOnly struct {
+	Executable
+	code int
+}
+
+func (e exitOnly) Run(ctx context.Context) (*Result, error) {
+	return &Result{Type: OpSingle, ExitCode: e.code}, nil
+}
+
+func (e exitOnly) String() string {
+	return "exit-only"
+}
+
+func TestParallelExitWithoutError(t *testing.T) {
+	ctx := context.Background()
+	echo, _ := NewExecutable("echo", "a")
+
+	// Test: a non-zero exit without an error still fails the batch
+	result, err := Parallel(echo, exitOnly{echo, 4}).Run(ctx)
+	var exitErr *ExitStatusError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 4 || result.ExitCode != 4 {
+		t.Errorf("expected exit status 4, got %d, %v", result.ExitCode, err)
+	}
+	if err != nil && err.Error() != "exit-only: exit status 4" {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	// Test: with fail-fast it is the error of the batch
+	result, err = Parallel(exitOnly{echo, 6}).Policy(ParallelFailFast).Run(ctx)
+	if err == nil || result.Error == nil || result.ExitCode != 6 {
+		t.Errorf("expected the batch to fail with exit code 6, got %d, %v", result.ExitCode, err)
+	}
+
+	// Test: a nil child fails without stopping the others
+	result, err = Parallel(nil, echo).Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "nil executable") || string(result.Stdout) != "a\n" {
+		t.Errorf("expected a nil executable error, got %q, %v", result.Stdout, err)
+	}
+}
+
+func TestParallelDependencies(t *testing.T) {
+	ctx := context.Background()
+	server, _ := NewExecutable("sleep", "0.3")
+	client, _ := NewExecutable("true")
+	fail, _ := NewExecutable("false")
+
+	// Test: After starts an executable delay after another one started,
+	// AfterDone delay after it succeeded
+	result, err := Parallel(server, client, client).
+		After(1, 0, 100*time.Millisecond).
+		AfterDone(2, 0, 50*time.Millisecond).
+		Run(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := result.Children[0].Start
+	end := start.Add(result.Children[0].Duration)
+	if gap := result.Children[1].Start.Sub(start); gap < 90*time.Millisecond || gap > 250*time.Millisecond {
+		t.Errorf("expected executable 1 to start 100ms after 0, got %v", gap)
+	}
+	if gap := result.Children[2].Start.Sub(end); gap < 40*time.Millisecond {
+		t.Errorf("expected executable 2 to start 50ms after 0 ended, got %v", gap)
+	}
+
+	// Test: a waiting executable holds no slot, so it cannot block its dependency
+	if _, err := Parallel(client, server).Limit(1).AfterDone(0, 1, 0).Run(ctx); err != nil {
+		t.Errorf("unexpected error with a limit: %v", err)
+	}
+
+	// Test: executables depending on a failed one are skipped, also transitively
+	result, _ = Parallel(fail, client, client).AfterDone(1, 0, 0).After(2, 1, 0).Run(ctx)
+	for i, reason := range []string{"", "dependency 0 failed", "dependency 1 was skipped"} {
+		if child := result.Children[i]; child.Skipped != (reason != "") || child.SkipReason != reason {
+			t.Errorf("executable %d: expected skip reason %q, got %q", i, reason, child.SkipReason)
+		}
+	}
+
+	// Test: invalid dependencies fail validation and the run
+	tests := []struct {
+		batch *Batch
+		err   string
+	}{
+		{Parallel(client, client).After(1, 2, 0), "parallel dependency of 1 on 2: no such executable"},
+		{Parallel(client, client).After(1, 0, -time.Second), "parallel dependency of 1 on 0: negative delay -1s"},
+		{Parallel(client).After(0, 0, 0), "parallel dependency cycle: 0 -> 0"},
+		{Parallel(client, client, client).After(0, 1, 0).AfterDone(1, 2, 0).After(2, 0, 0), "parallel dependency cycle: 0 -> 1 -> 2 -> 0"},
+	}
+	for _, tt := range tests {
+		if err := tt.batch.Validate(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected validation error %q, got %v", tt.err, err)
+		}
+		if _, err := tt.batch.Run(ctx); err == nil || err.Error() != tt.err {
+			t.Errorf("expected run error %q, got %v", tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package subprocess
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cuongtranba/subprocess/ast"
+)
+
+// SyntaxError reports a command line that Parse cannot read
+type SyntaxError struct {
+	Pos ast.Pos
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Parse builds the Executable of a POSIX-like command line such as
+// "cat log | grep err && echo ok || echo fail &", for commands stored in
+// configuration. It supports |, &&, ||, &, ;, parentheses and { a; b; }
+// braces for grouping, the
+// redirections <, >, >>, 2> and 2>&1, single and double quotes, backslash
+// escapes, backslash-newline line continuations and # comments. Newlines
+// separate commands like ;, and are ignored after operators that need more
+// input such as && or |, like in a script. There is no
+// variable, command or glob expansion, so $HOME or *.go are passed as they
+// are. opts are applied to every command, and AST gives the position of
+// every command and operator in cmdline
+func Parse(cmdline string, opts ...Option) (Executable, error) {
+	tokens, err := tokenize(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: cmdline, tokens: tokens, opts: opts}
+	exec, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return exec, nil
+}
+
+// tokenKind is the kind of a token of a command line
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPipe        // |
+	tokOr          // ||
+	tokAmp         // &
+	tokSemi        // ;
+	tokAnd         // &&
+	tokLParen      // (
+	tokRParen      // )
+	tokIn          // <
+	tokOut         // >
+	tokAppend      // >>
+	tokErr         // 2>
+	tokErrToOut    // 2>&1
+	tokUnsupported // operators with no equivalent, reported when parsed
+)
+
+// token is a word or operator of a command line
+type token struct {
+	kind   tokenKind
+	text   string // value of words, source of operators
+	offset int    // byte offset in the command line
+	quoted bool   // the word has quotes or escapes, so it is no reserved word
+}
+
+// is reports whether tok is the unquoted word, like the { and } reserved words
+func (t token) is(word string) bool {
+	return t.kind == tokWord && !t.quoted && t.text == word
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokWord:
+		return fmt.Sprintf("word %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// operators are the operators of the command line, longest first
+var operators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"2>&1", tokErrToOut},
+	{"2>>", tokUnsupported},
+	{"2>", tokErr},
+	{">>", tokAppend},
+	{">&", tokUnsupported},
+	{">|", tokUnsupported},
+	{"<<", tokUnsupported},
+	{"||", tokOr},
+	{"&&", tokAnd},
+	{"|", tokPipe},
+	{"&", tokAmp},
+	{"(", tokLParen},
+	{")", tokRParen},
+	{"<", tokIn},
+	{">", tokOut},
+	{";", tokSemi},
+	{"\n", tokSemi},
+}
+
+// tokenize splits a command line into words and operators, removing quotes
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(src[i:], "\\\n"):
+			// A line continuation separates words like a blank
+			i += 2
+			continue
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		}
+
+		if kind, text, ok := operatorAt(src, i); ok {
+			if text == "\n" && !endsCommand(tokens) {
+				// Blank lines and newlines after &&, ||, |, (, ; or &
+				i++
+				continue
+			}
+			tokens = append(tokens, token{kind: kind, text: text, offset: i})
+			i += len(text)
+			continue
+		}
+
+		start := i
+		var word strings.Builder
+		quoted := false
+		for i < len(src) && !isWordEnd(src, i) {
+			if c := src[i]; c == '\'' || c == '"' || c == '\\' {
+				quoted = true
+			}
+			switch c := src[i]; c {
+			case '\'':
+				end := strings.IndexByte(src[i+1:], '\'')
+				if end < 0 {
+					return nil, syntaxError(src, i, "unterminated single quote")
+				}
+				word.WriteString(src[i+1 : i+1+end])
+				i += end + 2
+			case '"':
+				j := i + 1
+				for ; j < len(src) && src[j] != '"'; j++ {
+					if strings.HasPrefix(src[j:], "\\\n") {
+						j++
+						continue
+					}
+					if src[j] == '\\' && j+1 < len(src) && strings.IndexByte("\"\\$`", src[j+1]) >= 0 {
+						j++
+					}
+					word.WriteByte(src[j])
+				}
+				if j == len(src) {
+					return nil, syntaxError(src, i, "unterminated double quote")
+				}
+				i = j + 1
+			case '\\':
+				if i+1 == len(src) {
+					return nil, syntaxError(src, i, "backslash at end of input")
+				}
+				if src[i+1] != '\n' {
+					// Backslash-newline continues the word on the next line
+					word.WriteByte(src[i+1])
+				}
+				i += 2
+			default:
+				word.WriteByte(c)
+				i++
+			}
+		}
+		tokens = append(tokens, token{kind: tokWord, text: word.String(), offset: start, quoted: quoted})
+	}
+	return append(tokens, token{kind: tokEOF, offset: len(src)}), nil
+}
+
+// endsCommand reports whether a newline after tokens ends a command, which it
+// does after a word, a closing parenthesis or a redirection, so a redirection
+// missing its file is reported. An opening brace needs more input like (
+func endsCommand(tokens []token) bool {
+	n := len(tokens)
+	if n == 0 {
+		return false
+	}
+	switch last := tokens[n-1]; last.kind {
+	case tokWord:
+		// { only opens a group where a command starts
+		return !last.is("{") || n > 1 && endsCommand(tokens[:n-1])
+	case tokRParen, tokErrToOut, tokIn, tokOut, tokAppend, tokErr:
+		return true
+	}
+	return false
+}
+
+// operatorAt returns the operator starting at offset i of src
+// 2> is only an operator at the start of a word, like in a shell
+func operatorAt(src string, i int) (tokenKind, string, bool) {
+	for _, op := range operators {
+		if !strings.HasPrefix(src[i:], op.text) {
+			continue
+		}
+		if op.text[0] == '2' && i > 0 && !isWordEnd(src, i-1) {
+			continue
+		}
+		return op.kind, op.text, true
+	}
+	return 0, "", false
+}
+
+// isWordEnd reports whether the byte at offset i of src ends an unquoted word
+func isWordEnd(src string, i int) bool {
+	switch src[i] {
+	case ' ', '\t', '\r', '\n', '|', '&', '(', ')', '<', '>', ';':
+		return true
+	}
+	return false
+}
+
+// syntaxError returns a SyntaxError at offset of src
+func syntaxError(src string, offset int, format string, args ...any) *SyntaxError {
+	return &SyntaxError{Pos: position(src, offset), Msg: fmt.Sprintf(format, args...)}
+}
+
+// position returns the line and column of offset in src
+func position(src string, offset int) ast.Pos {
+	pos := ast.Pos{Offset: offset, Line: 1, Column: 1}
+	for _, c := range []byte(src[:offset]) {
+		if c == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// withPos records pos in exec, so AST gives the source of parsed nodes
+func withPos(exec Executable, pos ast.Pos) Executable {
+	switch x := exec.(type) {
+	case *ExecutableProcess:
+		x.pos = pos
+	case *Pipeline:
+		x.pos = pos
+	}
+	return exec
+}
+
+// parser builds an Executable from tokens by recursive descent
+//
+//	list     = andOr { ( "&" | ";" ) [ andOr ] }
+//	andOr    = pipeline { ( "&&" | "||" ) pipeline }
+//	pipeline = command { "|" command }
+//	command  = ( words | "(" list ")" | "{" list "}" ) with redirections
+//
+// { and } are only reserved where a command starts, and need a separator
+// before }, like in a shell
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	opts   []Option
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...any) *SyntaxError {
+	return syntaxError(p.src, tok.offset, format, args...)
+}
+
+// at returns the position of tok
+func (p *parser) at(tok token) ast.Pos {
+	return position(p.src, tok.offset)
+}
+
+// list parses and-or lists separated by & or ;, where a & b runs a in the
+// background and then b, like a.Background().Then(b)
+func (p *parser) list() (Executable, error) {
+	exec, err := p.andOr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		sep := p.peek()
+		switch sep.kind {
+		case tokAmp:
+			exec = withPos(exec.Background(), p.at(sep))
+		case tokSemi:
+		default:
+			return exec, nil
+		}
+		p.next()
+		if next := p.peek(); next.kind == tokEOF || next.kind == tokRParen || next.is("}") {
+			return exec, nil
+		}
+		next, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		exec = withPos(exec.Then(next), p.at(sep))
+	}
+}
+
+func (p *parser) andOr() (Executable, error) {
+	exec, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op.kind == tokAnd || op.kind == tokOr; op = p.peek() {
+		p.next()
+		next, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		if op.kind == tokAnd {
+			exec = withPos(exec.And(next), p.at(op))
+		} else {
+			exec = withPos(exec.Or(next), p.at(op))
+		}
+	}
+	return exec, nil
+}
+
+func (p *parser) pipeline() (Executable, error) {
+	exec, err := p.command()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokPipe {
+		op := p.next()
+		next, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		exec = withPos(exec.Pipe(next), p.at(op))
+	}
+	return exec, nil
+}
+
+// target is where an output stream of a command goes
+type target struct {
+	path   string // empty for the stream the command was given
+	append bool
+	pos    ast.Pos // position of the redirection operator
+}
+
+func (p *parser) command() (Executable, error) {
+	start := p.peek()
+	var words []string
+	var group Executable
+	var grouping string // parentheses or braces around group
+	var stdin string
+	stdout, stderr := &target{}, &target{}
+	var errToOut ast.Pos // position of 2>&1 while stderr goes wherever stdout went
+
+	for {
+		tok := p.peek()
+		switch tok.kind {
+		case tokWord:
+			if group != nil {
+				return nil, p.errorf(tok, "unexpected %s after %s", tok, grouping)
+			}
+			if len(words) == 0 && tok.is("{") {
+				p.next()
+				inner, err := p.list()
+				if err != nil {
+					return nil, err
+				}
+				if closing := p.next(); !closing.is("}") {
+					return nil, p.errorf(closing, "expected \"}\", got %s", closing)
+				}
+				group, grouping = inner, "braces"
+				continue
+			}
+			words = append(words, p.next().text)
+			continue
+		case tokLParen:
+			if group != nil || len(words) > 0 {
+				return nil, p.errorf(tok, "unexpected %s", tok)
+			}
+			p.next()
+			inner, err := p.list()
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.kind != tokRParen {
+				return nil, p.errorf(closing, "expected \")\", got %s", closing)
+			}
+			group, grouping = inner, "parentheses"
+			continue
+		case tokIn, tokOut, tokAppend, tokErr:
+			p.next()
+			file := p.next()
+			if file.kind != tokWord {
+				return nil, p.errorf(file, "expected a file after %q, got %s", tok.text, file)
+			}
+			switch tok.kind {
+			case tokIn:
+				stdin = file.text
+			case tokOut, tokAppend:
+				if errToOut.IsValid() && stderr == stdout && stdout.path != "" {
+					// > a 2>&1 > b: stderr stays in a, only stdout moves on
+					if stdout.append {
+						return nil, syntaxError(p.src, errToOut.Offset, "appending stderr to a file is not supported")
+					}
+					stderr, errToOut = &target{path: stdout.path, pos: errToOut}, ast.Pos{}
+				}
+				stdout = &target{path: file.text, append: tok.kind == tokAppend, pos: p.at(tok)}
+			case tokErr:
+				stderr, errToOut = &target{path: file.text, pos: p.at(tok)}, ast.Pos{}
+			}
+			continue
+		case tokErrToOut:
+			p.next()
+			stderr, errToOut = stdout, p.at(tok)
+			continue
+		case tokUnsupported:
+			return nil, p.errorf(tok, "unsupported operator %q", tok.text)
+		}
+		break
+	}
+
+	var exec Executable
+	switch {
+	case group != nil:
+		if stdin != "" {
+			return nil, p.errorf(start, "input redirection of a group is not supported")
+		}
+		exec = group
+	case len(words) > 0:
+		opts := p.opts
+		if stdin != "" {
+			opts = append(append([]Option(nil), opts...), WithStdinFile(stdin))
+		}
+		cmd, cmdErr := Command(words[0], words[1:], opts...)
+		if cmdErr != nil {
+			return nil, p.errorf(start, "%v", cmdErr)
+		}
+		exec = withPos(cmd, p.at(start))
+	default:
+		return nil, p.errorf(start, "expected a command, got %s", start)
+	}
+	return redirectStreams(exec, stdout, stderr, errToOut), nil
+}
+
+// redirectStreams wraps exec in the redirections that send its output to the
+// stdout and stderr targets, like the redirections of a shell read left to right
+// errToOut is the position of 2>&1 when stderr is the stdout target of 2>&1
+func redirectStreams(exec Executable, stdout, stderr *target, errToOut ast.Pos) Executable {
+	redirectOut := func(exec Executable) Executable {
+		if stdout.append {
+			return withPos(exec.AppendStdout(stdout.path), stdout.pos)
+		}
+		return withPos(exec.RedirectStdout(stdout.path), stdout.pos)
+	}
+	redirectErrOut := func(exec Executable) Executable {
+		return withPos(exec.RedirectStderrToStdout(), errToOut)
+	}
+
+	switch {
+	case errToOut.IsValid() && stderr == stdout:
+		// 2>&1 after the stdout redirection: both streams go to the same place
+		exec = redirectErrOut(exec)
+		if stdout.path != "" {
+			exec = redirectOut(exec)
+		}
+		return exec
+	case errToOut.IsValid():
+		// 2>&1 before the stdout redirection: stderr takes the place of stdout
+		return redirectErrOut(redirectOut(exec))
+	}
+	if stdout.path != "" {
+		exec = redirectOut(exec)
+	}
+	if stderr.path != "" {
+		exec = withPos(exec.RedirectStderr(stderr.path), stderr.pos)
+	}
+	return exec
+}
@@ -0,0 +1,429 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cuongtranba/subprocess/ast"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdline string
+		want    string
+	}{
+		{
+			// Test: words are split on blanks
+			name:    "command",
+			cmdline: "  echo\thello   world ",
+			want:    "echo hello world",
+		},
+		{
+			// Test: operators follow shell precedence
+			name:    "operators",
+			cmdline: "cat log | grep err && echo ok || echo fail &",
+			want:    "cat log | grep err && echo ok || echo fail &",
+		},
+		{
+			// Test: operators need no blanks around them
+			name:    "no blanks",
+			cmdline: "true&&false||echo x|cat",
+			want:    "true && false || echo x | cat",
+		},
+		{
+			// Test: & between commands runs the left one in the background
+			name:    "background list",
+			cmdline: "sleep 1 & echo next",
+			want:    "sleep 1 & echo next",
+		},
+		{
+			// Test: ; runs commands one after the other and binds like &
+			name:    "sequence",
+			cmdline: "make; make test && echo ok; (echo a &) ; echo b;",
+			want:    "make; make test && echo ok; (echo a &); echo b",
+		},
+		{
+			// Test: parentheses group commands
+			name:    "group",
+			cmdline: "true && (false || echo x) | cat",
+			want:    "true && (false || echo x) | cat",
+		},
+		{
+			// Test: quotes and escapes are removed, with no expansion
+			name:    "quoting",
+			cmdline: `echo 'a b' "c \"d\" $HOME" e\ f '' *.go`,
+			want:    `echo 'a b' 'c "d" $HOME' 'e f' '' '*.go'`,
+		},
+		{
+			// Test: quoted operators are words
+			name:    "quoted operators",
+			cmdline: `echo '|' "&&" \>`,
+			want:    `echo '|' '&&' '>'`,
+		},
+		{
+			// Test: comments run to the end of the line, # inside a word is kept
+			name:    "comment",
+			cmdline: "echo a#b # comment",
+			want:    "echo 'a#b'",
+		},
+		{
+			// Test: redirections apply to the command they follow
+			name:    "redirections",
+			cmdline: "make > build.log 2> errors.log && echo done >> done.log",
+			want:    "(make > build.log) 2> errors.log && echo done >> done.log",
+		},
+		{
+			// Test: 2> is only a redirection at the start of a word
+			name:    "digit in word",
+			cmdline: "echo a2>f",
+			want:    "echo a2 > f",
+		},
+		{
+			// Test: 2>&1 after > sends both streams to the file
+			name:    "both to file",
+			cmdline: "make > build.log 2>&1",
+			want:    "(make 2>&1) > build.log",
+		},
+		{
+			// Test: 2>&1 before > sends stderr where stdout was
+			name:    "stderr to stdout then file",
+			cmdline: "make 2>&1 > build.log",
+			want:    "(make > build.log) 2>&1",
+		},
+		{
+			// Test: 2>&1 binds stderr to the file stdout went to at that point
+			name:    "stderr stays in first file",
+			cmdline: "make > a.log 2>&1 > b.log",
+			want:    "(make > b.log) 2> a.log",
+		},
+		{
+			// Test: newlines separate commands like ;, also after a comment
+			name:    "newlines",
+			cmdline: "\necho a # c\necho b\n\n(echo c\n) &&\n  echo d |\n cat\n",
+			want:    "echo a; echo b; echo c && echo d | cat",
+		},
+		{
+			// Test: braces group commands like parentheses, also over several lines
+			name:    "brace group",
+			cmdline: "{ echo a; echo b; } | cat && {\n  echo c\n  echo d\n} > out",
+			want:    "(echo a; echo b) | cat && (echo c; echo d) > out",
+		},
+		{
+			// Test: braces are only reserved where a command starts, and when unquoted
+			name:    "brace words",
+			cmdline: "echo { } '{' && { echo \\}; }",
+			want:    "echo '{' '}' '{' && echo '}'",
+		},
+		{
+			// Test: redirections apply to a group
+			name:    "group redirection",
+			cmdline: "(echo a && echo b) > out",
+			want:    "(echo a && echo b) > out",
+		},
+		{
+			// Test: backslash-newline continues the command line, also inside words and double quotes
+			name:    "line continuation",
+			cmdline: "echo a \\\n  b\\\nc \"d\\\ne\" |\\\n cat",
+			want:    "echo a bc de | cat",
+		},
+		{
+			// Test: the output of String parses to the same tree
+			name:    "round trip",
+			cmdline: "(make 2>&1) > build.log | (cat &)",
+			want:    "(make 2>&1) > build.log | (cat &)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, err := Parse(tt.cmdline)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := exec.(interface{ String() string }).String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmdline string
+		want    string
+	}{
+		{
+			// Test: an empty command line has no command
+			name:    "empty",
+			cmdline: "  # nothing",
+			want:    "1:12: expected a command, got end of input",
+		},
+		{
+			// Test: operators need a command on both sides
+			name:    "missing operand",
+			cmdline: "echo a &&",
+			want:    "1:10: expected a command, got end of input",
+		},
+		{
+			// Test: a leading operator has no command
+			name:    "leading operator",
+			cmdline: "| cat",
+			want:    `1:1: expected a command, got "|"`,
+		},
+		{
+			// Test: quotes must be closed
+			name:    "unterminated single quote",
+			cmdline: "echo 'a",
+			want:    "1:6: unterminated single quote",
+		},
+		{
+			// Test: double quotes must be closed
+			name:    "unterminated double quote",
+			cmdline: `echo "a\"`,
+			want:    "1:6: unterminated double quote",
+		},
+		{
+			// Test: a backslash needs a character to escape
+			name:    "trailing backslash",
+			cmdline: `echo a\`,
+			want:    "1:7: backslash at end of input",
+		},
+		{
+			// Test: redirections need a file
+			name:    "missing file",
+			cmdline: "echo a > | cat",
+			want:    `1:10: expected a file after ">", got "|"`,
+		},
+		{
+			// Test: parentheses must be closed
+			name:    "unclosed group",
+			cmdline: "(echo a",
+			want:    `1:8: expected ")", got end of input`,
+		},
+		{
+			// Test: a closing parenthesis needs an opening one
+			name:    "unopened group",
+			cmdline: "echo a)",
+			want:    `1:7: unexpected ")"`,
+		},
+		{
+			// Test: words cannot follow a group
+			name:    "word after group",
+			cmdline: "(echo a) b",
+			want:    `1:10: unexpected word "b" after parentheses`,
+		},
+		{
+			// Test: braces must be closed after a separator
+			name:    "unclosed braces",
+			cmdline: "{ echo a }",
+			want:    `1:11: expected "}", got end of input`,
+		},
+		{
+			// Test: words cannot follow braces
+			name:    "word after braces",
+			cmdline: "{ echo a; } b",
+			want:    `1:13: unexpected word "b" after braces`,
+		},
+		{
+			// Test: separators need a command between them
+			name:    "empty sequence",
+			cmdline: "echo a & ; echo b",
+			want:    `1:10: expected a command, got ";"`,
+		},
+		{
+			// Test: a newline ends a redirection missing its file
+			name:    "redirection before newline",
+			cmdline: "echo a >\nfile",
+			want:    `1:9: expected a file after ">", got "\n"`,
+		},
+		{
+			// Test: stderr can only replace a file, not append to it
+			name:    "append stderr",
+			cmdline: "echo a >> a.log 2>&1 > b.log",
+			want:    `1:17: appending stderr to a file is not supported`,
+		},
+		{
+			// Test: positions count lines
+			name:    "second line",
+			cmdline: "echo 'a\nb' 2>> f",
+			want:    `2:4: unsupported operator "2>>"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.cmdline)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected a *SyntaxError, got %v", err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	if err := os.WriteFile(input, []byte("b\na\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		cmdline    string
+		wantCode   int
+		wantStdout string
+		wantFiles  map[string]string
+	}{
+		{
+			// Test: < reads stdin from a file
+			name:       "stdin file",
+			cmdline:    "sort < " + input,
+			wantStdout: "a\nb\n",
+		},
+		{
+			// Test: || runs the fallback of a failed pipeline
+			name:       "fallback",
+			cmdline:    "false | cat && echo ok || echo fail",
+			wantStdout: "fail\n",
+		},
+		{
+			// Test: the options apply to every command
+			name:       "options",
+			cmdline:    "sh -c 'echo $GREETING' | cat",
+			wantStdout: "hello\n",
+		},
+		{
+			// Test: every command of a ; group writes to the pipe
+			name:       "sequence group in pipe",
+			cmdline:    "(echo a; echo b) | wc -l | tr -d ' '",
+			wantStdout: "2\n",
+		},
+		{
+			// Test: every command of an && group writes to the pipe
+			name:       "and group in pipe",
+			cmdline:    "(echo a && echo b) | wc -l | tr -d ' '",
+			wantStdout: "2\n",
+		},
+		{
+			// Test: > file 2>&1 writes both streams to the file
+			name:      "both to file",
+			cmdline:   "sh -c 'echo out; echo err >&2' > " + filepath.Join(dir, "both") + " 2>&1",
+			wantFiles: map[string]string{"both": "out\nerr\n"},
+		},
+		{
+			// Test: > a 2>&1 > b writes stderr to a and stdout to b
+			name:      "stderr to first file",
+			cmdline:   "sh -c 'echo out; echo err >&2' > " + filepath.Join(dir, "a") + " 2>&1 > " + filepath.Join(dir, "b"),
+			wantFiles: map[string]string{"a": "err\n", "b": "out\n"},
+		},
+		{
+			// Test: every command of a brace group writes to the pipe
+			name:       "brace group in pipe",
+			cmdline:    "{ echo a; echo b; } | wc -l | tr -d ' '",
+			wantStdout: "2\n",
+		},
+		{
+			// Test: commands on separate lines run one after the other
+			name:       "lines",
+			cmdline:    "echo a # first\necho b",
+			wantStdout: "a\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, err := Parse(tt.cmdline, WithEnv("GREETING=hello"))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			result, _ := exec.Run(context.Background())
+			if result.ExitCode != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, result.ExitCode)
+			}
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("expected stdout %q, got %q", tt.wantStdout, result.Stdout)
+			}
+			for name, want := range tt.wantFiles {
+				data, _ := os.ReadFile(filepath.Join(dir, name))
+				if string(data) != want {
+					t.Errorf("expected file %s to hold %q, got %q", name, want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	// Test: realistic script lines run the same once printed with String and parsed again
+	lines := []string{
+		"printf '%s\\n' \"it's\" 'a \"quoted\" word' | sort -r # comment",
+		"{ echo a; echo b; } | tr a-z A-Z && echo \"done: \\$HOME\"",
+		"sh -c 'echo out; echo err >&2' 2>&1 | wc -l | tr -d ' '",
+		"false || { echo fallback \\\n  with continuation; }",
+		"(echo x && false) || echo y; echo z",
+	}
+
+	for _, line := range lines {
+		t.Run(line, func(t *testing.T) {
+			exec, err := Parse(line)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			printed := exec.(interface{ String() string }).String()
+			again, err := Parse(printed)
+			if err != nil {
+				t.Fatalf("Parse of %q failed: %v", printed, err)
+			}
+			if reprinted := again.(interface{ String() string }).String(); reprinted != printed {
+				t.Errorf("expected %q, got %q", printed, reprinted)
+			}
+
+			want, _ := exec.Run(context.Background())
+			got, _ := again.Run(context.Background())
+			if string(got.Stdout) != string(want.Stdout) || got.ExitCode != want.ExitCode {
+				t.Errorf("expected %q (exit %d), got %q (exit %d) from %q", want.Stdout, want.ExitCode, got.Stdout, got.ExitCode, printed)
+			}
+		})
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	// Test: AST gives the position of every command and operator in the command line
+	exec, err := Parse("make > log && \\\n  (echo a | cat)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	and, ok := AST(exec).(*ast.And)
+	if !ok {
+		t.Fatalf("expected *ast.And, got %T", AST(exec))
+	}
+	redirect := and.Left.(*ast.Redirect)
+	pipe := and.Right.(*ast.Pipe)
+	tests := []struct {
+		name string
+		node ast.Node
+		want ast.Pos
+	}{
+		{name: "and", node: and, want: ast.Pos{Offset: 11, Line: 1, Column: 12}},
+		{name: "redirect", node: redirect, want: ast.Pos{Offset: 5, Line: 1, Column: 6}},
+		{name: "make", node: redirect.Exec, want: ast.Pos{Offset: 0, Line: 1, Column: 1}},
+		{name: "pipe", node: pipe, want: ast.Pos{Offset: 26, Line: 2, Column: 11}},
+		{name: "echo", node: pipe.Left, want: ast.Pos{Offset: 19, Line: 2, Column: 4}},
+		{name: "cat", node: pipe.Right, want: ast.Pos{Offset: 28, Line: 2, Column: 13}},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Pos(); got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package subprocess
+
+import "os"
+
+// WithProcessGroup starts the process in a new process group, and makes Stop,
+// ShutdownAll and context cancellation signal the whole group. Grandchildren
+// spawned by a shell are stopped with it instead of being orphaned
+// Only supported on Unix
+func WithProcessGroup() Option {
+	return func(o *Options) {
+		o.ProcessGroup = true
+	}
+}
+
+// signal sends sig to the process, or to its process group with WithProcessGroup
+func (p *ProcessRunner) signal(sig os.Signal) error {
+	return signalProcess(p.cmd.Process, p.group, sig)
+}
+
+// signalProcess sends sig to process, or to its process group if group is set
+func signalProcess(process *os.Process, group bool, sig os.Signal) error {
+	if group {
+		return signalGroup(process.Pid, sig)
+	}
+	return process.Signal(sig)
+}
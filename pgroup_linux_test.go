@@ -0,0 +1,63 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithProcessGroup(t *testing.T) {
+	// Test: stopping the process also stops the grandchildren of the shell
+	tests := []struct {
+		name string
+		stop func(runner *ProcessRunner, cancel context.CancelFunc)
+	}{
+		{"Stop", func(runner *ProcessRunner, cancel context.CancelFunc) { runner.Stop() }},
+		{"context", func(runner *ProcessRunner, cancel context.CancelFunc) { cancel() }},
+		{"ShutdownAll", func(runner *ProcessRunner, cancel context.CancelFunc) { ShutdownAll(context.Background()) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// trap keeps the shell alive on SIGTERM, only the group signal stops sleep
+			p, _ := NewProcess("sh", []string{"-c", "trap '' TERM; sleep 100 & echo $!; wait"}, WithProcessGroup())
+			runner, err := p.exec(ctx, 100*time.Millisecond)
+			if err != nil {
+				t.Fatalf("exec failed: %v", err)
+			}
+			line, err := bufio.NewReader(runner.Stdout()).ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read the pid: %v", err)
+			}
+			pid, _ := strconv.Atoi(strings.TrimSpace(line))
+
+			tt.stop(runner, cancel)
+			runner.Wait()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for running(pid) {
+				if time.Now().After(deadline) {
+					t.Fatalf("grandchild %d survived", pid)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// running reports whether pid exists and is not a zombie
+func running(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
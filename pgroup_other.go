@@ -0,0 +1,22 @@
+//go:build !unix
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup starts cmd in a new process group
+func setProcessGroup(cmd *exec.Cmd, ops *Options) error {
+	if ops.ProcessGroup {
+		return errors.New("WithProcessGroup is only supported on Unix")
+	}
+	return nil
+}
+
+// signalGroup sends sig to every process of the group led by pid
+func signalGroup(pid int, sig os.Signal) error {
+	return errors.New("process groups are only supported on Unix")
+}
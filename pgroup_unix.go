@@ -0,0 +1,37 @@
+//go:build unix
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in a new process group
+func setProcessGroup(cmd *exec.Cmd, ops *Options) error {
+	if !ops.ProcessGroup {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// A pseudo-terminal starts a new session, which is a new group already,
+	// and a session leader cannot change its group
+	cmd.SysProcAttr.Setpgid = !ops.PTY
+	return nil
+}
+
+// signalGroup sends sig to every process of the group led by pid
+func signalGroup(pid int, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.New("unsupported signal")
+	}
+	err := syscall.Kill(-pid, s)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
@@ -0,0 +1,466 @@
+package subprocess
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressTimeoutError reports a pipe that stopped moving data while stages were still running
+// The stages are slow or waiting on something outside the pipe, deadlocks the
+// engine can prove from the state of the pipes are reported as *DeadlockError
+type ProgressTimeoutError struct {
+	Timeout time.Duration // How long the pipe went without progress
+	Stages  []string      // Stages that were still running when the pipe was stopped
+}
+
+func (e *ProgressTimeoutError) Error() string {
+	return fmt.Sprintf("pipe made no progress for %v, stalled stages: %s",
+		e.Timeout, strings.Join(e.Stages, ", "))
+}
+
+// DeadlockError reports stages blocked writing to pipes nobody will read
+// before they finish, such as the stderr of a stage, which the engine reads
+// once its stdout ends. Deadlocks are found on Linux only
+type DeadlockError struct {
+	Stages []string // Stuck stages, with the pipe each one is blocked on
+}
+
+func (e *DeadlockError) Error() string {
+	return "pipe deadlocked: " + strings.Join(e.Stages, ", ")
+}
+
+// pipeChain is a set of started stages connected stdout to stdin
+type pipeChain struct {
+	stages   []*chainStage
+	copies   chan struct{} // receives once per finished copy goroutine
+	progress atomic.Int64  // bytes moved through the chain, watched by the progress timeout
+}
+
+// chainStage is one stage of a pipeChain
+type chainStage struct {
+	exec   Executable
+	runner *ProcessRunner // nil for stages that were run to completion
+	result *Result        // result of stages that were run to completion
+}
+
+// stdinPolicy returns when the engine closes the stdin of the stage
+// A stage with redirected stdin reads nothing from the pipe
+func (s *chainStage) stdinPolicy() StdinPolicy {
+	if ep, ok := s.exec.(*ExecutableProcess); ok {
+		if ep.process.ops.redirectsStdin() {
+			return StdinCloseImmediately
+		}
+		return ep.process.ops.StdinPolicy
+	}
+	return StdinCloseOnEOF
+}
+
+// flattenPipe returns the stages of a (possibly nested) pipe in order
+func flattenPipe(exec Executable) []Executable {
+	if p, ok := exec.(*Pipeline); ok && p.operation == OpPipe {
+		return append(flattenPipe(p.left), flattenPipe(p.right)...)
+	}
+	return []Executable{exec}
+}
+
+// stripBackground returns the pipe exec with the Background nodes of its stages
+// removed, and whether any was found
+func stripBackground(exec Executable) (Executable, bool) {
+	p, ok := exec.(*Pipeline)
+	if !ok {
+		return exec, false
+	}
+	switch p.operation {
+	case OpBackground:
+		inner, _ := stripBackground(p.left)
+		return inner, true
+	case OpPipe:
+		left, leftFound := stripBackground(p.left)
+		right, rightFound := stripBackground(p.right)
+		if !leftFound && !rightFound {
+			return exec, false
+		}
+		return newPipeline(OpPipe, left, right, p.settings), true
+	default:
+		return exec, false
+	}
+}
+
+// startChain starts every stage and connects the output of each stage to the
+// stdin of the next one. Stages that are not processes are run to completion
+// and their output is fed downstream
+func (v *ExecutionVisitor) startChain(execs []Executable) (*pipeChain, *Result, error) {
+	chain := &pipeChain{copies: make(chan struct{}, len(execs))}
+	for _, exec := range execs {
+		// Lazy and conditional stages are resolved now, so a process can be
+		// streamed like the others
+		exec, skipped, err := v.resolveStage(exec)
+		if err != nil {
+			chain.stop()
+			return nil, &Result{Type: OpSingle, Error: err, ExitCode: -1}, err
+		}
+		stage := &chainStage{exec: exec}
+		if skipped != nil {
+			stage.result = skipped
+		} else if ep, ok := exec.(*ExecutableProcess); ok {
+			runner, err := v.startProcess(ep)
+			if err != nil {
+				chain.stop()
+				return nil, &Result{
+					Type:     OpSingle,
+					Error:    fmt.Errorf("failed to start process: %w", err),
+					ExitCode: -1,
+				}, err
+			}
+			stage.runner = runner
+			if stage.stdinPolicy() == StdinCloseImmediately {
+				runner.ReaderWriter().CloseWrite()
+			}
+		} else {
+			stage.result, _ = exec.Run(v.ctx)
+		}
+		chain.stages = append(chain.stages, stage)
+	}
+
+	// Copy in goroutines so all stages run concurrently
+	for i := 0; i < len(chain.stages)-1; i++ {
+		go chain.connect(chain.stages[i], chain.stages[i+1])
+	}
+
+	return chain, nil, nil
+}
+
+// resolveStage returns the executable run for a pipe stage, building lazy
+// stages and evaluating conditions. A skipped conditional stage returns its result
+func (v *ExecutionVisitor) resolveStage(exec Executable) (Executable, *Result, error) {
+	switch x := exec.(type) {
+	case *LazyStage:
+		built, err := x.resolve(v.ctx, nil)
+		return built, nil, err
+	case *Conditional:
+		if ok, reason := x.evaluate(v.ctx); !ok {
+			return exec, &Result{Type: OpSingle, Skipped: true, SkipReason: reason, Command: x.String()}, nil
+		}
+		return v.resolveStage(x.exec)
+	default:
+		return exec, nil, nil
+	}
+}
+
+// connect copies the output of src to the stdin of dst, then closes it to signal EOF
+func (c *pipeChain) connect(src, dst *chainStage) {
+	defer func() { c.copies <- struct{}{} }()
+
+	if dst.runner == nil || dst.stdinPolicy() == StdinCloseImmediately {
+		// The stage reads no input, discard upstream output
+		io.Copy(io.Discard, c.output(src))
+		return
+	}
+	_, err := io.Copy(dst.runner.ReaderWriter(), c.output(src))
+	if dst.stdinPolicy() == StdinCloseOnEOF {
+		dst.runner.ReaderWriter().CloseWrite()
+	}
+
+	// dst stopped reading: close the output of src so it gets SIGPIPE on its
+	// next write like in a shell, instead of blocking on a full pipe forever
+	if err != nil && src.runner != nil {
+		src.runner.closeOutput()
+	}
+}
+
+// output returns a reader for the output of stage
+func (c *pipeChain) output(stage *chainStage) io.Reader {
+	if stage.runner == nil {
+		return bytes.NewReader(pipedOutput(stage.result))
+	}
+	return &progressReader{r: stage.runner.ReaderWriter(), progress: &c.progress}
+}
+
+// pipedOutput returns what a shell pipes out of a stage that is not a
+// process: every command of an &&, || or ; group writes to the pipe, while
+// the Result of a group keeps the output of its last command
+func pipedOutput(result *Result) []byte {
+	switch result.Type {
+	case OpAnd, OpOr, OpSeq:
+		var out []byte
+		for _, child := range result.Children {
+			out = append(out, pipedOutput(child)...)
+		}
+		return out
+	}
+	return result.Stdout
+}
+
+// stdin returns the stdin of the first stage, or nil if it is not a process
+func (c *pipeChain) stdin() io.WriteCloser {
+	if first := c.stages[0]; first.runner != nil {
+		return first.runner.ReaderWriter()
+	}
+	return nil
+}
+
+// closeInput signals EOF to the first stage, unless its stdin policy
+// keeps stdin open or already closed it
+func (c *pipeChain) closeInput() {
+	if first := c.stages[0]; first.runner != nil && first.stdinPolicy() == StdinCloseOnEOF {
+		first.runner.ReaderWriter().CloseWrite()
+	}
+}
+
+// stdout returns the output of the last stage
+func (c *pipeChain) stdout() io.Reader {
+	return c.output(c.stages[len(c.stages)-1])
+}
+
+// streams returns the stdout and stderr of the last stage apart
+func (c *pipeChain) streams() (io.Reader, io.Reader) {
+	last := c.stages[len(c.stages)-1]
+	if last.runner == nil {
+		return bytes.NewReader(pipedOutput(last.result)), bytes.NewReader(last.result.Stderr)
+	}
+	return &progressReader{r: last.runner.Stdout(), progress: &c.progress},
+		&progressReader{r: last.runner.Stderr(), progress: &c.progress}
+}
+
+// readOutput reads the output of the last stage within its output limit, or
+// passes it to the stdout handler of the stage if it has one
+// It reports whether output was dropped at the limit
+func (c *pipeChain) readOutput(max int64) ([]byte, bool) {
+	last := c.stages[len(c.stages)-1]
+	if ep, ok := last.exec.(*ExecutableProcess); ok && last.runner != nil {
+		reader := outputReader{ops: ep.process.ops, runner: last.runner, max: max}
+		return reader.read(c.stdout(), "stdout", ep.process.ops.StdoutHandler)
+	}
+	return readOutput(c.stdout(), max, nil)
+}
+
+// closeOutput closes the output of the last stage so it stops producing
+func (c *pipeChain) closeOutput() {
+	if last := c.stages[len(c.stages)-1]; last.runner != nil {
+		last.runner.closeOutput()
+	}
+}
+
+// running returns the names of the stages that have not exited yet
+func (c *pipeChain) running() []string {
+	var names []string
+	for _, stage := range c.stages {
+		if stage.runner != nil && !stage.runner.exited() {
+			names = append(names, fmt.Sprint(stage.exec))
+		}
+	}
+	return names
+}
+
+// deadlocked returns the stages blocked writing to a full pipe that the
+// engine does not drain: their stderr, read once their stdout ends, or their
+// stdout when the next stage is deadlocked too
+func (c *pipeChain) deadlocked() []string {
+	var stuck []string
+	nextStuck := false
+	for i := len(c.stages) - 1; i >= 0; i-- {
+		stage := c.stages[i]
+		reason := ""
+		if stage.runner != nil && !stage.runner.exited() && writingPipe(stage.runner.cmd.Process.Pid) {
+			switch {
+			case pipeFull(stage.runner.stderr):
+				reason = "blocked writing stderr, which is read once stdout ends"
+			case nextStuck && pipeFull(stage.runner.stdout):
+				reason = "blocked writing stdout to a stuck stage"
+			}
+		}
+		nextStuck = reason != ""
+		if nextStuck {
+			stuck = append([]string{fmt.Sprintf("%v (%s)", stage.exec, reason)}, stuck...)
+		}
+	}
+	return stuck
+}
+
+// stop kills every started stage and waits for it to exit
+func (c *pipeChain) stop() {
+	for _, stage := range c.stages {
+		if stage.runner != nil {
+			stage.runner.Stop()
+			stage.runner.Wait()
+		}
+	}
+}
+
+// waitChain waits for every stage of the chain and returns their results in order
+// The output of the last stage must have been read before calling waitChain
+func (v *ExecutionVisitor) waitChain(c *pipeChain) []*Result {
+	for i := 0; i < len(c.stages)-1; i++ {
+		<-c.copies
+	}
+
+	results := make([]*Result, len(c.stages))
+	for i, stage := range c.stages {
+		if stage.runner == nil {
+			results[i] = stage.result
+			continue
+		}
+		err := stage.runner.Wait()
+		stage.runner.raisePanic()
+		v.logExit(stage.exec, err)
+		results[i] = &Result{
+			Type:        OpSingle,
+			ExitCode:    v.getExitCode(err),
+			Error:       err,
+			PeakMemory:  stage.runner.PeakMemory(),
+			OpenedFiles: stage.runner.OpenedFiles(),
+			Crash:       stage.runner.CrashReport(),
+			Env:         stage.runner.EnvSnapshot(),
+			Command:     fmt.Sprint(stage.exec),
+			Start:       stage.runner.started,
+			Duration:    stage.runner.exitedAt.Sub(stage.runner.started),
+		}
+		if ep, ok := stage.exec.(*ExecutableProcess); ok {
+			results[i].Metadata = maps.Clone(ep.process.ops.Metadata)
+		}
+		annotatePorts(results[i], stage.runner)
+		v.diagnose(stage.exec, results[i])
+	}
+	return results
+}
+
+// finishChain waits for the chain started from exec and rebuilds its result tree
+// output is the output of the last stage, as read by the caller
+func (v *ExecutionVisitor) finishChain(exec Executable, c *pipeChain, output []byte) *Result {
+	stages := v.waitChain(c)
+	if last := c.stages[len(c.stages)-1]; last.runner != nil {
+		stages[len(stages)-1].Stdout = captureOutput(last.exec.(*ExecutableProcess).process.ops.Color, output)
+	}
+	result, _ := buildPipeResult(exec, stages)
+	return result
+}
+
+// buildPipeResult rebuilds the nested result tree of exec from the results of
+// its flattened stages, returning the stage results that were not consumed
+func buildPipeResult(exec Executable, stages []*Result) (*Result, []*Result) {
+	p, ok := exec.(*Pipeline)
+	if !ok || p.operation != OpPipe {
+		return stages[0], stages[1:]
+	}
+
+	left, rest := buildPipeResult(p.left, stages)
+	right, rest := buildPipeResult(p.right, rest)
+
+	// Final output is from the right side
+	result := &Result{
+		Type:     OpPipe,
+		Stdout:   right.Stdout,
+		Stderr:   right.Stderr,
+		ExitCode: right.ExitCode,
+		Children: []*Result{left, right},
+		Command:  p.String(),
+	}
+
+	// Stages run concurrently, the pipe spans from the first start to the last exit
+	result.Start = left.Start
+	if right.Start.Before(result.Start) {
+		result.Start = right.Start
+	}
+	end := left.Start.Add(left.Duration)
+	if rightEnd := right.Start.Add(right.Duration); rightEnd.After(end) {
+		end = rightEnd
+	}
+	result.Duration = end.Sub(result.Start)
+
+	// Use the exit code from whichever side failed first (fail-fast)
+	if left.Error != nil {
+		result.Error = left.Error
+		result.ExitCode = left.ExitCode
+		result.Stderr = left.Stderr
+	} else if right.Error != nil {
+		result.Error = right.Error
+	}
+
+	return result, rest
+}
+
+// watchProgress stops the chains when no data moves through any of them for
+// the progress timeout while stages are still running, or as soon as a
+// stalled chain is deadlocked. The returned function stops the watchdog and
+// returns the *ProgressTimeoutError or *DeadlockError, if any
+func (v *ExecutionVisitor) watchProgress(chains ...*pipeChain) func() error {
+	timeout := v.settings.progressTimeout
+	if timeout <= 0 {
+		return func() error { return nil }
+	}
+
+	stop := make(chan struct{})
+	detected := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(min(max(timeout/4, time.Millisecond), 100*time.Millisecond))
+		defer ticker.Stop()
+
+		progress := func() (total int64) {
+			for _, c := range chains {
+				total += c.progress.Load()
+			}
+			return total
+		}
+		last, lastChange := progress(), time.Now()
+		for {
+			select {
+			case <-stop:
+				detected <- nil
+				return
+			case now := <-ticker.C:
+				if progress := progress(); progress != last {
+					last, lastChange = progress, now
+					continue
+				}
+				var stuck []string
+				for _, c := range chains {
+					stuck = append(stuck, c.deadlocked()...)
+				}
+				if len(stuck) > 0 {
+					for _, c := range chains {
+						c.stop()
+					}
+					detected <- &DeadlockError{Stages: stuck}
+					return
+				}
+				if now.Sub(lastChange) < timeout {
+					continue
+				}
+				var stalled []string
+				for _, c := range chains {
+					stalled = append(stalled, c.running()...)
+				}
+				if len(stalled) == 0 {
+					continue
+				}
+				for _, c := range chains {
+					c.stop()
+				}
+				detected <- &ProgressTimeoutError{Timeout: timeout, Stages: stalled}
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		return <-detected
+	}
+}
+
+// progressReader counts the bytes read from r
+type progressReader struct {
+	r        io.Reader
+	progress *atomic.Int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.progress.Add(int64(n))
+	return n, err
+}
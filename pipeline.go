@@ -2,6 +2,8 @@ package subprocess
 
 import (
 	"context"
+	"io"
+	"log/slog"
 	"time"
 )
 
@@ -9,11 +11,16 @@ import (
 type OperationType int
 
 const (
-	OpSingle OperationType = iota // Single process execution
-	OpPipe                        // | - pipe stdout to stdin
-	OpAnd                         // && - run next if previous succeeds
-	OpOr                          // || - run next if previous fails
-	OpBackground                  // & - run in background
+	OpSingle     OperationType = iota // Single process execution
+	OpPipe                            // | - pipe stdout to stdin
+	OpAnd                             // && - run next if previous succeeds
+	OpOr                              // || - run next if previous fails
+	OpBackground                      // & - run in background
+	OpRoute                           // Route lines to downstreams by pattern
+	OpFanIn                           // Merge output of several producers
+	OpRedirect                        // >, >>, 2> and 2>&1 - redirect output
+	OpSeq                             // ; - run next after previous
+	OpParallel                        // Run several executables concurrently
 )
 
 // String returns a string representation of the operation type
@@ -29,31 +36,98 @@ func (o OperationType) String() string {
 		return "or"
 	case OpBackground:
 		return "background"
+	case OpRoute:
+		return "route"
+	case OpFanIn:
+		return "fan-in"
+	case OpRedirect:
+		return "redirect"
+	case OpSeq:
+		return "seq"
+	case OpParallel:
+		return "parallel"
 	default:
 		return "unknown"
 	}
 }
 
+// settings holds execution settings that are inherited when Executables are composed
+type settings struct {
+	shutdownTimeout time.Duration // graceful shutdown timeout
+	progressTimeout time.Duration // fail pipes that make no progress for this long, 0 disables
+	maxOutput       int64         // truncate captured output to this many bytes, 0 is unlimited
+	logger          *slog.Logger  // process lifecycle logging, nil disables it
+	repanic         bool          // raise panics again after stopping stages
+}
+
+// defaultSettings returns the settings of a newly created Executable, taken from Defaults
+func defaultSettings() settings {
+	return settings{
+		shutdownTimeout: Defaults.ShutdownTimeout,
+		progressTimeout: Defaults.ProgressTimeout,
+		maxOutput:       Defaults.MaxOutput,
+		logger:          Defaults.Logger,
+		repanic:         Defaults.Repanic,
+	}
+}
+
+// settingsOf returns the settings of exec, or the defaults for an Executable
+// implemented outside the package without Compose
+func settingsOf(exec Executable) settings {
+	if c, ok := exec.(configurable); ok {
+		return c.nodeSettings()
+	}
+	return defaultSettings()
+}
+
 // Result represents the result of executing an Executable
 // It uses a tree structure to capture all intermediate and final outputs
 type Result struct {
-	Type     OperationType // Type of operation that produced this result
-	Stdout   []byte        // Captured stdout
-	Stderr   []byte        // Captured stderr
-	ExitCode int           // Exit code of the process/pipeline
-	Error    error         // Execution error if any
-	Skipped  bool          // True if this process was skipped (in && || chains)
-	Children []*Result     // Child results in the execution tree
+	Type       OperationType // Type of operation that produced this result
+	Stdout     []byte        // Captured stdout
+	Stderr     []byte        // Captured stderr
+	ExitCode   int           // Exit code of the process/pipeline
+	Error      error         // Execution error if any
+	Skipped    bool          // True if this process was skipped (in && || chains)
+	SkipReason string        // Why a conditional stage was skipped
+	Cancelled  bool          // True if this branch was stopped with Branch.Cancel
+	Truncated  bool          // True if output was dropped at the output limit
+	Children   []*Result     // Child results in the execution tree
+
+	Command  string        // Command line of the executable, in shell syntax
+	Start    time.Time     // When the execution started
+	Duration time.Duration // How long the execution took
+
+	PeakMemory  int64        // Peak resident set size in bytes, measured when a memory limit is set
+	OpenedFiles []string     // Files opened by the process, recorded with WithFileTracing
+	Diagnostics []*Result    // Results of the WithDiagnostics commands run after a failure
+	Crash       *CrashReport // Crash bundle of a process killed by a crash signal, with WithCrashReport
+	Env         *EnvSnapshot // Environment of the process, with WithEnvSnapshot
+
+	// Annotations of the stage, from WithMetadata or added with Annotate
+	Metadata map[string]any
 
 	// Background-specific errors (non-fatal, don't affect exit code)
 	BackgroundErrors []error
 }
 
+// Annotate sets key to value in the metadata of the result, so consumers of
+// results can attach parsed values or tags without a side channel
+func (r *Result) Annotate(key string, value any) {
+	if r.Metadata == nil {
+		r.Metadata = make(map[string]any)
+	}
+	r.Metadata[key] = value
+}
+
 // Executable is the common interface for Process and Pipeline
 // It represents anything that can be executed and composed with operators
+// Only Run differs between implementations: the executables of the package
+// share one implementation of the other methods, and stages implemented
+// outside the package provide Run and get the rest from Compose
 type Executable interface {
 	// Run executes the Executable and returns the result
-	Run(ctx context.Context) (*Result, error)
+	Runnable
 
 	// Pipe connects stdout of this Executable to stdin of next
 	// Equivalent to: this | next
@@ -67,10 +141,45 @@ type Executable interface {
 	// Equivalent to: this || next
 	Or(next Executable) Executable
 
+	// Then runs next after this, whether this succeeds or not
+	// Equivalent to: this; next
+	Then(next Executable) Executable
+
 	// Background runs this Executable in the background
 	// Equivalent to: this &
 	Background() Executable
 
+	// RedirectStdout writes the stdout of this Executable to a file
+	// Equivalent to: this > path
+	RedirectStdout(path string) Executable
+
+	// AppendStdout appends the stdout of this Executable to a file
+	// Equivalent to: this >> path
+	AppendStdout(path string) Executable
+
+	// RedirectStderr writes the stderr of this Executable to a file
+	// Equivalent to: this 2> path
+	RedirectStderr(path string) Executable
+
+	// RedirectStderrToStdout captures the stderr of this Executable after its stdout
+	// Equivalent to: this 2>&1
+	RedirectStderrToStdout() Executable
+
 	// WithShutdownTimeout sets the timeout for graceful shutdown
 	WithShutdownTimeout(timeout time.Duration) Executable
+
+	// WithProgressTimeout fails pipes that move no data for timeout
+	// while stages are still running, naming the stalled stages
+	// On Linux, stages blocked on a pipe the engine will not drain fail
+	// with a *DeadlockError as soon as data stops moving
+	WithProgressTimeout(timeout time.Duration) Executable
+
+	// Reader exposes the output of this Executable as an io.Reader
+	Reader(ctx context.Context) io.ReadCloser
+
+	// Writer exposes the stdin of this Executable as an io.Writer
+	Writer(ctx context.Context) io.WriteCloser
+
+	// Validate checks the tree before running it, reporting all problems at once
+	Validate() error
 }
@@ -2,93 +2,132 @@ package subprocess
 
 import (
 	"context"
-	"time"
+	"fmt"
+
+	"github.com/cuongtranba/subprocess/ast"
 )
 
 // Pipeline represents a composition of Executables
 // It stores the structure using a flexible representation that can be traversed with the Visitor pattern
 type Pipeline struct {
-	operation       OperationType
-	left            Executable
-	right           Executable      // nil for Background operation
-	shutdownTimeout time.Duration
+	node
+	operation OperationType
+	left      Executable
+	right     Executable // nil for Background and Redirect operations
+	redirect  RedirectOp // redirection of the Redirect operation
+	path      string     // file of the Redirect operation, empty for 2>&1
+	pos       ast.Pos    // position of the operator in the command line of Parse
 }
 
-// Run executes the pipeline using the visitor pattern
-func (p *Pipeline) Run(ctx context.Context) (*Result, error) {
-	visitor := &ExecutionVisitor{
-		ctx:             ctx,
-		shutdownTimeout: p.shutdownTimeout,
-		backgroundJobs:  make([]*BackgroundJob, 0),
-	}
-
-	var result *Result
-	var err error
+// newPipeline returns a node combining left and right with op
+func newPipeline(op OperationType, left, right Executable, s settings) *Pipeline {
+	p := &Pipeline{operation: op, left: left, right: right}
+	p.node = node{self: p, settings: s}
+	return p
+}
 
-	// Use visitor pattern to execute based on operation type
+// String returns the pipeline in shell syntax, with parentheses where the
+// tree does not follow shell precedence
+func (p *Pipeline) String() string {
 	switch p.operation {
 	case OpPipe:
-		result, err = visitor.VisitPipe(p.left, p.right)
+		return operand(p.left, OpPipe, false) + " | " + operand(p.right, OpPipe, true)
 	case OpAnd:
-		result, err = visitor.VisitAnd(p.left, p.right)
+		return operand(p.left, OpAnd, false) + " && " + operand(p.right, OpAnd, true)
 	case OpOr:
-		result, err = visitor.VisitOr(p.left, p.right)
+		return operand(p.left, OpOr, false) + " || " + operand(p.right, OpOr, true)
+	case OpSeq:
+		// The & of a background command already ends it
+		if left, ok := p.left.(*Pipeline); ok && left.operation == OpBackground {
+			return operand(p.left, OpSeq, false) + " " + operand(p.right, OpSeq, true)
+		}
+		return operand(p.left, OpSeq, false) + "; " + operand(p.right, OpSeq, true)
 	case OpBackground:
-		result, err = visitor.VisitBackground(p.left)
+		return operand(p.left, OpBackground, false) + " &"
+	case OpRedirect:
+		if p.redirect == RedirectErrOut {
+			return operand(p.left, OpRedirect, false) + " 2>&1"
+		}
+		return operand(p.left, OpRedirect, false) + " " + p.redirect.String() + " " + shellQuote(p.path)
 	default:
-		panic("unknown operation type")
+		return "unknown"
 	}
-
-	// Wait for any background jobs before returning
-	if err == nil {
-		visitor.WaitForBackground(result)
-	}
-
-	return result, err
 }
 
-// Pipe creates a new pipeline that pipes output to the next executable
-func (p *Pipeline) Pipe(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpPipe,
-		left:            p,
-		right:           next,
-		shutdownTimeout: p.shutdownTimeout,
+// operand returns exec as an operand of op, in parentheses when needed
+// Like in a shell, redirections bind tighter than |, which binds tighter than
+// && and ||, which bind tighter than &, and operators group from the left
+// Nested redirections are grouped, as they apply one after the other
+func operand(exec Executable, op OperationType, right bool) string {
+	s := fmt.Sprint(exec)
+	inner, ok := exec.(*Pipeline)
+	if !ok {
+		return s
 	}
+	if precedence(inner.operation) < precedence(op) ||
+		(right || op == OpBackground || op == OpRedirect) && precedence(inner.operation) == precedence(op) {
+		return "(" + s + ")"
+	}
+	return s
 }
 
-// And creates a new pipeline that runs next only if this succeeds
-func (p *Pipeline) And(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpAnd,
-		left:            p,
-		right:           next,
-		shutdownTimeout: p.shutdownTimeout,
+// precedence returns how tightly a shell operator binds
+func precedence(op OperationType) int {
+	switch op {
+	case OpSeq, OpBackground:
+		return 0
+	case OpAnd, OpOr:
+		return 1
+	case OpRedirect:
+		return 3
+	default:
+		return 2
 	}
 }
 
-// Or creates a new pipeline that runs next only if this fails
-func (p *Pipeline) Or(next Executable) Executable {
-	return &Pipeline{
-		operation:       OpOr,
-		left:            p,
-		right:           next,
-		shutdownTimeout: p.shutdownTimeout,
-	}
+// Run executes the pipeline using the visitor pattern
+func (p *Pipeline) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, p.settings)
+	return visitor.run(p, func() (*Result, error) {
+		var result *Result
+		var err error
+
+		// Use visitor pattern to execute based on operation type
+		switch p.operation {
+		case OpPipe:
+			result, err = visitor.VisitPipe(p.left, p.right)
+		case OpAnd:
+			result, err = visitor.VisitAnd(p.left, p.right)
+		case OpOr:
+			result, err = visitor.VisitOr(p.left, p.right)
+		case OpSeq:
+			result, err = visitor.VisitSeq(p.left, p.right)
+		case OpBackground:
+			result, err = visitor.VisitBackground(p.left)
+		case OpRedirect:
+			result, err = visitor.VisitRedirect(p.left, p.redirect, p.path)
+		default:
+			panic("unknown operation type")
+		}
+
+		// Wait for any background jobs before returning
+		if err == nil {
+			visitor.WaitForBackground(result)
+		}
+
+		return result, err
+	})
 }
 
-// Background creates a pipeline that runs this in the background
-func (p *Pipeline) Background() Executable {
-	return &Pipeline{
-		operation:       OpBackground,
-		left:            p,
-		right:           nil,
-		shutdownTimeout: p.shutdownTimeout,
-	}
+// clone returns a copy of p, so With* methods never modify a shared definition
+func (p *Pipeline) clone() *Pipeline {
+	clone := *p
+	clone.self = &clone
+	return &clone
 }
 
-// WithShutdownTimeout sets the graceful shutdown timeout
-func (p *Pipeline) WithShutdownTimeout(timeout time.Duration) Executable {
-	p.shutdownTimeout = timeout
-	return p
+func (p *Pipeline) configure(edit func(*settings)) Executable {
+	clone := p.clone()
+	edit(&clone.settings)
+	return clone
 }
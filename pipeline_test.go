@@ -2,7 +2,12 @@ package subprocess
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -165,6 +170,95 @@ func TestOrOperatorFailure(t *testing.T) {
 	}
 }
 
+func TestThenOperator(t *testing.T) {
+	ctx := context.Background()
+	falseCmd, _ := NewExecutable("false")
+	trueCmd, _ := NewExecutable("true")
+	echo, _ := NewExecutable("echo", "after")
+
+	tests := []struct {
+		name       string
+		exec       Executable
+		wantCode   int
+		wantStdout string
+	}{
+		{
+			// Test: false; echo after runs echo and succeeds
+			name:       "after failure",
+			exec:       falseCmd.Then(echo),
+			wantStdout: "after\n",
+		},
+		{
+			// Test: echo after; echo after keeps the output of both commands
+			name:       "both outputs",
+			exec:       echo.Then(echo),
+			wantStdout: "after\nafter\n",
+		},
+		{
+			// Test: true; false fails with the exit code of the last command
+			name:     "last fails",
+			exec:     trueCmd.Then(falseCmd),
+			wantCode: 1,
+		},
+		{
+			// Test: false && true; echo after runs echo after the skipped and
+			name:       "after and",
+			exec:       falseCmd.And(trueCmd).Then(echo),
+			wantStdout: "after\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := tt.exec.Run(ctx)
+			if result.Type != OpSeq {
+				t.Errorf("expected OpSeq, got %v", result.Type)
+			}
+			if result.ExitCode != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, result.ExitCode)
+			}
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("expected stdout %q, got %q", tt.wantStdout, result.Stdout)
+			}
+			if len(result.Children) != 2 || result.Children[1].Skipped {
+				t.Error("expected both commands to run")
+			}
+		})
+	}
+}
+
+func TestThenPipe(t *testing.T) {
+	// Test: (echo a; echo b) | wc -l pipes the output of both commands
+	ctx := context.Background()
+	a, _ := NewExecutable("echo", "a")
+	b, _ := NewExecutable("echo", "b")
+	wc, _ := NewExecutable("wc", "-l")
+
+	result, err := a.Then(b).Pipe(wc).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(result.Stdout)); got != "2" {
+		t.Errorf("expected 2 lines, got %q", got)
+	}
+}
+
+func TestThenCancelled(t *testing.T) {
+	// Test: the next command is skipped once the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sleep, _ := NewExecutable("sleep", "5")
+	echo, _ := NewExecutable("echo", "after")
+
+	result, err := sleep.Then(echo).Run(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(result.Children) != 2 || !result.Children[1].Skipped {
+		t.Error("expected the next command to be skipped")
+	}
+}
+
 func TestComplexPipeline(t *testing.T) {
 	// Test: (echo "test" | grep "test") && echo "found" || echo "not found"
 	ctx := context.Background()
@@ -288,3 +382,485 @@ func TestPipeFailFast(t *testing.T) {
 		t.Error("expected non-zero exit code")
 	}
 }
+
+func TestProgressTimeout(t *testing.T) {
+	// Test: a pipe that moves no data is stopped and its stalled stages are named
+	ctx := context.Background()
+
+	stuck, _ := NewExecutable("sleep", "5")
+	cat, _ := NewExecutable("cat")
+
+	start := time.Now()
+	result, err := stuck.Pipe(cat).WithProgressTimeout(200 * time.Millisecond).Run(ctx)
+	duration := time.Since(start)
+
+	var stalled *ProgressTimeoutError
+	if !errors.As(err, &stalled) {
+		t.Fatalf("expected ProgressTimeoutError, got: %v", err)
+	}
+	if duration > 2*time.Second {
+		t.Errorf("progress timeout took too long: %v", duration)
+	}
+	if result.ExitCode != -1 {
+		t.Errorf("expected exit code -1, got %d", result.ExitCode)
+	}
+
+	if len(stalled.Stages) != 2 || stalled.Stages[0] != "sleep 5" || stalled.Stages[1] != "cat" {
+		t.Errorf("unexpected stalled stages: %v", stalled.Stages)
+	}
+}
+
+func TestProgressTimeoutWithProgress(t *testing.T) {
+	// Test: a pipe that keeps moving data is not stopped
+	ctx := context.Background()
+
+	ticker, _ := NewExecutable("sh", "-c", "for i in 1 2 3 4 5; do echo $i; sleep 0.05; done")
+	wc, _ := NewExecutable("wc", "-l")
+
+	result, err := ticker.Pipe(wc).WithProgressTimeout(200 * time.Millisecond).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+
+	stdout := strings.TrimSpace(string(result.Stdout))
+	if stdout != "5" {
+		t.Errorf("expected '5', got: %s", stdout)
+	}
+}
+
+func TestProgressTimeoutStreams(t *testing.T) {
+	// Test: fan-in, routes, Cmd, Reader and Writer are stopped when they make no progress
+	timeout := 200 * time.Millisecond
+	sleep, _ := NewExecutable("sleep", "5")
+	echo, _ := NewExecutable("echo", "hi")
+	cat, _ := NewExecutable("cat")
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"fan-in", func(ctx context.Context) error {
+			_, err := FanIn(sleep, echo).WithProgressTimeout(timeout).Run(ctx)
+			return err
+		}},
+		{"route", func(ctx context.Context) error {
+			_, err := Route(sleep).When(".", cat).WithProgressTimeout(timeout).Run(ctx)
+			return err
+		}},
+		{"cmd", func(ctx context.Context) error {
+			return NewCmd(ctx, sleep.Pipe(cat).WithProgressTimeout(timeout)).Run()
+		}},
+		{"reader", func(ctx context.Context) error {
+			_, err := io.ReadAll(sleep.Pipe(cat).WithProgressTimeout(timeout).Reader(ctx))
+			return err
+		}},
+		{"writer", func(ctx context.Context) error {
+			w := cat.Pipe(cat).WithProgressTimeout(timeout).Writer(ctx)
+			w.Write([]byte("x\n"))
+			time.Sleep(2 * timeout)
+			return w.Close()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			err := tt.run(context.Background())
+			var stalled *ProgressTimeoutError
+			if !errors.As(err, &stalled) {
+				t.Fatalf("expected ProgressTimeoutError, got: %v", err)
+			}
+			if duration := time.Since(start); duration > 2*time.Second {
+				t.Errorf("progress timeout took too long: %v", duration)
+			}
+		})
+	}
+}
+
+func TestPipeDownstreamExitsEarly(t *testing.T) {
+	// Test: yes | head -n 1 terminates once head exits
+	ctx := context.Background()
+	baseline := runtime.NumGoroutine()
+
+	yes, _ := NewExecutable("yes")
+	head, _ := NewExecutable("head", "-n", "1")
+
+	done := make(chan *Result, 1)
+	go func() {
+		result, _ := yes.Pipe(head).Run(ctx)
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		if string(result.Children[1].Stdout) != "y\n" {
+			t.Errorf("expected 'y', got: %q", result.Children[1].Stdout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipe did not terminate after downstream exited")
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+func TestPipeCancelMidStream(t *testing.T) {
+	// Test: cancelling the context stops every stage of a streaming pipe
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	baseline := runtime.NumGoroutine()
+
+	yes, _ := NewExecutable("yes")
+	cat1, _ := NewExecutable("cat")
+	cat2, _ := NewExecutable("cat")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := yes.Pipe(cat1).Pipe(cat2).Run(ctx)
+	if err == nil {
+		t.Error("expected error from cancelled pipe")
+	}
+	if duration := time.Since(start); duration > 5*time.Second {
+		t.Errorf("cancelled pipe took too long: %v", duration)
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+func TestPipeStageKilledMidStream(t *testing.T) {
+	// Test: killing a middle stage ends the pipe without leaking goroutines
+	ctx := context.Background()
+	baseline := runtime.NumGoroutine()
+
+	yes, _ := NewExecutable("yes")
+	dies, _ := NewExecutable("sh", "-c", "head -c 1000; kill -9 $$")
+	wc, _ := NewExecutable("wc", "-c")
+
+	result, err := yes.Pipe(dies).Pipe(wc).Run(ctx)
+	if err == nil {
+		t.Error("expected error from killed stage")
+	}
+
+	stdout := strings.TrimSpace(string(result.Stdout))
+	if stdout != "1000" {
+		t.Errorf("expected 1000 bytes to reach wc, got: %s", stdout)
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+func TestPipeCancelWithOrphanedDescendant(t *testing.T) {
+	// Test: a descendant holding the pipe open does not block cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	baseline := runtime.NumGoroutine()
+
+	spawner, _ := NewExecutable("sh", "-c", "sleep 10 & echo started; wait")
+	cat, _ := NewExecutable("cat")
+
+	start := time.Now()
+	_, err := spawner.Pipe(cat).Run(ctx)
+	if err == nil {
+		t.Error("expected error from cancelled pipe")
+	}
+	if duration := time.Since(start); duration > 5*time.Second {
+		t.Errorf("cancelled pipe took too long: %v", duration)
+	}
+
+	waitForGoroutines(t, baseline)
+}
+
+// waitForGoroutines fails the test if the number of goroutines does not
+// return to baseline, which means the engine leaked some
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked goroutines: %d running, expected at most %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStdinPolicy(t *testing.T) {
+	// A reader that tells EOF (status 1) apart from a read timeout (status > 128)
+	script := `read line; if read -t 0.3 more; then echo "data"; else echo "$line $?"; fi`
+
+	tests := []struct {
+		name     string
+		policy   StdinPolicy
+		expected string
+	}{
+		{
+			name:     "close on upstream EOF",
+			policy:   StdinCloseOnEOF,
+			expected: "hi 1",
+		},
+		{
+			name:     "keep open",
+			policy:   StdinKeepOpen,
+			expected: "hi 142",
+		},
+		{
+			name:     "close immediately",
+			policy:   StdinCloseImmediately,
+			expected: " 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			echo, _ := NewExecutable("echo", "hi")
+			process, _ := NewProcess("bash", []string{"-c", script}, WithStdinPolicy(tt.policy))
+
+			result, err := echo.Pipe(FromProcess(process)).Run(ctx)
+			if err != nil {
+				t.Fatalf("pipe failed: %v", err)
+			}
+
+			stdout := strings.TrimRight(string(result.Stdout), "\n")
+			if stdout != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, stdout)
+			}
+		})
+	}
+}
+
+func TestCommandStdinInPipe(t *testing.T) {
+	// Test: a stage with redirected stdin ignores upstream output, like "a | b < file"
+	ctx := context.Background()
+
+	echo, _ := NewExecutable("echo", "ignored")
+	tr, _ := Command("tr", []string{"a-z", "A-Z"}, WithStdin(strings.NewReader("from stdin\n")))
+	cat, _ := NewExecutable("cat")
+
+	result, err := echo.Pipe(tr).Pipe(cat).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	if string(result.Stdout) != "FROM STDIN\n" {
+		t.Errorf("unexpected output: %q", result.Stdout)
+	}
+}
+
+func TestWithReturnsCopy(t *testing.T) {
+	// Test: With* methods leave the receiver unchanged
+	echo, _ := NewExecutable("echo", "hi")
+	cat, _ := NewExecutable("cat")
+
+	tuned := echo.WithShutdownTimeout(time.Second)
+	if echo.(*ExecutableProcess).settings.shutdownTimeout == time.Second {
+		t.Error("WithShutdownTimeout modified the original process")
+	}
+	if tuned.(*ExecutableProcess).settings.shutdownTimeout != time.Second {
+		t.Error("WithShutdownTimeout was not applied to the copy")
+	}
+
+	pipe := echo.Pipe(cat)
+	pipe.WithProgressTimeout(time.Minute)
+	if pipe.(*Pipeline).settings.progressTimeout != 0 {
+		t.Error("WithProgressTimeout modified the original pipeline")
+	}
+}
+
+func TestBuilderReuse(t *testing.T) {
+	// Test: a shared base definition can be extended in different ways
+	ctx := context.Background()
+	src, _ := NewExecutable("printf", "a\\nb\\n")
+	catA, _ := NewExecutable("cat")
+	catB, _ := NewExecutable("cat")
+
+	base := Route(src).When("^a", catA)
+	withDefault := base.Default(catB)
+
+	result, err := base.Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+	if len(result.Children) != 2 {
+		t.Errorf("expected base route to have 2 children, got %d", len(result.Children))
+	}
+
+	result, err = withDefault.Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+	if len(result.Children) != 3 {
+		t.Errorf("expected extended route to have 3 children, got %d", len(result.Children))
+	}
+
+	merged := FanIn(src, src)
+	merged.Mode(MergeByKey)
+	if merged.mode != MergeInterleaved {
+		t.Error("Mode modified the original merger")
+	}
+}
+
+func TestConcurrentRunSameDefinition(t *testing.T) {
+	// Test: one definition can run from many goroutines at once
+	ctx := context.Background()
+	echo, _ := NewExecutable("echo", "hello")
+	tr, _ := NewExecutable("tr", "a-z", "A-Z")
+	pipe := echo.Pipe(tr)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := pipe.Run(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(result.Stdout) != "HELLO\n" {
+				errs <- fmt.Errorf("unexpected output: %q", result.Stdout)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestBackgroundInsidePipe(t *testing.T) {
+	// Test: a | b & backgrounds the whole pipe, wherever Background appears
+	ctx := context.Background()
+	echo, _ := NewExecutable("echo", "hi")
+	fail, _ := NewExecutable("sh", "-c", "cat; exit 1")
+
+	for name, pipe := range map[string]Executable{
+		"right":  echo.Pipe(fail.Background()),
+		"left":   echo.Background().Pipe(fail),
+		"nested": echo.Pipe(fail).Background().Pipe(fail),
+	} {
+		result, err := pipe.Run(ctx)
+		if err != nil {
+			t.Errorf("%s: expected no error from background pipe, got %v", name, err)
+			continue
+		}
+		if result.Type != OpBackground {
+			t.Errorf("%s: expected OpBackground, got %v", name, result.Type)
+		}
+		// The pipe failed in the background
+		if len(result.BackgroundErrors) != 1 {
+			t.Errorf("%s: expected 1 background error, got %v", name, result.BackgroundErrors)
+		}
+	}
+}
+
+func TestBackgroundPipeInMixedTree(t *testing.T) {
+	// Test: in (a | b &) || x && c the background pipe counts as a success
+	ctx := context.Background()
+	sleep, _ := NewExecutable("sh", "-c", "sleep 0.2; exit 1")
+	cat, _ := NewExecutable("cat")
+	echo, _ := NewExecutable("echo", "next")
+
+	bg := sleep.Pipe(cat.Background())
+	result, err := bg.Or(echo).And(echo).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipeline failed: %v", err)
+	}
+	if string(result.Stdout) != "next\n" {
+		t.Errorf("unexpected output: %q", result.Stdout)
+	}
+	if len(result.Children) != 2 || !result.Children[0].Children[1].Skipped {
+		t.Error("expected Or branch to be skipped since the background pipe succeeds")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	// Test: heartbeats keep a stdin-watching tool alive without hiding stalls
+	ctx := context.Background()
+	first, _ := NewExecutable("true")
+
+	// The tool echoes every heartbeat, which counts as progress
+	echoing, _ := Command("bash", []string{"-c", "for i in 1 2 3 4 5 6; do read -t 1 line || exit 1; echo $line; done"},
+		WithStdinPolicy(StdinKeepOpen), WithHeartbeat(50*time.Millisecond, []byte("ping\n")))
+	result, err := first.Pipe(echoing).WithProgressTimeout(150 * time.Millisecond).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	if strings.Count(string(result.Stdout), "ping") != 6 {
+		t.Errorf("expected 6 heartbeats echoed, got %q", result.Stdout)
+	}
+
+	// The tool is silent: heartbeats alone do not hide the stall
+	silent, _ := Command("sleep", []string{"5"},
+		WithStdinPolicy(StdinKeepOpen), WithHeartbeat(50*time.Millisecond, nil))
+	_, err = first.Pipe(silent).WithProgressTimeout(150 * time.Millisecond).Run(ctx)
+	var stalled *ProgressTimeoutError
+	if !errors.As(err, &stalled) {
+		t.Errorf("expected ProgressTimeoutError, got %v", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	// Test: diagnostics run only for the failing stage and are attached to it
+	ctx := context.Background()
+	df, _ := NewExecutable("echo", "disk report")
+	uname, _ := NewExecutable("echo", "system report")
+
+	ok, _ := Command("echo", []string{"input"}, WithDiagnostics(df))
+	failing, _ := Command("sh", []string{"-c", "cat >/dev/null; exit 3"}, WithDiagnostics(df, uname))
+
+	result, err := ok.Pipe(failing).Run(ctx)
+	if err == nil {
+		t.Fatal("expected pipe to fail")
+	}
+	if len(result.Children[0].Diagnostics) != 0 {
+		t.Error("expected no diagnostics for the successful stage")
+	}
+
+	diags := result.Children[1].Diagnostics
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d", len(diags))
+	}
+	if string(diags[0].Stdout) != "disk report\n" || string(diags[1].Stdout) != "system report\n" {
+		t.Errorf("unexpected diagnostics output: %q, %q", diags[0].Stdout, diags[1].Stdout)
+	}
+
+	// A single process gets its diagnostics too
+	single, _ := Command("false", nil, WithDiagnostics(df))
+	result, _ = single.Run(ctx)
+	if len(result.Diagnostics) != 1 {
+		t.Errorf("expected 1 diagnostic, got %d", len(result.Diagnostics))
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	// Test: WithMetadata annotations reach the result of every stage
+	ctx := context.Background()
+	build, _ := Command("echo", []string{"built"}, WithMetadata("artifact", "out/app"))
+	tag, _ := Command("cat", nil, WithMetadata("stage", "tag"))
+
+	result, err := build.Pipe(tag).Run(ctx)
+	if err != nil {
+		t.Fatalf("pipe failed: %v", err)
+	}
+	if result.Children[0].Metadata["artifact"] != "out/app" {
+		t.Errorf("expected artifact metadata, got %v", result.Children[0].Metadata)
+	}
+	if result.Children[1].Metadata["stage"] != "tag" {
+		t.Errorf("expected stage metadata, got %v", result.Children[1].Metadata)
+	}
+
+	// Results own their metadata, annotating one run leaves the definition alone
+	result.Children[0].Annotate("version", 2)
+	again, _ := build.Run(ctx)
+	if _, ok := again.Metadata["version"]; ok {
+		t.Error("annotation leaked into another run")
+	}
+	if again.Metadata["artifact"] != "out/app" {
+		t.Errorf("expected artifact metadata, got %v", again.Metadata)
+	}
+}
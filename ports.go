@@ -0,0 +1,118 @@
+package subprocess
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// reservedPorts holds the ports handed out by allocatePorts to processes that
+// are still running, so concurrent runs in this program never share one
+var reservedPorts = struct {
+	sync.Mutex
+	ports map[int]struct{}
+}{ports: make(map[int]struct{})}
+
+// WithPorts allocates a free TCP port for each name every time the process
+// starts, for servers started in parallel tests. "{{name}}" in the arguments
+// and environment is replaced by the port, e.g.
+//
+//	NewProcess("server", []string{"--listen", "127.0.0.1:{{http}}"}, WithPorts("http"))
+//
+// The ports are recorded under the "ports" key of Result.Metadata and
+// returned by ProcessRunner.Ports. A port stays reserved in this program
+// until the process exits; the operating system may still give it to another
+// program between allocation and the moment the process binds it
+func WithPorts(names ...string) Option {
+	return func(o *Options) {
+		o.Ports = append(o.Ports, names...)
+	}
+}
+
+// Ports returns the ports allocated with WithPorts by name
+func (p *ProcessRunner) Ports() map[string]int {
+	return maps.Clone(p.ports)
+}
+
+// annotatePorts records the ports allocated for runner in the metadata of result
+func annotatePorts(result *Result, runner *ProcessRunner) {
+	if len(runner.ports) > 0 {
+		result.Annotate("ports", runner.Ports())
+	}
+}
+
+// allocatePorts reserves a free port for each name, the returned function
+// releases them
+func allocatePorts(names []string) (map[string]int, func(), error) {
+	ports := make(map[string]int, len(names))
+	release := func() {
+		reservedPorts.Lock()
+		for _, port := range ports {
+			delete(reservedPorts.ports, port)
+		}
+		reservedPorts.Unlock()
+	}
+
+	reservedPorts.Lock()
+	defer reservedPorts.Unlock()
+	for _, name := range names {
+		if _, ok := ports[name]; ok {
+			continue
+		}
+		port, err := freePort()
+		if err != nil {
+			for _, port := range ports {
+				delete(reservedPorts.ports, port)
+			}
+			return nil, nil, fmt.Errorf("allocate port %s: %w", name, err)
+		}
+		reservedPorts.ports[port] = struct{}{}
+		ports[name] = port
+	}
+	return ports, release, nil
+}
+
+// freePort asks the operating system for a free port that is not reserved
+// The caller holds the reservedPorts lock
+func freePort() (int, error) {
+	for {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if _, ok := reservedPorts.ports[port]; !ok {
+			return port, nil
+		}
+	}
+}
+
+// withPorts returns a copy of ops with the port placeholders of its arguments
+// and environment replaced
+func (o *Options) withPorts(ports map[string]int) *Options {
+	pairs := make([]string, 0, 2*len(ports))
+	for name, port := range ports {
+		pairs = append(pairs, "{{"+name+"}}", strconv.Itoa(port))
+	}
+	r := strings.NewReplacer(pairs...)
+	replace := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+		out := make([]string, len(values))
+		for i, v := range values {
+			out[i] = r.Replace(v)
+		}
+		return out
+	}
+
+	ops := *o
+	ops.Args = replace(o.Args)
+	ops.Env = replace(o.Env)
+	ops.EnvOverrides = replace(o.EnvOverrides)
+	return &ops
+}
@@ -0,0 +1,64 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithPorts(t *testing.T) {
+	// Test: placeholders in arguments and environment are replaced by the
+	// allocated ports, which are recorded in the result
+	exec, _ := Command("sh", []string{"-c", "echo {{http}} $GRPC {{other}}"},
+		WithPorts("http", "grpc"),
+		WithEnvOverrides(map[string]string{"GRPC": "{{grpc}}"}))
+
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	ports, ok := result.Metadata["ports"].(map[string]int)
+	if !ok || len(ports) != 2 || ports["http"] == ports["grpc"] {
+		t.Fatalf("expected two distinct ports in the metadata, got %v", result.Metadata)
+	}
+	want := fmt.Sprintf("%d %d {{other}}\n", ports["http"], ports["grpc"])
+	if string(result.Stdout) != want {
+		t.Errorf("expected %q, got %q", want, result.Stdout)
+	}
+
+	reservedPorts.Lock()
+	defer reservedPorts.Unlock()
+	if len(reservedPorts.ports) != 0 {
+		t.Errorf("expected ports to be released after the exit, got %v", reservedPorts.ports)
+	}
+}
+
+func TestWithPortsConcurrent(t *testing.T) {
+	// Test: processes running at the same time never share a port
+	p, _ := NewProcess("sh", []string{"-c", "echo {{port}}; sleep 0.2"}, WithPorts("port"))
+
+	const runs = 20
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for range runs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := FromProcess(p).Run(context.Background())
+			if err != nil {
+				t.Errorf("Run failed: %v", err)
+				return
+			}
+			mu.Lock()
+			seen[strings.TrimSpace(string(result.Stdout))] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(seen) != runs {
+		t.Errorf("expected %d distinct ports, got %d", runs, len(seen))
+	}
+}
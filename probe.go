@@ -0,0 +1,189 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ToolProbe checks that a tool is installed in a supported version
+type ToolProbe struct {
+	Command     string   // name or path of the tool
+	VersionArgs []string // arguments printing the version, e.g. --version
+	Constraint  string   // semver constraint like ">=1.20, <2" or "^4.2", empty accepts any version
+}
+
+// ToolError lists every missing or outdated tool found by CheckTools
+type ToolError struct {
+	Problems []string
+}
+
+func (e *ToolError) Error() string {
+	return "missing or unsupported tools: " + strings.Join(e.Problems, "; ")
+}
+
+// Probe describes a tool requirement checked with CheckTools
+func Probe(cmd string, versionArgs []string, constraint string) ToolProbe {
+	return ToolProbe{Command: cmd, VersionArgs: versionArgs, Constraint: constraint}
+}
+
+// CheckTools checks every probe before a pipeline runs and returns a
+// *ToolError listing all missing and outdated tools, or nil
+// The first version number printed by the tool is compared to the constraint
+func CheckTools(ctx context.Context, probes ...ToolProbe) error {
+	var problems []string
+	for _, p := range probes {
+		if err := p.check(ctx); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", p.Command, err))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ToolError{Problems: problems}
+}
+
+// versionPattern matches the first version number in the output of a tool
+var versionPattern = regexp.MustCompile(`\d+(\.\d+){0,2}`)
+
+// check returns why the tool does not satisfy the probe
+func (p ToolProbe) check(ctx context.Context) error {
+	if _, err := exec.LookPath(p.Command); err != nil {
+		return fmt.Errorf("not found")
+	}
+	if p.Constraint == "" {
+		return nil
+	}
+	constraint, err := parseConstraint(p.Constraint)
+	if err != nil {
+		return err
+	}
+
+	probe, _ := Command(p.Command, p.VersionArgs)
+	result, err := probe.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("version check failed: %w", err)
+	}
+	match := versionPattern.Find(result.Stdout)
+	if match == nil {
+		return fmt.Errorf("no version in output %q", strings.TrimSpace(string(result.Stdout)))
+	}
+	version, _ := parseVersion(string(match))
+	if !constraint.allows(version) {
+		return fmt.Errorf("version %s does not satisfy %q", match, p.Constraint)
+	}
+	return nil
+}
+
+// version is a major, minor, patch triple
+type version [3]int
+
+// compare returns -1, 0 or 1 like strings.Compare
+func (v version) compare(o version) int {
+	for i := range v {
+		if v[i] != o[i] {
+			if v[i] < o[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses "1", "1.2" or "v1.2.3", missing parts are zero
+// It also returns how many parts were given
+func parseVersion(s string) (version, int) {
+	var v version
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) > 3 || s == "" {
+		return v, 0
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, 0
+		}
+		v[i] = n
+	}
+	return v, len(parts)
+}
+
+// constraint is a list of comparisons that must all hold
+type constraint []comparison
+
+type comparison struct {
+	op string
+	v  version
+}
+
+func (c constraint) allows(v version) bool {
+	for _, cmp := range c {
+		r := v.compare(cmp.v)
+		ok := false
+		switch cmp.op {
+		case ">=":
+			ok = r >= 0
+		case ">":
+			ok = r > 0
+		case "<=":
+			ok = r <= 0
+		case "<":
+			ok = r < 0
+		case "!=":
+			ok = r != 0
+		default:
+			ok = r == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseConstraint parses comparisons separated by commas or spaces, with the
+// operators =, !=, >, >=, <, <=, ^ (same major version) and ~ (same minor version)
+func parseConstraint(s string) (constraint, error) {
+	var c constraint
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		op := strings.TrimRight(field, "v0123456789.")
+		if op == field && i+1 < len(fields) {
+			// Operator separated from its version, like ">= 1.2"
+			i++
+			field += fields[i]
+		}
+		v, parts := parseVersion(field[len(op):])
+		if parts == 0 {
+			return nil, fmt.Errorf("invalid version constraint %q", s)
+		}
+
+		switch op {
+		case "^":
+			upper := version{v[0] + 1, 0, 0}
+			if v[0] == 0 {
+				upper = version{0, v[1] + 1, 0}
+			}
+			c = append(c, comparison{">=", v}, comparison{"<", upper})
+		case "~":
+			upper := version{v[0], v[1] + 1, 0}
+			if parts == 1 {
+				upper = version{v[0] + 1, 0, 0}
+			}
+			c = append(c, comparison{">=", v}, comparison{"<", upper})
+		case "", "=", "==", "!=", ">", ">=", "<", "<=":
+			c = append(c, comparison{op, v})
+		default:
+			return nil, fmt.Errorf("invalid operator %q in version constraint %q", op, s)
+		}
+	}
+	if len(c) == 0 {
+		return nil, fmt.Errorf("invalid version constraint %q", s)
+	}
+	return c, nil
+}
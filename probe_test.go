@@ -0,0 +1,68 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConstraint(t *testing.T) {
+	// Test: versions are checked against semver constraints
+	tests := []struct {
+		constraint string
+		version    string
+		allowed    bool
+	}{
+		{">=1.20", "1.21.3", true},
+		{">=1.20", "1.9", false},
+		{">= 1.2, < 2", "1.9.9", true},
+		{">=1.2 <2", "2.0.0", false},
+		{"^4.2", "4.30.1", true},
+		{"^4.2", "5.0", false},
+		{"^0.3", "0.4.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"1.2.3", "1.2.3", true},
+		{"!=1.2.3", "1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.version, func(t *testing.T) {
+			c, err := parseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			v, _ := parseVersion(tt.version)
+			if c.allows(v) != tt.allowed {
+				t.Errorf("expected allowed=%v", tt.allowed)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", ">=", "=>1.2", "1.2.3.4", "~x"} {
+		if _, err := parseConstraint(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	// Test: every missing and outdated tool is reported
+	ctx := context.Background()
+	ok := Probe("sh", []string{"-c", "echo tool version 1.4.2"}, "^1.4")
+	if err := CheckTools(ctx, ok, Probe("true", nil, "")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	outdated := Probe("sh", []string{"-c", "echo tool version 1.4.2"}, ">=2")
+	missing := Probe("no-such-tool-xyz", []string{"--version"}, "")
+	err := CheckTools(ctx, ok, outdated, missing)
+
+	var toolErr *ToolError
+	if !errors.As(err, &toolErr) {
+		t.Fatalf("expected ToolError, got %v", err)
+	}
+	if len(toolErr.Problems) != 2 {
+		t.Errorf("expected 2 problems, got %v", toolErr.Problems)
+	}
+}
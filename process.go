@@ -2,89 +2,576 @@ package subprocess
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"slices"
+	"sync"
+	"time"
 )
 
 type Options struct {
-	Command string
-	Args    []string
+	Command      string
+	Args         []string
+	StdinPolicy  StdinPolicy // when the engine closes stdin in pipelines
+	Dir          string      // working directory, empty for the current one
+	Env          []string    // environment in "key=value" form, nil inherits it
+	EnvOverrides []string    // set on top of Env or the inherited environment
+	Stdin        io.Reader   // read by the process instead of stdin written through the runner
+	StdinData    []byte      // read by every run as its stdin
+	StdinFile    string      // opened by every run as its stdin
 
-	reader io.ReadCloser
-	writer io.WriteCloser
+	DeadlineNotice *DeadlineNotice   // notify the process before its context deadline
+	Heartbeat      *Heartbeat        // write to stdin periodically
+	CPULimit       time.Duration     // kill the process after this much CPU time, 0 is unlimited
+	MemoryLimit    int64             // kill the process above this resident set size in bytes, 0 is unlimited
+	DiskLimit      *DiskLimit        // kill the process when a directory grows too large
+	NoNetwork      bool              // run the process without network access
+	TraceFiles     bool              // record the files opened by the process
+	Proxy          *Proxy            // proxy settings added to the environment
+	Diagnostics    []Executable      // run when the process fails
+	CrashReport    bool              // collect a CrashReport when the process crashes
+	MutexKey       string            // serialize with other processes using the same key
+	LockFile       string            // serialize with other processes, also in other programs, using this file
+	Singleflight   bool              // share the result of an identical run in progress
+	Transcript     io.Writer         // log of the stdin, stdout and stderr traffic
+	Recording      io.Writer         // asciinema cast of the terminal session with WithPTY
+	CILog          io.Writer         // receives the output as a CI log group
+	CIStyle        CIStyle           // log syntax of CILog
+	Metadata       map[string]any    // annotations copied to the Result of the process
+	Color          ColorPolicy       // whether the process prints colored output
+	LoadThrottle   *LoadThrottle     // delay and deprioritize the process on a busy host
+	Delay          time.Duration     // wait before starting the process
+	Toolchain      *Toolchain        // resolves the command and PATH of the process
+	Script         *EmbeddedScript   // extracted and run, by Command if it is set
+	RawCmdLine     string            // verbatim Windows command line
+	Encoding       string            // encoding of the output, transcoded to UTF-8
+	Timezone       string            // TZ of the process
+	FakeTime       *FakeTime         // clock of the process, set through libfaketime
+	CombinedOutput bool              // capture stderr after stdout in Result.Stdout
+	StdoutSink     io.Writer         // receives stdout as it is read
+	StderrSink     io.Writer         // receives stderr as it is read
+	StdoutHandler  func([]byte)      // receives each stdout line instead of Result.Stdout
+	StderrHandler  func([]byte)      // receives each stderr line instead of Result.Stderr
+	MaxOutputSize  int64             // cap of the captured stdout and stderr, 0 uses Defaults.MaxOutput
+	OutputLimit    OutputLimitPolicy // what happens past MaxOutputSize
+	Demux          *StreamDemux      // tells stderr lines apart in the captured stdout
+	Umask          *os.FileMode      // file mode creation mask, nil keeps the one of the program
+	PTY            bool              // run the process in a pseudo-terminal
+	ProcessGroup   bool              // run the process in its own process group, signaled as a whole
+	CancelSignal   os.Signal         // sent when the context is done, nil kills the process
+	KillDelay      time.Duration     // time between CancelSignal and SIGKILL
+	Timeout        time.Duration     // stop the process after this much wall time, 0 is unlimited
+	Ports          []string          // names of the free ports allocated for every run
+	SnapshotEnv    bool              // record the environment of the process in Result.Env
+	SecretEnv      []string          // parts of variable names redacted in the snapshot
+
+	chaos *chaosSource // faults injected by InjectChaos
 }
 
 type Process struct {
 	ops *Options
 }
 
+// Stream is the bidirectional connection to a running process
+// Reads return stdout followed by stderr, writes go to stdin
+type Stream interface {
+	io.ReadWriteCloser
+
+	// CloseWrite closes stdin only, signaling EOF to the process while
+	// its output can still be read
+	CloseWrite() error
+}
+
 type ProcessRunner struct {
 	cmd          *exec.Cmd
-	readerWriter io.ReadWriteCloser
-	doneCh       chan error
+	readerWriter *processStream
+	stdout       *os.File       // read end of the stdout pipe
+	stderr       *os.File       // read end of the stderr pipe
+	stdoutStream io.Reader      // stdout as read by callers, decoded and recorded
+	pty          *os.File       // master of the pseudo-terminal with WithPTY
+	cast         *castRecorder  // terminal session recorded with WithRecording
+	group        bool           // signals go to the process group of the process
+	ports        map[string]int // ports allocated with WithPorts
+	env          *EnvSnapshot   // environment recorded with WithEnvSnapshot
+	ciLog        *ciLog         // output group written with WithCIAnnotations
+	tracer       *fileTracer    // opened files recorded with WithFileTracing
+	cancel       func()         // cancels the context the process was started with
+	stderrStream io.Reader      // stderr as read by callers, decoded and recorded
+	done         chan struct{}  // closed once the process has exited
+	err          error          // exit status, valid after done is closed
+
+	shutdownTimeout time.Duration // grace period between SIGTERM and SIGKILL in ShutdownAll
+	started         time.Time     // when the process was started
+	exitedAt        time.Time     // when the process exited, valid after done is closed
+
+	mu         sync.Mutex
+	killedBy   error       // reason the engine killed the process, returned by Wait
+	peakMemory int64       // highest resident set size seen by the limit monitor
+	tail       *outputTail // last output read, kept with WithCrashReport
+	lastStatus string      // last /proc status sampled with WithCrashReport
+	panicked   *PanicError // panic of an output handler, raised again by the visitor
 }
 
 func (p *ProcessRunner) Stop() error {
-	return p.cmd.Process.Kill()
+	return p.signal(os.Kill)
 }
 
 func (p *ProcessRunner) Wait() error {
-	return <-p.doneCh
+	<-p.done
+	return p.err
+}
+
+// closeOutput closes the read ends of the output pipes
+// Pending reads return EOF and the process gets SIGPIPE on its next write
+func (p *ProcessRunner) closeOutput() {
+	p.stdout.Close()
+	p.stderr.Close()
+}
+
+// exited reports whether the process has already exited
+func (p *ProcessRunner) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
 }
 
-func (p *ProcessRunner) ReaderWriter() io.ReadWriteCloser {
+// Cmd returns the underlying exec.Cmd, for code that needs its Process or ProcessState
+func (p *ProcessRunner) Cmd() *exec.Cmd {
+	return p.cmd
+}
+
+func (p *ProcessRunner) ReaderWriter() Stream {
 	return p.readerWriter
 }
 
-func NewProcess(cmd string, args []string) (*Process, error) {
+// Stdout returns the stdout of the process alone
+// Read either Stdout and Stderr or the combined ReaderWriter, not both
+func (p *ProcessRunner) Stdout() io.Reader {
+	return p.stdoutStream
+}
+
+// Stderr returns the stderr of the process alone
+// It must be read concurrently with Stdout, or the process may block on a
+// full pipe
+func (p *ProcessRunner) Stderr() io.Reader {
+	return p.stderrStream
+}
+
+// NewProcess creates a Process definition that can be executed many times,
+// also concurrently. Slices are copied so later changes by the caller have no effect
+func NewProcess(cmd string, args []string, opts ...Option) (*Process, error) {
 	p := &Process{
 		ops: &Options{
-			Command: cmd,
-			Args:    args,
+			Command:   cmd,
+			Args:      slices.Clone(args),
+			Env:       slices.Clone(Defaults.Env),
+			Proxy:     Defaults.Proxy,
+			Toolchain: Defaults.Toolchain,
 		},
 	}
+	for _, opt := range opts {
+		opt(p.ops)
+	}
 	return p, nil
 }
 
 func (p *Process) Exec(ctx context.Context) (*ProcessRunner, error) {
-	cmd := exec.CommandContext(ctx, p.ops.Command, p.ops.Args...)
-	stdinPipe, err := cmd.StdinPipe()
+	return p.exec(ctx, Defaults.ShutdownTimeout)
+}
+
+// exec starts the process, shutdownTimeout is used when ShutdownAll stops it
+func (p *Process) exec(ctx context.Context, shutdownTimeout time.Duration) (*ProcessRunner, error) {
+	if p.ops.TraceFiles {
+		if err := checkTracingSupported(); err != nil {
+			return nil, err
+		}
+	}
+	if p.ops.needsProcStats() {
+		if err := checkLimitsSupported(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fetchCommand(ctx, p.ops); err != nil {
+		return nil, err
+	}
+	var faults []Fault
+	if p.ops.chaos != nil {
+		faults = p.ops.chaos.draw(p.ops)
+	}
+	if err := sleepContext(ctx, p.ops.Delay+startDelay(faults)); err != nil {
+		return nil, err
+	}
+
+	busy := false
+	if throttle := p.ops.LoadThrottle; throttle != nil {
+		var err error
+		if busy, err = throttle.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Wait for the locks first so the process does not start before its turn
+	unlock, err := acquireLocks(ctx, p.ops)
+	if err != nil {
+		return nil, err
+	}
+	var ports map[string]int
+	if len(p.ops.Ports) > 0 {
+		var releasePorts func()
+		if ports, releasePorts, err = allocatePorts(p.ops.Ports); err != nil {
+			unlock()
+			return nil, err
+		}
+		unlockFiles := unlock
+		unlock = func() {
+			releasePorts()
+			unlockFiles()
+		}
+		p = &Process{ops: p.ops.withPorts(ports)}
+	}
+	l, err := commandLine(p.ops)
 	if err != nil {
+		unlock()
 		return nil, err
 	}
-	stdoutPipe, err := cmd.StdoutPipe()
+	release := func() {
+		l.cleanup()
+		unlock()
+	}
+	// WithTimeout cancels the process through its own context, so it shuts
+	// down the same way as when ctx is done
+	ctx, cancel := context.WithCancel(ctx)
+	runner, err := p.start(ctx, cancel, shutdownTimeout, l, release)
 	if err != nil {
+		cancel()
+		release()
 		return nil, err
 	}
+	if busy {
+		setNice(runner.cmd.Process.Pid, p.ops.LoadThrottle.nice())
+	}
+	runner.injectFaults(faults)
+	runner.ports = ports
+	return runner, nil
+}
 
-	stderrPipe, err := cmd.StderrPipe()
+// start starts the process as described by l, unlock is called once it exited
+// cancel cancels ctx, it is called once the process exited too
+func (p *Process) start(ctx context.Context, cancel context.CancelFunc, shutdownTimeout time.Duration, l *launch, unlock func()) (*ProcessRunner, error) {
+	cmd := exec.CommandContext(ctx, l.name, l.args...)
+	cmd.ExtraFiles = l.extraFiles
+	cmd.Dir = p.ops.Dir
+	cmd.Env = processEnv(p.ops)
+	// exec.Command searched the PATH of the program, the one of the process wins
+	if path, err := lookPath(l.name, cmd.Env); err == nil {
+		cmd.Path, cmd.Err = path, nil
+	}
+	if err := applyCmdLine(cmd, p.ops); err != nil {
+		return nil, err
+	}
+	if err := setProcessGroup(cmd, p.ops); err != nil {
+		return nil, err
+	}
+	setCancel(cmd, p.ops)
+	if err := checkClock(p.ops); err != nil {
+		return nil, err
+	}
+	decode, err := lookupEncoding(p.ops.Encoding)
 	if err != nil {
 		return nil, err
 	}
+	if p.ops.NoNetwork {
+		if err := isolateNetwork(cmd); err != nil {
+			return nil, err
+		}
+	}
 
-	readerWriter := io.MultiReader(stdoutPipe, stderrPipe)
+	var tr *transcript
+	if p.ops.Transcript != nil {
+		tr = newTranscript(p.ops.Transcript)
+	}
 
-	rw := struct {
-		io.Reader
-		io.Writer
-		io.Closer
-	}{
-		Reader: readerWriter,
-		Writer: stdinPipe,
-		Closer: stdinPipe,
+	var stdinPipe io.WriteCloser = redirectedStdin{}
+	if p.ops.PTY {
+		// Connected to the terminal below
+		if l.stdin != nil {
+			return nil, errors.New("WithPTY cannot be combined with WithStdin")
+		}
+	} else if p.ops.Recording != nil {
+		return nil, errors.New("WithRecording requires WithPTY")
+	} else if l.stdin != nil {
+		cmd.Stdin = l.stdin
+		if tr != nil {
+			cmd.Stdin = &transcriptReader{r: l.stdin, stream: "stdin", transcript: tr}
+		}
+	} else {
+		var err error
+		if stdinPipe, err = cmd.StdinPipe(); err != nil {
+			return nil, err
+		}
+		if tr != nil {
+			stdinPipe = &transcriptWriter{w: stdinPipe, transcript: tr}
+		}
 	}
 
-	if err := cmd.Start(); err != nil {
+	// Use our own pipes for output: exec.Cmd closes the pipes returned by
+	// StdoutPipe/StderrPipe as soon as Wait returns, which races with readers
+	// With a PTY, the terminal carries stdin, stdout and stderr, and the
+	// stderr pipe stays empty
+	var stdoutReader, stdoutWriter *os.File
+	if p.ops.PTY {
+		stdoutReader, stdoutWriter, err = openPTY()
+	} else {
+		stdoutReader, stdoutWriter, err = os.Pipe()
+	}
+	if err != nil {
 		return nil, err
 	}
-	doneCh := make(chan error, 1)
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdoutReader.Close()
+		stdoutWriter.Close()
+		return nil, err
+	}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	var stdout, stderr io.Reader = pipeReader{stdoutReader}, pipeReader{stderrReader}
+	var cast *castRecorder
+	if p.ops.PTY {
+		attachPTY(cmd, stdoutWriter)
+		if p.ops.Recording != nil {
+			rows, cols, _ := windowSize(stdoutReader)
+			cast = newCastRecorder(p.ops.Recording, rows, cols, fmt.Sprint(FromProcess(p)))
+		}
+		stdout = ptyReader{stdoutReader, cast}
+		stdinPipe = &ptyInput{master: stdoutReader, cast: cast}
+		if tr != nil {
+			stdinPipe = &transcriptWriter{w: stdinPipe, transcript: tr}
+		}
+	}
+	if decode != nil {
+		stdout, stderr = decode(stdout), decode(stderr)
+	}
+	if tr != nil {
+		stdout = &transcriptReader{r: stdout, stream: "stdout", transcript: tr}
+		stderr = &transcriptReader{r: stderr, stream: "stderr", transcript: tr}
+	}
+	rw := &processStream{stdin: stdinPipe}
+
+	var tracer *fileTracer
+	if p.ops.TraceFiles {
+		tracer, err = startTraced(cmd, func() error { return startWithUmask(cmd, p.ops.Umask) })
+	} else {
+		err = startWithUmask(cmd, p.ops.Umask)
+	}
+	// The child holds its own copies of the write ends
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		stdoutReader.Close()
+		stderrReader.Close()
+		return nil, err
+	}
+	runner := &ProcessRunner{
+		cmd:             cmd,
+		stdout:          stdoutReader,
+		stderr:          stderrReader,
+		done:            make(chan struct{}),
+		readerWriter:    rw,
+		shutdownTimeout: shutdownTimeout,
+		started:         time.Now(),
+		cancel:          cancel,
+		group:           p.ops.ProcessGroup,
+		tracer:          tracer,
+	}
+	rw.runner = runner
+	if p.ops.PTY {
+		runner.pty = stdoutReader
+		runner.cast = cast
+	}
+	if p.ops.SnapshotEnv {
+		runner.env = snapshotEnv(cmd.Env, p.ops.SecretEnv)
+	}
+	if p.ops.CrashReport {
+		runner.tail = &outputTail{}
+		stdout = &tailReader{r: stdout, runner: runner}
+		stderr = &tailReader{r: stderr, runner: runner}
+	}
+	if p.ops.CILog != nil {
+		runner.ciLog = newCILog(p.ops.CILog, p.ops.CIStyle, fmt.Sprint(FromProcess(p)))
+		stdout = &ciReader{r: stdout, stream: 0, log: runner.ciLog}
+		stderr = &ciReader{r: stderr, stream: 1, log: runner.ciLog}
+	}
+	if p.ops.StdoutSink != nil {
+		stdout = io.TeeReader(stdout, sink{p.ops.StdoutSink})
+	}
+	if p.ops.StderrSink != nil {
+		stderr = io.TeeReader(stderr, sink{p.ops.StderrSink})
+	}
+	runner.stdoutStream, runner.stderrStream = stdout, stderr
+	rw.Reader = io.MultiReader(stdout, stderr)
+	register(runner)
+	go func() {
+		var err error
+		if tracer != nil {
+			err = tracer.wait(cmd)
+		} else {
+			err = cmd.Wait()
+		}
+		runner.mu.Lock()
+		if runner.killedBy != nil {
+			err = runner.killedBy
+		}
+		runner.mu.Unlock()
+		runner.err = err
+		runner.exitedAt = time.Now()
+		if runner.ciLog != nil {
+			runner.ciLog.exited(err)
+		}
+		unlock()
+		close(runner.done)
+		unregister(runner)
+	}()
+
+	if p.ops.hasLimits() {
+		go runner.monitorLimits(p.ops)
+	}
+	if p.ops.Timeout > 0 {
+		go runner.enforceTimeout(p.ops)
+	}
+	if p.ops.CrashReport {
+		go runner.sampleStatus()
+	}
+
+	if notice := p.ops.DeadlineNotice; notice != nil {
+		if deadline, ok := ctx.Deadline(); ok {
+			go runner.notifyDeadline(time.Until(deadline)-notice.Before, notice)
+		}
+	}
+
+	if hb := p.ops.Heartbeat; hb != nil && hb.Interval > 0 && l.stdin == nil {
+		go runner.heartbeat(hb)
+	}
+
+	// Once the context is done the process is killed, but its descendants may
+	// still hold the pipes open. Close them so readers and writers never block
+	// A process sent CancelSignal keeps its pipes while it shuts down
 	go func() {
-		doneCh <- cmd.Wait()
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			if p.ops.CancelSignal != nil && !runner.awaitShutdown() {
+				return
+			}
+			rw.Close()
+		case <-runner.done:
+		}
 	}()
-	return &ProcessRunner{
-		cmd:          cmd,
-		doneCh:       doneCh,
-		readerWriter: rw,
-	}, nil
+
+	return runner, nil
 }
 
+// notifyDeadline sends notice to the process after delay, unless it exited before
+func (p *ProcessRunner) notifyDeadline(delay time.Duration, notice *DeadlineNotice) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return
+	case <-timer.C:
+	}
+
+	if notice.Signal != nil {
+		p.cmd.Process.Signal(notice.Signal)
+	}
+	if notice.Line != "" {
+		io.WriteString(p.readerWriter, notice.Line+"\n")
+	}
+}
+
+// heartbeat writes hb.Data to stdin every hb.Interval until the process exits
+// or a write fails because stdin was closed
+func (p *ProcessRunner) heartbeat(hb *Heartbeat) {
+	data := hb.Data
+	if len(data) == 0 {
+		data = []byte("\n")
+	}
+
+	ticker := time.NewTicker(hb.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			if _, err := p.readerWriter.Write(data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// processStream implements Stream on top of the process pipes
+type processStream struct {
+	io.Reader
+	stdin  io.WriteCloser
+	runner *ProcessRunner
+}
+
+func (s *processStream) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+func (s *processStream) CloseWrite() error {
+	return s.stdin.Close()
+}
+
+// Close tears down the whole stream: stdin is closed and pending and
+// future reads return EOF
+func (s *processStream) Close() error {
+	err := s.stdin.Close()
+	s.runner.closeOutput()
+	return err
+}
+
+// redirectedStdin is the stdin of a stream whose process reads Options.Stdin
+type redirectedStdin struct{}
+
+func (redirectedStdin) Write(p []byte) (int, error) {
+	return 0, errors.New("subprocess: stdin is redirected with WithStdin")
+}
+
+func (redirectedStdin) Close() error {
+	return nil
+}
+
+// sink ignores the errors of w, so a failing sink never stops the output
+type sink struct{ w io.Writer }
+
+func (s sink) Write(p []byte) (int, error) {
+	s.w.Write(p)
+	return len(p), nil
+}
+
+// pipeReader closes the read end of a pipe once it reaches EOF
+type pipeReader struct {
+	*os.File
+}
+
+func (r pipeReader) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	if err == io.EOF {
+		r.File.Close()
+	} else if errors.Is(err, os.ErrClosed) {
+		return n, io.EOF
+	}
+	return n, err
+}
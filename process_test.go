@@ -1,6 +1,7 @@
 package subprocess
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"strings"
@@ -54,6 +55,80 @@ func TestNewProcess(t *testing.T) {
 	}
 }
 
+// TestProcessOptions verifies the functional options are applied when executing
+func TestProcessOptions(t *testing.T) {
+	t.Setenv("INHERITED", "inherited")
+	tests := []struct {
+		name string
+		cmd  string
+		args []string
+		opts []Option
+		want string
+	}{
+		{
+			name: "working directory",
+			cmd:  "pwd",
+			opts: []Option{WithDir("/")},
+			want: "/\n",
+		},
+		{
+			name: "environment",
+			cmd:  "sh",
+			args: []string{"-c", "echo $A-$B"},
+			opts: []Option{WithEnv("A=1", "B=2")},
+			want: "1-2\n",
+		},
+		{
+			name: "environment map",
+			cmd:  "sh",
+			args: []string{"-c", "echo $A-${INHERITED:-unset}"},
+			opts: []Option{WithEnvMap(map[string]string{"A": "1"})},
+			want: "1-unset\n",
+		},
+		{
+			name: "inherited environment with overrides",
+			cmd:  "sh",
+			args: []string{"-c", "echo $A-$B-$INHERITED"},
+			opts: []Option{WithEnvOverrides(map[string]string{"A": "1"}), WithEnvOverrides(map[string]string{"B": "2"})},
+			want: "1-2-inherited\n",
+		},
+		{
+			name: "environment with overrides",
+			cmd:  "sh",
+			args: []string{"-c", "echo $A-$B"},
+			opts: []Option{WithEnv("A=1", "B=2"), WithEnvOverrides(map[string]string{"B": "3"})},
+			want: "1-3\n",
+		},
+		{
+			name: "stdin",
+			cmd:  "tr",
+			args: []string{"a-z", "A-Z"},
+			opts: []Option{WithStdin(strings.NewReader("hello\n"))},
+			want: "HELLO\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProcess(tt.cmd, tt.args, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewProcess() error = %v", err)
+			}
+			runner, err := p.Exec(context.Background())
+			if err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+			output, _ := io.ReadAll(runner.ReaderWriter())
+			if err := runner.Wait(); err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
 // TestProcessExec_Success verifies successful process execution
 func TestProcessExec_Success(t *testing.T) {
 	ctx := context.Background()
@@ -133,7 +208,7 @@ func TestProcessRunner_ReaderWriter(t *testing.T) {
 	}
 
 	// Close stdin to signal EOF
-	rw.Close()
+	rw.CloseWrite()
 
 	// Read from stdout
 	output, err := io.ReadAll(rw)
@@ -151,6 +226,77 @@ func TestProcessRunner_ReaderWriter(t *testing.T) {
 	}
 }
 
+// TestProcessRunner_HalfClose verifies output can be read after closing stdin
+func TestProcessRunner_HalfClose(t *testing.T) {
+	ctx := context.Background()
+	// 'sort' only writes once it has seen EOF on stdin
+	p, err := NewProcess("sort", []string{})
+	if err != nil {
+		t.Fatalf("NewProcess() error = %v", err)
+	}
+
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	rw := runner.ReaderWriter()
+	io.WriteString(rw, "b\nc\na\n")
+	if err := rw.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite() error = %v", err)
+	}
+
+	// Writing after CloseWrite fails, reading still works
+	if _, err := io.WriteString(rw, "d\n"); err == nil {
+		t.Error("expected write after CloseWrite to fail")
+	}
+
+	output, err := io.ReadAll(rw)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(output) != "a\nb\nc\n" {
+		t.Errorf("output = %q, want %q", string(output), "a\nb\nc\n")
+	}
+
+	if err := runner.Wait(); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+}
+
+// TestProcessRunner_Close verifies Close tears down both directions
+func TestProcessRunner_Close(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewProcess("cat", []string{})
+	if err != nil {
+		t.Fatalf("NewProcess() error = %v", err)
+	}
+
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	rw := runner.ReaderWriter()
+	if err := rw.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Reads return EOF right away instead of waiting for output
+	output, err := io.ReadAll(rw)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if len(output) != 0 {
+		t.Errorf("expected no output after Close, got %q", output)
+	}
+
+	// cat sees EOF on stdin and exits
+	if err := runner.Wait(); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+}
+
 // TestProcessRunner_Stop verifies process termination
 func TestProcessRunner_Stop(t *testing.T) {
 	ctx := context.Background()
@@ -321,8 +467,8 @@ func TestProcessExec_MultipleWrites(t *testing.T) {
 		}
 	}
 
-	// Close to signal EOF
-	rw.Close()
+	// Close stdin to signal EOF
+	rw.CloseWrite()
 
 	// Get output
 	output := <-outputCh
@@ -386,3 +532,108 @@ func TestProcessExec_EmptyArgs(t *testing.T) {
 
 	runner.Wait()
 }
+
+func TestProcessExec_Transcript(t *testing.T) {
+	var transcript strings.Builder
+	p, _ := NewProcess("sh", []string{"-c", "read line; echo \"got $line\"; echo oops >&2"},
+		WithTranscript(&transcript))
+	runner, err := p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	io.WriteString(runner.ReaderWriter(), "hello\n")
+	runner.ReaderWriter().CloseWrite()
+	io.ReadAll(runner.ReaderWriter())
+	if err := runner.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	log := transcript.String()
+	stdin := strings.Index(log, `stdin  "hello\n"`)
+	stdout := strings.Index(log, `stdout "got hello\n"`)
+	if stdin < 0 || stdout < 0 || stdin > stdout {
+		t.Errorf("expected stdin then stdout entries, got:\n%s", log)
+	}
+	if !strings.Contains(log, `stderr "oops\n"`) {
+		t.Errorf("expected stderr entry, got:\n%s", log)
+	}
+}
+
+func TestProcessExec_Delay(t *testing.T) {
+	p, _ := NewProcess("true", nil, WithDelay(200*time.Millisecond))
+
+	start := time.Now()
+	runner, err := p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	runner.Wait()
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("process started after %v, want at least 200ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Exec(ctx); err == nil {
+		t.Error("Exec() expected error when the context ends during the delay")
+	}
+}
+
+// TestProcessRunner_SeparateStreams verifies stdout and stderr can be read apart
+func TestProcessRunner_SeparateStreams(t *testing.T) {
+	p, _ := NewProcess("sh", []string{"-c", "echo out; echo err >&2"})
+	runner, err := p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	errCh := make(chan []byte, 1)
+	go func() {
+		stderr, _ := io.ReadAll(runner.Stderr())
+		errCh <- stderr
+	}()
+	stdout, _ := io.ReadAll(runner.Stdout())
+	stderr := <-errCh
+	runner.Wait()
+	if string(stdout) != "out\n" || string(stderr) != "err\n" {
+		t.Errorf("Stdout() = %q, Stderr() = %q", stdout, stderr)
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		stdout string
+		stderr string
+	}{
+		{"separate", nil, "out\n", "err\n"},
+		{"combined", []Option{WithCombinedOutput()}, "out\nerr\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := Command("sh", []string{"-c", "echo out; echo err >&2"}, tt.opts...)
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if string(result.Stdout) != tt.stdout || string(result.Stderr) != tt.stderr {
+				t.Errorf("Stdout = %q, Stderr = %q", result.Stdout, result.Stderr)
+			}
+		})
+	}
+}
+
+// TestProcessExec_Sinks verifies output is copied to sinks and still captured
+func TestProcessExec_Sinks(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	exec, _ := Command("sh", []string{"-c", "echo out; echo err >&2"}, WithStdout(&stdout), WithStderr(&stderr))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("sinks got %q and %q", stdout.String(), stderr.String())
+	}
+	if string(result.Stdout) != "out\n" || string(result.Stderr) != "err\n" {
+		t.Errorf("result got %q and %q", result.Stdout, result.Stderr)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build unix
+
+package subprocess
+
+import (
+	"context"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestProcessExec_DeadlineNotice verifies the process is notified before its deadline
+func TestProcessExec_DeadlineNotice(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		notice DeadlineNotice
+	}{
+		{
+			name:   "signal",
+			args:   []string{"-c", "trap 'echo checkpoint; exit 0' USR1; while :; do sleep 0.05; done"},
+			notice: DeadlineNotice{Before: 2 * time.Second, Signal: syscall.SIGUSR1},
+		},
+		{
+			name:   "stdin line",
+			args:   []string{"-c", "read line; echo $line"},
+			notice: DeadlineNotice{Before: 2 * time.Second, Line: "checkpoint"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+			defer cancel()
+
+			p, _ := NewProcess("sh", tt.args, WithDeadlineNotice(tt.notice))
+			runner, err := p.Exec(ctx)
+			if err != nil {
+				t.Fatalf("Exec() error = %v", err)
+			}
+
+			output, _ := io.ReadAll(runner.ReaderWriter())
+			if err := runner.Wait(); err != nil {
+				t.Fatalf("Wait() error = %v, process was not notified in time", err)
+			}
+			if string(output) != "checkpoint\n" {
+				t.Errorf("output = %q, want %q", output, "checkpoint\n")
+			}
+		})
+	}
+}
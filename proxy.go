@@ -0,0 +1,37 @@
+package subprocess
+
+// Proxy holds the proxy and CA bundle settings injected into the environment
+// of a process, so they don't have to be repeated on every command
+type Proxy struct {
+	HTTP     string // HTTP_PROXY and http_proxy
+	HTTPS    string // HTTPS_PROXY and https_proxy
+	NoProxy  string // NO_PROXY and no_proxy
+	CABundle string // path of a CA bundle, set for the common tools that read one
+}
+
+// env returns the environment variables for p, empty fields are left out
+func (p *Proxy) env() []string {
+	var env []string
+	add := func(value string, names ...string) {
+		if value == "" {
+			return
+		}
+		for _, name := range names {
+			env = append(env, name+"="+value)
+		}
+	}
+	add(p.HTTP, "HTTP_PROXY", "http_proxy")
+	add(p.HTTPS, "HTTPS_PROXY", "https_proxy")
+	add(p.NoProxy, "NO_PROXY", "no_proxy")
+	add(p.CABundle, "SSL_CERT_FILE", "REQUESTS_CA_BUNDLE", "CURL_CA_BUNDLE", "NODE_EXTRA_CA_CERTS", "GIT_SSL_CAINFO")
+	return env
+}
+
+// WithProxy injects the proxy and CA bundle settings of proxy into the
+// environment of the process, on top of its configured or inherited environment
+// Defaults.Proxy applies the same settings to every new process
+func WithProxy(proxy Proxy) Option {
+	return func(o *Options) {
+		o.Proxy = &proxy
+	}
+}
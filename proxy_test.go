@@ -0,0 +1,50 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithProxy(t *testing.T) {
+	// Test: proxy variables are added on top of the environment
+	ctx := context.Background()
+	proxy := Proxy{
+		HTTPS:    "http://proxy:3128",
+		NoProxy:  "localhost",
+		CABundle: "/etc/ssl/corp.pem",
+	}
+
+	env, _ := Command("sh", []string{"-c", "echo $https_proxy $NO_PROXY $SSL_CERT_FILE $KEEP ${HTTP_PROXY:-unset}"},
+		WithEnv("KEEP=kept", "NO_PROXY=old"), WithProxy(proxy))
+	result, err := env.Run(ctx)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	expected := "http://proxy:3128 localhost /etc/ssl/corp.pem kept unset\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("expected %q, got %q", expected, result.Stdout)
+	}
+}
+
+func TestDefaultsProxy(t *testing.T) {
+	// Test: the inherited environment is kept when only a proxy is set
+	saved := Defaults
+	defer func() { Defaults = saved }()
+	Defaults.Proxy = &Proxy{HTTP: "http://proxy:8080"}
+
+	env, _ := NewExecutable("sh", "-c", "echo $HTTP_PROXY; echo $PATH")
+	result, err := env.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Stdout)), "\n")
+	if lines[0] != "http://proxy:8080" {
+		t.Errorf("expected proxy, got %q", lines[0])
+	}
+	if len(lines) < 2 || lines[1] == "" {
+		t.Error("expected PATH to be inherited")
+	}
+}
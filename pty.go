@@ -0,0 +1,109 @@
+package subprocess
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// WithPTY runs the process in a new pseudo-terminal, for programs that behave
+// differently without one, like ssh, sudo and REPLs. The terminal carries
+// stdin, stdout and stderr: the output of both is read from stdout and input
+// is echoed like on a real terminal. Closing stdin sends the end-of-file
+// character. The terminal starts with the size of the terminal of the
+// program, or 80x24, use ProcessRunner.Resize to change it
+// Only supported on Linux
+func WithPTY() Option {
+	return func(o *Options) {
+		o.PTY = true
+	}
+}
+
+// PTY returns the master side of the pseudo-terminal of a process started
+// with WithPTY, or nil. Reads return the terminal output, writes are typed input
+func (p *ProcessRunner) PTY() io.ReadWriteCloser {
+	if p.pty == nil {
+		return nil
+	}
+	return ptyReader{p.pty, p.cast}
+}
+
+// Resize changes the window size of the pseudo-terminal, the process gets
+// SIGWINCH. Forward the SIGWINCH of the program to keep both in sync
+func (p *ProcessRunner) Resize(rows, cols uint16) error {
+	if p.pty == nil {
+		return errors.New("subprocess: process has no PTY, start it WithPTY")
+	}
+	if err := setWindowSize(p.pty, rows, cols); err != nil {
+		return err
+	}
+	if p.cast != nil {
+		p.cast.resize(rows, cols)
+	}
+	return nil
+}
+
+// ptyReader reads the output of a pseudo-terminal. Once the process and its
+// children closed the terminal, reads fail with EIO, which ends the output
+// The file is not embedded, so io.Copy cannot bypass Read and Write through
+// the ReadFrom and WriteTo methods of os.File
+type ptyReader struct {
+	file *os.File
+	cast *castRecorder // records the output and input, or nil
+}
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	if r.cast != nil && n > 0 {
+		r.cast.record("o", p[:n])
+	}
+	if errors.Is(err, syscall.EIO) {
+		err = io.EOF
+	}
+	if err == io.EOF {
+		if r.cast != nil {
+			r.cast.flush()
+		}
+		r.file.Close()
+	} else if errors.Is(err, os.ErrClosed) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+func (r ptyReader) Close() error {
+	return r.file.Close()
+}
+
+func (r ptyReader) Write(p []byte) (int, error) {
+	n, err := r.file.Write(p)
+	if r.cast != nil && n > 0 {
+		r.cast.record("i", p[:n])
+	}
+	return n, err
+}
+
+// ptyInput writes the input of a pseudo-terminal. A terminal cannot be half
+// closed, so Close sends the end-of-file character instead
+type ptyInput struct {
+	master *os.File
+	cast   *castRecorder // records the input, or nil
+	once   sync.Once
+}
+
+func (w *ptyInput) Write(p []byte) (int, error) {
+	return ptyReader{w.master, w.cast}.Write(p)
+}
+
+func (w *ptyInput) Close() error {
+	var err error
+	w.once.Do(func() {
+		_, err = w.Write([]byte{0x04})
+		if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EIO) {
+			err = nil
+		}
+	})
+	return err
+}
@@ -0,0 +1,99 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY allocates a pseudo-terminal and returns its master and slave sides
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	var index uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&index)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", index), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	rows, cols := uint16(24), uint16(80)
+	var size winsize
+	if ioctl(os.Stdin, syscall.TIOCGWINSZ, unsafe.Pointer(&size)) == nil && size.rows > 0 {
+		rows, cols = size.rows, size.cols
+	}
+	if err := setWindowSize(master, rows, cols); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// attachPTY makes slave the stdio and controlling terminal of cmd, in a new session
+func attachPTY(cmd *exec.Cmd, slave *os.File) {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
+
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// windowSize returns the window size of the terminal f
+func windowSize(f *os.File) (rows, cols uint16, err error) {
+	var size winsize
+	if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return 0, 0, err
+	}
+	return size.rows, size.cols, nil
+}
+
+// notifyResize relays SIGWINCH, sent when the terminal of the program is resized, to c
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+// setWindowSize sets the window size of the terminal f
+func setWindowSize(f *os.File, rows, cols uint16) error {
+	size := winsize{rows: rows, cols: cols}
+	return ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&size))
+}
+
+// ioctl runs request on f through its raw connection, unlike f.Fd() this
+// keeps f non-blocking so read deadlines still interrupt pending reads
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return &os.SyscallError{Syscall: "ioctl", Err: errno}
+	}
+	return nil
+}
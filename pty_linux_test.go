@@ -0,0 +1,139 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithPTY(t *testing.T) {
+	// Test: the process runs on a terminal and its output is captured
+	testPTY(t)
+	exec, _ := Command("sh", []string{"-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; echo err >&2"}, WithPTY())
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "tty\r\nerr\r\n" {
+		t.Errorf("unexpected output %q", result.Stdout)
+	}
+}
+
+func TestPTYResize(t *testing.T) {
+	// Test: input reaches the process and resizing sends SIGWINCH
+	testPTY(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	script := `trap 'stty size; exit' WINCH; stty -echo; echo ready; read name; echo "hi $name"; while :; do sleep 0.05; done`
+	p, _ := NewProcess("sh", []string{"-c", script}, WithPTY())
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	defer runner.Stop()
+
+	lines := bufio.NewReader(runner.PTY())
+	if line, _ := lines.ReadString('\n'); strings.TrimSpace(line) != "ready" {
+		t.Fatalf("unexpected output %q", line)
+	}
+	io.WriteString(runner.PTY(), "pty\n")
+	if line, _ := lines.ReadString('\n'); strings.TrimSpace(line) != "hi pty" {
+		t.Fatalf("unexpected greeting %q", line)
+	}
+	if err := runner.Resize(30, 100); err != nil {
+		t.Fatalf("resize failed: %v", err)
+	}
+	if line, _ := lines.ReadString('\n'); strings.TrimSpace(line) != "30 100" {
+		t.Errorf("unexpected size %q", line)
+	}
+	runner.Wait()
+
+	plain, _ := NewProcess("true", nil)
+	runner, _ = plain.Exec(ctx)
+	runner.Wait()
+	if runner.PTY() != nil || runner.Resize(1, 1) == nil {
+		t.Error("expected no PTY without WithPTY")
+	}
+}
+
+func TestPTYStreamDemux(t *testing.T) {
+	// Test: marked stderr lines are split from the terminal output
+	testPTY(t)
+	script := `echo out; echo "E> err" >&2; echo more`
+	exec, _ := Command("sh", []string{"-c", script}, WithPTY(), WithStreamDemux(StreamDemux{Markers: []string{"E> "}}))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "out\r\nmore\r\n" || string(result.Stderr) != "err\r\n" {
+		t.Errorf("unexpected split %q, %q", result.Stdout, result.Stderr)
+	}
+	if result.Metadata["demux"] != DemuxProtocol {
+		t.Errorf("expected protocol confidence, got %v", result.Metadata["demux"])
+	}
+}
+
+func TestPTYRecording(t *testing.T) {
+	// Test: the session is recorded as a cast with its size, input, output
+	// and resizes, and replays the terminal output
+	testPTY(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var cast lockedBuffer
+	script := `trap 'stty size; exit' WINCH; stty -echo; echo ready; read name; echo "hi $name"; while :; do sleep 0.05; done`
+	p, _ := NewProcess("sh", []string{"-c", script}, WithPTY(), WithRecording(&cast))
+	runner, err := p.Exec(ctx)
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	defer runner.Stop()
+
+	var out bytes.Buffer
+	lines := io.TeeReader(runner.PTY(), &out)
+	buf := make([]byte, 64)
+	for !strings.Contains(out.String(), "ready") {
+		lines.Read(buf)
+	}
+	io.WriteString(runner.PTY(), "pty\n")
+	for !strings.Contains(out.String(), "hi pty") {
+		lines.Read(buf)
+	}
+	runner.Resize(30, 100)
+	io.Copy(io.Discard, lines)
+	runner.Wait()
+
+	recorded, err := ReadCast(strings.NewReader(cast.String()))
+	if err != nil {
+		t.Fatalf("invalid cast %q: %v", cast.String(), err)
+	}
+	if !strings.HasPrefix(recorded.Title, "sh -c ") || recorded.Width == 0 || recorded.Height == 0 {
+		t.Errorf("unexpected header %+v", recorded)
+	}
+	var kinds, input string
+	for _, event := range recorded.Events {
+		kinds += event.Kind
+		if event.Kind == "i" {
+			input += event.Data
+		}
+	}
+	if input != "pty\n" || !strings.Contains(kinds, "r") || !strings.Contains(cast.String(), `"r", "100x30"`) {
+		t.Errorf("unexpected events %q in %q", kinds, cast.String())
+	}
+	var replayed bytes.Buffer
+	recorded.Replay(ctx, &replayed, 0)
+	if replayed.String() != out.String() || !strings.Contains(replayed.String(), "30 100") {
+		t.Errorf("expected the replay to match the output %q, got %q", out.String(), replayed.String())
+	}
+
+	// Test: recording without a terminal is rejected
+	plain, _ := NewProcess("true", nil, WithRecording(io.Discard))
+	if _, err := plain.Exec(ctx); err == nil || !strings.Contains(err.Error(), "requires WithPTY") {
+		t.Errorf("expected an error without WithPTY, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// openPTY allocates a pseudo-terminal and returns its master and slave sides
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("WithPTY is only supported on Linux")
+}
+
+// attachPTY makes slave the stdio and controlling terminal of cmd, in a new session
+func attachPTY(cmd *exec.Cmd, slave *os.File) {}
+
+// windowSize returns the window size of the terminal f
+func windowSize(f *os.File) (rows, cols uint16, err error) {
+	return 0, 0, errors.New("WithPTY is only supported on Linux")
+}
+
+// notifyResize does nothing, terminals are only resized on Linux
+func notifyResize(c chan<- os.Signal) {}
+
+// setWindowSize sets the window size of the terminal f
+func setWindowSize(f *os.File, rows, cols uint16) error {
+	return errors.New("WithPTY is only supported on Linux")
+}
@@ -0,0 +1,59 @@
+package subprocess
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// RawMode puts the terminal f in raw mode, for bridging interactive children,
+// and returns the function restoring its previous state. The state is also
+// restored when the program receives SIGINT, SIGTERM or SIGHUP, after which
+// the signal is sent again so the program terminates as it would have
+// Use WithRawMode to restore the terminal when a panic unwinds as well
+// Only supported on Linux
+func RawMode(f *os.File) (restore func() error, err error) {
+	saved, err := makeRaw(f)
+	if err != nil {
+		return nil, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	var once sync.Once
+	var restoreErr error
+	restore = func() error {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			restoreErr = restoreTerminal(f, saved)
+		})
+		return restoreErr
+	}
+
+	go func() {
+		select {
+		case sig := <-signals:
+			restore()
+			if self, err := os.FindProcess(os.Getpid()); err == nil {
+				self.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+	return restore, nil
+}
+
+// WithRawMode runs fn with the terminal f in raw mode and restores it when fn
+// returns, also when it panics or the program is interrupted
+func WithRawMode(f *os.File, fn func() error) error {
+	restore, err := RawMode(f)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return fn()
+}
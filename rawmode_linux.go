@@ -0,0 +1,45 @@
+package subprocess
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw switches the terminal f to raw mode like cfmakeraw(3) and returns
+// its previous state
+func makeRaw(f *os.File) (*syscall.Termios, error) {
+	var saved syscall.Termios
+	if err := termiosIoctl(f, syscall.TCGETS, &saved); err != nil {
+		return nil, err
+	}
+
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termiosIoctl(f, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// restoreTerminal sets the state of the terminal f back to saved
+func restoreTerminal(f *os.File, saved *syscall.Termios) error {
+	return termiosIoctl(f, syscall.TCSETS, saved)
+}
+
+func termiosIoctl(f *os.File, request uintptr, t *syscall.Termios) error {
+	return ioctl(f, request, unsafe.Pointer(t))
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	var state syscall.Termios
+	return termiosIoctl(f, syscall.TCGETS, &state) == nil
+}
@@ -0,0 +1,61 @@
+package subprocess
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+// testPTY returns the controlling side and the terminal side of a new pseudo terminal
+func testPTY(t *testing.T) (*os.File, *os.File) {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	t.Cleanup(func() {
+		ptmx.Close()
+		tty.Close()
+	})
+	return ptmx, tty
+}
+
+func TestRawMode(t *testing.T) {
+	// Test: raw mode disables line editing and restore brings it back, also after a panic
+	_, tty := testPTY(t)
+	lflag := func() uint32 {
+		var state syscall.Termios
+		if err := termiosIoctl(tty, syscall.TCGETS, &state); err != nil {
+			t.Fatal(err)
+		}
+		return state.Lflag
+	}
+
+	restore, err := RawMode(tty)
+	if err != nil {
+		t.Fatalf("RawMode failed: %v", err)
+	}
+	if lflag()&(syscall.ICANON|syscall.ECHO) != 0 {
+		t.Error("expected canonical mode and echo to be off")
+	}
+	if err := restore(); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if lflag()&syscall.ICANON == 0 {
+		t.Error("expected canonical mode to be restored")
+	}
+
+	func() {
+		defer func() { recover() }()
+		WithRawMode(tty, func() error { panic("boom") })
+	}()
+	if lflag()&syscall.ICANON == 0 {
+		t.Error("expected terminal to be restored after a panic")
+	}
+
+	r, w, _ := os.Pipe()
+	defer r.Close()
+	defer w.Close()
+	if _, err := RawMode(r); err == nil {
+		t.Error("expected error for a file that is not a terminal")
+	}
+}
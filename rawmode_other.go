@@ -0,0 +1,25 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+)
+
+// terminalState is the saved state of a terminal
+type terminalState struct{}
+
+func makeRaw(f *os.File) (*terminalState, error) {
+	return nil, errors.New("RawMode is only supported on Linux")
+}
+
+func restoreTerminal(f *os.File, saved *terminalState) error {
+	return nil
+}
+
+// isTerminal reports whether f is a terminal, always false where terminal
+// modes are unsupported
+func isTerminal(f *os.File) bool {
+	return false
+}
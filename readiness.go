@@ -0,0 +1,148 @@
+package subprocess
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+)
+
+// logPatterns are the compiled log patterns of a HealthCheck
+type logPatterns struct {
+	ready []*regexp.Regexp // LogPattern and LogPatterns, matched in order
+	fail  []*regexp.Regexp // FailPatterns
+}
+
+// compileLogPatterns compiles the log patterns of h
+func compileLogPatterns(h HealthCheck) (logPatterns, error) {
+	var p logPatterns
+	if h.MaxLine < 0 {
+		return p, fmt.Errorf("invalid maximum line length %d", h.MaxLine)
+	}
+	ready := h.LogPatterns
+	if h.LogPattern != "" {
+		ready = append([]string{h.LogPattern}, ready...)
+	}
+	for _, expr := range ready {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return p, fmt.Errorf("invalid log pattern: %w", err)
+		}
+		p.ready = append(p.ready, re)
+	}
+	for _, expr := range h.FailPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return p, fmt.Errorf("invalid fail pattern: %w", err)
+		}
+		p.fail = append(p.fail, re)
+	}
+	return p, nil
+}
+
+// watch returns a logWatch following one run, or nil without patterns
+// onReady receives the named groups of the ready patterns once they matched
+func (p logPatterns) watch(onReady func(info map[string]string)) *logWatch {
+	if len(p.ready) == 0 && len(p.fail) == 0 {
+		return nil
+	}
+	w := &logWatch{
+		patterns: p,
+		onReady:  onReady,
+		info:     make(map[string]string),
+		ready:    make(chan struct{}),
+		failed:   make(chan struct{}),
+	}
+	if len(p.ready) == 0 {
+		close(w.ready)
+	}
+	return w
+}
+
+// logWatch follows the output lines of one run of a service: the ready
+// patterns must match one after the other, while a fail pattern ends the
+// start right away. Lines after the service got ready are ignored
+type logWatch struct {
+	patterns logPatterns
+	onReady  func(info map[string]string)
+	ready    chan struct{} // closed once every ready pattern matched
+	failed   chan struct{} // closed when a fail pattern matched first
+
+	mu      sync.Mutex
+	next    int               // index of the ready pattern waited for
+	done    bool              // ready or failed
+	info    map[string]string // named groups of the matched ready patterns
+	failure string            // line that matched a fail pattern
+	skipped int               // lines too long to match
+}
+
+// line checks one output line against the patterns
+func (w *logWatch) line(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return
+	}
+
+	for _, re := range w.patterns.fail {
+		if re.Match(line) {
+			w.done = true
+			w.failure = string(line)
+			close(w.failed)
+			return
+		}
+	}
+	if w.next == len(w.patterns.ready) {
+		return
+	}
+	re := w.patterns.ready[w.next]
+	groups := re.FindSubmatch(line)
+	if groups == nil {
+		return
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			w.info[name] = string(groups[i])
+		}
+	}
+	w.next++
+	if w.next == len(w.patterns.ready) {
+		w.onReady(maps.Clone(w.info))
+		close(w.ready)
+	}
+}
+
+// skip counts a line too long to be checked against the patterns
+func (w *logWatch) skip() {
+	w.mu.Lock()
+	w.skipped++
+	w.mu.Unlock()
+}
+
+// finish stops checking fail patterns once the service is ready
+func (w *logWatch) finish() {
+	w.mu.Lock()
+	w.done = true
+	w.mu.Unlock()
+}
+
+// err returns why the service failed to start, valid once failed is closed
+func (w *logWatch) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return fmt.Errorf("failed to start: %s", w.failure)
+}
+
+// progress describes the ready pattern waited for, for timeouts
+func (w *logWatch) progress() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.next == len(w.patterns.ready) {
+		return ""
+	}
+	progress := fmt.Sprintf(", waiting for log pattern %q", w.patterns.ready[w.next])
+	if w.skipped > 0 {
+		progress += fmt.Sprintf(", skipped %d lines longer than MaxLine", w.skipped)
+	}
+	return progress
+}
@@ -0,0 +1,92 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// RedirectOp is a shell output redirection
+type RedirectOp int
+
+const (
+	RedirectOut    RedirectOp = iota // > file
+	RedirectAppend                   // >> file
+	RedirectErr                      // 2> file
+	RedirectErrOut                   // 2>&1
+)
+
+// String returns the shell operator of the redirection
+func (r RedirectOp) String() string {
+	switch r {
+	case RedirectOut:
+		return ">"
+	case RedirectAppend:
+		return ">>"
+	case RedirectErr:
+		return "2>"
+	case RedirectErrOut:
+		return "2>&1"
+	default:
+		return "unknown"
+	}
+}
+
+// newRedirect returns a node running exec with its output redirected
+func newRedirect(exec Executable, s settings, op RedirectOp, path string) Executable {
+	p := newPipeline(OpRedirect, exec, nil, s)
+	p.redirect, p.path = op, path
+	return p
+}
+
+// VisitRedirect runs exec and writes its stdout or stderr to path, or moves
+// its stderr to its stdout for RedirectErrOut
+// Like in a shell, the file is created before exec runs, and exec does not
+// run if the file cannot be opened
+func (v *ExecutionVisitor) VisitRedirect(exec Executable, op RedirectOp, path string) (*Result, error) {
+	var file *os.File
+	if op != RedirectErrOut {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if op == RedirectAppend {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(path, flags, 0o666)
+		if err != nil {
+			return &Result{Type: OpRedirect, Error: err, ExitCode: 1}, err
+		}
+		file = f
+	}
+
+	inner, _ := exec.Run(v.ctx)
+	result := &Result{
+		Type:     OpRedirect,
+		Stdout:   inner.Stdout,
+		Stderr:   inner.Stderr,
+		ExitCode: inner.ExitCode,
+		Error:    inner.Error,
+		Children: []*Result{inner},
+	}
+
+	var err error
+	switch op {
+	case RedirectOut, RedirectAppend:
+		_, err = file.Write(result.Stdout)
+		result.Stdout = nil
+	case RedirectErr:
+		_, err = file.Write(result.Stderr)
+		result.Stderr = nil
+	case RedirectErrOut:
+		result.Stdout = append(slices.Clip(result.Stdout), result.Stderr...)
+		result.Stderr = nil
+	}
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil && result.Error == nil {
+		result.Error = fmt.Errorf("redirect %s %s: %w", op, path, err)
+		result.ExitCode = 1
+	}
+	return result, result.Error
+}
@@ -0,0 +1,117 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.log")
+	both, _ := NewExecutable("sh", "-c", "echo out; echo err >&2")
+	echo, _ := NewExecutable("echo", "out")
+	upper, _ := NewExecutable("tr", "a-z", "A-Z")
+
+	tests := []struct {
+		name       string
+		exec       Executable
+		existing   string
+		wantString string
+		wantStdout string
+		wantStderr string
+		wantFile   string
+	}{
+		{
+			// Test: > truncates the file and leaves stdout empty
+			name:       "stdout",
+			exec:       both.RedirectStdout(out),
+			existing:   "old\n",
+			wantString: "sh -c 'echo out; echo err >&2' > " + out,
+			wantStderr: "err\n",
+			wantFile:   "out\n",
+		},
+		{
+			// Test: >> appends to the file
+			name:       "append",
+			exec:       both.AppendStdout(out),
+			existing:   "old\n",
+			wantString: "sh -c 'echo out; echo err >&2' >> " + out,
+			wantStderr: "err\n",
+			wantFile:   "old\nout\n",
+		},
+		{
+			// Test: 2> writes stderr to the file
+			name:       "stderr",
+			exec:       both.RedirectStderr(out),
+			wantString: "sh -c 'echo out; echo err >&2' 2> " + out,
+			wantStdout: "out\n",
+			wantFile:   "err\n",
+		},
+		{
+			// Test: 2>&1 captures stderr after stdout
+			name:       "stderr to stdout",
+			exec:       both.RedirectStderrToStdout(),
+			wantString: "sh -c 'echo out; echo err >&2' 2>&1",
+			wantStdout: "out\nerr\n",
+		},
+		{
+			// Test: nested redirections apply one after the other
+			name:       "stderr to stdout then file",
+			exec:       both.RedirectStderrToStdout().RedirectStdout(out),
+			wantString: "(sh -c 'echo out; echo err >&2' 2>&1) > " + out,
+			wantFile:   "out\nerr\n",
+		},
+		{
+			// Test: a redirected pipe is grouped
+			name:       "pipe",
+			exec:       echo.Pipe(upper).RedirectStdout(out),
+			wantString: "(echo out | tr a-z A-Z) > " + out,
+			wantFile:   "OUT\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(out)
+			if tt.existing != "" {
+				os.WriteFile(out, []byte(tt.existing), 0o644)
+			}
+			if got := tt.exec.(*Pipeline).String(); got != tt.wantString {
+				t.Errorf("expected %q, got %q", tt.wantString, got)
+			}
+
+			result, err := tt.exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if result.Type != OpRedirect || len(result.Children) != 1 {
+				t.Errorf("expected a redirect node with one child, got %v with %d", result.Type, len(result.Children))
+			}
+			if string(result.Stdout) != tt.wantStdout || string(result.Stderr) != tt.wantStderr {
+				t.Errorf("expected stdout %q and stderr %q, got %q and %q",
+					tt.wantStdout, tt.wantStderr, result.Stdout, result.Stderr)
+			}
+			if tt.wantFile != "" {
+				data, _ := os.ReadFile(out)
+				if string(data) != tt.wantFile {
+					t.Errorf("expected file %q, got %q", tt.wantFile, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectOpenFailure(t *testing.T) {
+	// Test: the command does not run when the file cannot be opened
+	marker := filepath.Join(t.TempDir(), "ran")
+	touch, _ := NewExecutable("touch", marker)
+	result, err := touch.RedirectStdout(filepath.Join(t.TempDir(), "missing", "out.log")).Run(context.Background())
+	if err == nil || result.ExitCode != 1 {
+		t.Fatalf("expected exit code 1 and an error, got %d and %v", result.ExitCode, err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected the command not to run")
+	}
+}
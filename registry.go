@@ -0,0 +1,86 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// registry tracks every running process started by this package
+var registry = struct {
+	sync.Mutex
+	runners map[*ProcessRunner]struct{}
+}{runners: make(map[*ProcessRunner]struct{})}
+
+func register(runner *ProcessRunner) {
+	registry.Lock()
+	registry.runners[runner] = struct{}{}
+	registry.Unlock()
+}
+
+func unregister(runner *ProcessRunner) {
+	registry.Lock()
+	delete(registry.runners, runner)
+	registry.Unlock()
+}
+
+// ShutdownAll stops every process started by this package that is still
+// running, including background jobs, and waits for them to exit
+// Each process gets SIGTERM, then SIGKILL once the shutdown timeout of its
+// Executable expires or ctx is done. Hook it into the SIGTERM handling of a
+// service to drain children with one call. New processes can still be started
+func ShutdownAll(ctx context.Context) error {
+	registry.Lock()
+	runners := make([]*ProcessRunner, 0, len(registry.runners))
+	for runner := range registry.runners {
+		runners = append(runners, runner)
+	}
+	registry.Unlock()
+
+	errs := make([]error, len(runners))
+	var wg sync.WaitGroup
+	for i, runner := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = runner.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Shutdown stops the process gracefully: it sends SIGTERM, waits for the
+// process to exit, then kills it once the shutdown timeout expires or ctx is
+// done. The timeout is the one of the Executable that started the process, or
+// Defaults.ShutdownTimeout for Process.Exec. An error is returned if the
+// process has still not exited when ctx is done
+func (p *ProcessRunner) Shutdown(ctx context.Context) error {
+	if p.exited() {
+		return nil
+	}
+	if err := p.signal(syscall.SIGTERM); err != nil {
+		// SIGTERM is not supported on every platform
+		p.Stop()
+	}
+
+	timer := time.NewTimer(p.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	p.Stop()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s did not exit: %w", p.cmd, ctx.Err())
+	}
+}
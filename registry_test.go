@@ -0,0 +1,114 @@
+package subprocess
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestShutdownAll(t *testing.T) {
+	// Test: running processes and background jobs are drained
+	p, _ := NewProcess("sleep", []string{"10"})
+	runner, err := p.Exec(context.Background())
+	if err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+
+	sleep, _ := NewExecutable("sleep", "10")
+	done := make(chan *Result, 1)
+	go func() {
+		result, _ := sleep.Background().Run(context.Background())
+		done <- result
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := ShutdownAll(context.Background()); err != nil {
+		t.Fatalf("ShutdownAll failed: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("processes did not stop on SIGTERM")
+	}
+	if runner.Wait() == nil {
+		t.Error("expected the process to be terminated")
+	}
+
+	select {
+	case result := <-done:
+		if len(result.BackgroundErrors) != 1 {
+			t.Errorf("expected background job to be terminated, got %v", result.BackgroundErrors)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("background job was not stopped")
+	}
+}
+
+func TestShutdownAllKillsAfterTimeout(t *testing.T) {
+	// Test: processes ignoring SIGTERM are killed after their shutdown timeout
+	stubborn, _ := NewExecutable("sh", "-c", "trap '' TERM; echo ready; exec sleep 10")
+	stubborn = stubborn.WithShutdownTimeout(200 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := stubborn.Run(context.Background())
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := ShutdownAll(context.Background()); err != nil {
+		t.Fatalf("ShutdownAll failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("expected kill after the shutdown timeout, took %v", elapsed)
+	}
+	if err := <-done; err == nil {
+		t.Error("expected the process to be killed")
+	}
+}
+
+func TestProcessRunnerShutdown(t *testing.T) {
+	// Test: SIGTERM lets the process clean up, SIGKILL follows the timeout or ctx
+	tests := []struct {
+		name       string
+		script     string
+		timeout    time.Duration
+		ctxTimeout time.Duration
+		output     string
+		minElapsed time.Duration
+	}{
+		{"cleans up", "trap 'echo cleaned; exit 0' TERM; echo ready; while :; do sleep 0.01; done", 5 * time.Second, 5 * time.Second, "ready\ncleaned\n", 0},
+		{"killed after timeout", "trap '' TERM; echo ready; while :; do sleep 0.01; done", 200 * time.Millisecond, 5 * time.Second, "ready\n", 200 * time.Millisecond},
+		{"killed when ctx is done", "trap '' TERM; echo ready; while :; do sleep 0.01; done", 5 * time.Second, 200 * time.Millisecond, "ready\n", 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := NewProcess("sh", []string{"-c", tt.script})
+			runner, err := p.exec(context.Background(), tt.timeout)
+			if err != nil {
+				t.Fatalf("exec failed: %v", err)
+			}
+			output := make(chan []byte, 1)
+			go func() {
+				data, _ := io.ReadAll(runner.Stdout())
+				output <- data
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.ctxTimeout)
+			defer cancel()
+			start := time.Now()
+			runner.Shutdown(ctx)
+			elapsed := time.Since(start)
+
+			if elapsed < tt.minElapsed || elapsed > 3*time.Second {
+				t.Errorf("unexpected shutdown time %v", elapsed)
+			}
+			if got := string(<-output); got != tt.output {
+				t.Errorf("expected output %q, got %q", tt.output, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package subprocess
+
+import (
+	"encoding/base64"
+	"os"
+	"runtime"
+	"time"
+	"unicode/utf8"
+)
+
+// ReportVersion is the version of the Report schema, increased on incompatible changes
+const ReportVersion = 1
+
+// Report is a stable, machine-readable description of an execution, meant to
+// be encoded as JSON and archived or compared by CI systems
+type Report struct {
+	Version  int         `json:"version"`
+	Pipeline string      `json:"pipeline"`
+	Host     ReportHost  `json:"host"`
+	Result   *ReportNode `json:"result"`
+}
+
+// ReportHost describes the machine that ran the execution
+type ReportHost struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	GoVersion string `json:"go_version"`
+}
+
+// ReportNode is one node of the result tree in a Report
+type ReportNode struct {
+	Type             string         `json:"type"`
+	Command          string         `json:"command,omitempty"`
+	ExitCode         int            `json:"exit_code"`
+	Error            string         `json:"error,omitempty"`
+	Skipped          bool           `json:"skipped,omitempty"`
+	SkipReason       string         `json:"skip_reason,omitempty"`
+	Cancelled        bool           `json:"cancelled,omitempty"`
+	Start            time.Time      `json:"start,omitzero"`
+	DurationSeconds  float64        `json:"duration_seconds"`
+	Stdout           string         `json:"stdout,omitempty"`
+	StdoutEncoding   string         `json:"stdout_encoding,omitempty"` // "base64" for output that is not UTF-8
+	Stderr           string         `json:"stderr,omitempty"`
+	StderrEncoding   string         `json:"stderr_encoding,omitempty"` // "base64" for output that is not UTF-8
+	Truncated        bool           `json:"truncated,omitempty"`
+	PeakMemory       int64          `json:"peak_memory,omitempty"`
+	OpenedFiles      []string       `json:"opened_files,omitempty"`
+	Crash            *ReportCrash   `json:"crash,omitempty"`
+	Env              *EnvSnapshot   `json:"env,omitempty"`
+	Metadata         map[string]any `json:"metadata,omitempty"`
+	BackgroundErrors []string       `json:"background_errors,omitempty"`
+	Diagnostics      []*ReportNode  `json:"diagnostics,omitempty"`
+	Children         []*ReportNode  `json:"children,omitempty"`
+}
+
+// ReportCrash is the CrashReport of a process in a Report
+type ReportCrash struct {
+	Signal             string `json:"signal"`
+	CorePattern        string `json:"core_pattern,omitempty"`
+	CoreFile           string `json:"core_file,omitempty"`
+	OutputTail         string `json:"output_tail,omitempty"`
+	OutputTailEncoding string `json:"output_tail_encoding,omitempty"` // "base64" for output that is not UTF-8
+	Status             string `json:"status,omitempty"`
+}
+
+// Report describes the result tree r in the versioned Report schema
+func (r *Result) Report() *Report {
+	hostname, _ := os.Hostname()
+	return &Report{
+		Version:  ReportVersion,
+		Pipeline: r.Command,
+		Host: ReportHost{
+			Hostname:  hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			GoVersion: runtime.Version(),
+		},
+		Result: r.reportNode(),
+	}
+}
+
+// reportNode converts r and its children to report nodes
+func (r *Result) reportNode() *ReportNode {
+	node := &ReportNode{
+		Type:            r.Type.String(),
+		Command:         r.Command,
+		ExitCode:        r.ExitCode,
+		Skipped:         r.Skipped,
+		SkipReason:      r.SkipReason,
+		Cancelled:       r.Cancelled,
+		Start:           r.Start,
+		DurationSeconds: r.Duration.Seconds(),
+		Truncated:       r.Truncated,
+		PeakMemory:      r.PeakMemory,
+		OpenedFiles:     r.OpenedFiles,
+		Env:             r.Env,
+		Metadata:        r.Metadata,
+	}
+	node.Stdout, node.StdoutEncoding = reportOutput(r.Stdout)
+	node.Stderr, node.StderrEncoding = reportOutput(r.Stderr)
+	if c := r.Crash; c != nil {
+		node.Crash = &ReportCrash{
+			Signal:      c.Signal.String(),
+			CorePattern: c.CorePattern,
+			CoreFile:    c.CoreFile,
+			Status:      c.Status,
+		}
+		node.Crash.OutputTail, node.Crash.OutputTailEncoding = reportOutput(c.OutputTail)
+	}
+	if r.Error != nil {
+		node.Error = r.Error.Error()
+	}
+	for _, err := range r.BackgroundErrors {
+		node.BackgroundErrors = append(node.BackgroundErrors, err.Error())
+	}
+	for _, diag := range r.Diagnostics {
+		node.Diagnostics = append(node.Diagnostics, diag.reportNode())
+	}
+	for _, child := range r.Children {
+		if child != nil {
+			node.Children = append(node.Children, child.reportNode())
+		}
+	}
+	return node
+}
+
+// reportOutput returns output as text with an empty encoding, or base64
+// encoded with the encoding "base64" when it is not valid UTF-8, so JSON
+// does not replace its invalid bytes
+func reportOutput(output []byte) (string, string) {
+	if utf8.Valid(output) {
+		return string(output), ""
+	}
+	return base64.StdEncoding.EncodeToString(output), "base64"
+}
@@ -0,0 +1,104 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	// Test: the report describes the pipeline and every node, and encodes as JSON
+	ctx := context.Background()
+	echo, _ := NewExecutable("echo", "hello world")
+	grep, _ := NewExecutable("grep", "hello")
+	fail, _ := NewExecutable("sh", "-c", "exit 3")
+
+	result, _ := echo.Pipe(grep).And(fail).Run(ctx)
+	report := result.Report()
+
+	if report.Version != ReportVersion {
+		t.Errorf("expected version %d, got %d", ReportVersion, report.Version)
+	}
+	expected := "echo 'hello world' | grep hello && sh -c 'exit 3'"
+	if report.Pipeline != expected {
+		t.Errorf("expected pipeline %q, got %q", expected, report.Pipeline)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+
+	root := decoded.Result
+	if root.Type != "and" || root.ExitCode != 3 || root.Error == "" {
+		t.Errorf("unexpected root node: %+v", root)
+	}
+	pipe := root.Children[0]
+	if pipe.Type != "pipe" || pipe.Command != "echo 'hello world' | grep hello" || len(pipe.Children) != 2 {
+		t.Errorf("unexpected pipe node: %+v", pipe)
+	}
+	if pipe.Children[1].Stdout != "hello world\n" {
+		t.Errorf("unexpected grep output %q", pipe.Children[1].Stdout)
+	}
+	if pipe.Start.IsZero() || root.DurationSeconds < pipe.DurationSeconds {
+		t.Errorf("unexpected timing: pipe %v %vs, root %vs", pipe.Start, pipe.DurationSeconds, root.DurationSeconds)
+	}
+}
+
+func TestPipelineString(t *testing.T) {
+	// Test: pipelines print in shell syntax with parentheses where needed
+	a, _ := NewExecutable("a")
+	b, _ := NewExecutable("b")
+	c, _ := NewExecutable("c")
+
+	tests := []struct {
+		exec     Executable
+		expected string
+	}{
+		{a.Pipe(b).Pipe(c), "a | b | c"},
+		{a.And(b).Or(c), "a && b || c"},
+		{a.And(b.Or(c)), "a && (b || c)"},
+		{a.And(b).Pipe(c), "(a && b) | c"},
+		{a.Pipe(b).And(c).Background(), "a | b && c &"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(tt.exec); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	// Test: output that is not UTF-8 is base64 encoded so no byte is lost
+	printf, _ := NewExecutable("printf", `\377ok`)
+	result, _ := printf.Run(context.Background())
+	result.Crash = &CrashReport{Signal: syscall.SIGSEGV, OutputTail: []byte("boom\n"), CorePattern: "core"}
+
+	data, err := json.Marshal(result.Report())
+	if err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+
+	node := decoded.Result
+	if node.StdoutEncoding != "base64" {
+		t.Fatalf("expected base64 stdout, got %q encoded as %q", node.Stdout, node.StdoutEncoding)
+	}
+	if stdout, _ := base64.StdEncoding.DecodeString(node.Stdout); string(stdout) != "\xffok" {
+		t.Errorf("expected stdout %q, got %q", "\xffok", stdout)
+	}
+	crash := node.Crash
+	if crash == nil || crash.Signal != syscall.SIGSEGV.String() || crash.OutputTail != "boom\n" || crash.OutputTailEncoding != "" || crash.CorePattern != "core" {
+		t.Errorf("unexpected crash node: %+v", crash)
+	}
+}
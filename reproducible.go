@@ -0,0 +1,53 @@
+package subprocess
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// WithUmask sets the file mode creation mask of the process, e.g. 0o022
+func WithUmask(umask os.FileMode) Option {
+	return func(o *Options) {
+		o.Umask = &umask
+	}
+}
+
+// Reproducible bundles the settings that make a build step produce the same
+// output on every run and machine:
+//   - the environment is cleared except PATH and the variables in allowEnv
+//   - TZ=UTC, LANG=C.UTF-8 and LC_COLLATE=C, so dates, messages and the order
+//     of shell glob expansion and sort do not depend on the host
+//   - SOURCE_DATE_EPOCH is kept when set, otherwise it is 0
+//   - umask 022
+//   - no network access on Linux, where WithNoNetwork is supported
+//
+// Options given after Reproducible can override each of these
+func Reproducible(allowEnv ...string) Option {
+	return func(o *Options) {
+		base := o.Env
+		if base == nil {
+			base = os.Environ()
+		}
+		keep := append([]string{"PATH", "SOURCE_DATE_EPOCH"}, allowEnv...)
+		var env []string
+		for _, kv := range base {
+			key, _, _ := strings.Cut(kv, "=")
+			if slices.Contains(keep, key) {
+				env = append(env, kv)
+			}
+		}
+		pinned := []string{"TZ=UTC", "LANG=C.UTF-8", "LC_COLLATE=C"}
+		if !slices.ContainsFunc(env, func(kv string) bool { return strings.HasPrefix(kv, "SOURCE_DATE_EPOCH=") }) {
+			pinned = append(pinned, "SOURCE_DATE_EPOCH=0")
+		}
+		o.Env = mergeEnv(env, pinned)
+
+		umask := os.FileMode(0o022)
+		o.Umask = &umask
+		if runtime.GOOS == "linux" {
+			o.NoNetwork = true
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestReproducible(t *testing.T) {
+	// Test: only allowed variables are inherited, locale, time and umask are pinned
+	t.Setenv("KEEP_ME", "kept")
+	t.Setenv("DROP_ME", "dropped")
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	script := `echo "$KEEP_ME-${DROP_ME:-none}-$TZ-$LANG-$LC_COLLATE-$SOURCE_DATE_EPOCH"; umask`
+	exec, _ := Command("sh", []string{"-c", script}, Reproducible("KEEP_ME"))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	expected := "kept-none-UTC-C.UTF-8-C-1700000000\n0022\n"
+	if string(result.Stdout) != expected {
+		t.Errorf("expected %q, got %q", expected, result.Stdout)
+	}
+
+	p, _ := NewProcess("true", nil, Reproducible())
+	if p.ops.NoNetwork != (runtime.GOOS == "linux") {
+		t.Errorf("expected no network on Linux only, got %v", p.ops.NoNetwork)
+	}
+}
+
+func TestWithUmask(t *testing.T) {
+	// Test: the process gets the umask, the program keeps its own
+	exec, _ := Command("sh", []string{"-c", "umask"}, WithUmask(0o077))
+	result, err := exec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "0077\n" {
+		t.Errorf("expected 0077, got %q", result.Stdout)
+	}
+	plain, _ := NewExecutable("sh", "-c", "umask")
+	if result, _ := plain.Run(context.Background()); string(result.Stdout) == "0077\n" {
+		t.Error("expected the umask of the program to be restored")
+	}
+}
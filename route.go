@@ -0,0 +1,102 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Router splits the output of a source Executable line by line and sends
+// each line to the first route whose pattern matches (like a demultiplexer)
+// Lines that match no route go to the default route, or are dropped if none is set
+type Router struct {
+	node
+	source   Executable
+	routes   []route
+	fallback Executable // nil when no default route is configured
+	err      error      // first invalid pattern, reported by Run
+	buffer   lineBuffer
+}
+
+// route pairs a line pattern with the Executable receiving matching lines
+type route struct {
+	pattern *regexp.Regexp
+	dest    Executable
+}
+
+// Route creates a Router that demultiplexes the output of source
+func Route(source Executable) *Router {
+	r := &Router{
+		source: source,
+		buffer: defaultLineBuffer(),
+	}
+	r.node = newNode(r)
+	return r
+}
+
+// When sends lines matching the regular expression pattern to dest
+// Routes are evaluated in the order they were added
+func (r *Router) When(pattern string, dest Executable) *Router {
+	clone := r.clone()
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		if clone.err == nil {
+			clone.err = err
+		}
+		return clone
+	}
+	clone.routes = append(clone.routes, route{pattern: re, dest: dest})
+	return clone
+}
+
+// Default sends lines that match no route to dest
+func (r *Router) Default(dest Executable) *Router {
+	clone := r.clone()
+	clone.fallback = dest
+	return clone
+}
+
+// Buffer sets the initial buffer size and the maximum line length used when
+// scanning source output, like bufio.Scanner.Buffer
+// Lines longer than max fail the run instead of being split. Sizes that are
+// not positive, or an initial size above max, are reported by Run and Validate
+func (r *Router) Buffer(initial, max int) *Router {
+	clone := r.clone()
+	clone.buffer = lineBuffer{initial: initial, max: max}
+	return clone
+}
+
+// clone returns a copy of r, so builder methods never modify a shared definition
+func (r *Router) clone() *Router {
+	clone := *r
+	clone.routes = append([]route(nil), r.routes...)
+	clone.self = &clone
+	return &clone
+}
+
+func (r *Router) configure(edit func(*settings)) Executable {
+	clone := r.clone()
+	edit(&clone.settings)
+	return clone
+}
+
+// String describes the router and its routes
+func (r *Router) String() string {
+	parts := []string{fmt.Sprint(r.source)}
+	for _, rt := range r.routes {
+		parts = append(parts, fmt.Sprintf("/%s/ -> %v", rt.pattern, rt.dest))
+	}
+	if r.fallback != nil {
+		parts = append(parts, fmt.Sprintf("default -> %v", r.fallback))
+	}
+	return "route(" + strings.Join(parts, "; ") + ")"
+}
+
+// Run executes the source and all routes using the visitor pattern
+func (r *Router) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, r.settings)
+	return visitor.run(r, func() (*Result, error) {
+		return visitor.VisitRoute(r)
+	})
+}
@@ -0,0 +1,191 @@
+package subprocess
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRouteByPattern(t *testing.T) {
+	// Test: errors and warnings from a log are sent to different downstreams
+	ctx := context.Background()
+
+	logs, _ := NewExecutable("printf", "ERROR disk full\\nINFO started\\nWARN slow\\nERROR timeout\\n")
+	errors, _ := NewExecutable("cat")
+	warnings, _ := NewExecutable("cat")
+
+	result, err := Route(logs).
+		When("^ERROR", errors).
+		When("^WARN", warnings).
+		Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+
+	if result.Type != OpRoute {
+		t.Errorf("expected OpRoute, got %v", result.Type)
+	}
+
+	// Source plus one child per route
+	if len(result.Children) != 3 {
+		t.Fatalf("expected 3 children, got %d", len(result.Children))
+	}
+
+	errOut := string(result.Children[1].Stdout)
+	if errOut != "ERROR disk full\nERROR timeout\n" {
+		t.Errorf("unexpected error route output: %q", errOut)
+	}
+
+	warnOut := string(result.Children[2].Stdout)
+	if warnOut != "WARN slow\n" {
+		t.Errorf("unexpected warning route output: %q", warnOut)
+	}
+
+	// Unmatched lines are dropped without a default route
+	if strings.Contains(string(result.Stdout), "INFO") {
+		t.Errorf("expected INFO line to be dropped, got: %s", result.Stdout)
+	}
+}
+
+func TestRouteDefault(t *testing.T) {
+	// Test: unmatched lines go to the default route
+	ctx := context.Background()
+
+	logs, _ := NewExecutable("printf", "ERROR a\\nINFO b\\nDEBUG c\\n")
+	errors, _ := NewExecutable("cat")
+	rest, _ := NewExecutable("wc", "-l")
+
+	result, err := Route(logs).
+		When("^ERROR", errors).
+		Default(rest).
+		Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+
+	count := strings.TrimSpace(string(result.Children[2].Stdout))
+	if count != "2" {
+		t.Errorf("expected 2 lines on default route, got: %s", count)
+	}
+}
+
+func TestRouteToPipe(t *testing.T) {
+	// Test: a route destination can itself be a pipe
+	ctx := context.Background()
+
+	logs, _ := NewExecutable("printf", "ERROR a\\nERROR b\\nINFO c\\n")
+	cat, _ := NewExecutable("cat")
+	wc, _ := NewExecutable("wc", "-l")
+
+	result, err := Route(logs).When("ERROR", cat.Pipe(wc)).Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+
+	count := strings.TrimSpace(string(result.Stdout))
+	if count != "2" {
+		t.Errorf("expected 2 routed lines, got: %s", count)
+	}
+}
+
+func TestRouteInvalidPattern(t *testing.T) {
+	ctx := context.Background()
+
+	logs, _ := NewExecutable("echo", "test")
+	cat, _ := NewExecutable("cat")
+
+	result, err := Route(logs).When("(", cat).Run(ctx)
+	if err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+	if result.ExitCode != -1 {
+		t.Errorf("expected exit code -1, got %d", result.ExitCode)
+	}
+}
+
+func TestRouteDestinationFailure(t *testing.T) {
+	// Test: a failing destination fails the route
+	ctx := context.Background()
+
+	logs, _ := NewExecutable("printf", "ERROR a\\n")
+	failing, _ := NewExecutable("sh", "-c", "cat >/dev/null; exit 3")
+
+	result, err := Route(logs).When("ERROR", failing).Run(ctx)
+	if err == nil {
+		t.Fatal("expected error from failing destination")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", result.ExitCode)
+	}
+}
+
+func TestRouteLongLines(t *testing.T) {
+	// Test: lines longer than the default scanner limit need a larger buffer
+	ctx := context.Background()
+
+	longLine := "head -c 100000 /dev/zero | tr '\\0' a; echo"
+
+	source, _ := NewExecutable("sh", "-c", longLine)
+	wc, _ := NewExecutable("wc", "-c")
+	_, err := Route(source).Default(wc).Run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Buffer") {
+		t.Errorf("expected line length error mentioning Buffer, got: %v", err)
+	}
+
+	source, _ = NewExecutable("sh", "-c", longLine)
+	wc, _ = NewExecutable("wc", "-c")
+	result, err := Route(source).Default(wc).Buffer(4096, 1<<20).Run(ctx)
+	if err != nil {
+		t.Fatalf("route failed: %v", err)
+	}
+
+	count := strings.TrimSpace(string(result.Stdout))
+	if count != "100001" {
+		t.Errorf("expected 100001 bytes, got: %s", count)
+	}
+}
+
+func TestRouteInvalidBuffer(t *testing.T) {
+	tests := []struct {
+		name         string
+		initial, max int
+		want         string
+	}{
+		{
+			// Test: a negative initial size fails the run instead of panicking
+			name:    "negative initial",
+			initial: -1,
+			max:     100,
+			want:    "initial size -1 must be positive",
+		},
+		{
+			// Test: a zero maximum line length fails the run
+			name:    "zero max",
+			initial: 16,
+			max:     0,
+			want:    "maximum line length 0 must be positive",
+		},
+		{
+			// Test: the initial size cannot exceed the maximum
+			name:    "initial above max",
+			initial: 200,
+			max:     100,
+			want:    "initial size 200 exceeds maximum line length 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, _ := NewExecutable("echo", "a")
+			cat, _ := NewExecutable("cat")
+			_, routeErr := Route(source).Default(cat).Buffer(tt.initial, tt.max).Run(context.Background())
+			source, _ = NewExecutable("echo", "a")
+			_, fanInErr := FanIn(source).Buffer(tt.initial, tt.max).Run(context.Background())
+			for _, err := range []error{routeErr, fanInErr} {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("expected error containing %q, got %v", tt.want, err)
+				}
+			}
+		})
+	}
+}
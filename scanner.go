@@ -0,0 +1,55 @@
+package subprocess
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// lineBuffer configures the buffer used to scan output line by line
+type lineBuffer struct {
+	initial int // initial buffer size in bytes
+	max     int // maximum line length in bytes
+}
+
+// defaultLineBuffer matches the defaults of bufio.Scanner
+func defaultLineBuffer() lineBuffer {
+	return lineBuffer{
+		initial: 4096,
+		max:     bufio.MaxScanTokenSize,
+	}
+}
+
+// check rejects sizes bufio.Scanner cannot work with
+func (b lineBuffer) check() error {
+	switch {
+	case b.initial <= 0:
+		return fmt.Errorf("invalid line buffer: initial size %d must be positive", b.initial)
+	case b.max <= 0:
+		return fmt.Errorf("invalid line buffer: maximum line length %d must be positive", b.max)
+	case b.initial > b.max:
+		return fmt.Errorf("invalid line buffer: initial size %d exceeds maximum line length %d", b.initial, b.max)
+	}
+	return nil
+}
+
+// newLineScanner returns a scanner reading lines from r with the given buffer,
+// or the error of an invalid buffer
+func newLineScanner(r io.Reader, buf lineBuffer) (*bufio.Scanner, error) {
+	if err := buf.check(); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, buf.initial), buf.max)
+	return scanner, nil
+}
+
+// scanError explains scanner errors, pointing at the buffer configuration
+// when a line is longer than the maximum
+func scanError(err error, buf lineBuffer) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("line longer than %d bytes, raise the limit with Buffer: %w", buf.max, err)
+	}
+	return err
+}
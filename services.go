@@ -0,0 +1,471 @@
+package subprocess
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cuongtranba/subprocess/backoff"
+)
+
+// RestartPolicy controls when a supervised service is restarted after it exits
+type RestartPolicy int
+
+const (
+	RestartOnFailure RestartPolicy = iota // Restart after a failed exit
+	RestartAlways                         // Restart after any exit
+	RestartNever                          // Leave the service down
+)
+
+// String returns a string representation of the restart policy
+func (r RestartPolicy) String() string {
+	switch r {
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	case RestartNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// restarts reports whether a service that exited with err is restarted
+func (r RestartPolicy) restarts(err error) bool {
+	switch r {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// HealthCheck decides when a started service is ready
+// Every check that is set must pass, a service without checks is ready once started
+type HealthCheck struct {
+	LogPattern   string        // regexp matched against each line of stdout and stderr
+	LogPatterns  []string      // regexps matched one after the other, after LogPattern
+	FailPatterns []string      // regexps failing the start as soon as a line matches
+	MaxLine      int           // longest line in bytes matched against the patterns, 64KiB if zero, longer lines are skipped
+	Command      Executable    // succeeds once the service is ready
+	Address      string        // host:port accepting TCP connections once the service is ready
+	Interval     time.Duration // between attempts of Command and Address, 100ms if zero
+	Timeout      time.Duration // how long the service may take to get ready, 30s if zero
+}
+
+// Service is a named long-running process of a Services group
+type Service struct {
+	Name        string
+	Process     *Process
+	DependsOn   []string         // services started and ready before this one
+	Health      HealthCheck      // when the service is ready
+	Restart     RestartPolicy    // when the service is restarted once ready
+	Backoff     backoff.Strategy // delay before restarts, exponential from 100ms to 10s if nil
+	MaxRestarts int              // restarts before the service is left down, 0 is unlimited
+}
+
+// ServiceError reports a service that could not be started or did not get ready
+type ServiceError struct {
+	Service string
+	Err     error
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("service %s: %v", e.Service, e.Err)
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// Services starts a group of services in dependency order and supervises them,
+// like docker compose for integration test environments
+type Services struct {
+	services []Service
+
+	mu      sync.Mutex
+	running []*supervisor // in start order
+}
+
+// NewServices creates a group of services, started by Up
+func NewServices(services ...Service) *Services {
+	return &Services{services: append([]Service(nil), services...)}
+}
+
+// Up starts every service after its dependencies, waiting for each one to be
+// ready before starting the next. Ready services are restarted according to
+// their policy until Down is called or ctx is done
+// If a service fails to start or get ready, the ones already started are
+// stopped and a *ServiceError is returned
+func (s *Services) Up(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.running) > 0 {
+		return errors.New("services are already up")
+	}
+
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range order {
+		sup, err := newSupervisor(ctx, svc)
+		if err == nil {
+			err = sup.up()
+		}
+		if err != nil {
+			s.down(context.WithoutCancel(ctx))
+			return &ServiceError{Service: svc.Name, Err: err}
+		}
+		s.running = append(s.running, sup)
+	}
+	return nil
+}
+
+// Down stops the services in reverse start order with ProcessRunner.Shutdown
+// and waits for their supervisors to return
+func (s *Services) Down(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.down(ctx)
+}
+
+func (s *Services) down(ctx context.Context) error {
+	var errs []error
+	for i := len(s.running) - 1; i >= 0; i-- {
+		if err := s.running[i].down(ctx); err != nil {
+			errs = append(errs, &ServiceError{Service: s.running[i].Name, Err: err})
+		}
+	}
+	s.running = nil
+	return errors.Join(errs...)
+}
+
+// Runner returns the current runner of the named service, nil if it is not running
+func (s *Services) Runner(name string) *ProcessRunner {
+	if sup := s.supervisor(name); sup != nil {
+		sup.mu.Lock()
+		defer sup.mu.Unlock()
+		return sup.runner
+	}
+	return nil
+}
+
+// Restarts returns how many times the named service was restarted since Up
+func (s *Services) Restarts(name string) int {
+	if sup := s.supervisor(name); sup != nil {
+		sup.mu.Lock()
+		defer sup.mu.Unlock()
+		return sup.restarts
+	}
+	return 0
+}
+
+// Info returns the named groups of the log pattern of the named service, as
+// matched by its latest run, e.g. the port of `listening on :(?P<port>\d+)`
+func (s *Services) Info(name string) map[string]string {
+	if sup := s.supervisor(name); sup != nil {
+		sup.mu.Lock()
+		defer sup.mu.Unlock()
+		return maps.Clone(sup.info)
+	}
+	return nil
+}
+
+func (s *Services) supervisor(name string) *supervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sup := range s.running {
+		if sup.Name == name {
+			return sup
+		}
+	}
+	return nil
+}
+
+// startOrder returns the services with every service after its dependencies,
+// otherwise keeping the order they were given in
+func (s *Services) startOrder() ([]Service, error) {
+	byName := make(map[string]Service, len(s.services))
+	for _, svc := range s.services {
+		if svc.Name == "" {
+			return nil, errors.New("service without a name")
+		}
+		if _, ok := byName[svc.Name]; ok {
+			return nil, &ServiceError{Service: svc.Name, Err: errors.New("defined twice")}
+		}
+		if svc.Process == nil {
+			return nil, &ServiceError{Service: svc.Name, Err: errors.New("no process")}
+		}
+		byName[svc.Name] = svc
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(s.services))
+	var order []Service
+	var visit func(svc Service, path []string) error
+	visit = func(svc Service, path []string) error {
+		switch state[svc.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return &ServiceError{Service: svc.Name, Err: fmt.Errorf("dependency cycle %v", append(path, svc.Name))}
+		}
+		state[svc.Name] = visiting
+		for _, name := range svc.DependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return &ServiceError{Service: svc.Name, Err: fmt.Errorf("unknown dependency %s", name)}
+			}
+			if err := visit(dep, append(path, svc.Name)); err != nil {
+				return err
+			}
+		}
+		state[svc.Name] = visited
+		order = append(order, svc)
+		return nil
+	}
+	for _, svc := range s.services {
+		if err := visit(svc, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// supervisor runs one service and restarts it when it exits
+type supervisor struct {
+	Service
+	patterns logPatterns // compiled log patterns of Health
+
+	ctx    context.Context // of the service processes
+	cancel context.CancelFunc
+	halt   context.Context // done once the service is going down
+	stop   context.CancelFunc
+	done   chan struct{} // closed when supervise returns
+
+	mu       sync.Mutex
+	runner   *ProcessRunner
+	restarts int
+	info     map[string]string // named groups of the log pattern in the latest run
+}
+
+func newSupervisor(ctx context.Context, svc Service) (*supervisor, error) {
+	patterns, err := compileLogPatterns(svc.Health)
+	if err != nil {
+		return nil, err
+	}
+	sup := &supervisor{Service: svc, patterns: patterns, done: make(chan struct{})}
+	sup.ctx, sup.cancel = context.WithCancel(ctx)
+	sup.halt, sup.stop = context.WithCancel(sup.ctx)
+	return sup, nil
+}
+
+// up starts the service, waits for it to be ready and starts supervising it
+func (s *supervisor) up() error {
+	runner, watch, err := s.start()
+	if err != nil {
+		s.cancel()
+		return err
+	}
+	if err := s.Health.wait(s.ctx, runner, watch); err != nil {
+		runner.Shutdown(context.WithoutCancel(s.ctx))
+		s.cancel()
+		return err
+	}
+	go s.supervise(runner)
+	return nil
+}
+
+// start runs the service and drains its output, so it never blocks on a full
+// pipe. The returned watch follows the output against the log patterns
+func (s *supervisor) start() (*ProcessRunner, *logWatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.halt.Err() != nil {
+		return nil, nil, s.halt.Err()
+	}
+	runner, err := s.Process.Exec(s.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.runner = runner
+
+	watch := s.patterns.watch(s.setInfo)
+	line, skip := func([]byte) {}, func() {}
+	if watch != nil {
+		line, skip = watch.line, watch.skip
+	}
+	go drainLines(runner.Stdout(), s.Health.maxLine(), line, skip)
+	go drainLines(runner.Stderr(), s.Health.maxLine(), line, skip)
+	return runner, watch, nil
+}
+
+// setInfo records the named groups of the log patterns matched by the service
+func (s *supervisor) setInfo(info map[string]string) {
+	s.mu.Lock()
+	s.info = info
+	s.mu.Unlock()
+}
+
+// supervise restarts the service according to its policy until it goes down
+func (s *supervisor) supervise(runner *ProcessRunner) {
+	defer close(s.done)
+
+	strategy := s.Backoff
+	if strategy == nil {
+		strategy = backoff.Exponential(100*time.Millisecond, 10*time.Second)
+	}
+	b := backoff.New(strategy, backoff.Budget{MaxAttempts: s.MaxRestarts})
+	for {
+		err := runner.Wait()
+		if s.halt.Err() != nil || !s.Restart.restarts(err) {
+			return
+		}
+		if b.Wait(s.halt) != nil {
+			return
+		}
+		if runner, _, err = s.start(); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+	}
+}
+
+// down stops supervising the service and shuts its process down
+func (s *supervisor) down(ctx context.Context) error {
+	s.mu.Lock()
+	s.stop()
+	runner := s.runner
+	s.mu.Unlock()
+
+	err := runner.Shutdown(ctx)
+	s.cancel()
+	<-s.done
+	return err
+}
+
+// wait returns once every check passes, or why the service did not get ready
+func (h HealthCheck) wait(ctx context.Context, runner *ProcessRunner, watch *logWatch) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	interval := h.Interval
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("not ready after %v", timeout))
+	defer cancel()
+
+	var logged, failed <-chan struct{}
+	if watch != nil {
+		logged, failed = watch.ready, watch.failed
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// logged is set to nil once the log patterns matched
+		if logged == nil && h.ready(ctx) {
+			if watch != nil {
+				watch.finish()
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if watch != nil {
+				return fmt.Errorf("%w%s", context.Cause(ctx), watch.progress())
+			}
+			return context.Cause(ctx)
+		case <-failed:
+			return watch.err()
+		case <-runner.done:
+			if runner.err != nil {
+				return fmt.Errorf("exited before it was ready: %w", runner.err)
+			}
+			return errors.New("exited before it was ready")
+		case <-logged:
+			logged = nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ready runs the Command and Address checks once
+func (h HealthCheck) ready(ctx context.Context) bool {
+	if h.Command != nil {
+		if _, err := h.Command.Run(ctx); err != nil {
+			return false
+		}
+	}
+	if h.Address != "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", h.Address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+	}
+	return true
+}
+
+// maxLine returns the longest line matched against the log patterns
+func (h HealthCheck) maxLine() int {
+	if h.MaxLine > 0 {
+		return h.MaxLine
+	}
+	return defaultLineBuffer().max
+}
+
+// drainLines reads r to the end, passing every line up to max bytes to fn
+// Longer lines are not buffered, skip is called for each of them instead and
+// draining goes on with the next line
+func drainLines(r io.Reader, max int, fn func(line []byte), skip func()) {
+	br := bufio.NewReader(r)
+	var line []byte
+	long := false
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !long {
+			line = append(line, chunk...)
+			if len(trimEOL(line)) > max {
+				long, line = true, line[:0]
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		switch {
+		case long:
+			skip()
+		case err == nil || len(line) > 0:
+			fn(trimEOL(line))
+		}
+		line, long = line[:0], false
+		if err != nil {
+			return
+		}
+	}
+}
+
+// trimEOL drops the line ending of line, like bufio.ScanLines
+func trimEOL(line []byte) []byte {
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+}
@@ -0,0 +1,241 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cuongtranba/subprocess/backoff"
+)
+
+func TestServicesUpDown(t *testing.T) {
+	// Test: dependencies are ready before dependents start, Down stops everything
+	db, _ := NewProcess("sh", []string{"-c", "sleep 0.2; echo ready to accept connections; exec sleep 10"})
+	app, _ := NewProcess("sleep", []string{"10"})
+	services := NewServices(
+		Service{Name: "app", Process: app, DependsOn: []string{"db"}},
+		Service{Name: "db", Process: db, Health: HealthCheck{LogPattern: "ready to (?P<what>accept)"}},
+	)
+
+	if err := services.Up(context.Background()); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	dbRunner, appRunner := services.Runner("db"), services.Runner("app")
+	if dbRunner == nil || appRunner == nil {
+		t.Fatal("expected both services to be running")
+	}
+	if info := services.Info("db"); info["what"] != "accept" {
+		t.Errorf("expected the named group of the log pattern, got %v", info)
+	}
+	if appRunner.started.Sub(dbRunner.started) < 200*time.Millisecond {
+		t.Error("expected app to start once db was ready")
+	}
+
+	if err := services.Down(context.Background()); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if !dbRunner.exited() || !appRunner.exited() {
+		t.Error("expected every service to be stopped")
+	}
+	if services.Runner("db") != nil {
+		t.Error("expected no runner after Down")
+	}
+}
+
+func TestServicesAddressHealth(t *testing.T) {
+	// Test: a service is ready once its address accepts connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer listener.Close()
+
+	server, _ := NewProcess("sleep", []string{"10"})
+	check, _ := NewExecutable("true")
+	services := NewServices(Service{
+		Name:    "server",
+		Process: server,
+		Health:  HealthCheck{Address: listener.Addr().String(), Command: check},
+	})
+	if err := services.Up(context.Background()); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	services.Down(context.Background())
+}
+
+func TestServicesRestart(t *testing.T) {
+	// Test: a failing service is restarted until its restart budget is spent
+	crash, _ := NewProcess("sh", []string{"-c", "exit 1"})
+	services := NewServices(Service{
+		Name:        "crash",
+		Process:     crash,
+		Restart:     RestartOnFailure,
+		Backoff:     backoff.Constant(10 * time.Millisecond),
+		MaxRestarts: 2,
+	})
+	if err := services.Up(context.Background()); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	defer services.Down(context.Background())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for services.Restarts("crash") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := services.Restarts("crash"); got != 2 {
+		t.Errorf("expected 2 restarts, got %d", got)
+	}
+}
+
+func TestServicesErrors(t *testing.T) {
+	sleep, _ := NewProcess("sleep", []string{"10"})
+	exit, _ := NewProcess("sh", []string{"-c", "exit 3"})
+
+	tests := []struct {
+		name     string
+		services []Service
+		want     string
+	}{
+		{
+			name:     "unknown dependency",
+			services: []Service{{Name: "app", Process: sleep, DependsOn: []string{"db"}}},
+			want:     "service app: unknown dependency db",
+		},
+		{
+			name: "dependency cycle",
+			services: []Service{
+				{Name: "a", Process: sleep, DependsOn: []string{"b"}},
+				{Name: "b", Process: sleep, DependsOn: []string{"a"}},
+			},
+			want: "service a: dependency cycle [a b a]",
+		},
+		{
+			name:     "defined twice",
+			services: []Service{{Name: "a", Process: sleep}, {Name: "a", Process: sleep}},
+			want:     "service a: defined twice",
+		},
+		{
+			name:     "invalid log pattern",
+			services: []Service{{Name: "a", Process: sleep, Health: HealthCheck{LogPattern: "("}}},
+			want:     "service a: invalid log pattern",
+		},
+		{
+			name:     "invalid fail pattern",
+			services: []Service{{Name: "a", Process: sleep, Health: HealthCheck{FailPatterns: []string{"["}}}},
+			want:     "service a: invalid fail pattern",
+		},
+		{
+			name:     "exited before ready",
+			services: []Service{{Name: "a", Process: exit, Health: HealthCheck{LogPattern: "ready"}}},
+			want:     "service a: exited before it was ready",
+		},
+		{
+			name: "not ready in time",
+			services: []Service{
+				{Name: "a", Process: sleep},
+				{Name: "b", Process: sleep, DependsOn: []string{"a"}, Health: HealthCheck{LogPattern: "ready", Timeout: 100 * time.Millisecond}},
+			},
+			want: "service b: not ready after 100ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := NewServices(tt.services...)
+			err := services.Up(context.Background())
+			var serviceErr *ServiceError
+			if !errors.As(err, &serviceErr) {
+				t.Fatalf("expected *ServiceError, got %v", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("expected error %q, got %q", tt.want, err)
+			}
+			if services.Runner("a") != nil {
+				t.Error("expected started services to be stopped")
+			}
+		})
+	}
+}
+
+func TestServicesLogPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		health   HealthCheck
+		wantErr  string
+		wantInfo map[string]string
+	}{
+		{
+			// Test: patterns match in order, lines matching a later pattern
+			// early do not count
+			name:     "ordered",
+			script:   "echo ready to accept; echo listening on 5432; echo ready to accept",
+			health:   HealthCheck{LogPatterns: []string{`listening on (?P<port>\d+)`, "ready to accept"}},
+			wantInfo: map[string]string{"port": "5432"},
+		},
+		{
+			// Test: the timeout names the pattern still waited for
+			name:    "out of order",
+			script:  "echo ready to accept; echo listening on 5432",
+			health:  HealthCheck{LogPatterns: []string{"listening on", "ready to accept"}, Timeout: 200 * time.Millisecond},
+			wantErr: `service db: not ready after 200ms, waiting for log pattern "ready to accept"`,
+		},
+		{
+			// Test: a fail pattern ends the start before the timeout
+			name:    "fail pattern",
+			script:  "echo starting; echo FATAL: data directory missing >&2",
+			health:  HealthCheck{LogPattern: "ready", FailPatterns: []string{"FATAL", "PANIC"}},
+			wantErr: "service db: failed to start: FATAL: data directory missing",
+		},
+		{
+			// Test: fail patterns are not checked once the service is ready
+			name:   "fail after ready",
+			script: "echo ready; sleep 0.2; echo FATAL: later",
+			health: HealthCheck{LogPattern: "ready", FailPatterns: []string{"FATAL"}},
+		},
+		{
+			// Test: lines longer than the default maximum are skipped, later lines still match
+			name:   "long line",
+			script: "head -c 70000 /dev/zero | tr '\\0' x; echo; echo ready",
+			health: HealthCheck{LogPattern: "ready"},
+		},
+		{
+			// Test: lines longer than MaxLine are skipped and reported on timeout
+			name:    "max line",
+			script:  "echo this line is ready but too long",
+			health:  HealthCheck{LogPattern: "ready", MaxLine: 16, Timeout: 200 * time.Millisecond},
+			wantErr: `service db: not ready after 200ms, waiting for log pattern "ready", skipped 1 lines longer than MaxLine`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := NewProcess("sh", []string{"-c", tt.script + "; exec sleep 10"})
+			services := NewServices(Service{Name: "db", Process: db, Health: tt.health})
+
+			start := time.Now()
+			err := services.Up(context.Background())
+			defer services.Down(context.Background())
+			if time.Since(start) > 2*time.Second {
+				t.Error("expected Up to return before the default timeout")
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Up failed: %v", err)
+			}
+			if info := services.Info("db"); len(tt.wantInfo) > 0 && !maps.Equal(info, tt.wantInfo) {
+				t.Errorf("expected info %v, got %v", tt.wantInfo, info)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package subprocess
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+)
+
+// WithSingleflight deduplicates identical runs: while a process with the same
+// resolved command, arguments, directory, environment, stdin and options
+// affecting its result is running, new runs wait for it and get a copy of its
+// Result instead of spawning a duplicate. Use it for expensive idempotent
+// queries triggered concurrently. Cancelling the context of the first run
+// cancels it for everyone waiting on it
+// Only applies to processes run on their own, not to streamed pipe stages
+// It cannot be combined with output handlers or writers, such as WithStdout,
+// which only the first run would feed
+func WithSingleflight() Option {
+	return func(o *Options) {
+		o.Singleflight = true
+	}
+}
+
+// errSingleflightHandlers rejects output handlers and writers on shared runs
+var errSingleflightHandlers = errors.New("singleflight cannot be combined with output handlers or writers")
+
+// observesOutput reports whether ops passes the output to a handler or writer
+// while it is read, which only happens for the run that reads it
+func (o *Options) observesOutput() bool {
+	return o.StdoutHandler != nil || o.StderrHandler != nil || o.StdoutSink != nil ||
+		o.StderrSink != nil || o.Transcript != nil || o.CILog != nil || o.Recording != nil
+}
+
+// flight is a process run shared by identical callers
+type flight struct {
+	done   chan struct{}
+	result *Result
+	err    error
+}
+
+// flights holds the shared runs in progress by key
+var flights struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// visitShared runs ep, or waits for an identical run already in progress
+func (v *ExecutionVisitor) visitShared(ep *ExecutableProcess) (*Result, error) {
+	ops := *ep.process.ops
+	if ops.observesOutput() {
+		return &Result{Type: OpSingle, Error: errSingleflightHandlers, ExitCode: -1}, errSingleflightHandlers
+	}
+	if ops.Stdin != nil {
+		// The stdin is part of the key, buffer it so the leader can still read it
+		data, err := io.ReadAll(ops.Stdin)
+		if err != nil {
+			return &Result{Type: OpSingle, Error: err, ExitCode: -1}, err
+		}
+		ops.Stdin = bytes.NewReader(data)
+	}
+	key := flightKey(&ops)
+
+	flights.mu.Lock()
+	if flights.calls == nil {
+		flights.calls = make(map[string]*flight)
+	}
+	if call, ok := flights.calls[key]; ok {
+		flights.mu.Unlock()
+		select {
+		case <-call.done:
+			return sharedResult(call.result, &ops), call.err
+		case <-v.ctx.Done():
+			return &Result{Type: OpSingle, Error: v.ctx.Err(), ExitCode: -1}, v.ctx.Err()
+		}
+	}
+	call := &flight{done: make(chan struct{})}
+	flights.calls[key] = call
+	flights.mu.Unlock()
+
+	defer func() {
+		if call.result == nil {
+			// The leader panicked, its waiters fail instead
+			call.err = errors.New("shared run did not complete")
+			call.result = &Result{Type: OpSingle, Error: call.err, ExitCode: -1}
+		}
+		flights.mu.Lock()
+		delete(flights.calls, key)
+		flights.mu.Unlock()
+		close(call.done)
+	}()
+
+	leader := &ExecutableProcess{process: &Process{ops: &ops}}
+	leader.node = node{self: leader, settings: ep.settings}
+	call.result, call.err = v.visitProcess(leader)
+	return sharedResult(call.result, &ops), call.err
+}
+
+// sharedResult returns a copy of the shared result r for a caller with ops,
+// annotated with the metadata of the caller instead of the one of the leader
+func sharedResult(r *Result, ops *Options) *Result {
+	clone := cloneResult(r)
+	clone.Metadata = maps.Clone(ops.Metadata)
+	return clone
+}
+
+// cloneResult returns a deep copy of r, so callers sharing a run can modify
+// their result without affecting the others
+func cloneResult(r *Result) *Result {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	clone.Stdout = bytes.Clone(r.Stdout)
+	clone.Stderr = bytes.Clone(r.Stderr)
+	clone.OpenedFiles = slices.Clone(r.OpenedFiles)
+	clone.Metadata = maps.Clone(r.Metadata)
+	clone.BackgroundErrors = slices.Clone(r.BackgroundErrors)
+	if r.Crash != nil {
+		crash := *r.Crash
+		crash.OutputTail = bytes.Clone(r.Crash.OutputTail)
+		clone.Crash = &crash
+	}
+	if r.Env != nil {
+		env := *r.Env
+		env.Env = slices.Clone(r.Env.Env)
+		env.Added = slices.Clone(r.Env.Added)
+		env.Removed = slices.Clone(r.Env.Removed)
+		env.Changed = slices.Clone(r.Env.Changed)
+		clone.Env = &env
+	}
+	clone.Children = cloneResults(r.Children)
+	clone.Diagnostics = cloneResults(r.Diagnostics)
+	return &clone
+}
+
+func cloneResults(results []*Result) []*Result {
+	if results == nil {
+		return nil
+	}
+	clones := make([]*Result, len(results))
+	for i, r := range results {
+		clones[i] = cloneResult(r)
+	}
+	return clones
+}
+
+// flightKey identifies identical runs of the process described by ops
+func flightKey(ops *Options) string {
+	h := sha256.New()
+	write := func(s string) {
+		binary.Write(h, binary.LittleEndian, int64(len(s)))
+		io.WriteString(h, s)
+	}
+	field := func(v any) {
+		write(fmt.Sprint(v))
+	}
+	write(resolveCommand(ops))
+	if ops.Script != nil {
+		write(ops.Script.Path)
+	}
+	write(ops.Dir)
+	// Options changing how the process runs or how its Result is built
+	for _, v := range []any{
+		ops.Timeout, ops.MaxOutputSize, ops.OutputLimit, ops.CombinedOutput, ops.Color,
+		ops.Encoding, ops.PTY, ops.NoNetwork, ops.CPULimit, ops.MemoryLimit, ops.RawCmdLine,
+		ops.StdinPolicy, ops.CancelSignal, ops.KillDelay, ops.CrashReport, ops.TraceFiles,
+		ops.SnapshotEnv, ops.SecretEnv, ops.Umask != nil, ops.DiskLimit != nil, ops.Demux != nil,
+		ops.chaos != nil,
+	} {
+		field(v)
+	}
+	if ops.Umask != nil {
+		field(*ops.Umask)
+	}
+	if ops.DiskLimit != nil {
+		field(*ops.DiskLimit)
+	}
+	if d := ops.Demux; d != nil {
+		field(d.Markers)
+		for _, pattern := range d.Patterns {
+			field(pattern)
+		}
+	}
+	if ops.chaos != nil {
+		// Injected faults are random, only runs of the same source share
+		field(fmt.Sprintf("%p", ops.chaos))
+	}
+	binary.Write(h, binary.LittleEndian, int64(len(ops.Args)))
+	for _, arg := range ops.Args {
+		write(arg)
+	}
+	env := processEnv(ops)
+	if env == nil {
+		env = os.Environ()
+	}
+	binary.Write(h, binary.LittleEndian, int64(len(env)))
+	for _, kv := range env {
+		write(kv)
+	}
+	if r, ok := ops.Stdin.(*bytes.Reader); ok {
+		stdin := make([]byte, r.Len())
+		r.ReadAt(stdin, 0)
+		write(string(stdin))
+	}
+	write(string(ops.StdinData))
+	write(ops.StdinFile)
+	return hex.EncodeToString(h.Sum(nil))
+}
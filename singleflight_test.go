@@ -0,0 +1,96 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSingleflight(t *testing.T) {
+	// Test: concurrent identical runs spawn one process, other stdin or timeout spawns another
+	runs := filepath.Join(t.TempDir(), "runs")
+	script := "echo run >> " + runs + "; cat; sleep 0.3; echo out"
+	query, _ := Command("sh", []string{"-c", script}, WithSingleflight(), WithStdin(strings.NewReader("q1\n")), WithMetadata("q", 1))
+	query2, _ := Command("sh", []string{"-c", script}, WithSingleflight(), WithStdin(strings.NewReader("q1\n")), WithMetadata("q", 3))
+	other, _ := Command("sh", []string{"-c", script}, WithSingleflight(), WithStdin(strings.NewReader("q2\n")))
+	timeout, _ := Command("sh", []string{"-c", script}, WithSingleflight(), WithStdin(strings.NewReader("q1\n")), WithTimeout(time.Minute))
+
+	g, _ := NewGroup(context.Background())
+	g.Go(query)
+	g.Go(query2)
+	g.Go(other)
+	g.Go(timeout)
+	if err := g.Wait(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := g.Results()
+	for i, expected := range []string{"q1\nout\n", "q1\nout\n", "q2\nout\n", "q1\nout\n"} {
+		if string(results[i].Stdout) != expected {
+			t.Errorf("run %d: expected %q, got %q", i, expected, results[i].Stdout)
+		}
+	}
+	data, _ := os.ReadFile(runs)
+	if count := strings.Count(string(data), "run"); count != 3 {
+		t.Errorf("expected 3 processes, got %d", count)
+	}
+
+	// Shared results are copies, changing one leaves the other intact
+	results[0].Stdout[0] = 'X'
+	results[0].Annotate("q", 2)
+	if string(results[1].Stdout) != "q1\nout\n" || results[1].Metadata["q"] != 3 {
+		t.Errorf("shared result was modified: %q %v", results[1].Stdout, results[1].Metadata)
+	}
+	if results[3].Metadata != nil {
+		t.Errorf("expected no metadata on a run without any, got %v", results[3].Metadata)
+	}
+}
+
+func TestSingleflightKey(t *testing.T) {
+	// Test: options changing how the output is decoded or the process runs spawn separate processes
+	runs := filepath.Join(t.TempDir(), "runs")
+	script := "echo run >> " + runs + "; sleep 0.3; printf 'caf\\351'"
+	umask := os.FileMode(0o077)
+	for name, opts := range map[string][]Option{
+		"encoding": {WithEncoding("latin1")},
+		"color":    {WithColor(ColorNever)},
+		"umask":    {WithUmask(umask)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			os.Remove(runs)
+			plain, _ := Command("sh", []string{"-c", script}, WithSingleflight())
+			other, _ := Command("sh", []string{"-c", script}, append(opts, WithSingleflight())...)
+			g, _ := NewGroup(context.Background())
+			g.Go(plain)
+			g.Go(other)
+			if err := g.Wait(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, _ := os.ReadFile(runs)
+			if count := strings.Count(string(data), "run"); count != 2 {
+				t.Errorf("expected 2 processes, got %d", count)
+			}
+		})
+	}
+}
+
+func TestSingleflightHandlers(t *testing.T) {
+	// Test: output handlers and writers are rejected, only the first run would feed them
+	for name, opt := range map[string]Option{
+		"handler": WithStdoutHandler(func([]byte) {}),
+		"writer":  WithStdout(io.Discard),
+	} {
+		query, _ := Command("echo", []string{"q"}, WithSingleflight(), opt)
+		if err := query.Validate(); err == nil || !strings.Contains(err.Error(), "output handlers") {
+			t.Errorf("%s: expected a validation error, got %v", name, err)
+		}
+		if _, err := query.Run(context.Background()); !errors.Is(err, errSingleflightHandlers) {
+			t.Errorf("%s: expected errSingleflightHandlers, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package subprocess
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// WithStdinString makes the process read s as its stdin, like cmd <<< "s"
+// without the trailing newline. Unlike WithStdin, every run reads all of s
+func WithStdinString(s string) Option {
+	return func(o *Options) {
+		o.Stdin, o.StdinData, o.StdinFile = nil, []byte(s), ""
+	}
+}
+
+// WithStdinFile makes the process read the file at path as its stdin, like
+// "cmd < path". The file is opened by every run, a relative path is relative
+// to the working directory of the program like in a shell
+func WithStdinFile(path string) Option {
+	return func(o *Options) {
+		o.Stdin, o.StdinData, o.StdinFile = nil, nil, path
+	}
+}
+
+// hasStdin reports whether ops sets the stdin of the process
+func (o *Options) hasStdin() bool {
+	return o.Stdin != nil || o.StdinData != nil || o.StdinFile != ""
+}
+
+// openStdin returns the stdin set by ops for a run and a function closing it,
+// or a nil reader when the process reads from the runner
+func openStdin(ops *Options) (io.Reader, func(), error) {
+	switch {
+	case ops.StdinData != nil:
+		return bytes.NewReader(ops.StdinData), func() {}, nil
+	case ops.StdinFile != "":
+		f, err := os.Open(ops.StdinFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	default:
+		return ops.Stdin, func() {}, nil
+	}
+}
@@ -0,0 +1,63 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdinOptions(t *testing.T) {
+	// Test: static input starts a pipe and is read again by every run
+	file := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(file, []byte("from file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		output string
+		err    string
+	}{
+		{"string", []Option{WithStdinString("from string\n")}, "FROM STRING\n", ""},
+		{"file", []Option{WithStdinFile(file)}, "FROM FILE\n", ""},
+		{"reader", []Option{WithStdin(strings.NewReader("from reader\n"))}, "FROM READER\n", ""},
+		{"last one wins", []Option{WithStdinFile(file), WithStdinString("last\n")}, "LAST\n", ""},
+		{"missing file", []Option{WithStdinFile(filepath.Join(t.TempDir(), "missing"))}, "", "no such file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cat, _ := Command("cat", nil, tt.opts...)
+			tr, _ := NewExecutable("tr", "a-z", "A-Z")
+			pipeline := cat.Pipe(tr)
+
+			result, err := pipeline.Run(context.Background())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				if verr := pipeline.Validate(); verr == nil || !strings.Contains(verr.Error(), "stdin file") {
+					t.Errorf("expected a validation error, got %v", verr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if string(result.Stdout) != tt.output {
+				t.Errorf("expected %q, got %q", tt.output, result.Stdout)
+			}
+
+			// A reader is consumed by the first run, the other sources are not
+			if tt.name != "reader" {
+				again, _ := pipeline.Run(context.Background())
+				if string(again.Stdout) != tt.output {
+					t.Errorf("second run: expected %q, got %q", tt.output, again.Stdout)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// execReader reads the output of an executable, starting it on the first Read
+type execReader struct {
+	ctx  context.Context
+	exec Executable
+
+	once   sync.Once
+	cancel context.CancelFunc
+	pr     *io.PipeReader
+	done   chan struct{}
+	err    error
+}
+
+func newExecReader(ctx context.Context, exec Executable) io.ReadCloser {
+	return &execReader{ctx: ctx, exec: exec}
+}
+
+func (r *execReader) start() {
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(r.ctx)
+	pr, pw := io.Pipe()
+	r.pr, r.done = pr, make(chan struct{})
+
+	cmd := NewCmd(ctx, r.exec)
+	cmd.Stdout = pw
+	go func() {
+		defer close(r.done)
+		r.err = cmd.Run()
+		// A failed run surfaces as the error of the final Read instead of EOF
+		pw.CloseWithError(r.err)
+	}()
+}
+
+func (r *execReader) Read(b []byte) (int, error) {
+	r.once.Do(r.start)
+	return r.pr.Read(b)
+}
+
+// Close stops the executable if it is still running and waits for it
+// The error of a run that was stopped early is not reported
+func (r *execReader) Close() error {
+	started := true
+	r.once.Do(func() { started = false })
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return r.err
+	default:
+	}
+	r.cancel()
+	r.pr.Close()
+	<-r.done
+	return nil
+}
+
+// execWriter feeds its writes to the stdin of an executable, starting it on
+// the first Write. The output of the executable is discarded
+// It runs with the settings of the executable, and a panic during the run is
+// returned as a *PanicError
+type execWriter struct {
+	ctx  context.Context
+	exec Executable
+
+	once   sync.Once
+	chain  *pipeChain
+	done   chan struct{} // closed once the run finished
+	err    error         // error of starting the executable
+	runErr error         // error of the run, set once done is closed
+}
+
+func newExecWriter(ctx context.Context, exec Executable) io.WriteCloser {
+	return &execWriter{ctx: ctx, exec: exec}
+}
+
+func (w *execWriter) start() {
+	if !isStreamable(w.exec) {
+		w.err = errors.New("subprocess: only processes and pipes can be written to")
+		return
+	}
+
+	started := make(chan error, 1)
+	w.done = make(chan struct{})
+	visitor := newExecutionVisitor(w.ctx, settingsOf(w.exec))
+	go func() {
+		defer close(w.done)
+		_, w.runErr = visitor.run(w.exec, func() (*Result, error) {
+			return w.visit(visitor, started)
+		})
+		// Reports a panic before the stages were started
+		select {
+		case started <- w.runErr:
+		default:
+		}
+	}()
+	w.err = <-started
+}
+
+// visit starts the stages, sends the error of starting them to started and
+// discards the output until the stages complete
+func (w *execWriter) visit(v *ExecutionVisitor, started chan<- error) (*Result, error) {
+	chain, failed, err := v.startChain(flattenPipe(w.exec))
+	if err != nil {
+		started <- err
+		return failed, err
+	}
+	w.chain = chain
+	stopWatchdog := v.watchProgress(chain)
+	started <- nil
+
+	io.Copy(io.Discard, chain.stdout())
+	result := v.finishChain(w.exec, chain, nil)
+	if err := stopWatchdog(); err != nil {
+		result.Error = err
+		result.ExitCode = -1
+	}
+	return result, result.Error
+}
+
+func (w *execWriter) Write(b []byte) (int, error) {
+	w.once.Do(w.start)
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.chain.stdin().Write(b)
+	// Writes count as progress of the pipe
+	w.chain.progress.Add(int64(n))
+	return n, err
+}
+
+// Close signals EOF to the executable, waits for it and returns its error
+func (w *execWriter) Close() error {
+	w.once.Do(w.start)
+	if w.chain == nil {
+		return w.err
+	}
+
+	w.chain.closeInput()
+	<-w.done
+	return w.runErr
+}
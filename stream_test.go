@@ -0,0 +1,129 @@
+package subprocess
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReaderCSV(t *testing.T) {
+	// Test: pipeline output can be consumed by encoding/csv
+	ctx := context.Background()
+	printf, _ := NewExecutable("printf", "name,age\\nalice,30\\nbob,25\\n")
+	tail, _ := NewExecutable("tail", "-n", "+2")
+
+	records, err := csv.NewReader(printf.Pipe(tail).Reader(ctx)).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if len(records) != 2 || records[1][0] != "bob" {
+		t.Errorf("unexpected records: %v", records)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	// Test: a failed run is reported instead of EOF
+	failing, _ := NewExecutable("sh", "-c", "echo partial; exit 3")
+
+	r := failing.Reader(context.Background())
+	out, err := io.ReadAll(r)
+	if err == nil {
+		t.Fatal("expected error from failing command")
+	}
+	if string(out) != "partial\n" {
+		t.Errorf("expected partial output, got %q", out)
+	}
+	if err := r.Close(); err == nil {
+		t.Error("expected Close to return the run error")
+	}
+}
+
+func TestReaderCloseEarly(t *testing.T) {
+	// Test: Close stops an endless producer
+	yes, _ := NewExecutable("yes")
+
+	r := yes.Reader(context.Background())
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("expected no error when closing early, got %v", err)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	// Test: writes feed the stdin of a pipe
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "out.txt")
+
+	tr, _ := NewExecutable("tr", "a-z", "A-Z")
+	save, _ := NewExecutable("sh", "-c", "cat > "+path)
+
+	w := tr.Pipe(save).Writer(ctx)
+	for i := 1; i <= 3; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file failed: %v", err)
+	}
+	if string(data) != "LINE 1\nLINE 2\nLINE 3\n" {
+		t.Errorf("unexpected file content: %q", data)
+	}
+}
+
+func TestWriterNotStreamable(t *testing.T) {
+	// Test: operators without stdin cannot be written to
+	a, _ := NewExecutable("true")
+	b, _ := NewExecutable("true")
+
+	w := a.And(b).Writer(context.Background())
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("expected write to fail")
+	}
+}
+
+func TestWriterSettings(t *testing.T) {
+	// Test: the shutdown timeout of the executable applies to its processes
+	stubborn, _ := NewExecutable("sh", "-c", "trap '' TERM; cat > /dev/null; exec sleep 10")
+	stubborn = stubborn.WithShutdownTimeout(200 * time.Millisecond)
+
+	w := stubborn.Writer(context.Background())
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := ShutdownAll(context.Background()); err != nil {
+		t.Fatalf("ShutdownAll failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected kill after the shutdown timeout, took %v", elapsed)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("expected the process to be killed")
+	}
+}
+
+func TestReaderPanic(t *testing.T) {
+	// Test: a panic during the run is returned as a PanicError
+	echo, _ := NewExecutable("echo", "hi")
+	bad := When(func(context.Context) bool { panic("bad condition") }, echo)
+
+	var panicErr *PanicError
+	if _, err := io.ReadAll(bad.Reader(context.Background())); !errors.As(err, &panicErr) {
+		t.Errorf("expected PanicError, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package subprocesstest starts services such as databases and emulators for
+// integration tests, like net/http/httptest does for HTTP servers
+package subprocesstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cuongtranba/subprocess"
+)
+
+// StopTimeout bounds how long the cleanup of StartService waits for a
+// service to exit after SIGTERM and SIGKILL
+var StopTimeout = 30 * time.Second
+
+// Service is a service started by StartService
+type Service struct {
+	Runner *subprocess.ProcessRunner
+	Info   map[string]string // named groups of health.LogPattern in the line that matched it
+}
+
+// StartService starts process, waits until it passes health and stops it
+// gracefully once the test and its subtests are done. The test fails if the
+// service does not get ready
+// Connection details printed by the service are parsed with named groups in
+// the log pattern, e.g. `listening on (?P<addr>\S+)` sets Info["addr"]
+func StartService(t testing.TB, process *subprocess.Process, health subprocess.HealthCheck) *Service {
+	t.Helper()
+
+	name := t.Name()
+	services := subprocess.NewServices(subprocess.Service{
+		Name:    name,
+		Process: process,
+		Health:  health,
+		Restart: subprocess.RestartNever,
+	})
+	if err := services.Up(context.Background()); err != nil {
+		t.Fatalf("start service: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+		defer cancel()
+		if err := services.Down(ctx); err != nil {
+			t.Errorf("stop service: %v", err)
+		}
+	})
+
+	return &Service{
+		Runner: services.Runner(name),
+		Info:   services.Info(name),
+	}
+}
@@ -0,0 +1,28 @@
+package subprocesstest
+
+import (
+	"testing"
+
+	"github.com/cuongtranba/subprocess"
+)
+
+func TestStartService(t *testing.T) {
+	// Test: connection details are parsed from the ready line and the
+	// service is stopped when the subtest ends
+	process, _ := subprocess.NewProcess("sh", []string{"-c", "echo starting; echo listening on 127.0.0.1:5432; exec sleep 10"})
+
+	var service *Service
+	t.Run("use", func(t *testing.T) {
+		service = StartService(t, process, subprocess.HealthCheck{LogPattern: `listening on (?P<host>[\d.]+):(?P<port>\d+)`})
+		if service.Info["host"] != "127.0.0.1" || service.Info["port"] != "5432" {
+			t.Errorf("expected host 127.0.0.1 and port 5432, got %v", service.Info)
+		}
+		if service.Runner == nil {
+			t.Fatal("expected a runner")
+		}
+	})
+
+	if service.Runner.Cmd().ProcessState == nil {
+		t.Error("expected the service to be stopped after the subtest")
+	}
+}
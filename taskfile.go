@@ -0,0 +1,746 @@
+package subprocess
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TaskFile is a set of tasks read from a Makefile or a justfile, so existing
+// task files can be run by the engine while they are migrated
+// Recipes run with sh -c, one line after another, in the directory set with
+// Dir or the working directory of the program
+type TaskFile struct {
+	tasks   map[string]*task
+	order   []string          // targets in the order they were declared
+	aliases map[string]string // justfile aliases
+	vars    map[string]string // variables, by name
+	simple  map[string]bool   // variables already expanded when assigned
+	exports map[string]bool   // justfile variables exported to recipes
+	make    bool              // make syntax: $(VAR) variables and file targets
+	dir     string            // where recipes run and target files are looked up
+
+	// justfile settings
+	shell      []string // command running each recipe line, sh -c when nil
+	exportAll  bool     // set export: every variable is exported
+	dotenv     bool     // set dotenv-load: .env is loaded into the environment
+	positional bool     // set positional-arguments: $0 is the recipe name
+}
+
+// task is a target and its recipe
+type task struct {
+	name   string
+	deps   []string
+	recipe []string
+	phony  bool // always runs, otherwise only when the target file is out of date
+}
+
+var (
+	makeAssignment = regexp.MustCompile(`^([A-Za-z_.][A-Za-z0-9_.-]*)\s*(\?=|::=|:=|\+=|=)\s*(.*)$`)
+	justAssignment = regexp.MustCompile(`^(export\s+)?([A-Za-z_][A-Za-z0-9_-]*)\s*:=\s*(.*)$`)
+	justRecipe     = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)([^:]*):(.*)$`)
+	justAlias      = regexp.MustCompile(`^alias\s+([A-Za-z_][A-Za-z0-9_-]*)\s*:=\s*([A-Za-z_][A-Za-z0-9_-]*)\s*$`)
+	justSetting    = regexp.MustCompile(`^set\s+([a-z-]+)\s*(?::=\s*(.*))?$`)
+)
+
+// ParseMakefile reads the rules and variables of a simple Makefile
+// Targets listed in .PHONY always run, other targets only run when the file
+// they name is missing or older than one of its prerequisites, like make.
+// Variables ($(VAR), ${VAR}, the environment) and $@, $< and $^ are expanded
+// Recipe lines starting with @ or - are supported, - ignores their failure
+// Pattern rules, conditionals, includes and functions return an error
+func ParseMakefile(r io.Reader) (*TaskFile, error) {
+	f := newTaskFile(true)
+	var current *task
+	var phony []string
+
+	lines, err := readLogicalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		text := l.text
+		if strings.HasPrefix(text, "\t") {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: recipe line without a target", l.number)
+			}
+			if line := strings.TrimSpace(text); line != "" {
+				current.recipe = append(current.recipe, line)
+			}
+			continue
+		}
+
+		text = stripComment(text)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		current = nil
+
+		if word, _, _ := strings.Cut(strings.TrimSpace(text), " "); isMakeDirective(word) {
+			return nil, fmt.Errorf("line %d: %s is not supported", l.number, word)
+		}
+		if m := makeAssignment.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+			if err := f.assignMake(m[1], m[2], m[3]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.number, err)
+			}
+			continue
+		}
+
+		targets, prereqs, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a rule or an assignment", l.number)
+		}
+		prereqs, inline, _ := strings.Cut(prereqs, ";")
+		prereqs = strings.TrimPrefix(prereqs, ":") // double-colon rules run like single ones
+		targetNames, err := f.expandFields(targets)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.number, err)
+		}
+		deps, err := f.expandFields(prereqs)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.number, err)
+		}
+
+		if len(targetNames) == 1 && targetNames[0] == ".PHONY" {
+			phony = append(phony, deps...)
+			continue
+		}
+		for _, name := range targetNames {
+			if strings.Contains(name, "%") {
+				return nil, fmt.Errorf("line %d: pattern rules are not supported", l.number)
+			}
+		}
+		for _, name := range targetNames {
+			if strings.HasPrefix(name, ".") {
+				// Other special targets change how make runs, not what it runs
+				continue
+			}
+			t := f.rule(name)
+			t.deps = append(t.deps, deps...)
+			if line := strings.TrimSpace(inline); line != "" {
+				t.recipe = append(t.recipe, line)
+			}
+			current = t
+		}
+	}
+
+	for _, name := range phony {
+		if t, ok := f.tasks[name]; ok {
+			t.phony = true
+		}
+	}
+	return f, nil
+}
+
+// ParseJustfile reads the recipes and variables of a simple justfile
+// Recipes always run, {{var}} is replaced by the value of the variable and
+// exported variables are set in the environment of the recipes. Aliases and
+// recipe lines starting with @ or - are supported, - ignores their failure
+// The export, shell, dotenv-load and positional-arguments settings are
+// supported, other settings, recipe parameters, shebang recipes and
+// backticks return an error
+func ParseJustfile(r io.Reader) (*TaskFile, error) {
+	f := newTaskFile(false)
+	var current *task
+
+	lines, err := readLogicalLines(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		text := l.text
+		if text != "" && (text[0] == ' ' || text[0] == '\t') {
+			if current == nil {
+				if strings.TrimSpace(text) == "" || strings.HasPrefix(strings.TrimSpace(text), "#") {
+					continue
+				}
+				return nil, fmt.Errorf("line %d: indented line outside a recipe", l.number)
+			}
+			line := strings.TrimSpace(text)
+			if line == "" {
+				continue
+			}
+			if len(current.recipe) == 0 && strings.HasPrefix(line, "#!") {
+				return nil, fmt.Errorf("line %d: shebang recipes are not supported", l.number)
+			}
+			current.recipe = append(current.recipe, line)
+			continue
+		}
+
+		current = nil
+		text = strings.TrimSpace(stripComment(text))
+		switch {
+		case text == "":
+			continue
+		case strings.HasPrefix(text, "set "):
+			if err := f.setJust(text); err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.number, err)
+			}
+			continue
+		case strings.HasPrefix(text, "["):
+			// Attributes change how just lists recipes, not what they run
+			continue
+		case strings.HasPrefix(text, "import ") || strings.HasPrefix(text, "mod "):
+			return nil, fmt.Errorf("line %d: %s is not supported", l.number, strings.Fields(text)[0])
+		}
+
+		if m := justAlias.FindStringSubmatch(text); m != nil {
+			f.aliases[m[1]] = m[2]
+			continue
+		}
+		if m := justAssignment.FindStringSubmatch(text); m != nil {
+			value, err := f.justValue(m[3])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.number, err)
+			}
+			f.vars[m[2]] = value
+			if m[1] != "" {
+				f.exports[m[2]] = true
+			}
+			continue
+		}
+		m := justRecipe.FindStringSubmatch(text)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected a recipe or an assignment", l.number)
+		}
+		if strings.TrimSpace(m[2]) != "" {
+			return nil, fmt.Errorf("line %d: recipe parameters are not supported", l.number)
+		}
+		t := f.rule(m[1])
+		t.phony = true
+		for _, dep := range strings.Fields(m[3]) {
+			if strings.ContainsAny(dep, "()") {
+				return nil, fmt.Errorf("line %d: dependency arguments are not supported", l.number)
+			}
+			t.deps = append(t.deps, dep)
+		}
+		current = t
+	}
+	return f, nil
+}
+
+// newTaskFile returns an empty task file using make or just syntax
+func newTaskFile(makeSyntax bool) *TaskFile {
+	return &TaskFile{
+		tasks:   make(map[string]*task),
+		aliases: make(map[string]string),
+		vars:    make(map[string]string),
+		simple:  make(map[string]bool),
+		exports: make(map[string]bool),
+		make:    makeSyntax,
+	}
+}
+
+// rule returns the task called name, declaring it if needed
+func (f *TaskFile) rule(name string) *task {
+	if t, ok := f.tasks[name]; ok {
+		return t
+	}
+	t := &task{name: name}
+	f.tasks[name] = t
+	f.order = append(f.order, name)
+	return t
+}
+
+// Dir returns a copy of f whose recipes run in dir, where the files of the
+// targets and prerequisites are also looked up, like make -C dir
+func (f *TaskFile) Dir(dir string) *TaskFile {
+	clone := *f
+	clone.dir = dir
+	return &clone
+}
+
+// path returns the path of the file named after a target or a prerequisite
+func (f *TaskFile) path(name string) string {
+	if f.dir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(f.dir, name)
+}
+
+// Targets returns the names of the targets in the order they were declared
+func (f *TaskFile) Targets() []string {
+	return append([]string(nil), f.order...)
+}
+
+// Default returns the target run by make or just without arguments: the
+// first one, or .DEFAULT_GOAL in a Makefile
+func (f *TaskFile) Default() string {
+	if goal := strings.TrimSpace(f.vars[".DEFAULT_GOAL"]); goal != "" {
+		return goal
+	}
+	if len(f.order) == 0 {
+		return ""
+	}
+	return f.order[0]
+}
+
+// Executable returns the Executable running target: its prerequisites first,
+// each of them once, then its recipe lines joined with And
+// Prerequisites run one after another in dependency order, never
+// concurrently like make -j
+func (f *TaskFile) Executable(target string) (Executable, error) {
+	var steps []Executable
+	done := make(map[string]bool)
+	if err := f.plan(target, done, nil, &steps); err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return True(), nil
+	}
+	exec := steps[0]
+	for _, step := range steps[1:] {
+		exec = exec.And(step)
+	}
+	return exec, nil
+}
+
+// plan appends the steps running target after its prerequisites, depth-first
+// visiting holds the targets being planned, to report cycles
+func (f *TaskFile) plan(target string, done map[string]bool, visiting []string, steps *[]Executable) error {
+	if alias, ok := f.aliases[target]; ok {
+		target = alias
+	}
+	if done[target] {
+		return nil
+	}
+	for i, name := range visiting {
+		if name == target {
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(visiting[i:], target), " -> "))
+		}
+	}
+
+	t, ok := f.tasks[target]
+	if !ok {
+		if f.make {
+			// A prerequisite without a rule is a source file, make only needs it to exist
+			if _, err := os.Stat(f.path(target)); err == nil {
+				done[target] = true
+				return nil
+			}
+		}
+		return fmt.Errorf("no rule to make target %q", target)
+	}
+
+	visiting = append(visiting, target)
+	for _, dep := range t.deps {
+		if err := f.plan(dep, done, visiting, steps); err != nil {
+			return err
+		}
+	}
+	done[target] = true
+
+	recipe, err := f.recipe(t)
+	if err != nil || recipe == nil {
+		return err
+	}
+	if !t.phony {
+		recipe = Unless(func(context.Context) bool { return f.upToDate(t) }, recipe)
+	}
+	*steps = append(*steps, recipe)
+	return nil
+}
+
+// recipe returns the lines of the recipe of t joined with And, nil if it is empty
+func (f *TaskFile) recipe(t *task) (Executable, error) {
+	env, err := f.recipeEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts := []Option{WithDir(f.dir)}
+	if len(env) > 0 {
+		opts = append(opts, WithEnvOverrides(env))
+	}
+	shell := f.shell
+	if shell == nil {
+		shell = []string{"sh", "-c"}
+	}
+
+	var recipe Executable
+	for _, line := range t.recipe {
+		line, err := f.expandRecipe(t, line)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", t.name, err)
+		}
+		prefix := len(line) - len(strings.TrimLeft(line, "-@+ \t"))
+		ignore := strings.Contains(line[:prefix], "-")
+		line = line[prefix:]
+
+		args := append(append([]string(nil), shell[1:]...), line)
+		if f.positional {
+			args = append(args, t.name)
+		}
+		step, err := Command(shell[0], args, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if ignore {
+			step = step.Or(True())
+		}
+		if recipe == nil {
+			recipe = step
+		} else {
+			recipe = recipe.And(step)
+		}
+	}
+	return recipe, nil
+}
+
+// recipeEnv returns the variables set in the environment of the recipes:
+// the ones of .env with set dotenv-load, then the exported variables
+func (f *TaskFile) recipeEnv() (map[string]string, error) {
+	env := make(map[string]string)
+	if f.dotenv {
+		dotenv, err := readDotenv(f.path(".env"))
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(env, dotenv)
+	}
+	for name, value := range f.vars {
+		if f.exportAll || f.exports[name] {
+			env[name] = value
+		}
+	}
+	return env, nil
+}
+
+// setJust applies a justfile set line. Boolean settings are enabled by their
+// name alone or := true
+func (f *TaskFile) setJust(line string) error {
+	m := justSetting.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("invalid setting %q", line)
+	}
+	name, value := m[1], strings.TrimSpace(m[2])
+	switch name {
+	case "export", "dotenv-load", "positional-arguments":
+		if value != "" && value != "true" && value != "false" {
+			return fmt.Errorf("setting %s: expected true or false, got %s", name, value)
+		}
+		enabled := value != "false"
+		switch name {
+		case "export":
+			f.exportAll = enabled
+		case "dotenv-load":
+			f.dotenv = enabled
+		default:
+			f.positional = enabled
+		}
+	case "shell":
+		shell, err := f.justList(value)
+		if err != nil || len(shell) == 0 {
+			return fmt.Errorf("setting shell: expected a list like [\"bash\", \"-c\"], got %s", value)
+		}
+		f.shell = shell
+	default:
+		return fmt.Errorf("setting %s is not supported", name)
+	}
+	return nil
+}
+
+// justList evaluates a justfile list of values, like ["bash", "-uc"]
+func (f *TaskFile) justList(expr string) ([]string, error) {
+	if !strings.HasPrefix(expr, "[") || !strings.HasSuffix(expr, "]") {
+		return nil, fmt.Errorf("expected a list")
+	}
+	var items []string
+	var quote byte
+	start, inner := 0, expr[1:len(expr)-1]
+	for i := 0; i <= len(inner); i++ {
+		switch {
+		case i < len(inner) && quote != 0:
+			if inner[i] == quote {
+				quote = 0
+			}
+		case i < len(inner) && (inner[i] == '"' || inner[i] == '\''):
+			quote = inner[i]
+		case i == len(inner) || inner[i] == ',':
+			if item := strings.TrimSpace(inner[start:i]); item != "" {
+				value, err := f.justValue(item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, value)
+			}
+			start = i + 1
+		}
+	}
+	return items, nil
+}
+
+// readDotenv reads the KEY=value lines of a .env file. A missing file has no
+// variables, like with just
+func readDotenv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(name)] = value
+	}
+	return vars, nil
+}
+
+// upToDate reports whether the file of the target t exists and is newer than
+// the files of its prerequisites. A phony prerequisite always makes it stale
+func (f *TaskFile) upToDate(t *task) bool {
+	info, err := os.Stat(f.path(t.name))
+	if err != nil {
+		return false
+	}
+	for _, dep := range t.deps {
+		if d, ok := f.tasks[dep]; ok && d.phony {
+			return false
+		}
+		depInfo, err := os.Stat(f.path(dep))
+		if err != nil || depInfo.ModTime().After(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// assignMake records a Makefile variable assignment
+func (f *TaskFile) assignMake(name, op, value string) error {
+	switch op {
+	case "?=":
+		if _, ok := f.vars[name]; ok {
+			return nil
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			return nil
+		}
+	case ":=", "::=":
+		expanded, err := f.expandMake(value, nil, 0)
+		if err != nil {
+			return err
+		}
+		f.vars[name], f.simple[name] = expanded, true
+		return nil
+	case "+=":
+		if old, ok := f.vars[name]; ok {
+			if f.simple[name] {
+				expanded, err := f.expandMake(value, nil, 0)
+				if err != nil {
+					return err
+				}
+				value = expanded
+			}
+			f.vars[name] = strings.TrimSpace(old + " " + value)
+			return nil
+		}
+	}
+	f.vars[name], f.simple[name] = value, false
+	return nil
+}
+
+// expandFields expands the variables of a rule line and splits it into words
+func (f *TaskFile) expandFields(s string) ([]string, error) {
+	expanded, err := f.expandMake(s, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(expanded), nil
+}
+
+// expandRecipe expands the variables of a recipe line of t
+func (f *TaskFile) expandRecipe(t *task, line string) (string, error) {
+	if !f.make {
+		return f.interpolate(line)
+	}
+	return f.expandMake(line, t, 0)
+}
+
+// expandMake expands the make variables of s, with the automatic variables of t
+func (f *TaskFile) expandMake(s string, t *task, depth int) (string, error) {
+	if depth > 32 {
+		return "", fmt.Errorf("recursive variable in %q", s)
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		var name string
+		switch c := s[i]; c {
+		case '$':
+			b.WriteByte('$')
+			continue
+		case '(', '{':
+			closing := byte(')')
+			if c == '{' {
+				closing = '}'
+			}
+			end := strings.IndexByte(s[i:], closing)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference in %q", s)
+			}
+			name = s[i+1 : i+end]
+			i += end
+			if strings.ContainsAny(name, " \t,") {
+				return "", fmt.Errorf("make functions are not supported: %s", name)
+			}
+		default:
+			name = string(c)
+		}
+
+		value, err := f.makeVariable(name, t, depth)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// makeVariable returns the value of the make variable name
+func (f *TaskFile) makeVariable(name string, t *task, depth int) (string, error) {
+	if t != nil {
+		switch name {
+		case "@":
+			return t.name, nil
+		case "<":
+			if len(t.deps) == 0 {
+				return "", nil
+			}
+			return t.deps[0], nil
+		case "^":
+			return strings.Join(t.deps, " "), nil
+		}
+	}
+	value, ok := f.vars[name]
+	if !ok {
+		return os.Getenv(name), nil
+	}
+	if f.simple[name] {
+		return value, nil
+	}
+	return f.expandMake(value, t, depth+1)
+}
+
+// justValue evaluates the right side of a justfile assignment: string
+// literals and variables, joined with +
+func (f *TaskFile) justValue(expr string) (string, error) {
+	var b strings.Builder
+	for _, part := range strings.Split(expr, "+") {
+		part = strings.TrimSpace(part)
+		switch {
+		case len(part) >= 2 && (part[0] == '"' || part[0] == '\'') && part[len(part)-1] == part[0]:
+			b.WriteString(part[1 : len(part)-1])
+		case strings.HasPrefix(part, "`"):
+			return "", fmt.Errorf("backticks are not supported")
+		default:
+			value, ok := f.vars[part]
+			if !ok {
+				return "", fmt.Errorf("unknown variable %q", part)
+			}
+			b.WriteString(value)
+		}
+	}
+	return b.String(), nil
+}
+
+// interpolate replaces the {{variable}} of a justfile recipe line
+func (f *TaskFile) interpolate(line string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(line, "{{")
+		if start < 0 {
+			b.WriteString(line)
+			return b.String(), nil
+		}
+		if strings.HasPrefix(line[start:], "{{{{") {
+			b.WriteString(line[:start] + "{{")
+			line = line[start+4:]
+			continue
+		}
+		end := strings.Index(line[start:], "}}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated interpolation in %q", line)
+		}
+		value, err := f.justValue(line[start+2 : start+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(line[:start] + value)
+		line = line[start+end+2:]
+	}
+}
+
+// logicalLine is a line of a task file with its continuations joined
+type logicalLine struct {
+	number int // line number of its first physical line
+	text   string
+}
+
+// readLogicalLines reads r, joining lines ending with a backslash
+func readLogicalLines(r io.Reader) ([]logicalLine, error) {
+	var lines []logicalLine
+	scanner := bufio.NewScanner(r)
+	number := 0
+	var pending *logicalLine
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if pending != nil {
+			pending.text += " " + strings.TrimLeft(text, " \t")
+		} else {
+			pending = &logicalLine{number: number, text: text}
+		}
+		if strings.HasSuffix(pending.text, "\\") {
+			pending.text = strings.TrimSuffix(pending.text, "\\")
+			continue
+		}
+		lines = append(lines, *pending)
+		pending = nil
+	}
+	if pending != nil {
+		lines = append(lines, *pending)
+	}
+	return lines, scanner.Err()
+}
+
+// stripComment removes a # comment from a line that is not a recipe line
+func stripComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// isMakeDirective reports whether word starts a make directive
+func isMakeDirective(word string) bool {
+	switch word {
+	case "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif", "include", "-include", "sinclude",
+		"define", "endef", "export", "unexport", "override", "vpath":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMakefile = `# Build the greeting
+NAME = world
+GREETING := hello $(NAME)
+OUT ?= out.txt
+
+.PHONY: all clean log
+
+all: $(OUT) log
+	@echo done >> log.txt
+
+$(OUT): input.txt
+	echo "$(GREETING) from $@ using $<" > $@
+
+log:
+	-false
+	echo log >> log.txt
+
+clean: ; rm -f $(OUT) log.txt
+`
+
+func TestParseMakefile(t *testing.T) {
+	// Test: prerequisites run first, once, and file targets only when stale
+	ctx := context.Background()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ParseMakefile(strings.NewReader(testMakefile))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if f.Default() != "all" {
+		t.Errorf("expected default target all, got %q", f.Default())
+	}
+	if targets := strings.Join(f.Targets(), " "); targets != "all out.txt log clean" {
+		t.Errorf("unexpected targets %q", targets)
+	}
+
+	exec, err := f.Dir(dir).Executable("all")
+	if err != nil {
+		t.Fatalf("executable failed: %v", err)
+	}
+	for range 2 {
+		if _, err := exec.Run(ctx); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+	}
+
+	out, _ := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if string(out) != "hello world from out.txt using input.txt\n" {
+		t.Errorf("unexpected out.txt %q", out)
+	}
+	// The phony targets ran twice, out.txt was up to date the second time
+	log, _ := os.ReadFile(filepath.Join(dir, "log.txt"))
+	if string(log) != "log\ndone\nlog\ndone\n" {
+		t.Errorf("unexpected log.txt %q", log)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "out.txt"))
+	if err := os.WriteFile(filepath.Join(dir, "out.txt"), []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(dir, "out.txt"), info.ModTime(), info.ModTime())
+	os.Chtimes(filepath.Join(dir, "input.txt"), info.ModTime().Add(1e9), info.ModTime().Add(1e9))
+	exec.Run(ctx)
+	if out, _ := os.ReadFile(filepath.Join(dir, "out.txt")); string(out) == "stale" {
+		t.Error("expected out.txt to be rebuilt after input.txt changed")
+	}
+}
+
+func TestParseJustfile(t *testing.T) {
+	// Test: variables, exports, aliases and dependencies of a justfile
+	ctx := context.Background()
+	justfile := `
+name := "world"
+export GREETING := "hello " + name
+
+alias b := build
+
+# Build it
+build: setup
+    echo {{name}} > build.txt
+    @echo "$GREETING" >> build.txt
+
+[private]
+setup:
+    -false
+    echo {{{{raw}} > setup.txt
+`
+	f, err := ParseJustfile(strings.NewReader(justfile))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	dir := t.TempDir()
+	exec, err := f.Dir(dir).Executable("b")
+	if err != nil {
+		t.Fatalf("executable failed: %v", err)
+	}
+	if _, err := exec.Run(ctx); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	build, _ := os.ReadFile(filepath.Join(dir, "build.txt"))
+	if string(build) != "world\nhello world\n" {
+		t.Errorf("unexpected build.txt %q", build)
+	}
+	setup, _ := os.ReadFile(filepath.Join(dir, "setup.txt"))
+	if string(setup) != "{{raw}}\n" {
+		t.Errorf("unexpected setup.txt %q", setup)
+	}
+}
+
+func TestJustfileSettings(t *testing.T) {
+	// Test: export, shell, dotenv-load and positional-arguments change how
+	// recipes run
+	justfile := `
+name := "custom"
+
+set export
+set dotenv-load := true
+set positional-arguments
+set shell := ["env", 'SHELL_NAME=' + name, "sh", "-c"]
+
+show:
+    echo "$name $FROM_DOTENV $SHELL_NAME $0" > show.txt
+`
+	f, err := ParseJustfile(strings.NewReader(justfile))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("# local\nexport FROM_DOTENV='dot env'\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exec, err := f.Dir(dir).Executable("show")
+	if err != nil {
+		t.Fatalf("executable failed: %v", err)
+	}
+	if _, err := exec.Run(context.Background()); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	show, _ := os.ReadFile(filepath.Join(dir, "show.txt"))
+	if string(show) != "custom dot env custom show\n" {
+		t.Errorf("unexpected show.txt %q", show)
+	}
+
+	// Test: without .env, dotenv-load sets nothing
+	if _, err := f.Dir(t.TempDir()).Executable("show"); err != nil {
+		t.Errorf("expected a missing .env to be ignored, got %v", err)
+	}
+}
+
+func TestTaskFileErrors(t *testing.T) {
+	// Test: unsupported syntax and broken dependency graphs are reported
+	tests := []struct {
+		name   string
+		parse  func(string) (*TaskFile, error)
+		source string
+		target string
+		err    string
+	}{
+		{"pattern rule", makefile, "%.o: %.c\n\tcc $<\n", "", "pattern rules"},
+		{"conditional", makefile, "ifeq ($(A),1)\nendif\n", "", "ifeq is not supported"},
+		{"function", makefile, "all:\n\techo $(shell date)\n", "all", "functions are not supported"},
+		{"cycle", makefile, "a: b\nb: a\n", "a", "dependency cycle: a -> b -> a"},
+		{"missing target", makefile, "a: missing\n", "a", `no rule to make target "missing"`},
+		{"recipe parameters", justfile, "build target:\n    echo {{target}}\n", "", "parameters are not supported"},
+		{"backticks", justfile, "v := `date`\n", "", "backticks"},
+		{"unknown recipe", justfile, "a:\n    true\n", "b", `no rule to make target "b"`},
+		{"unsupported setting", justfile, "set tempdir := \"/tmp\"\n", "", "setting tempdir is not supported"},
+		{"boolean setting", justfile, "set export := yes\n", "", "setting export: expected true or false"},
+		{"shell setting", justfile, "set shell := \"bash\"\n", "", "setting shell: expected a list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := tt.parse(tt.source)
+			if err == nil && tt.target != "" {
+				_, err = f.Executable(tt.target)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func makefile(source string) (*TaskFile, error) {
+	return ParseMakefile(strings.NewReader(source))
+}
+
+func justfile(source string) (*TaskFile, error) {
+	return ParseJustfile(strings.NewReader(source))
+}
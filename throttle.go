@@ -0,0 +1,61 @@
+package subprocess
+
+import (
+	"context"
+	"time"
+)
+
+// throttlePollInterval is how often the CPU pressure is checked while a start is delayed
+const throttlePollInterval = 250 * time.Millisecond
+
+// LoadThrottle keeps interactive hosts responsive while batch processes run
+type LoadThrottle struct {
+	MaxPressure float64       // CPU pressure in percent above which the host is considered busy
+	MaxDelay    time.Duration // how long to delay the start while the host is busy
+	Nice        int           // niceness of processes started on a busy host, 0 for 10
+}
+
+// WithLoadThrottle delays the start of the process while the CPU pressure is
+// above throttle.MaxPressure, for at most throttle.MaxDelay, and lowers its
+// priority when the host is still busy once it starts. The pressure is the
+// "some avg10" value of /proc/pressure/cpu, or the load average per CPU in
+// percent when PSI is unavailable. Only applied on Linux
+func WithLoadThrottle(throttle LoadThrottle) Option {
+	return func(o *Options) {
+		o.LoadThrottle = &throttle
+	}
+}
+
+// readCPUPressure returns the CPU pressure of the host, replaced in tests
+var readCPUPressure = cpuPressure
+
+// wait delays until the host is not busy, MaxDelay passed or ctx is done, and
+// reports whether the host is still busy
+func (t *LoadThrottle) wait(ctx context.Context) (bool, error) {
+	deadline := time.Now().Add(t.MaxDelay)
+	for {
+		pressure, ok := readCPUPressure()
+		if !ok || pressure <= t.MaxPressure {
+			return false, nil
+		}
+		if !time.Now().Before(deadline) {
+			return true, nil
+		}
+
+		timer := time.NewTimer(min(throttlePollInterval, time.Until(deadline)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return true, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// nice returns the niceness of processes started on a busy host
+func (t *LoadThrottle) nice() int {
+	if t.Nice == 0 {
+		return 10
+	}
+	return t.Nice
+}
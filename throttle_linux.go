@@ -0,0 +1,39 @@
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cpuPressure returns the CPU pressure of the host in percent
+func cpuPressure() (float64, bool) {
+	if data, err := os.ReadFile("/proc/pressure/cpu"); err == nil {
+		// some avg10=1.23 avg60=0.50 avg300=0.10 total=12345
+		for _, field := range strings.Fields(string(data)) {
+			if value, ok := strings.CutPrefix(field, "avg10="); ok {
+				if pressure, err := strconv.ParseFloat(value, 64); err == nil {
+					return pressure, true
+				}
+			}
+		}
+	}
+
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	var load float64
+	if _, err := fmt.Sscan(string(data), &load); err != nil {
+		return 0, false
+	}
+	return load / float64(runtime.NumCPU()) * 100, true
+}
+
+// setNice sets the niceness of the process pid
+func setNice(pid, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
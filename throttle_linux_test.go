@@ -0,0 +1,44 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoadThrottle(t *testing.T) {
+	// Test: a busy host delays the start up to MaxDelay, then lowers the priority
+	defer func() { readCPUPressure = cpuPressure }()
+	throttle := LoadThrottle{MaxPressure: 50, MaxDelay: 300 * time.Millisecond, Nice: 7}
+	plain, _ := NewExecutable("nice")
+	baseline, _ := plain.Run(context.Background())
+
+	tests := []struct {
+		name     string
+		pressure float64
+		minDelay time.Duration
+		expected string
+	}{
+		{"idle host", 10, 0, string(baseline.Stdout)},
+		{"busy host", 90, 300 * time.Millisecond, "7\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readCPUPressure = func() (float64, bool) { return tt.pressure, true }
+			exec, _ := Command("sh", []string{"-c", "sleep 0.1; nice"}, WithLoadThrottle(throttle))
+
+			start := time.Now()
+			result, err := exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("expected start to be delayed by %v, took %v", tt.minDelay, elapsed)
+			}
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("expected niceness %q, got %q", tt.expected, result.Stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package subprocess
+
+func cpuPressure() (float64, bool) {
+	return 0, false
+}
+
+func setNice(pid, nice int) error {
+	return nil
+}
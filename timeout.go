@@ -0,0 +1,48 @@
+package subprocess
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeoutError reports a process that was stopped by WithTimeout
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: timed out after %v", e.Command, e.Timeout)
+}
+
+// WithTimeout stops the process once it has run for d, independently of the
+// context of the run. Wait and the Result of the stage return a *TimeoutError,
+// and the rest of a pipeline continues by the usual && and || rules
+// The process is killed, or sent the signal of WithCancelSignal first
+func WithTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// enforceTimeout stops the process once it has run for ops.Timeout
+func (p *ProcessRunner) enforceTimeout(ops *Options) {
+	timer := time.NewTimer(ops.Timeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+		return
+	case <-timer.C:
+	}
+
+	reason := &TimeoutError{Command: ops.Command, Timeout: ops.Timeout}
+	if ops.CancelSignal == nil {
+		p.kill(reason)
+		return
+	}
+	p.mu.Lock()
+	p.killedBy = reason
+	p.mu.Unlock()
+	// Signals the process through cmd.Cancel, cmd.WaitDelay kills it if needed
+	p.cancel()
+}
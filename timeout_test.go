@@ -0,0 +1,37 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	// Test: a stage that times out fails on its own and || recovers from it
+	ctx := context.Background()
+	slow, _ := Command("sleep", []string{"10"}, WithTimeout(100*time.Millisecond))
+	fast, _ := Command("echo", []string{"fast"}, WithTimeout(5*time.Second))
+	recovered, _ := NewExecutable("echo", "recovered")
+
+	start := time.Now()
+	result, err := fast.And(slow).Or(recovered).Run(ctx)
+	if err != nil {
+		t.Fatalf("expected || to recover, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the slow stage to time out, took %v", elapsed)
+	}
+	if string(result.Stdout) != "recovered\n" {
+		t.Errorf("expected recovered, got %q", result.Stdout)
+	}
+
+	and := result.Children[0]
+	if and.Children[0].Error != nil {
+		t.Errorf("expected the fast stage to succeed, got %v", and.Children[0].Error)
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(and.Children[1].Error, &timeoutErr) || timeoutErr.Timeout != 100*time.Millisecond {
+		t.Errorf("expected a TimeoutError, got %v", and.Children[1].Error)
+	}
+}
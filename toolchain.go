@@ -0,0 +1,275 @@
+package subprocess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Toolchain maps logical tool names to concrete binaries and adds directories
+// searched before PATH, so pipelines can be made hermetic without changing the
+// PATH of the program. A Toolchain is immutable, builder methods return a copy
+type Toolchain struct {
+	tools    map[string]string
+	sources  map[string]ToolSource
+	path     []string
+	cacheDir string
+}
+
+// ToolSource is a binary downloaded on first use and verified by its checksum
+type ToolSource struct {
+	URL    string // location of the binary itself, archives are not unpacked
+	SHA256 string // hex encoded checksum of the binary
+}
+
+// NewToolchain returns an empty toolchain that resolves commands like PATH
+func NewToolchain() *Toolchain {
+	return &Toolchain{tools: make(map[string]string), sources: make(map[string]ToolSource)}
+}
+
+// Tool maps the command name to the binary at path, e.g. "go" to a vendored SDK
+func (t *Toolchain) Tool(name, path string) *Toolchain {
+	clone := t.clone()
+	clone.tools[name] = path
+	return clone
+}
+
+// Prepend adds directories searched for commands before PATH
+// They are also prepended to the PATH of the process, so tools it starts
+// resolve the same way
+func (t *Toolchain) Prepend(dirs ...string) *Toolchain {
+	clone := t.clone()
+	clone.path = append(slices.Clone(dirs), clone.path...)
+	return clone
+}
+
+// Download makes the command name run the binary at url, which is downloaded
+// before the first run, verified against sha256 and cached, e.g. a pinned yq v4
+// release. Cached binaries are shared by every toolchain and program using the
+// same cache directory
+func (t *Toolchain) Download(name, url, sha256 string) *Toolchain {
+	clone := t.clone()
+	clone.sources[name] = ToolSource{URL: url, SHA256: strings.ToLower(sha256)}
+	return clone
+}
+
+// CacheDir sets where downloaded tools are stored
+// The default is the subprocess/tools directory in os.UserCacheDir, and runs
+// of downloaded tools fail when there is none
+func (t *Toolchain) CacheDir(dir string) *Toolchain {
+	clone := t.clone()
+	clone.cacheDir = dir
+	return clone
+}
+
+func (t *Toolchain) clone() *Toolchain {
+	clone := *t
+	clone.tools = maps.Clone(t.tools)
+	clone.sources = maps.Clone(t.sources)
+	clone.path = slices.Clone(t.path)
+	return &clone
+}
+
+// Resolve returns the binary run for the command name
+// Mapped tools win, then the toolchain directories are searched. Paths and
+// names found nowhere are returned unchanged and looked up in PATH
+func (t *Toolchain) Resolve(name string) string {
+	if path, ok := t.tools[name]; ok {
+		return path
+	}
+	if source, ok := t.sources[name]; ok {
+		if path, err := t.cachePath(name, source); err == nil {
+			return path
+		}
+		// Runs report the error when fetching the tool
+		return name
+	}
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") {
+		return name
+	}
+	for _, dir := range t.path {
+		candidate := filepath.Join(dir, name)
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+// Fetch downloads the tools with the given names that are not cached yet,
+// or every declared download when no name is given
+// Runs fetch their command on demand, Fetch makes it happen up front
+func (t *Toolchain) Fetch(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(t.sources))
+	}
+	for _, name := range names {
+		if err := t.fetch(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch downloads the tool name unless it is cached or not a download
+func (t *Toolchain) fetch(ctx context.Context, name string) error {
+	source, ok := t.sources[name]
+	if !ok {
+		return nil
+	}
+	path, err := t.cachePath(name, source)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", name, err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("fetch %s: %w", name, err)
+	}
+	if err := download(ctx, source, path); err != nil {
+		return fmt.Errorf("fetch %s: %w", name, err)
+	}
+	return nil
+}
+
+// cachePath returns where the binary of source is cached
+// The path contains the checksum, so only verified content is ever found there
+// There is no fallback to a shared directory such as os.TempDir, where other
+// users could plant a binary under a known checksum
+func (t *Toolchain) cachePath(name string, source ToolSource) (string, error) {
+	if !isSHA256(source.SHA256) {
+		return "", fmt.Errorf("invalid SHA-256 checksum %q: want 64 hex characters", source.SHA256)
+	}
+	dir := t.cacheDir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("no cache directory for downloaded tools, set one with CacheDir: %w", err)
+		}
+		dir = filepath.Join(userDir, "subprocess", "tools")
+	}
+	return filepath.Join(dir, source.SHA256, name), nil
+}
+
+// isSHA256 reports whether sum is a hex encoded SHA-256 checksum
+func isSHA256(sum string) bool {
+	if len(sum) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// download stores the binary of source at path once its checksum matches
+// It is written to a temporary file first, so concurrent downloads and
+// interrupted ones never leave a partial binary at path
+func download(ctx context.Context, source ToolSource, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s: %s", source.URL, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download %s: %w", source.URL, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != source.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", source.URL, sum, source.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// env returns the PATH override for a process whose environment is base
+func (t *Toolchain) env(base []string) []string {
+	if len(t.path) == 0 {
+		return nil
+	}
+	dirs := slices.Clone(t.path)
+	for _, kv := range base {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok && value != "" {
+			dirs = append(dirs, value)
+		}
+	}
+	return []string{"PATH=" + strings.Join(dirs, string(os.PathListSeparator))}
+}
+
+// lookPath finds name like exec.LookPath, but searches the PATH of env, the
+// environment of the process, nil standing for the one of the program
+func lookPath(name string, env []string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") {
+		return exec.LookPath(name)
+	}
+	path := os.Getenv("PATH")
+	if env != nil {
+		path = ""
+		for _, kv := range env {
+			if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+				path = value
+			}
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		// Like exec.LookPath, commands are not run from the working directory
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		if found, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return found, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// WithToolchain resolves the command and the PATH of the process with t
+// Defaults.Toolchain is used when this option is not given
+func WithToolchain(t *Toolchain) Option {
+	return func(o *Options) {
+		o.Toolchain = t
+	}
+}
+
+// fetchCommand downloads the command of ops if its toolchain declares it
+func fetchCommand(ctx context.Context, ops *Options) error {
+	if ops.Toolchain == nil {
+		return nil
+	}
+	return ops.Toolchain.fetch(ctx, ops.Command)
+}
+
+// resolveCommand returns the binary run for the command of ops
+func resolveCommand(ops *Options) string {
+	if ops.Toolchain == nil {
+		return ops.Command
+	}
+	return ops.Toolchain.Resolve(ops.Command)
+}
@@ -0,0 +1,186 @@
+package subprocess
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestToolchain(t *testing.T) {
+	// Test: commands resolve through the toolchain without changing PATH
+	ctx := context.Background()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho vendored\n"
+	if err := os.WriteFile(filepath.Join(dir, "vendored-tool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tc := NewToolchain().Prepend(dir).Tool("greet", "/bin/echo")
+
+	tests := []struct {
+		name     string
+		cmd      string
+		args     []string
+		expected string
+	}{
+		{"directory", "vendored-tool", nil, "vendored\n"},
+		{"mapped tool", "greet", []string{"hi"}, "hi\n"},
+		{"PATH of the process", "sh", []string{"-c", "vendored-tool"}, "vendored\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := Command(tt.cmd, tt.args, WithToolchain(tc))
+			if err := exec.Validate(); err != nil {
+				t.Fatalf("validate failed: %v", err)
+			}
+			result, err := exec.Run(ctx)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if string(result.Stdout) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Stdout)
+			}
+		})
+	}
+
+	if tc.Resolve("vendored-tool") == "vendored-tool" {
+		t.Error("expected the toolchain directory to be searched")
+	}
+	if NewToolchain().Resolve("vendored-tool") != "vendored-tool" {
+		t.Error("expected an empty toolchain to leave names unchanged")
+	}
+}
+
+func TestToolchainProcessPath(t *testing.T) {
+	// Test: commands are validated and run from the PATH the process gets,
+	// not from the PATH of the program
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho private\n"
+	if err := os.WriteFile(filepath.Join(dir, "private-tool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		valid bool
+	}{
+		{"PATH of the program", nil, false},
+		{"WithEnv", []Option{WithEnv("PATH=" + dir)}, true},
+		{"WithEnvOverrides", []Option{WithEnvOverrides(map[string]string{"PATH": dir})}, true},
+		{"PATH without the tool", []Option{WithEnv("PATH=/nonexistent")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _ := Command("private-tool", nil, tt.opts...)
+			err := exec.Validate()
+			if tt.valid != (err == nil) {
+				t.Fatalf("expected valid %v, got %v", tt.valid, err)
+			}
+			if !tt.valid {
+				return
+			}
+			result, err := exec.Run(context.Background())
+			if err != nil || string(result.Stdout) != "private\n" {
+				t.Errorf("expected the tool to run, got %q, %v", result.Stdout, err)
+			}
+		})
+	}
+}
+
+func TestToolchainDownload(t *testing.T) {
+	// Test: a declared tool is downloaded once, verified and cached
+	ctx := context.Background()
+	script := []byte("#!/bin/sh\necho downloaded \"$@\"\n")
+	sum := sha256.Sum256(script)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write(script)
+	}))
+	defer server.Close()
+
+	tc := NewToolchain().CacheDir(t.TempDir()).Download("fetched", server.URL, hex.EncodeToString(sum[:]))
+	exec, _ := Command("fetched", []string{"v4"}, WithToolchain(tc))
+	if err := exec.Validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	for range 2 {
+		result, err := exec.Run(ctx)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		if string(result.Stdout) != "downloaded v4\n" {
+			t.Errorf("unexpected output: %q", result.Stdout)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 download, got %d", requests.Load())
+	}
+
+	// A checksum mismatch fails the run and caches nothing
+	cache := t.TempDir()
+	bad := NewToolchain().CacheDir(cache).Download("fetched", server.URL, strings.Repeat("0", 64))
+	if err := bad.Fetch(ctx); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(bad.Resolve("fetched")); err == nil {
+		t.Error("expected no cached binary after a checksum mismatch")
+	}
+	entries, _ := os.ReadDir(filepath.Join(cache, strings.Repeat("0", 64)))
+	if len(entries) != 0 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+}
+
+func TestToolchainDownloadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		cacheDir string
+		sha256   string
+		want     string
+	}{
+		{
+			// Test: a checksum that is not 64 hex characters is never used as a path
+			name:     "path in checksum",
+			cacheDir: t.TempDir(),
+			sha256:   "../../bin",
+			want:     `invalid SHA-256 checksum "../../bin"`,
+		},
+		{
+			// Test: a truncated checksum is rejected
+			name:     "short checksum",
+			cacheDir: t.TempDir(),
+			sha256:   strings.Repeat("a", 63),
+			want:     "want 64 hex characters",
+		},
+		{
+			// Test: without a user cache directory the download fails instead of using a shared one
+			name:   "no cache directory",
+			sha256: strings.Repeat("0", 64),
+			want:   "no cache directory for downloaded tools",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", "")
+			t.Setenv("HOME", "")
+			tc := NewToolchain().CacheDir(tt.cacheDir).Download("fetched", "http://127.0.0.1:0/tool", tt.sha256)
+			if err := tc.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+			exec, _ := Command("fetched", nil, WithToolchain(tc))
+			if err := exec.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected validation error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package subprocess
+
+import (
+	"os/exec"
+	"slices"
+	"sync"
+)
+
+// WithFileTracing records the files opened by the process and its descendants
+// in Result.OpenedFiles, for dependency discovery. Every successful open is
+// intercepted with ptrace, so files opened and closed right away are recorded
+// too. Tracing stops the process at each of its system calls, which slows down
+// syscall-heavy processes
+// Only supported on Linux on amd64 and arm64, and where ptrace is allowed;
+// elsewhere the process fails to start instead of running untraced
+func WithFileTracing() Option {
+	return func(o *Options) {
+		o.TraceFiles = true
+	}
+}
+
+// fileTracer records the files opened by a traced process tree
+type fileTracer struct {
+	exited chan struct{} // closed once the traced process exited, before it is reaped
+	reaped chan struct{} // closed by the runner once Wait reaped the process
+
+	mu    sync.Mutex
+	files map[string]struct{}
+}
+
+func newFileTracer() *fileTracer {
+	return &fileTracer{
+		exited: make(chan struct{}),
+		reaped: make(chan struct{}),
+		files:  make(map[string]struct{}),
+	}
+}
+
+// record adds path to the opened files
+func (t *fileTracer) record(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[path] = struct{}{}
+}
+
+// wait reaps the traced process with cmd.Wait once the tracer saw it exit
+// The tracer must not be running a ptrace request while the process is reaped
+func (t *fileTracer) wait(cmd *exec.Cmd) error {
+	<-t.exited
+	defer close(t.reaped)
+	return cmd.Wait()
+}
+
+// OpenedFiles returns the sorted paths of the files opened by the process and
+// its descendants, only recorded with WithFileTracing
+func (p *ProcessRunner) OpenedFiles() []string {
+	if p.tracer == nil {
+		return nil
+	}
+	p.tracer.mu.Lock()
+	defer p.tracer.mu.Unlock()
+
+	if len(p.tracer.files) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(p.tracer.files))
+	for path := range p.tracer.files {
+		files = append(files, path)
+	}
+	slices.Sort(files)
+	return files
+}
@@ -0,0 +1,197 @@
+//go:build linux && (amd64 || arm64)
+
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ptraceExitKill = 0x100000 // PTRACE_O_EXITKILL, kill the tracees if the tracer thread exits
+	sysOpenat2     = 437      // openat2, the same number on every architecture
+	cldDumped      = 3        // CLD_DUMPED, the last si_code of an exited child
+)
+
+// checkTracingSupported reports whether file tracing is available
+func checkTracingSupported() error {
+	return nil
+}
+
+// startTraced starts cmd with start under ptrace and records every file the
+// process and its descendants open until the whole tree exited
+func startTraced(cmd *exec.Cmd, start func() error) (*fileTracer, error) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	t := newFileTracer()
+	started := make(chan error, 1)
+	go func() {
+		// Every ptrace request must come from the thread that started the
+		// process. The thread is never unlocked, it ends with the goroutine
+		runtime.LockOSThread()
+		if err := start(); err != nil {
+			started <- err
+			return
+		}
+		pid := cmd.Process.Pid
+		if err := attach(pid); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			started <- fmt.Errorf("file tracing: %w", err)
+			return
+		}
+		started <- nil
+		t.trace(pid)
+	}()
+	if err := <-started; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// attach waits for the stop of pid after its exec and makes it report its
+// system calls and the ones of the processes and threads it creates
+func attach(pid int) error {
+	var ws syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &ws, syscall.WALL, nil); err != nil {
+		return err
+	}
+	if !ws.Stopped() {
+		return fmt.Errorf("process exited before it could be traced")
+	}
+	options := syscall.PTRACE_O_TRACESYSGOOD | syscall.PTRACE_O_TRACEFORK | syscall.PTRACE_O_TRACEVFORK |
+		syscall.PTRACE_O_TRACECLONE | syscall.PTRACE_O_TRACEEXEC | ptraceExitKill
+	if err := syscall.PtraceSetOptions(pid, options); err != nil {
+		return err
+	}
+	return syscall.PtraceSyscall(pid, 0)
+}
+
+// tracee is the state of one traced thread
+type tracee struct {
+	inSyscall bool // stopped between entering and leaving a system call
+	fresh     bool // created by a traced fork or clone, its first SIGSTOP is not delivered
+}
+
+// trace runs the tracees until all of them exited. pid is the traced process
+// itself, which is left for the runner to reap
+func (t *fileTracer) trace(pid int) {
+	defer func() {
+		select {
+		case <-t.exited:
+		default:
+			close(t.exited)
+		}
+	}()
+
+	tracees := map[int]*tracee{pid: {}}
+	for len(tracees) > 0 {
+		tid, exited, err := waitTracee()
+		if err != nil {
+			return
+		}
+		if exited && tid == pid {
+			// Reaped by cmd.Wait, so the exit status reaches the runner
+			delete(tracees, tid)
+			close(t.exited)
+			<-t.reaped
+			continue
+		}
+
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &ws, syscall.WALL|syscall.WNOTHREAD, nil); err != nil || !ws.Stopped() {
+			delete(tracees, tid)
+			continue
+		}
+		state := tracees[tid]
+		if state == nil {
+			// Stopped before its parent reported creating it
+			state = &tracee{fresh: true}
+			tracees[tid] = state
+		}
+
+		sig := ws.StopSignal()
+		switch {
+		case sig == syscall.SIGTRAP|0x80:
+			if state.inSyscall = !state.inSyscall; !state.inSyscall {
+				t.recordOpen(tid)
+			}
+			sig = 0
+		case ws.TrapCause() > 0:
+			switch ws.TrapCause() {
+			case syscall.PTRACE_EVENT_FORK, syscall.PTRACE_EVENT_VFORK, syscall.PTRACE_EVENT_CLONE:
+				if child, err := syscall.PtraceGetEventMsg(tid); err == nil && tracees[int(child)] == nil {
+					tracees[int(child)] = &tracee{fresh: true}
+				}
+			case syscall.PTRACE_EVENT_EXEC:
+				// A thread calling exec takes over the id of the thread group leader
+				if former, err := syscall.PtraceGetEventMsg(tid); err == nil && int(former) != tid {
+					delete(tracees, int(former))
+				}
+			}
+			sig = 0
+		case sig == syscall.SIGSTOP && state.fresh:
+			state.fresh = false
+			sig = 0
+		}
+		syscall.PtraceSyscall(tid, int(sig))
+	}
+}
+
+// recordOpen records the file opened by the system call tid is leaving, if
+// it is a successful open
+// Pipes, sockets and files under /dev and /proc are left out
+func (t *fileTracer) recordOpen(tid int) {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(tid, &regs); err != nil {
+		return
+	}
+	nr, fd := syscallResult(&regs)
+	if !openSyscalls[nr] || fd < 0 {
+		return
+	}
+
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%d", tid, fd))
+	if err != nil || !strings.HasPrefix(target, "/") ||
+		strings.HasPrefix(target, "/dev/") || strings.HasPrefix(target, "/proc/") {
+		return
+	}
+	t.record(target)
+}
+
+// siginfo is the part of siginfo_t filled in for SIGCHLD by waitid
+type siginfo struct {
+	signo  int32
+	errno  int32
+	code   int32
+	_      int32
+	pid    int32
+	uid    uint32
+	status int32
+	_      [100]byte
+}
+
+// waitTracee waits for a tracee of the calling thread to stop or exit without
+// consuming the event, and returns its id and whether it exited
+func waitTracee() (int, bool, error) {
+	var info siginfo
+	options := syscall.WEXITED | syscall.WSTOPPED | syscall.WNOWAIT | syscall.WALL | syscall.WNOTHREAD
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_WAITID, 0, 0, uintptr(unsafe.Pointer(&info)), uintptr(options), 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, false, errno
+		}
+		return int(info.pid), info.code <= cldDumped, nil
+	}
+}
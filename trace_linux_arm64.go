@@ -0,0 +1,15 @@
+package subprocess
+
+import "syscall"
+
+// openSyscalls are the system calls returning a new file descriptor for a path
+var openSyscalls = map[uint64]bool{
+	syscall.SYS_OPENAT: true,
+	sysOpenat2:         true,
+}
+
+// syscallResult returns the number and the result of the system call a
+// tracee is leaving
+func syscallResult(regs *syscall.PtraceRegs) (uint64, int64) {
+	return regs.Regs[8], int64(regs.Regs[0])
+}
@@ -0,0 +1,72 @@
+package subprocess
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileTracing(t *testing.T) {
+	// Test: files opened by the process and its descendants are recorded
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	child := filepath.Join(dir, "child.txt")
+	os.WriteFile(input, []byte("data"), 0644)
+	os.WriteFile(child, []byte("data"), 0644)
+
+	script := "exec 3< " + input + "; sleep 0.2 < " + child
+	traced, _ := Command("sh", []string{"-c", script}, WithFileTracing())
+
+	result, err := traced.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, path := range []string{input, child} {
+		if !slices.Contains(result.OpenedFiles, path) {
+			t.Errorf("expected %s in opened files, got %v", path, result.OpenedFiles)
+		}
+	}
+
+	// Without tracing nothing is recorded
+	plain, _ := NewExecutable("sh", "-c", script)
+	result, _ = plain.Run(context.Background())
+	if result.OpenedFiles != nil {
+		t.Errorf("expected no opened files, got %v", result.OpenedFiles)
+	}
+}
+
+func TestFileTracingShortLived(t *testing.T) {
+	// Test: files opened and closed right away by the process and its children are recorded
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	output := filepath.Join(dir, "output.txt")
+	os.WriteFile(input, []byte("data"), 0644)
+
+	traced, _ := Command("sh", []string{"-c", "cat " + input + "; : > " + output}, WithFileTracing())
+	result, err := traced.Run(context.Background())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if string(result.Stdout) != "data" {
+		t.Errorf("unexpected output: %q", result.Stdout)
+	}
+	for _, path := range []string{input, output} {
+		if !slices.Contains(result.OpenedFiles, path) {
+			t.Errorf("expected %s in opened files, got %v", path, result.OpenedFiles)
+		}
+	}
+	for _, path := range result.OpenedFiles {
+		if strings.HasPrefix(path, "/dev/") || strings.HasPrefix(path, "/proc/") {
+			t.Errorf("unexpected opened file %s", path)
+		}
+	}
+
+	// Exit codes and signals of a traced process are reported as usual
+	failing, _ := Command("sh", []string{"-c", "kill -TERM $$"}, WithFileTracing())
+	if _, err := failing.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "terminated") {
+		t.Errorf("expected the process to be terminated, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux || !(amd64 || arm64)
+
+package subprocess
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// checkTracingSupported reports whether file tracing is available
+func checkTracingSupported() error {
+	return errors.New("WithFileTracing is only supported on Linux on amd64 and arm64")
+}
+
+func startTraced(cmd *exec.Cmd, start func() error) (*fileTracer, error) {
+	return nil, checkTracingSupported()
+}
@@ -0,0 +1,73 @@
+package subprocess
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithTranscript writes an interleaved log of everything written to the stdin
+// of the process and read from its stdout and stderr to w, for debugging
+// protocol interactions with child tools. Each chunk is one line holding the
+// seconds since the start, the stream name and the quoted data:
+//
+//	0.000153 stdin  "PING\n"
+//	0.002371 stdout "PONG\n"
+//
+// Output is logged when the engine reads it, so chunks show when data was consumed
+func WithTranscript(w io.Writer) Option {
+	return func(o *Options) {
+		o.Transcript = w
+	}
+}
+
+// transcript serializes the chunks of one process run to a writer
+type transcript struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+}
+
+func newTranscript(w io.Writer) *transcript {
+	return &transcript{w: w, start: time.Now()}
+}
+
+// record logs a chunk of data seen on stream
+func (t *transcript) record(stream string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%.6f %-6s %q\n", time.Since(t.start).Seconds(), stream, data)
+}
+
+// transcriptReader records what is read from r on stream
+type transcriptReader struct {
+	r          io.Reader
+	stream     string
+	transcript *transcript
+}
+
+func (t *transcriptReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.transcript.record(t.stream, p[:n])
+	return n, err
+}
+
+// transcriptWriter records what is written to w as stdin
+type transcriptWriter struct {
+	w          io.WriteCloser
+	transcript *transcript
+}
+
+func (t *transcriptWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.transcript.record("stdin", p[:n])
+	return n, err
+}
+
+func (t *transcriptWriter) Close() error {
+	return t.w.Close()
+}
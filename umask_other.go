@@ -0,0 +1,18 @@
+//go:build !unix
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// startWithUmask starts cmd with the file mode creation mask umask, or with
+// the one of the program when it is nil
+func startWithUmask(cmd *exec.Cmd, umask *os.FileMode) error {
+	if umask != nil {
+		return errors.New("WithUmask is only supported on Unix")
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package subprocess
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes starts that change the umask of the program
+var umaskMu sync.Mutex
+
+// startWithUmask starts cmd with the file mode creation mask umask, or with
+// the one of the program when it is nil. The umask is process wide, so it is
+// only changed for the moment the child is forked
+func startWithUmask(cmd *exec.Cmd, umask *os.FileMode) error {
+	if umask == nil {
+		return cmd.Start()
+	}
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(int(*umask))
+	defer syscall.Umask(old)
+	return cmd.Start()
+}
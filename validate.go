@@ -0,0 +1,224 @@
+package subprocess
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem Validate found in an execution tree
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid pipeline: " + strings.Join(e.Problems, "; ")
+}
+
+// validate walks the tree of exec without running anything and returns a
+// *ValidationError with all problems found, or nil
+func validate(exec Executable) error {
+	v := &validator{}
+	v.walk(exec, "")
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// validator collects the problems found while walking a tree
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	if path != "" {
+		format = path + ": " + format
+	}
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// walk validates exec, found at path in the tree
+func (v *validator) walk(e Executable, path string) {
+	switch x := e.(type) {
+	case nil:
+		v.addf(path, "nil executable")
+
+	case *ExecutableProcess:
+		v.checkSettings(path, x.settings)
+		v.checkCommand(path, x.process.ops)
+		if _, err := lookupEncoding(x.process.ops.Encoding); err != nil {
+			v.addf(path, "%v", err)
+		}
+		if err := checkClock(x.process.ops); err != nil {
+			v.addf(path, "%v", err)
+		}
+		if file := x.process.ops.StdinFile; file != "" {
+			if _, err := os.Stat(file); err != nil {
+				v.addf(path, "stdin file: %v", err)
+			}
+		}
+		if x.process.ops.Timeout < 0 {
+			v.addf(path, "negative timeout %v", x.process.ops.Timeout)
+		}
+		if x.process.ops.MaxOutputSize < 0 {
+			v.addf(path, "negative output limit %d", x.process.ops.MaxOutputSize)
+		}
+		if ops := x.process.ops; ops.Singleflight && ops.observesOutput() {
+			v.addf(path, "%v", errSingleflightHandlers)
+		}
+
+	case *Builtin:
+		v.checkSettings(path, x.settings)
+		if x.err != nil {
+			v.addf(path, "%v", x.err)
+		}
+
+	case *Pipeline:
+		v.checkSettings(path, x.settings)
+		name := x.operation.String()
+		switch x.operation {
+		case OpPipe, OpAnd, OpOr, OpSeq:
+			v.walk(x.left, treePath(path, name+" left"))
+			v.walk(x.right, treePath(path, name+" right"))
+		case OpBackground:
+			v.walk(x.left, treePath(path, name))
+		case OpRedirect:
+			if x.redirect != RedirectErrOut && x.path == "" {
+				v.addf(path, "redirect %s without a file", x.redirect)
+			}
+			v.walk(x.left, treePath(path, name))
+		default:
+			v.addf(path, "unknown operation %v", x.operation)
+		}
+
+	case *Router:
+		v.checkSettings(path, x.settings)
+		if x.err != nil {
+			v.addf(path, "invalid route pattern: %v", x.err)
+		}
+		if err := x.buffer.check(); err != nil {
+			v.addf(path, "%v", err)
+		}
+		v.walk(x.source, treePath(path, "route source"))
+		for i, r := range x.routes {
+			v.checkDestination(treePath(path, fmt.Sprintf("route %d", i)), r.dest)
+		}
+		if x.fallback != nil {
+			v.checkDestination(treePath(path, "route default"), x.fallback)
+		}
+
+	case *Branch:
+		v.checkSettings(path, x.settings)
+		v.walk(x.exec, treePath(path, "branch"))
+
+	case *Conditional:
+		v.checkSettings(path, x.settings)
+		if x.cond == nil {
+			v.addf(path, "nil condition")
+		}
+		v.walk(x.exec, treePath(path, "conditional"))
+
+	case *LazyStage:
+		v.checkSettings(path, x.settings)
+
+	case *Merger:
+		v.checkSettings(path, x.settings)
+		if len(x.producers) == 0 {
+			v.addf(path, "fan-in without producers")
+		}
+		if err := x.buffer.check(); err != nil {
+			v.addf(path, "%v", err)
+		}
+		for i, p := range x.producers {
+			v.walk(p, treePath(path, fmt.Sprintf("fan-in producer %d", i)))
+		}
+
+	case *Batch:
+		v.checkSettings(path, x.settings)
+		if len(x.execs) == 0 {
+			v.addf(path, "parallel without executables")
+		}
+		if x.limit < 0 {
+			v.addf(path, "negative parallel limit %d", x.limit)
+		}
+		if x.stagger < 0 {
+			v.addf(path, "negative parallel stagger %v", x.stagger)
+		}
+		if err := x.checkDependencies(); err != nil {
+			v.addf(path, "%v", err)
+		}
+		for i, exec := range x.execs {
+			v.walk(exec, treePath(path, fmt.Sprintf("parallel executable %d", i)))
+		}
+	}
+}
+
+// checkDestination validates a route destination, which must be streamable
+func (v *validator) checkDestination(path string, dest Executable) {
+	if dest != nil && !isStreamable(dest) {
+		v.addf(path, "route destination must be a process or a pipe")
+		return
+	}
+	v.walk(dest, path)
+}
+
+// checkCommand reports commands that cannot be found
+func (v *validator) checkCommand(path string, ops *Options) {
+	if ops.Script != nil {
+		if _, err := fs.Stat(ops.Script.FS, ops.Script.Path); err != nil {
+			v.addf(path, "embedded script: %v", err)
+		}
+		if ops.Command == "" {
+			if ops.Script.Delivery != ScriptTempFile {
+				v.addf(path, "in-memory script without an interpreter command")
+			}
+			return
+		}
+	}
+	name := resolveCommand(ops)
+	if name == "" {
+		v.addf(path, "empty command")
+		return
+	}
+	// Downloads are fetched when the process starts
+	if tc := ops.Toolchain; tc != nil {
+		if source, ok := tc.sources[ops.Command]; ok {
+			if _, err := tc.cachePath(ops.Command, source); err != nil {
+				v.addf(path, "%v", err)
+			}
+			return
+		}
+	}
+	// Relative paths are resolved against the working directory of the process
+	if strings.Contains(name, "/") && !filepath.IsAbs(name) && ops.Dir != "" {
+		name = filepath.Join(ops.Dir, name)
+	}
+	// Looked up in the PATH the process gets, which WithEnv or the toolchain may set
+	if _, err := lookPath(name, processEnv(ops)); err != nil {
+		v.addf(path, "%v", err)
+	}
+}
+
+// checkSettings reports timeouts that cannot work as intended
+func (v *validator) checkSettings(path string, s settings) {
+	if s.shutdownTimeout < 0 {
+		v.addf(path, "negative shutdown timeout %v", s.shutdownTimeout)
+	}
+	if s.progressTimeout < 0 {
+		v.addf(path, "negative progress timeout %v", s.progressTimeout)
+	} else if s.progressTimeout > 0 && s.progressTimeout < time.Millisecond {
+		v.addf(path, "progress timeout %v would fail healthy pipes", s.progressTimeout)
+	}
+}
+
+// treePath appends a step to a path in the tree
+func treePath(path, step string) string {
+	if path == "" {
+		return step
+	}
+	return path + " > " + step
+}
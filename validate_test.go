@@ -0,0 +1,117 @@
+package subprocess
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	echo, _ := NewExecutable("echo", "hi")
+	cat, _ := NewExecutable("cat")
+	missing, _ := NewExecutable("definitely-not-a-real-binary")
+	timeout, _ := Command("echo", nil, WithTimeout(-time.Second))
+	limited, _ := Command("echo", nil, WithMaxOutputSize(-1))
+
+	tests := []struct {
+		name     string
+		exec     Executable
+		problems []string
+	}{
+		{
+			name: "valid pipeline",
+			exec: echo.Pipe(cat).And(echo),
+		},
+		{
+			name:     "missing binary",
+			exec:     echo.Pipe(missing),
+			problems: []string{"pipe right", "definitely-not-a-real-binary"},
+		},
+		{
+			name:     "nil child",
+			exec:     echo.And(nil),
+			problems: []string{"and right: nil executable"},
+		},
+		{
+			name: "background inside pipe",
+			exec: echo.Pipe(cat.Background()),
+		},
+		{
+			name:     "negative timeout",
+			exec:     echo.WithShutdownTimeout(-time.Second),
+			problems: []string{"negative shutdown timeout"},
+		},
+		{
+			name:     "negative process timeout",
+			exec:     timeout,
+			problems: []string{"negative timeout"},
+		},
+		{
+			name:     "negative output limit",
+			exec:     limited,
+			problems: []string{"negative output limit -1"},
+		},
+		{
+			name:     "invalid route",
+			exec:     Route(echo).When("(", cat).When("x", echo.And(cat)),
+			problems: []string{"invalid route pattern", "route 0: route destination must be a process or a pipe"},
+		},
+		{
+			name:     "empty fan-in",
+			exec:     FanIn(),
+			problems: []string{"fan-in without producers"},
+		},
+		{
+			name:     "invalid parallel",
+			exec:     Parallel().Limit(-1),
+			problems: []string{"parallel without executables", "negative parallel limit -1"},
+		},
+		{
+			name:     "invalid route buffer",
+			exec:     Route(echo).Default(cat).Buffer(-1, 100),
+			problems: []string{"initial size -1 must be positive"},
+		},
+		{
+			name:     "invalid fan-in buffer",
+			exec:     FanIn(echo).Buffer(8, 4),
+			problems: []string{"initial size 8 exceeds maximum line length 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.exec.Validate()
+			if len(tt.problems) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			for _, p := range tt.problems {
+				if !strings.Contains(err.Error(), p) {
+					t.Errorf("expected error to mention %q, got: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	// Test: every problem is returned, not just the first one
+	a, _ := NewExecutable("missing-one")
+	b, _ := NewExecutable("missing-two")
+
+	var verr *ValidationError
+	if !errors.As(a.Pipe(b).Validate(), &verr) {
+		t.Fatal("expected ValidationError")
+	}
+	if len(verr.Problems) != 2 {
+		t.Errorf("expected 2 problems, got %v", verr.Problems)
+	}
+}
@@ -0,0 +1,24 @@
+package subprocess
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Variants returns the variant of a logical stage for the running platform,
+// so cross-platform tools can declare one stage with platform-specific
+// commands, like open, xdg-open or start. Keys are "goos/goarch", "goos" or
+// "" for the fallback, and the most specific match wins
+func Variants(variants map[string]Executable) (Executable, error) {
+	return selectVariant(variants, runtime.GOOS, runtime.GOARCH)
+}
+
+// selectVariant returns the variant for goos and goarch
+func selectVariant(variants map[string]Executable, goos, goarch string) (Executable, error) {
+	for _, key := range []string{goos + "/" + goarch, goos, ""} {
+		if exec, ok := variants[key]; ok && exec != nil {
+			return exec, nil
+		}
+	}
+	return nil, fmt.Errorf("no variant for %s/%s", goos, goarch)
+}
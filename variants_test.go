@@ -0,0 +1,50 @@
+package subprocess
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSelectVariant(t *testing.T) {
+	// Test: the most specific variant for the platform is selected
+	linuxArm, _ := NewExecutable("linux-arm")
+	linux, _ := NewExecutable("xdg-open")
+	darwin, _ := NewExecutable("open")
+	fallback, _ := NewExecutable("fallback")
+	variants := map[string]Executable{
+		"linux/arm64": linuxArm,
+		"linux":       linux,
+		"darwin":      darwin,
+	}
+
+	tests := []struct {
+		goos, goarch string
+		withDefault  bool
+		expected     string
+	}{
+		{"linux", "arm64", false, "linux-arm"},
+		{"linux", "amd64", false, "xdg-open"},
+		{"darwin", "arm64", false, "open"},
+		{"windows", "amd64", true, "fallback"},
+		{"windows", "amd64", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos+"/"+tt.goarch, func(t *testing.T) {
+			vs := variants
+			if tt.withDefault {
+				vs = map[string]Executable{"": fallback, "linux": linux}
+			}
+			exec, err := selectVariant(vs, tt.goos, tt.goarch)
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("expected error, got %v", exec)
+				}
+				return
+			}
+			if err != nil || fmt.Sprint(exec) != tt.expected {
+				t.Errorf("expected %q, got %v (%v)", tt.expected, exec, err)
+			}
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os/exec"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -15,14 +17,35 @@ type Visitor interface {
 	VisitPipe(left, right Executable) (*Result, error)
 	VisitAnd(left, right Executable) (*Result, error)
 	VisitOr(left, right Executable) (*Result, error)
+	VisitSeq(left, right Executable) (*Result, error)
 	VisitBackground(exec Executable) (*Result, error)
+	VisitRoute(r *Router) (*Result, error)
+	VisitFanIn(m *Merger) (*Result, error)
+	VisitParallel(b *Batch) (*Result, error)
+	VisitBuiltin(b *Builtin) (*Result, error)
+	VisitBranch(b *Branch) (*Result, error)
+	VisitLazy(l *LazyStage, prior *Result) (*Result, error)
+	VisitConditional(c *Conditional) (*Result, error)
+	VisitRedirect(exec Executable, op RedirectOp, path string) (*Result, error)
 }
 
 // ExecutionVisitor implements the Visitor interface for executing pipelines
 type ExecutionVisitor struct {
-	ctx             context.Context
-	shutdownTimeout time.Duration
-	backgroundJobs  []*BackgroundJob
+	ctx            context.Context
+	settings       settings
+	backgroundJobs []*BackgroundJob
+
+	mu      sync.Mutex
+	runners []*ProcessRunner // every process started, stopped on panic
+}
+
+// newExecutionVisitor creates a visitor that executes with the given settings
+func newExecutionVisitor(ctx context.Context, s settings) *ExecutionVisitor {
+	return &ExecutionVisitor{
+		ctx:            ctx,
+		settings:       s,
+		backgroundJobs: make([]*BackgroundJob, 0),
+	}
 }
 
 // BackgroundJob tracks a process running in the background
@@ -34,37 +57,151 @@ type BackgroundJob struct {
 
 // VisitProcess executes a single process
 func (v *ExecutionVisitor) VisitProcess(ep *ExecutableProcess) (*Result, error) {
+	if ep.process.ops.Singleflight {
+		return v.visitShared(ep)
+	}
+	return v.visitProcess(ep)
+}
+
+// visitProcess starts the process of ep and collects its result
+func (v *ExecutionVisitor) visitProcess(ep *ExecutableProcess) (*Result, error) {
 	// Start the process
-	runner, err := ep.process.Exec(v.ctx)
+	runner, err := v.startProcess(ep)
 	if err != nil {
 		return &Result{
 			Type:     OpSingle,
 			Error:    fmt.Errorf("failed to start process: %w", err),
 			ExitCode: -1,
+			Metadata: maps.Clone(ep.process.ops.Metadata),
 		}, err
 	}
 
-	// Read all output from ReaderWriter (stdout+stderr combined)
-	output, _ := io.ReadAll(runner.ReaderWriter())
+	// The process reads no input
+	if ep.process.ops.StdinPolicy != StdinKeepOpen {
+		runner.ReaderWriter().CloseWrite()
+	}
+
+	// Read stdout and stderr concurrently so neither pipe fills up
+	var output, errOutput []byte
+	var truncated, errTruncated bool
+	ops := ep.process.ops
+	reader := outputReader{ops: ops, runner: runner, max: v.settings.maxOutput}
+	if ops.CombinedOutput {
+		output, truncated = reader.read(runner.ReaderWriter(), "stdout", ops.StdoutHandler)
+	} else {
+		stderrDone := make(chan struct{})
+		go func() {
+			errOutput, errTruncated = reader.read(runner.Stderr(), "stderr", ops.StderrHandler)
+			close(stderrDone)
+		}()
+		output, truncated = reader.read(runner.Stdout(), "stdout", ops.StdoutHandler)
+		<-stderrDone
+	}
+	var demuxed DemuxConfidence
+	if ops.Demux != nil {
+		output, errOutput, demuxed = ops.Demux.split(output, errOutput)
+	}
 
 	// Wait for completion
 	err = runner.Wait()
-	exitCode := 0
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = -1
+	runner.raisePanic()
+	v.logExit(ep, err)
+	exitCode := v.getExitCode(err)
+
+	result := &Result{
+		Type:        OpSingle,
+		Stdout:      output,
+		Stderr:      errOutput,
+		Truncated:   truncated || errTruncated,
+		ExitCode:    exitCode,
+		Error:       err,
+		PeakMemory:  runner.PeakMemory(),
+		OpenedFiles: runner.OpenedFiles(),
+		Crash:       runner.CrashReport(),
+		Env:         runner.EnvSnapshot(),
+		Metadata:    maps.Clone(ep.process.ops.Metadata),
+		Command:     ep.String(),
+		Start:       runner.started,
+		Duration:    runner.exitedAt.Sub(runner.started),
+	}
+	annotatePorts(result, runner)
+	if ops.Demux != nil {
+		result.Annotate("demux", demuxed)
+	}
+	v.diagnose(ep, result)
+	return result, err
+}
+
+// VisitBuiltin executes a builtin in the current goroutine
+func (v *ExecutionVisitor) VisitBuiltin(b *Builtin) (*Result, error) {
+	if err := v.ctx.Err(); err != nil {
+		return &Result{Type: OpSingle, Error: err, ExitCode: -1}, err
+	}
+	if b.err != nil {
+		return &Result{Type: OpSingle, Error: b.err, ExitCode: 2}, b.err
+	}
+
+	result := &Result{Type: OpSingle, ExitCode: b.run()}
+	if result.ExitCode != 0 {
+		result.Error = &BuiltinError{Name: b.name, Code: result.ExitCode}
+	}
+	return result, result.Error
+}
+
+// VisitBranch executes the wrapped executable until it finishes or the branch
+// is cancelled, in which case the result is marked Cancelled
+func (v *ExecutionVisitor) VisitBranch(b *Branch) (*Result, error) {
+	if b.Cancelled() {
+		return &Result{Type: OpSingle, Cancelled: true, Error: ErrBranchCancelled, ExitCode: -1}, ErrBranchCancelled
+	}
+
+	ctx, cancel := context.WithCancel(v.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.signal.done:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	result, err := b.exec.Run(ctx)
+	if err != nil && b.Cancelled() {
+		result.Cancelled = true
+		result.Error = ErrBranchCancelled
+		err = ErrBranchCancelled
+	}
+	return result, err
+}
+
+// VisitLazy builds the executable of l from the prior result and runs it
+func (v *ExecutionVisitor) VisitLazy(l *LazyStage, prior *Result) (*Result, error) {
+	exec, err := l.resolve(v.ctx, prior)
+	if err != nil {
+		return &Result{Type: OpSingle, Error: err, ExitCode: -1}, err
+	}
+	return exec.Run(v.ctx)
+}
+
+// VisitConditional runs the executable of c if its condition holds, and
+// returns a skipped result with the reason otherwise
+func (v *ExecutionVisitor) VisitConditional(c *Conditional) (*Result, error) {
+	if ok, reason := c.evaluate(v.ctx); !ok {
+		return &Result{Type: OpSingle, Skipped: true, SkipReason: reason}, nil
 	}
+	return c.exec.Run(v.ctx)
+}
 
-	return &Result{
-		Type:     OpSingle,
-		Stdout:   output,
-		Stderr:   nil, // Combined with stdout in ReaderWriter
-		ExitCode: exitCode,
-		Error:    err,
-	}, err
+// runNext runs next after prior in an And or Or, passing prior to lazy stages
+func (v *ExecutionVisitor) runNext(next Executable, prior *Result) (*Result, error) {
+	l, ok := next.(*LazyStage)
+	if !ok {
+		return next.Run(v.ctx)
+	}
+	visitor := newExecutionVisitor(v.ctx, l.settings)
+	return visitor.run(l, func() (*Result, error) {
+		return visitor.VisitLazy(l, prior)
+	})
 }
 
 // VisitPipe executes two executables with stdout piped to stdin
@@ -77,34 +214,39 @@ func (v *ExecutionVisitor) VisitPipe(left, right Executable) (*Result, error) {
 		}, err
 	}
 
-	// Execute left and right with streaming pipe
-	leftResult, rightResult, err := v.executePipe(left, right)
-
-	// Build result tree
-	result := &Result{
-		Type:     OpPipe,
-		Children: []*Result{leftResult, rightResult},
+	// Like in a shell, a background stage puts the whole pipe segment in the
+	// background: a | b & runs as (a | b) &
+	pipe := newPipeline(OpPipe, left, right, settings{})
+	if stripped, ok := stripBackground(pipe); ok {
+		return v.VisitBackground(stripped)
 	}
 
+	// Start every stage of the pipe with streaming connections
+	chain, failed, err := v.startChain(flattenPipe(pipe))
 	if err != nil {
-		result.Error = err
-		// Use the exit code from whichever side failed
-		if leftResult.Error != nil {
-			result.ExitCode = leftResult.ExitCode
-			result.Stderr = leftResult.Stderr
-		} else {
-			result.ExitCode = rightResult.ExitCode
-			result.Stderr = rightResult.Stderr
-		}
-		return result, err
+		return &Result{
+			Type:     OpPipe,
+			Error:    err,
+			ExitCode: failed.ExitCode,
+			Children: []*Result{failed},
+		}, err
 	}
 
-	// Final output is from the right side
-	result.Stdout = rightResult.Stdout
-	result.Stderr = rightResult.Stderr
-	result.ExitCode = rightResult.ExitCode
+	// The first stage reads no input
+	chain.closeInput()
 
-	return result, nil
+	// Read final output from the last stage
+	stopWatchdog := v.watchProgress(chain)
+	output, truncated := chain.readOutput(v.settings.maxOutput)
+	result := v.finishChain(pipe, chain, output)
+	result.Truncated = truncated
+
+	if err := stopWatchdog(); err != nil {
+		result.Error = err
+		result.ExitCode = -1
+	}
+
+	return result, result.Error
 }
 
 // VisitAnd executes right only if left succeeds (exit code 0)
@@ -134,7 +276,7 @@ func (v *ExecutionVisitor) VisitAnd(left, right Executable) (*Result, error) {
 	}
 
 	// Left succeeded, execute right
-	rightResult, err := right.Run(v.ctx)
+	rightResult, err := v.runNext(right, leftResult)
 	result.Children = append(result.Children, rightResult)
 
 	// Final result is from right
@@ -146,6 +288,46 @@ func (v *ExecutionVisitor) VisitAnd(left, right Executable) (*Result, error) {
 	return result, err
 }
 
+// VisitSeq executes right after left, whatever the exit code of left
+// The exit code is the one of right and the output is the output of left
+// followed by the one of right, as with ; in bash. Right is skipped once the
+// context is done
+func (v *ExecutionVisitor) VisitSeq(left, right Executable) (*Result, error) {
+	// Execute left
+	leftResult, err := left.Run(v.ctx)
+
+	// Build result structure
+	result := &Result{
+		Type:     OpSeq,
+		Children: []*Result{leftResult},
+	}
+
+	// A cancelled run stops here
+	if ctxErr := v.ctx.Err(); ctxErr != nil {
+		result.Children = append(result.Children, &Result{Type: OpSingle, Skipped: true})
+		result.ExitCode = leftResult.ExitCode
+		result.Error = leftResult.Error
+		if result.Error == nil {
+			result.Error, result.ExitCode = ctxErr, -1
+		}
+		result.Stdout = leftResult.Stdout
+		result.Stderr = leftResult.Stderr
+		return result, result.Error
+	}
+
+	// Execute right whatever happened to left
+	rightResult, err := v.runNext(right, leftResult)
+	result.Children = append(result.Children, rightResult)
+
+	// Exit code is from right, output is from both like the output of a; b
+	result.ExitCode = rightResult.ExitCode
+	result.Error = rightResult.Error
+	result.Stdout = append(append([]byte(nil), leftResult.Stdout...), rightResult.Stdout...)
+	result.Stderr = append(append([]byte(nil), leftResult.Stderr...), rightResult.Stderr...)
+
+	return result, err
+}
+
 // VisitOr executes right only if left fails (exit code != 0)
 // Matches bash behavior: if right succeeds, overall result is success
 func (v *ExecutionVisitor) VisitOr(left, right Executable) (*Result, error) {
@@ -173,7 +355,7 @@ func (v *ExecutionVisitor) VisitOr(left, right Executable) (*Result, error) {
 	}
 
 	// Left failed, execute right (bash behavior: || recovers from failure)
-	rightResult, rightErr := right.Run(v.ctx)
+	rightResult, rightErr := v.runNext(right, leftResult)
 	result.Children = append(result.Children, rightResult)
 
 	// Final result is from right (bash semantics)
@@ -222,6 +404,256 @@ func (v *ExecutionVisitor) VisitBackground(exec Executable) (*Result, error) {
 	return result, nil
 }
 
+// VisitRoute executes a Router, writing each line of the source output
+// to the stdin of the first route whose pattern matches
+func (v *ExecutionVisitor) VisitRoute(r *Router) (*Result, error) {
+	if r.err != nil {
+		return &Result{
+			Type:     OpRoute,
+			Error:    fmt.Errorf("invalid route pattern: %w", r.err),
+			ExitCode: -1,
+		}, r.err
+	}
+	if err := r.buffer.check(); err != nil {
+		return &Result{Type: OpRoute, Error: err, ExitCode: -1}, err
+	}
+
+	// Check context before starting
+	if err := v.ctx.Err(); err != nil {
+		return &Result{
+			Type:  OpRoute,
+			Error: err,
+		}, err
+	}
+
+	dests := make([]Executable, 0, len(r.routes)+1)
+	for _, rt := range r.routes {
+		dests = append(dests, rt.dest)
+	}
+	if r.fallback != nil {
+		dests = append(dests, r.fallback)
+	}
+
+	// Start all destinations first so no routed line is lost
+	chains := make([]*pipeChain, 0, len(dests))
+	stopAll := func() {
+		for _, chain := range chains {
+			chain.stop()
+		}
+	}
+	for _, dest := range dests {
+		if !isStreamable(dest) {
+			err := fmt.Errorf("route destination must be a process or a pipe")
+			stopAll()
+			return &Result{Type: OpRoute, Error: err, ExitCode: -1}, err
+		}
+		chain, failed, err := v.startChain(flattenPipe(dest))
+		if err != nil {
+			stopAll()
+			return &Result{
+				Type:     OpRoute,
+				Error:    err,
+				ExitCode: -1,
+				Children: []*Result{failed},
+			}, err
+		}
+		chains = append(chains, chain)
+	}
+
+	// Start the source; it reads no input
+	sourceChain, failed, err := v.startChain(flattenPipe(r.source))
+	if err != nil {
+		stopAll()
+		return &Result{
+			Type:     OpRoute,
+			Error:    err,
+			ExitCode: failed.ExitCode,
+			Children: []*Result{failed},
+		}, err
+	}
+	sourceChain.closeInput()
+	source := sourceChain.stdout()
+	stopWatchdog := v.watchProgress(append([]*pipeChain{sourceChain}, chains...)...)
+
+	// Collect the output of every destination concurrently
+	outputs := make([][]byte, len(chains))
+	readDone := make(chan struct{}, len(chains))
+	for i, chain := range chains {
+		go func(i int, chain *pipeChain) {
+			outputs[i], _ = chain.readOutput(v.settings.maxOutput)
+			readDone <- struct{}{}
+		}(i, chain)
+	}
+
+	// Demultiplex the source line by line
+	broken := make([]bool, len(chains))
+	scanner, scanErr := newLineScanner(source, r.buffer)
+	for scanErr == nil && scanner.Scan() {
+		idx := r.match(scanner.Bytes())
+		if idx < 0 || broken[idx] {
+			continue
+		}
+		line := append(scanner.Bytes(), '\n')
+		if _, err := chains[idx].stdin().Write(line); err != nil {
+			// Destination stopped reading, drop its remaining lines
+			broken[idx] = true
+		}
+	}
+	if scanErr == nil {
+		scanErr = scanner.Err()
+	}
+	if scanErr != nil {
+		// Stop the source instead of leaving it blocked on a full pipe
+		sourceChain.closeOutput()
+	}
+
+	// Close every destination stdin to signal EOF
+	for _, chain := range chains {
+		chain.closeInput()
+	}
+	for range chains {
+		<-readDone
+	}
+
+	// Build result tree
+	result := &Result{
+		Type:     OpRoute,
+		Children: []*Result{v.finishChain(r.source, sourceChain, nil)},
+	}
+	for i, chain := range chains {
+		result.Children = append(result.Children, v.finishChain(dests[i], chain, outputs[i]))
+		result.Stdout = append(result.Stdout, outputs[i]...)
+	}
+
+	// Return first error (fail-fast)
+	if err := stopWatchdog(); err != nil {
+		result.Error = err
+		result.ExitCode = -1
+		return result, err
+	}
+	if scanErr != nil {
+		result.Error = fmt.Errorf("failed to read source output: %w", scanError(scanErr, r.buffer))
+		result.ExitCode = -1
+		return result, result.Error
+	}
+	for _, child := range result.Children {
+		if child.Error != nil {
+			result.Error = child.Error
+			result.ExitCode = child.ExitCode
+			return result, child.Error
+		}
+	}
+
+	return result, nil
+}
+
+// match returns the index of the route receiving line, or -1 if it is dropped
+func (r *Router) match(line []byte) int {
+	for i, rt := range r.routes {
+		if rt.pattern.Match(line) {
+			return i
+		}
+	}
+	if r.fallback != nil {
+		return len(r.routes)
+	}
+	return -1
+}
+
+// VisitFanIn executes all producers concurrently and merges their output
+// line by line according to the merger's mode
+func (v *ExecutionVisitor) VisitFanIn(m *Merger) (*Result, error) {
+	if err := m.buffer.check(); err != nil {
+		return &Result{Type: OpFanIn, Error: err, ExitCode: -1}, err
+	}
+
+	// Check context before starting
+	if err := v.ctx.Err(); err != nil {
+		return &Result{
+			Type:  OpFanIn,
+			Error: err,
+		}, err
+	}
+
+	// Start every producer; none of them reads input
+	chains := make([]*pipeChain, 0, len(m.producers))
+	readers := make([]io.Reader, 0, len(m.producers))
+	for _, producer := range m.producers {
+		chain, failed, err := v.startChain(flattenPipe(producer))
+		if err != nil {
+			for _, started := range chains {
+				started.stop()
+			}
+			return &Result{
+				Type:     OpFanIn,
+				Error:    err,
+				ExitCode: failed.ExitCode,
+				Children: []*Result{failed},
+			}, err
+		}
+		chain.closeInput()
+		chains = append(chains, chain)
+		readers = append(readers, chain.stdout())
+	}
+	stopWatchdog := v.watchProgress(chains...)
+
+	// Scan each producer into its own line channel
+	lines := make([]chan []byte, len(readers))
+	scanErrs := make([]error, len(readers))
+	for i, r := range readers {
+		lines[i] = make(chan []byte, 64)
+		go func(i int, r io.Reader) {
+			defer close(lines[i])
+			scanner, err := newLineScanner(r, m.buffer)
+			for err == nil && scanner.Scan() {
+				lines[i] <- append([]byte(nil), scanner.Bytes()...)
+			}
+			if err == nil {
+				err = scanner.Err()
+			}
+			if scanErrs[i] = err; err != nil {
+				// Stop the producer instead of leaving it blocked on a full pipe
+				chains[i].closeOutput()
+			}
+		}(i, r)
+	}
+
+	outputs := make([][]byte, len(readers))
+	merged := m.merge(lines, outputs)
+
+	// Build result tree
+	result := &Result{
+		Type:   OpFanIn,
+		Stdout: merged,
+	}
+	for i, chain := range chains {
+		result.Children = append(result.Children, v.finishChain(m.producers[i], chain, outputs[i]))
+	}
+
+	// Return first error (fail-fast)
+	if err := stopWatchdog(); err != nil {
+		result.Error = err
+		result.ExitCode = -1
+		return result, err
+	}
+	for _, err := range scanErrs {
+		if err != nil {
+			result.Error = fmt.Errorf("failed to read producer output: %w", scanError(err, m.buffer))
+			result.ExitCode = -1
+			return result, result.Error
+		}
+	}
+	for _, child := range result.Children {
+		if child.Error != nil {
+			result.Error = child.Error
+			result.ExitCode = child.ExitCode
+			return result, child.Error
+		}
+	}
+
+	return result, nil
+}
+
 // WaitForBackground waits for all background jobs and collects their results
 func (v *ExecutionVisitor) WaitForBackground(result *Result) {
 	if len(v.backgroundJobs) == 0 {
@@ -246,7 +678,7 @@ func (v *ExecutionVisitor) WaitForBackground(result *Result) {
 			select {
 			case <-job.done:
 				// Completed gracefully
-			case <-time.After(v.shutdownTimeout):
+			case <-time.After(v.settings.shutdownTimeout):
 				// Timeout, job may be orphaned (bash behavior)
 			}
 		}
@@ -274,7 +706,7 @@ func (v *ExecutionVisitor) gracefulShutdown(cmds []*exec.Cmd) {
 		select {
 		case <-done:
 			// Exited gracefully
-		case <-time.After(v.shutdownTimeout):
+		case <-time.After(v.settings.shutdownTimeout):
 			// Timeout: send SIGKILL
 			cmd.Process.Signal(syscall.SIGKILL)
 			cmd.Wait() // reap zombie
@@ -282,113 +714,58 @@ func (v *ExecutionVisitor) gracefulShutdown(cmds []*exec.Cmd) {
 	}
 }
 
-// executePipe connects two processes via their ProcessRunner.ReaderWriter()
-func (v *ExecutionVisitor) executePipe(left, right Executable) (*Result, *Result, error) {
-	// Start left process
-	leftRunner, leftResult, err := v.startProcess(left)
-	if err != nil {
-		return leftResult, &Result{Type: OpSingle, ExitCode: -1}, err
-	}
-
-	// Start right process
-	rightRunner, rightResult, err := v.startProcess(right)
-	if err != nil {
-		return leftResult, rightResult, err
-	}
-
-	// Connect left's output (stdout+stderr) to right's input (stdin)
-	// Copy in a goroutine so both processes can run concurrently
-	copyDone := make(chan error, 1)
-	go func() {
-		_, err := io.Copy(rightRunner.ReaderWriter(), leftRunner.ReaderWriter())
-		rightRunner.ReaderWriter().Close() // Close stdin to signal EOF
-		copyDone <- err
-	}()
-
-	// Read final output from right process
-	output, _ := io.ReadAll(rightRunner.ReaderWriter())
-
-	// Wait for copy to complete
-	<-copyDone
-
-	// Wait for both processes
-	leftErr := leftRunner.Wait()
-	rightErr := rightRunner.Wait()
-
-	// Build results
-	leftResult = &Result{
-		Type:     OpSingle,
-		ExitCode: v.getExitCode(leftErr),
-		Error:    leftErr,
-	}
-
-	rightResult = &Result{
-		Type:     OpSingle,
-		Stdout:   output,
-		ExitCode: v.getExitCode(rightErr),
-		Error:    rightErr,
-	}
-
-	// Return first error (fail-fast)
-	if leftErr != nil {
-		return leftResult, rightResult, leftErr
-	}
-	if rightErr != nil {
-		return leftResult, rightResult, rightErr
+// startProcess starts the process of ep, logging it when a logger is set
+func (v *ExecutionVisitor) startProcess(ep *ExecutableProcess) (*ProcessRunner, error) {
+	runner, err := ep.process.exec(v.ctx, v.settings.shutdownTimeout)
+	if err == nil {
+		v.mu.Lock()
+		v.runners = append(v.runners, runner)
+		v.mu.Unlock()
 	}
-
-	return leftResult, rightResult, nil
-}
-
-// startProcess starts an Executable and returns its ProcessRunner
-func (v *ExecutionVisitor) startProcess(exec Executable) (*ProcessRunner, *Result, error) {
-	if ep, ok := exec.(*ExecutableProcess); ok {
-		runner, err := ep.process.Exec(v.ctx)
+	if logger := v.settings.logger; logger != nil {
 		if err != nil {
-			return nil, &Result{
-				Type:     OpSingle,
-				Error:    err,
-				ExitCode: -1,
-			}, err
+			logger.Debug("process failed to start", "cmd", ep.String(), "error", err)
+		} else {
+			logger.Debug("process started", "cmd", ep.String(), "pid", runner.cmd.Process.Pid)
 		}
-		return runner, nil, nil
 	}
+	return runner, err
+}
 
-	// For nested pipelines, check if it's a Pipe operation
-	if p, ok := exec.(*Pipeline); ok {
-		if p.operation == OpPipe {
-			// Recursively handle nested pipes
-			return v.startNestedPipe(p)
-		}
+// logExit logs the exit of the process of ep when a logger is set
+func (v *ExecutionVisitor) logExit(ep Executable, err error) {
+	if logger := v.settings.logger; logger != nil {
+		logger.Debug("process exited", "cmd", fmt.Sprint(ep), "exit_code", v.getExitCode(err))
 	}
-
-	// For other pipeline types (And/Or/Background), execute normally
-	result, err := exec.Run(v.ctx)
-	return nil, result, err
 }
 
-// startNestedPipe handles nested pipe operations recursively
-func (v *ExecutionVisitor) startNestedPipe(p *Pipeline) (*ProcessRunner, *Result, error) {
-	// For a nested pipe, we need to recursively connect the processes
-	// This creates a chain: left | right
-	leftRunner, _, err := v.startProcess(p.left)
-	if err != nil {
-		return nil, &Result{Type: OpPipe, Error: err, ExitCode: -1}, err
+// diagnose runs the diagnostics of a failed process and attaches their results
+func (v *ExecutionVisitor) diagnose(exec Executable, result *Result) {
+	ep, ok := exec.(*ExecutableProcess)
+	if !ok || result.Error == nil || len(ep.process.ops.Diagnostics) == 0 {
+		return
 	}
 
-	rightRunner, _, err := v.startProcess(p.right)
-	if err != nil {
-		return nil, &Result{Type: OpPipe, Error: err, ExitCode: -1}, err
+	// The failure may come from the context, diagnostics run regardless
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(v.ctx), diagnosticsTimeout)
+	defer cancel()
+	for _, diag := range ep.process.ops.Diagnostics {
+		diagResult, _ := diag.Run(ctx)
+		result.Diagnostics = append(result.Diagnostics, diagResult)
 	}
+}
 
-	// Connect left to right
-	go func() {
-		io.Copy(rightRunner.ReaderWriter(), leftRunner.ReaderWriter())
-		rightRunner.ReaderWriter().Close()
-	}()
-
-	// Return the rightmost runner (final output comes from here)
-	return rightRunner, nil, nil
+// isStreamable reports whether exec can be started with a ProcessRunner
+// whose stdin and stdout are available for streaming
+func isStreamable(exec Executable) bool {
+	switch e := exec.(type) {
+	case *ExecutableProcess:
+		return true
+	case *Pipeline:
+		return e.operation == OpPipe && isStreamable(e.left) && isStreamable(e.right)
+	default:
+		return false
+	}
 }
 
 // getExitCode extracts exit code from error
@@ -399,5 +776,11 @@ func (v *ExecutionVisitor) getExitCode(err error) int {
 	if exitError, ok := err.(*exec.ExitError); ok {
 		return exitError.ExitCode()
 	}
+	if builtinError, ok := err.(*BuiltinError); ok {
+		return builtinError.ExitCode()
+	}
+	if faultError, ok := err.(*FaultError); ok {
+		return faultError.ExitCode()
+	}
 	return -1
 }
@@ -0,0 +1,72 @@
+package subprocess
+
+import (
+	"context"
+	"fmt"
+)
+
+// Conditional runs an Executable only when a predicate evaluated at run time
+// holds, e.g. a feature flag, the OS or the existence of a file
+type Conditional struct {
+	node
+	exec   Executable
+	cond   func(ctx context.Context) bool
+	negate bool // run when cond is false, for Unless
+}
+
+// When runs exec only if cond returns true when the stage is reached
+// Otherwise the stage succeeds without running and its result is marked
+// Skipped with the reason in SkipReason
+func When(cond func(ctx context.Context) bool, exec Executable) *Conditional {
+	c := &Conditional{
+		exec: exec,
+		cond: cond,
+	}
+	c.node = newNode(c)
+	return c
+}
+
+// Unless runs exec only if cond returns false when the stage is reached
+func Unless(cond func(ctx context.Context) bool, exec Executable) *Conditional {
+	c := When(cond, exec)
+	c.negate = true
+	return c
+}
+
+// String returns the command line of the wrapped executable
+func (c *Conditional) String() string {
+	return fmt.Sprint(c.exec)
+}
+
+// evaluate returns whether exec runs, or the reason it is skipped
+func (c *Conditional) evaluate(ctx context.Context) (bool, string) {
+	if c.cond(ctx) == c.negate {
+		if c.negate {
+			return false, "unless condition is true"
+		}
+		return false, "when condition is false"
+	}
+	return true, ""
+}
+
+// Run evaluates the condition and runs the executable using the visitor pattern
+func (c *Conditional) Run(ctx context.Context) (*Result, error) {
+	visitor := newExecutionVisitor(ctx, c.settings)
+	return visitor.run(c, func() (*Result, error) {
+		return visitor.VisitConditional(c)
+	})
+}
+
+// clone returns a copy of c, so With* methods never modify a shared definition
+func (c *Conditional) clone() *Conditional {
+	clone := *c
+	clone.self = &clone
+	return &clone
+}
+
+func (c *Conditional) configure(edit func(*settings)) Executable {
+	clone := c.clone()
+	clone.exec = configureExec(c.exec, edit)
+	edit(&clone.settings)
+	return clone
+}
@@ -0,0 +1,65 @@
+package subprocess
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWhenUnless(t *testing.T) {
+	// Test: stages run or are skipped with a reason depending on the predicate
+	yes := func(context.Context) bool { return true }
+	no := func(context.Context) bool { return false }
+	echo, _ := NewExecutable("echo", "ran")
+
+	tests := []struct {
+		name   string
+		exec   Executable
+		output string
+		reason string
+	}{
+		{"when true", When(yes, echo), "ran\n", ""},
+		{"when false", When(no, echo), "", "when condition is false"},
+		{"unless true", Unless(yes, echo), "", "unless condition is true"},
+		{"unless false", Unless(no, echo), "ran\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.exec.Run(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(result.Stdout) != tt.output {
+				t.Errorf("expected output %q, got %q", tt.output, result.Stdout)
+			}
+			if result.Skipped != (tt.reason != "") || result.SkipReason != tt.reason {
+				t.Errorf("expected skip reason %q, got %v %q", tt.reason, result.Skipped, result.SkipReason)
+			}
+		})
+	}
+}
+
+func TestWhenInPipeline(t *testing.T) {
+	// Test: a skipped stage lets And continue and feeds nothing into a pipe
+	ctx := context.Background()
+	no := func(context.Context) bool { return false }
+	yes := func(context.Context) bool { return true }
+	source, _ := NewExecutable("echo", "data")
+	upper, _ := NewExecutable("tr", "a-z", "A-Z")
+	next, _ := NewExecutable("echo", "next")
+
+	result, err := When(no, source).And(next).Run(ctx)
+	if err != nil || string(result.Stdout) != "next\n" {
+		t.Errorf("expected And to continue after a skipped stage, got %q, %v", result.Stdout, err)
+	}
+
+	result, err = source.Pipe(When(yes, upper)).Run(ctx)
+	if err != nil || string(result.Stdout) != "DATA\n" {
+		t.Errorf("expected conditional stage to read the pipe, got %q, %v", result.Stdout, err)
+	}
+
+	result, err = source.Pipe(When(no, upper)).Run(ctx)
+	if err != nil || !result.Children[1].Skipped {
+		t.Errorf("expected skipped pipe stage, got %+v, %v", result.Children[1], err)
+	}
+}